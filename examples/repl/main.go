@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	str "strings"
 
@@ -16,8 +17,15 @@ func printUsage() {
 	fmt.Printf("Usage: %s <nexus_url> <command> [<options>]\n"+
 		"Following commands are supported:\n"+
 		"listNodes\n"+
+		"status\n"+
+		"snapshot\n"+
 		"addNode <nodeAddr>\n"+
+		"addLearner <nodeAddr>\n"+
+		"addShadow <nodeAddr>\n"+
+		"promoteLearner <nodeId>\n"+
 		"removeNode <nodeAddr>\n"+
+		"replaceNode <oldNodeId> <nodeAddr>\n"+
+		"transferLeader <nodeId>\n"+
 		"mysql load <expression>\n"+
 		"mysql save <expression>\n"+
 		"redis load db.index=<num> <expression>\n"+
@@ -135,8 +143,35 @@ func listNodes(nexus_url string) {
 	listNodesUsingCli(nc)
 }
 
+func clusterStatus(nexus_url string) {
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if status, err := nc.ClusterStatus(); err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Printf("Node: %x, Leader: %x, Term: %d, Commit index: %d, Applied index: %d, Writable: %t, Readable: %t\n",
+			status.NodeId, status.Leader, status.Term, status.CommitIndex, status.AppliedIndex, status.Writable, status.Readable)
+	}
+}
+
+func takeSnapshot(nexus_url string) {
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if index, err := nc.Snapshot(); err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Printf("Snapshot taken at index: %d\n", index)
+	}
+}
+
 func listNodesUsingCli(nc *grpc.NexusClient) {
-	leaderId, members := nc.ListNodes()
+	leaderId, members, err := nc.ListNodes()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 	var ids []uint64
 	for id := range members {
 		ids = append(ids, id)
@@ -149,7 +184,11 @@ func listNodesUsingCli(nc *grpc.NexusClient) {
 		fmt.Println("Current cluster members:")
 	}
 	for _, id := range ids {
-		fmt.Printf("%x => %s (%s) \n", id, members[id].NodeUrl, members[id].Status)
+		if members[id].IsLearner {
+			fmt.Printf("%x => %s (%s, learner) \n", id, members[id].NodeUrl, members[id].Status)
+		} else {
+			fmt.Printf("%x => %s (%s) \n", id, members[id].NodeUrl, members[id].Status)
+		}
 	}
 }
 
@@ -170,6 +209,58 @@ func addNode(nexus_url string, args []string) {
 	listNodesUsingCli(nc)
 }
 
+func addLearner(nexus_url string, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: <nodeAddr> must be provided")
+		printUsage()
+		return
+	}
+	node_addr := strings.TrimSpace(args[0])
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if err := nc.AddLearner(node_addr); err != nil {
+		fmt.Println(err.Error())
+	}
+	listNodesUsingCli(nc)
+}
+
+func addShadow(nexus_url string, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: <nodeAddr> must be provided")
+		printUsage()
+		return
+	}
+	node_addr := strings.TrimSpace(args[0])
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if err := nc.AddShadow(node_addr); err != nil {
+		fmt.Println(err.Error())
+	}
+	listNodesUsingCli(nc)
+}
+
+func promoteLearner(nexus_url string, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: <nodeId> must be provided")
+		printUsage()
+		return
+	}
+	nodeId, err := strconv.ParseUint(strings.TrimSpace(args[0]), 16, 64)
+	if err != nil {
+		fmt.Printf("Error: invalid <nodeId>: %v\n", err)
+		return
+	}
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if err := nc.PromoteLearner(nodeId); err != nil {
+		fmt.Println(err.Error())
+	}
+	listNodesUsingCli(nc)
+}
+
 func removeNode(nexus_url string, args []string) {
 	if len(args) < 1 {
 		fmt.Println("Error: <nodeAddr> must be provided")
@@ -187,6 +278,47 @@ func removeNode(nexus_url string, args []string) {
 	listNodesUsingCli(nc)
 }
 
+func replaceNode(nexus_url string, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Error: <oldNodeId> and <nodeAddr> must be provided")
+		printUsage()
+		return
+	}
+	oldNodeId, err := strconv.ParseUint(strings.TrimSpace(args[0]), 16, 64)
+	if err != nil {
+		fmt.Printf("Error: invalid <oldNodeId>: %v\n", err)
+		return
+	}
+	nodeUrl := strings.TrimSpace(args[1])
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if err := nc.ReplaceNode(oldNodeId, nodeUrl); err != nil {
+		fmt.Println(err.Error())
+	}
+	listNodesUsingCli(nc)
+}
+
+func transferLeader(nexus_url string, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: <nodeId> must be provided")
+		printUsage()
+		return
+	}
+	nodeId, err := strconv.ParseUint(strings.TrimSpace(args[0]), 16, 64)
+	if err != nil {
+		fmt.Printf("Error: invalid <nodeId>: %v\n", err)
+		return
+	}
+	nc := newNexusClient(nexus_url)
+	defer nc.Close()
+
+	if err := nc.TransferLeadership(nodeId); err != nil {
+		fmt.Println(err.Error())
+	}
+	listNodesUsingCli(nc)
+}
+
 func main() {
 	arg_len := len(os.Args)
 	if arg_len < 3 {
@@ -198,10 +330,24 @@ func main() {
 	switch cmd {
 	case "listnodes":
 		listNodes(nexus_url)
+	case "status":
+		clusterStatus(nexus_url)
+	case "snapshot":
+		takeSnapshot(nexus_url)
 	case "addnode":
 		addNode(nexus_url, os.Args[3:])
+	case "addlearner":
+		addLearner(nexus_url, os.Args[3:])
+	case "addshadow":
+		addShadow(nexus_url, os.Args[3:])
+	case "promotelearner":
+		promoteLearner(nexus_url, os.Args[3:])
 	case "removenode":
 		removeNode(nexus_url, os.Args[3:])
+	case "replacenode":
+		replaceNode(nexus_url, os.Args[3:])
+	case "transferleader":
+		transferLeader(nexus_url, os.Args[3:])
 	case "mysql":
 		sendMySQL(nexus_url, os.Args[3:])
 	case "redis":
@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// admittedMethods are the RPCs subject to admission control. Health
+// checks and administrative RPCs are always served, so that an
+// overloaded node can still be observed and operated upon.
+var admittedMethods = map[string]bool{
+	"/nexus.api.Nexus/Save":       true,
+	"/nexus.api.Nexus/SaveStream": true,
+	"/nexus.api.Nexus/Load":       true,
+	"/nexus.api.Nexus/LoadStream": true,
+}
+
+// admission limits the number of Saves and Loads being served at once.
+// Once the number of them in flight reaches the high watermark, new
+// ones are rejected till it drops to the low watermark, so that the
+// node gets to recover instead of flapping around the limit.
+type admission struct {
+	mu        sync.Mutex
+	high, low int
+	inflight  int
+	shedding  bool
+}
+
+func newAdmission(high, low int) *admission {
+	if low >= high {
+		low = high - 1
+	}
+	return &admission{high: high, low: low}
+}
+
+// admit returns true if a new request can be served, in which case
+// done must be invoked once it is served.
+func (this *admission) admit() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.shedding && this.inflight <= this.low {
+		this.shedding = false
+	}
+	if !this.shedding && this.inflight >= this.high {
+		this.shedding = true
+	}
+	if this.shedding {
+		return false
+	}
+	this.inflight++
+	return true
+}
+
+func (this *admission) done() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.inflight--
+}
+
+func (this *admission) unaryInterceptor(ctx context.Context, req interface{}, info *ggrpc.UnaryServerInfo, handler ggrpc.UnaryHandler) (interface{}, error) {
+	if !admittedMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	if !this.admit() {
+		return nil, status.Error(codes.ResourceExhausted, ErrTooManyRequests.Error())
+	}
+	defer this.done()
+	return handler(ctx, req)
+}
+
+func (this *admission) streamInterceptor(srv interface{}, ss ggrpc.ServerStream, info *ggrpc.StreamServerInfo, handler ggrpc.StreamHandler) error {
+	if !admittedMethods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	if !this.admit() {
+		return status.Error(codes.ResourceExhausted, ErrTooManyRequests.Error())
+	}
+	defer this.done()
+	return handler(srv, ss)
+}
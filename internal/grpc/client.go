@@ -2,39 +2,229 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"github.com/flipkart-incubator/nexus/models"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/flipkart-incubator/nexus/pkg/api"
+	"github.com/flipkart-incubator/nexus/pkg/raft"
 	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	ReadBufSize  = 10 << 20
 	WriteBufSize = 10 << 20
 	Timeout      = 10 * time.Second
+	// ConfChangeTimeout bounds membership changes, which the servers
+	// allow longer than Saves. See raft.ConfChangeTimeout.
+	ConfChangeTimeout = time.Minute
 )
 
 type NexusClient struct {
 	cliConn  *ggrpc.ClientConn
 	nexusCli api.NexusClient
+
+	readYourWrites bool
+	consistency    raft.ReadConsistency
+	lastSaveIndex  uint64
+	dialOpts       []ggrpc.DialOption
+	timeout        time.Duration
+	compressAbove  int
+	svcAddr        string
+	peerAddrFunc   func(nodeUrl string) (string, error)
+
+	// for redirecting Saves to the leader
+	leaderRequired bool
+	leaderAddrFunc func(nodeUrl string) (string, error)
+	creds          ggrpc.DialOption
+	opts           []ClientOption
+	leaderMu       sync.Mutex
+	leaderAddr     string
+	leaderCli      *NexusClient
+}
+
+type ClientOption func(*NexusClient)
+
+// WithReadYourWrites makes every Load observe all the Saves made
+// previously using the same client, by passing the index of the latest
+// such Save as the minimum index for the Load.
+func WithReadYourWrites() ClientOption {
+	return func(nc *NexusClient) {
+		nc.readYourWrites = true
+	}
+}
+
+// WithSessionConsistency is similar to WithReadYourWrites except that
+// Loads are also served from the local store of the node this client is
+// connected to, once it has applied the latest Save made using this
+// client, instead of going through a RAFT ReadIndex. This is cheaper
+// than linearizable Loads, but may miss the Saves of other clients.
+func WithSessionConsistency() ClientOption {
+	return func(nc *NexusClient) {
+		nc.readYourWrites = true
+		nc.consistency = raft.Stale
+	}
+}
+
+// WithCodec makes the client encode and decode all the messages using
+// the given codec instead of protobuf. The service must be configured
+// with the same codec using WithServerCodec.
+func WithCodec(codec encoding.Codec) ClientOption {
+	return func(nc *NexusClient) {
+		nc.dialOpts = append(nc.dialOpts, ggrpc.WithDefaultCallOptions(ggrpc.ForceCodec(codec)))
+	}
+}
+
+// WithTimeout sets the timeout of every RPC made by the client, other
+// than membership changes and the ones made with a caller-provided
+// context. It defaults to Timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(nc *NexusClient) {
+		if timeout > 0 {
+			nc.timeout = timeout
+		}
+	}
+}
+
+// WithCompression makes the client compress the payloads of Saves of at
+// least the given size in bytes using gzip, while sending them to the
+// server. This is independent of raft.CompressPayloads, which compresses
+// the payloads in the RAFT log.
+func WithCompression(threshold int) ClientOption {
+	return func(nc *NexusClient) {
+		nc.compressAbove = threshold
+	}
+}
+
+// WithLeaderRedirect makes a node other than the leader reject Saves
+// with ErrNotLeader instead of forwarding them to the leader, and the
+// rejected Saves be retried once on the leader, as hinted by the server.
+// Saves failing otherwise are not retried, since they may have been
+// applied. The given function maps the RAFT URL of the leader to the
+// address of its gRPC service, similar to WithServiceAddrFunc, if the
+// leader does not advertise its service address. The
+// connection to the leader is retained for the Saves that follow.
+func WithLeaderRedirect(svcAddrFunc func(nodeUrl string) (string, error)) ClientOption {
+	return func(nc *NexusClient) {
+		nc.leaderRequired = true
+		nc.leaderAddrFunc = svcAddrFunc
+	}
+}
+
+// withLeaderRequired makes a node other than the leader reject Saves
+// with ErrNotLeader instead of forwarding them to the leader.
+func withLeaderRequired() ClientOption {
+	return func(nc *NexusClient) {
+		nc.leaderRequired = true
+	}
+}
+
+// WithPeerAddrFunc sets the function that maps the RAFT URL of a peer
+// to the address of its gRPC service, for the replicas to which Loads
+// are redirected by LoadOrRedirect, if the peer does not advertise its
+// service address. By default, the host of the RAFT
+// URL is used along with the port of the service this client connects
+// to, which suits deployments that use the same port on every node.
+func WithPeerAddrFunc(svcAddrFunc func(nodeUrl string) (string, error)) ClientOption {
+	return func(nc *NexusClient) {
+		nc.peerAddrFunc = svcAddrFunc
+	}
+}
+
+// NewNexusClient connects to the given address over an insecure
+// connection, configured as per the given options. Use
+// NewSecureNexusClient instead for connecting over TLS.
+func NewNexusClient(svcAddr string, opts ...ClientOption) (*NexusClient, error) {
+	return dialNexusClient(context.Background(), svcAddr, ggrpc.WithInsecure(), opts...)
+}
+
+func NewInSecureNexusClient(svcAddr string, opts ...ClientOption) (*NexusClient, error) {
+	return NewNexusClient(svcAddr, opts...)
 }
 
-func NewInSecureNexusClient(svcAddr string) (*NexusClient, error) {
-	if conn, err := ggrpc.Dial(svcAddr, ggrpc.WithInsecure(), ggrpc.WithBlock(), ggrpc.WithReadBufferSize(ReadBufSize), ggrpc.WithWriteBufferSize(WriteBufSize)); err != nil {
+// NewSecureNexusClient is similar to NewInSecureNexusClient except that
+// it connects over TLS using the given config. A nil config verifies the
+// server certificate against the system cert pool.
+func NewSecureNexusClient(svcAddr string, tlsConf *tls.Config, opts ...ClientOption) (*NexusClient, error) {
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
+	}
+	creds := ggrpc.WithTransportCredentials(credentials.NewTLS(tlsConf))
+	return dialNexusClient(context.Background(), svcAddr, creds, opts...)
+}
+
+// WithDialOptions passes the given options to gRPC while connecting,
+// over and above those set by default, such as for adding interceptors.
+func WithDialOptions(dialOpts ...ggrpc.DialOption) ClientOption {
+	return func(nc *NexusClient) {
+		nc.dialOpts = append(nc.dialOpts, dialOpts...)
+	}
+}
+
+// dialNexusClient connects to the given address using the given
+// transport credentials, giving up once the given context expires.
+func dialNexusClient(ctx context.Context, svcAddr string, creds ggrpc.DialOption, opts ...ClientOption) (*NexusClient, error) {
+	nc := &NexusClient{timeout: Timeout, creds: creds, opts: opts, svcAddr: svcAddr}
+	for _, opt := range opts {
+		opt(nc)
+	}
+	if nc.peerAddrFunc == nil {
+		_, port, _ := net.SplitHostPort(svcAddr)
+		nc.peerAddrFunc = func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, port) }
+	}
+	dialOpts := append([]ggrpc.DialOption{creds, ggrpc.WithBlock(), ggrpc.WithReadBufferSize(ReadBufSize), ggrpc.WithWriteBufferSize(WriteBufSize)}, nc.dialOpts...)
+	if conn, err := ggrpc.DialContext(ctx, svcAddr, dialOpts...); err != nil {
 		return nil, err
 	} else {
-		nexus_cli := api.NewNexusClient(conn)
-		return &NexusClient{conn, nexus_cli}, nil
+		nc.cliConn, nc.nexusCli = conn, api.NewNexusClient(conn)
+		return nc, nil
+	}
+}
+
+// LastSaveIndex returns the RAFT index of the latest Save made using
+// this client, which can be used with HasApplied for routing reads.
+func (this *NexusClient) LastSaveIndex() uint64 {
+	return atomic.LoadUint64(&this.lastSaveIndex)
+}
+
+// observeSave records the index of the given Save, if it is the
+// latest one made using this client.
+func (this *NexusClient) observeSave(index uint64) {
+	for {
+		last := atomic.LoadUint64(&this.lastSaveIndex)
+		if index <= last || atomic.CompareAndSwapUint64(&this.lastSaveIndex, last, index) {
+			return
+		}
 	}
 }
 
 func (this *NexusClient) HealthCheck() api.HealthCheckResponse_ServingStatus {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	return this.HealthCheckFor("")
+}
+
+// HealthCheckFor checks the health of the given service, which can be
+// either LivenessService or ReadinessService.
+func (this *NexusClient) HealthCheckFor(service string) api.HealthCheckResponse_ServingStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
 	defer cancel()
-	req := &api.HealthCheckRequest{Service: ""}
+	req := &api.HealthCheckRequest{Service: service}
 	if res, err := this.nexusCli.Check(ctx, req); err != nil {
 		return api.HealthCheckResponse_NOT_SERVING
 	} else {
@@ -42,67 +232,985 @@ func (this *NexusClient) HealthCheck() api.HealthCheckResponse_ServingStatus {
 	}
 }
 
-func (this *NexusClient) Save(data []byte, params map[string][]byte) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+// CheckHealth is similar to HealthCheckFor except that it returns the
+// complete response, including the lag of the store and whether the
+// node knows of a leader and is connected to it.
+func (this *NexusClient) CheckHealth(service string) (*api.HealthCheckResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.nexusCli.Check(ctx, &api.HealthCheckRequest{Service: service})
+}
+
+// Save saves the given data via the server. An optional correlation ID,
+// such as the trace ID of the caller, can be given, which the servers
+// log at every stage of the Save, up to it being applied onto the store.
+func (this *NexusClient) Save(data []byte, params map[string][]byte, correlationId ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.SaveContext(ctx, data, params, correlationId...)
+}
+
+// SaveContext is similar to Save except that the Save is bound to the
+// given context instead of the timeout of the client, so that its
+// deadline and cancellation are propagated to the server.
+func (this *NexusClient) SaveContext(ctx context.Context, data []byte, params map[string][]byte, correlationId ...string) ([]byte, error) {
+	var corrId string
+	if len(correlationId) > 0 {
+		corrId = correlationId[0]
+	}
+	res, st := this.save(ctx, data, params, raft.NormalPriority, corrId)
+	return res, statusErr(st)
+}
+
+// SaveWithStatus is similar to Save except that on failure it returns
+// the complete gRPC status, including its code and details.
+func (this *NexusClient) SaveWithStatus(data []byte, params map[string][]byte) ([]byte, *status.Status) {
+	return this.SaveWithPriority(data, params, raft.NormalPriority)
+}
+
+// SaveWithPriority is similar to SaveWithStatus except that the Save
+// is admitted for proposing as per the given priority, when the server
+// limits the number of proposals in flight.
+func (this *NexusClient) SaveWithPriority(data []byte, params map[string][]byte, priority raft.Priority) ([]byte, *status.Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.save(ctx, data, params, priority, "")
+}
+
+func (this *NexusClient) save(ctx context.Context, data []byte, params map[string][]byte, priority raft.Priority, correlationId string) ([]byte, *status.Status) {
+	if priority != raft.NormalPriority {
+		ctx = metadata.AppendToOutgoingContext(ctx, PriorityHeader, priority.String())
+	}
+	if this.leaderRequired {
+		ctx = metadata.AppendToOutgoingContext(ctx, LeaderRequiredHeader, "true")
+	}
+	saveReq := &api.SaveRequest{Data: data, Args: params, CorrelationId: correlationId}
+	var trailer metadata.MD
+	callOpts := []ggrpc.CallOption{ggrpc.Trailer(&trailer)}
+	if this.compressAbove > 0 && len(data) >= this.compressAbove {
+		callOpts = append(callOpts, ggrpc.UseCompressor(gzip.Name))
+	}
+	res, err := this.nexusCli.Save(ctx, saveReq, callOpts...)
+	if err != nil && this.leaderAddrFunc != nil && status.Code(err) == codes.FailedPrecondition {
+		if vals := trailer.Get(LeaderHeader); len(vals) > 0 {
+			var svcAddr string
+			if addrs := trailer.Get(LeaderAddrHeader); len(addrs) > 0 {
+				svcAddr = addrs[0]
+			}
+			res, err = this.saveOnLeader(ctx, vals[0], svcAddr, saveReq)
+		}
+	}
+	if err != nil {
+		return nil, status.Convert(err)
+	} else {
+		if res.Status.Code != 0 {
+			return nil, responseStatus(res.Status)
+		} else {
+			this.observeSave(res.Index)
+			return res.ResData, nil
+		}
+	}
+}
+
+// saveOnLeader retries the given Save on the leader with the given RAFT
+// URL and advertised service address, if any, within a timeout of its
+// own and with the same metadata.
+func (this *NexusClient) saveOnLeader(ctx context.Context, leaderUrl, svcAddr string, saveReq *api.SaveRequest) (*api.SaveResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	leaderCli, err := this.leaderClient(ctx, leaderUrl, svcAddr)
+	if err != nil {
+		return nil, err
+	}
+	return leaderCli.nexusCli.Save(metadata.NewOutgoingContext(ctx, md), saveReq)
+}
+
+// leaderClient returns the client connected to the leader with the
+// given RAFT URL, replacing the one connected to an earlier leader. The
+// RAFT URL is mapped to a service address only if none is advertised.
+func (this *NexusClient) leaderClient(ctx context.Context, leaderUrl, svcAddr string) (*NexusClient, error) {
+	if svcAddr == "" {
+		var err error
+		if svcAddr, err = this.leaderAddrFunc(leaderUrl); err != nil {
+			return nil, err
+		}
+	}
+	this.leaderMu.Lock()
+	defer this.leaderMu.Unlock()
+	if this.leaderCli != nil && this.leaderAddr == svcAddr {
+		return this.leaderCli, nil
+	}
+	leaderCli, err := dialNexusClient(ctx, svcAddr, this.creds, this.opts...)
+	if err != nil {
+		return nil, err
+	}
+	if this.leaderCli != nil {
+		this.leaderCli.Close()
+	}
+	this.leaderAddr, this.leaderCli = svcAddr, leaderCli
+	return leaderCli, nil
+}
+
+// SaveWithAckLevel is similar to SaveWithStatus except that the Save
+// is acknowledged by the server at the given ack level. Note that with
+// raft.AckCommitted, the response of the store is not returned.
+func (this *NexusClient) SaveWithAckLevel(data []byte, params map[string][]byte, ackLevel raft.AckLevel) ([]byte, *status.Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
 	defer cancel()
+	if ackLevel != raft.AckAppliedLocal {
+		ctx = metadata.AppendToOutgoingContext(ctx, AckLevelHeader, ackLevel.String())
+	}
 	saveReq := &api.SaveRequest{Data: data, Args: params}
 	if res, err := this.nexusCli.Save(ctx, saveReq); err != nil {
+		return nil, status.Convert(err)
+	} else {
+		if res.Status.Code != 0 {
+			return nil, responseStatus(res.Status)
+		} else {
+			this.observeSave(res.Index)
+			return res.ResData, nil
+		}
+	}
+}
+
+const (
+	saveRetryMinBackoff = 100 * time.Millisecond
+	saveRetryMaxBackoff = 5 * time.Second
+)
+
+// SaveUntilCommitted saves the given data, retrying with exponential
+// backoff across transient failures such as leader changes, till it is
+// confirmed to be applied or the given context expires. All the attempts
+// carry the given idempotency key, using which the servers apply the
+// data only once even if an earlier attempt did get committed. Returns
+// the RAFT index at which the data was applied. Saves rejected by a
+// server shedding load are retried only after the time it asks for.
+func (this *NexusClient) SaveUntilCommitted(ctx context.Context, data []byte, params map[string][]byte, idempotencyKey string) (uint64, error) {
+	if idempotencyKey == "" {
+		return 0, errors.New("idempotencyKey must not be empty")
+	}
+	saveReq := &api.SaveRequest{Data: data, Args: params, IdempotencyKey: idempotencyKey}
+	backoff := saveRetryMinBackoff
+	for {
+		var trailer metadata.MD
+		attemptCtx, cancel := context.WithTimeout(ctx, this.timeout)
+		res, err := this.nexusCli.Save(attemptCtx, saveReq, ggrpc.Trailer(&trailer))
+		cancel()
+		if err == nil {
+			if res.Status.Code != 0 {
+				return 0, statusErr(responseStatus(res.Status))
+			}
+			this.observeSave(res.Index)
+			return res.Index, nil
+		}
+		wait := backoff
+		if retryAfter := RetryAfter(trailer); retryAfter > 0 {
+			wait = retryAfter
+		} else if !isRetriable(status.Code(err)) {
+			return 0, toError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, toError(err)
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > saveRetryMaxBackoff {
+			backoff = saveRetryMaxBackoff
+		}
+	}
+}
+
+// RetryAfter returns the time after which a Save rejected by a server
+// shedding load may be retried, as per the given trailer of its response.
+// Returns 0 if the trailer carries no such hint.
+func RetryAfter(trailer metadata.MD) time.Duration {
+	if vals := trailer.Get(RetryAfterHeader); len(vals) > 0 {
+		if retryAfterMs, err := strconv.ParseInt(vals[0], 10, 64); err == nil && retryAfterMs > 0 {
+			return time.Duration(retryAfterMs) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// isRetriable reports whether a Save failing with the given code may
+// succeed if attempted again.
+func isRetriable(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// errorDomain is the domain of the ErrorInfo detail set by servers in
+// the status of requests failing with one of the knownErrors.
+const errorDomain = "nexus"
+
+// knownErrors are the errors recognised in the failures reported by
+// servers, so that the errors returned by this client match them. Each
+// is identified by the reason in the ErrorInfo detail of the status.
+var knownErrors = []struct {
+	reason string
+	err    error
+}{
+	{"NOT_LEADER", raft.ErrNotLeader},
+	{"NO_LEADER", raft.ErrNoLeader},
+	{"NO_QUORUM", raft.ErrNoQuorum},
+	{"PROPOSAL_TOO_LARGE", raft.ErrProposalTooLarge},
+	{"PROPOSAL_DROPPED", raft.ErrProposalDropped},
+	{"APPLY_LAGGING", raft.ErrApplyLagging},
+	{"CONF_CHANGE_IN_PROGRESS", raft.ErrConfChangeInProgress},
+	{"UNKNOWN_MEMBER", raft.ErrUnknownMember},
+	{"RESTORE_FAILED", raft.ErrRestoreFailed},
+	{"RECOVERING", raft.ErrRecovering},
+	{"LEADER_CHANGED", raft.ErrLeaderChanged},
+	{"NODE_REMOVED", raft.ErrNodeRemoved},
+	{"SHADOW_MEMBER", raft.ErrShadowMember},
+	{"OVERLOADED", raft.ErrOverloaded},
+	{"COMPACTED", raft.ErrCompacted},
+	{"SHUTTING_DOWN", raft.ErrShuttingDown},
+	{"TOO_MANY_REQUESTS", raft.ErrTooManyRequests},
+}
+
+// Error is returned by this client for requests failed by a server. It
+// matches the corresponding error via errors.Is, such as raft.ErrNotLeader
+// or raft.ErrTimeout, and retains the gRPC status of the failure, which
+// is returned by status.FromError.
+type Error struct {
+	Status *status.Status
+	err    error
+}
+
+func (this *Error) Error() string {
+	return this.Status.Err().Error()
+}
+
+func (this *Error) Unwrap() error {
+	return this.err
+}
+
+func (this *Error) GRPCStatus() *status.Status {
+	return this.Status
+}
+
+// statusErr returns the Error for the given status, nil if it is OK.
+func statusErr(st *status.Status) error {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+	err := &Error{Status: st}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			for _, known := range knownErrors {
+				if info.Reason == known.reason {
+					err.err = known.err
+					return err
+				}
+			}
+		}
+	}
+	// The statuses in responses, and those of servers predating the
+	// ErrorInfo detail, only carry the message of the error.
+	for _, known := range knownErrors {
+		if strings.Contains(st.Message(), known.err.Error()) {
+			err.err = known.err
+			return err
+		}
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		err.err = raft.ErrTimeout
+	case codes.Canceled:
+		err.err = context.Canceled
+	case codes.FailedPrecondition:
+		err.err = raft.ErrNotLeader
+	}
+	return err
+}
+
+// toError converts the given error of a gRPC call into an Error.
+func toError(err error) error {
+	if _, ok := status.FromError(err); !ok {
+		return err
+	}
+	return statusErr(status.Convert(err))
+}
+
+// responseStatus converts the status in the response of a server into
+// a gRPC status. Servers predating gRPC codes in responses set them -1.
+func responseStatus(st *api.Status) *status.Status {
+	code := codes.Code(st.Code)
+	if st.Code < 0 {
+		code = codes.Unknown
+	}
+	return status.New(code, st.Message)
+}
+
+// SaveInChunks streams the given data to the server in chunks of the
+// given size, all of which are applied atomically as a single Save.
+func (this *NexusClient) SaveInChunks(data []byte, params map[string][]byte, chunkSize int) ([]byte, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("chunkSize must be positive")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	stream, err := this.nexusCli.SaveStream(ctx)
+	if err != nil {
 		return nil, err
+	}
+	for off := 0; off == 0 || off < len(data); off += chunkSize {
+		end := off + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := &api.SaveRequest{Data: data[off:end]}
+		if off == 0 {
+			chunk.Args = params
+		}
+		if err := stream.Send(chunk); err != nil {
+			break
+		}
+	}
+	if res, err := stream.CloseAndRecv(); err != nil {
+		return nil, toError(err)
 	} else {
 		if res.Status.Code != 0 {
-			return nil, errors.New(res.Status.Message)
+			return nil, statusErr(responseStatus(res.Status))
 		} else {
+			this.observeSave(res.Index)
 			return res.ResData, nil
 		}
 	}
 }
 
 func (this *NexusClient) Load(data []byte, params map[string][]byte) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.LoadContext(ctx, data, params)
+}
+
+// LoadContext is similar to Load except that the Load is bound to the
+// given context instead of the timeout of the client, so that its
+// deadline and cancellation are propagated to the server.
+func (this *NexusClient) LoadContext(ctx context.Context, data []byte, params map[string][]byte) ([]byte, error) {
+	res, _, st := this.load(ctx, data, params, this.consistency)
+	return res, statusErr(st)
+}
+
+// LoadWithStatus is similar to Load except that on failure it returns
+// the complete gRPC status, including its code and details.
+func (this *NexusClient) LoadWithStatus(data []byte, params map[string][]byte) ([]byte, *status.Status) {
+	res, _, st := this.LoadWithFreshness(data, params)
+	return res, st
+}
+
+// LoadWithFreshness is similar to LoadWithStatus except that it also
+// returns the freshness of the loaded data, using which callers can
+// determine how stale it is.
+func (this *NexusClient) LoadWithFreshness(data []byte, params map[string][]byte) ([]byte, raft.Freshness, *status.Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.load(ctx, data, params, this.consistency)
+}
+
+// LoadWithConsistency is similar to LoadWithStatus except that the Load
+// is served as per the given read consistency. For instance, raft.Stale
+// skips the ReadIndex round trip and reads the local store of the node
+// this client is connected to.
+func (this *NexusClient) LoadWithConsistency(data []byte, params map[string][]byte, rc raft.ReadConsistency) ([]byte, *status.Status) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
 	defer cancel()
-	loadReq := &api.LoadRequest{Data: data, Args: params}
+	res, _, st := this.load(ctx, data, params, rc)
+	return res, st
+}
+
+func (this *NexusClient) load(ctx context.Context, data []byte, params map[string][]byte, rc raft.ReadConsistency) ([]byte, raft.Freshness, *status.Status) {
+	loadReq := &api.LoadRequest{Data: data, Args: params, Consistency: api.LoadRequest_ReadConsistency(rc)}
+	if this.readYourWrites {
+		loadReq.MinIndex = atomic.LoadUint64(&this.lastSaveIndex)
+	}
 	if res, err := this.nexusCli.Load(ctx, loadReq); err != nil {
-		return nil, err
+		return nil, raft.Freshness{}, status.Convert(err)
 	} else {
 		if res.Status.Code != 0 {
-			return nil, errors.New(res.Status.Message)
+			return nil, raft.Freshness{}, responseStatus(res.Status)
 		} else {
-			return res.ResData, nil
+			return res.ResData, raft.Freshness{CommittedIndex: res.CommittedIndex, AppliedIndex: res.AppliedIndex}, nil
 		}
 	}
 }
 
+// LoadStream is similar to Load except that the response is streamed
+// in frames, for reads too large for a single gRPC message. The returned
+// reader must be closed once done, and fails if it is not fully consumed
+// within the timeout of the client.
+func (this *NexusClient) LoadStream(data []byte) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	loadReq := &api.LoadRequest{Data: data, Consistency: api.LoadRequest_ReadConsistency(this.consistency)}
+	if this.readYourWrites {
+		loadReq.MinIndex = atomic.LoadUint64(&this.lastSaveIndex)
+	}
+	stream, err := this.nexusCli.LoadStream(ctx, loadReq)
+	if err != nil {
+		cancel()
+		return nil, toError(err)
+	}
+	return &loadStreamReader{stream: stream, cancel: cancel}, nil
+}
+
+type loadStreamReader struct {
+	stream api.Nexus_LoadStreamClient
+	cancel context.CancelFunc
+	buf    []byte
+}
+
+func (this *loadStreamReader) Read(p []byte) (int, error) {
+	for len(this.buf) == 0 {
+		res, err := this.stream.Recv()
+		if err != nil {
+			return 0, toError(err)
+		}
+		if res.Status != nil && res.Status.Code != 0 {
+			return 0, statusErr(responseStatus(res.Status))
+		}
+		this.buf = res.ResData
+	}
+	n := copy(p, this.buf)
+	this.buf = this.buf[n:]
+	return n, nil
+}
+
+func (this *loadStreamReader) Close() error {
+	this.cancel()
+	return nil
+}
+
+// localLoad loads the given data from the store of the node this client
+// is connected to, once it has applied all the entries till minIndex.
+func (this *NexusClient) localLoad(data []byte, params map[string][]byte, minIndex uint64) ([]byte, raft.Freshness, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, ReadConsistencyHeader, raft.Stale.String())
+	loadReq := &api.LoadRequest{Data: data, Args: params, MinIndex: minIndex}
+	if res, err := this.nexusCli.Load(ctx, loadReq); err != nil {
+		return nil, raft.Freshness{}, toError(err)
+	} else if res.Status.Code != 0 {
+		return nil, raft.Freshness{}, statusErr(responseStatus(res.Status))
+	} else {
+		return res.ResData, raft.Freshness{CommittedIndex: res.CommittedIndex, AppliedIndex: res.AppliedIndex}, nil
+	}
+}
+
+// Freshness returns the commit index of the leader along with the
+// applied index of the node this client is connected to.
+func (this *NexusClient) Freshness() (raft.Freshness, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.Freshness(ctx, &empty.Empty{}); err != nil {
+		return raft.Freshness{}, toError(err)
+	} else if res.Status.Code != 0 {
+		return raft.Freshness{}, statusErr(responseStatus(res.Status))
+	} else {
+		return raft.Freshness{CommittedIndex: res.CommittedIndex, AppliedIndex: res.AppliedIndex}, nil
+	}
+}
+
+// LoadOrRedirect is similar to Load except that if the node this client
+// is connected to is draining, it returns the service addresses of the
+// replicas to which the Load must be redirected instead, as mapped from
+// their RAFT URLs by the function set with WithPeerAddrFunc, unless
+// advertised by the replicas.
+func (this *NexusClient) LoadOrRedirect(data []byte, params map[string][]byte) ([]byte, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	loadReq := &api.LoadRequest{Data: data, Args: params, Consistency: api.LoadRequest_ReadConsistency(this.consistency)}
+	if this.readYourWrites {
+		loadReq.MinIndex = atomic.LoadUint64(&this.lastSaveIndex)
+	}
+	var trailer metadata.MD
+	if res, err := this.nexusCli.Load(ctx, loadReq, ggrpc.Trailer(&trailer)); err != nil {
+		if vals := trailer.Get(RedirectHeader); len(vals) > 0 {
+			var advertised []string
+			if addrs := trailer.Get(RedirectAddrsHeader); len(addrs) > 0 {
+				advertised = strings.Split(addrs[0], ",")
+			}
+			return nil, this.peerAddrs(strings.Split(vals[0], ","), advertised), toError(err)
+		}
+		return nil, nil, toError(err)
+	} else if res.Status.Code != 0 {
+		return nil, nil, statusErr(responseStatus(res.Status))
+	} else {
+		return res.ResData, nil, nil
+	}
+}
+
+// peerAddrs maps the given RAFT URLs of peers to the addresses of their
+// services, leaving out the ones that cannot be mapped. The addresses
+// advertised by the peers, if any, are given in the same order and are
+// preferred.
+func (this *NexusClient) peerAddrs(nodeUrls, advertised []string) []string {
+	var svcAddrs []string
+	for i, nodeUrl := range nodeUrls {
+		if len(advertised) == len(nodeUrls) && advertised[i] != "" {
+			svcAddrs = append(svcAddrs, advertised[i])
+		} else if svcAddr, err := this.peerAddrFunc(nodeUrl); err == nil {
+			svcAddrs = append(svcAddrs, svcAddr)
+		}
+	}
+	return svcAddrs
+}
+
+// Drain puts the node this client is connected to into drain mode, or
+// takes it out of it, during which Loads made on it are redirected.
+func (this *NexusClient) Drain(draining bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.Drain(ctx, &api.DrainRequest{Draining: draining}); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
 func (this *NexusClient) AddNode(nodeUrl string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
 	defer cancel()
 	req := &api.AddNodeRequest{NodeUrl: nodeUrl}
 	if res, err := this.nexusCli.AddNode(ctx, req); err != nil {
-		return err
+		return toError(err)
 	} else if res.Code != 0 {
-		return errors.New(res.Message)
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// AddNodeDryRun checks whether the node at the given URL can be added
+// to the cluster, including that it is reachable, without adding it.
+func (this *NexusClient) AddNodeDryRun(nodeUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
+	defer cancel()
+	req := &api.AddNodeRequest{NodeUrl: nodeUrl, DryRun: true}
+	if res, err := this.nexusCli.AddNode(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// AddLearner adds the node at the given URL as a learner, which
+// replicates the RAFT log without voting till it is promoted.
+func (this *NexusClient) AddLearner(nodeUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
+	defer cancel()
+	req := &api.AddNodeRequest{NodeUrl: nodeUrl, Learner: true}
+	if res, err := this.nexusCli.AddNode(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// AddShadow adds the node at the given URL as a shadow member, which
+// replicates like a learner but is hidden from clients and refuses their
+// requests. It can be promoted to a regular voter with PromoteLearner.
+func (this *NexusClient) AddShadow(nodeUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
+	defer cancel()
+	req := &api.AddNodeRequest{NodeUrl: nodeUrl, Shadow: true}
+	if res, err := this.nexusCli.AddNode(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// PromoteLearner makes the learner with the given ID a voter, once it
+// has caught up. It must be invoked on the leader.
+func (this *NexusClient) PromoteLearner(nodeId uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
+	defer cancel()
+	req := &api.PromoteNodeRequest{NodeId: nodeId}
+	if res, err := this.nexusCli.PromoteNode(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
 	}
 	return nil
 }
 
 func (this *NexusClient) RemoveNode(nodeUrl string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
 	defer cancel()
 	req := &api.RemoveNodeRequest{NodeUrl: nodeUrl}
 	if res, err := this.nexusCli.RemoveNode(ctx, req); err != nil {
-		return err
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// RemoveNodeDryRun checks whether the node at the given URL can be
+// removed from the cluster, without removing it.
+func (this *NexusClient) RemoveNodeDryRun(nodeUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
+	defer cancel()
+	req := &api.RemoveNodeRequest{NodeUrl: nodeUrl, DryRun: true}
+	if res, err := this.nexusCli.RemoveNode(ctx, req); err != nil {
+		return toError(err)
 	} else if res.Code != 0 {
-		return errors.New(res.Message)
+		return statusErr(responseStatus(res))
 	}
 	return nil
 }
 
-func (this *NexusClient) ListNodes() (uint64, map[uint64]*models.NodeInfo) {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+// ReplaceNode swaps the member with the given ID for the node at the
+// given URL. See RaftReplicator.ReplaceMember for the guarantees.
+func (this *NexusClient) ReplaceNode(oldNodeId uint64, nodeUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfChangeTimeout)
 	defer cancel()
-	res, _ := this.nexusCli.ListNodes(ctx, &empty.Empty{})
-	return res.Leader, res.Nodes
+	req := &api.ReplaceNodeRequest{OldNodeId: oldNodeId, NodeUrl: nodeUrl}
+	if res, err := this.nexusCli.ReplaceNode(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// TransferLeadership hands over the leadership of the cluster to the
+// voter with the given ID, and waits till it becomes the leader.
+func (this *NexusClient) TransferLeadership(nodeId uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	req := &api.TransferLeadershipRequest{NodeId: nodeId}
+	if res, err := this.nexusCli.TransferLeadership(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+func (this *NexusClient) CompactLog(index uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	req := &api.CompactLogRequest{Index: index}
+	if res, err := this.nexusCli.CompactLog(ctx, req); err != nil {
+		return toError(err)
+	} else if res.Code != 0 {
+		return statusErr(responseStatus(res))
+	}
+	return nil
+}
+
+// Snapshot makes the node this client is connected to take a snapshot
+// of its store right away, such as prior to maintenance, and returns
+// the RAFT index of the snapshot.
+func (this *NexusClient) Snapshot() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.Snapshot(ctx, &empty.Empty{}); err != nil {
+		return 0, toError(err)
+	} else if res.Status.Code != 0 {
+		return 0, statusErr(responseStatus(res.Status))
+	} else {
+		return res.Index, nil
+	}
+}
+
+// HasApplied reports whether the node this client is connected to has
+// applied all the entries up to the given index.
+func (this *NexusClient) HasApplied(index uint64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	req := &api.HasAppliedRequest{Index: index}
+	if res, err := this.nexusCli.HasApplied(ctx, req); err != nil {
+		return false, toError(err)
+	} else if res.Status.Code != 0 {
+		return false, statusErr(responseStatus(res.Status))
+	} else {
+		return res.Applied, nil
+	}
+}
+
+// AppliedIndex returns the index up to which the node this client is
+// connected to has applied the committed entries onto its store. This
+// is the watermark that linearizable reads wait on, which callers can
+// poll to throttle their writes till the store catches up.
+func (this *NexusClient) AppliedIndex() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.HasApplied(ctx, &api.HasAppliedRequest{}); err != nil {
+		return 0, toError(err)
+	} else if res.Status.Code != 0 {
+		return 0, statusErr(responseStatus(res.Status))
+	} else {
+		return res.AppliedIndex, nil
+	}
+}
+
+// ListNodes returns the leader along with the members of the cluster,
+// as known to the node this client is connected to.
+func (this *NexusClient) ListNodes() (uint64, map[uint64]*models.NodeInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.ListNodes(ctx, &empty.Empty{}); err != nil {
+		return 0, nil, toError(err)
+	} else if res == nil {
+		return 0, nil, errors.New("no response for listing nodes")
+	} else {
+		return res.Leader, res.Nodes, nil
+	}
+}
+
+type ClusterEventType int
+
+const (
+	NodeJoined ClusterEventType = iota
+	NodeLeft
+	LeaderChanged
+	NodeOffline
+	NodeOnline
+)
+
+func (this ClusterEventType) String() string {
+	switch this {
+	case NodeJoined:
+		return "NodeJoined"
+	case NodeLeft:
+		return "NodeLeft"
+	case LeaderChanged:
+		return "LeaderChanged"
+	case NodeOffline:
+		return "NodeOffline"
+	case NodeOnline:
+		return "NodeOnline"
+	default:
+		return "Unknown"
+	}
+}
+
+// WatchCommits invokes the given function with every Save committed and
+// applied on the node, in order, starting from the given index, or from
+// the next entry to be applied if it is 0. It blocks till the context
+// expires or the function fails, whose error is then returned. Dropped
+// streams are transparently re-opened from the entry following the last
+// one processed, hence no commit is missed or repeated. If the entries
+// from the given index have been compacted away, an error matching
+// raft.ErrCompacted is returned, on which the consumer must re-bootstrap
+// from a snapshot and resume from the entry following it.
+func (this *NexusClient) WatchCommits(ctx context.Context, fromIndex uint64, fn func(raft.Commit) error) error {
+	next := fromIndex
+	if next == 0 {
+		// resolved upfront, as a stream dropped before its first commit
+		// would otherwise be re-opened from a later applied index
+		applied, err := this.AppliedIndex()
+		if err != nil {
+			return err
+		}
+		next = applied + 1
+	}
+	for {
+		stream, err := this.nexusCli.WatchCommits(ctx, &api.WatchCommitsRequest{FromIndex: next})
+		for err == nil {
+			var res *api.WatchCommitsResponse
+			if res, err = stream.Recv(); err == nil {
+				if err := fn(raft.Commit{Index: res.Index, Term: res.Term, Data: res.Data}); err != nil {
+					return err
+				}
+				next = res.Index + 1
+			}
+		}
+		switch st := status.Convert(err); {
+		case st.Code() == codes.OutOfRange:
+			return fmt.Errorf("%w: %s", raft.ErrCompacted, strings.TrimPrefix(st.Message(), raft.ErrCompacted.Error()+", "))
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != io.EOF && !isRetriable(st.Code()):
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(eventStreamRetryInterval):
+		}
+	}
+}
+
+// ClusterEvent is a change in the topology of the cluster. For
+// LeaderChanged events, the node is the new leader, 0 if there is none.
+// NodeOffline and NodeOnline events are sent when a member becomes
+// unreachable beyond the offline grace period of the cluster, and when
+// it becomes reachable again, without any change in membership.
+type ClusterEvent struct {
+	Type    ClusterEventType
+	NodeId  uint64
+	NodeUrl string
+}
+
+const (
+	eventStreamBufSize       = 64
+	eventStreamRetryInterval = time.Second
+)
+
+// EventStream streams the changes in the topology of the cluster, till
+// the given context expires after which the returned channel is closed.
+// Events for all the existing members and the current leader are sent
+// right at the start. Dropped connections are transparently re-opened,
+// after which only the changes missed in the meantime are sent.
+func (this *NexusClient) EventStream(ctx context.Context) <-chan ClusterEvent {
+	events := make(chan ClusterEvent, eventStreamBufSize)
+	go this.streamEvents(ctx, events)
+	return events
+}
+
+func (this *NexusClient) streamEvents(ctx context.Context, events chan<- ClusterEvent) {
+	defer close(events)
+	var leader uint64
+	members, offline := make(map[uint64]string), make(map[uint64]bool)
+	for {
+		if stream, err := this.nexusCli.WatchTopology(ctx, &empty.Empty{}); err == nil {
+			for {
+				res, err := stream.Recv()
+				if err != nil {
+					break
+				}
+				for _, event := range topologyEvents(leader, members, offline, res) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+				leader, members, offline = res.Leader, memberUrls(res.Nodes), offlineMembers(res.Nodes)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventStreamRetryInterval):
+		}
+	}
+}
+
+// topologyEvents returns the events that transform the given leader,
+// members and OFFLINE members into the ones in the given response.
+func topologyEvents(leader uint64, members map[uint64]string, offline map[uint64]bool, res *api.ListNodesResponse) []ClusterEvent {
+	var events []ClusterEvent
+	for id, node := range res.Nodes {
+		if _, present := members[id]; !present {
+			events = append(events, ClusterEvent{Type: NodeJoined, NodeId: id, NodeUrl: node.NodeUrl})
+		}
+		if isOffline := node.Status == models.NodeInfo_OFFLINE; isOffline && !offline[id] {
+			events = append(events, ClusterEvent{Type: NodeOffline, NodeId: id, NodeUrl: node.NodeUrl})
+		} else if !isOffline && offline[id] {
+			events = append(events, ClusterEvent{Type: NodeOnline, NodeId: id, NodeUrl: node.NodeUrl})
+		}
+	}
+	for id, url := range members {
+		if _, present := res.Nodes[id]; !present {
+			events = append(events, ClusterEvent{Type: NodeLeft, NodeId: id, NodeUrl: url})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Type != events[j].Type {
+			return events[i].Type < events[j].Type
+		}
+		return events[i].NodeId < events[j].NodeId
+	})
+	if res.Leader != leader {
+		event := ClusterEvent{Type: LeaderChanged, NodeId: res.Leader}
+		if node, present := res.Nodes[res.Leader]; present {
+			event.NodeUrl = node.NodeUrl
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// ListNodesAuthoritative is similar to ListNodes except that it also
+// reports whether the statuses of the nodes are authoritative, which is
+// the case only if the node this client is connected to is the leader.
+// Otherwise, the statuses are the best effort inference of a follower.
+func (this *NexusClient) ListNodesAuthoritative() (uint64, map[uint64]*models.NodeInfo, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	if res, err := this.nexusCli.ListNodes(ctx, &empty.Empty{}); err != nil {
+		return 0, nil, false, toError(err)
+	} else {
+		return res.Leader, res.Nodes, res.Authoritative, nil
+	}
+}
+
+// ListInflightOps lists the operations waiting to be served on the node
+// this client is connected to, oldest first.
+func (this *NexusClient) ListInflightOps() ([]raft.InflightOp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	res, err := this.nexusCli.ListInflightOps(ctx, &empty.Empty{})
+	if err != nil {
+		return nil, toError(err)
+	} else if res.Status.Code != 0 {
+		return nil, statusErr(responseStatus(res.Status))
+	}
+	ops := make([]raft.InflightOp, len(res.Ops))
+	for i, op := range res.Ops {
+		ops[i] = raft.InflightOp{Id: op.Id, Type: raft.OpType(op.Type), Age: time.Duration(op.AgeMillis) * time.Millisecond}
+		if op.DeadlineUnixMillis != 0 {
+			ops[i].Deadline = time.Unix(0, op.DeadlineUnixMillis*int64(time.Millisecond))
+		}
+	}
+	return ops, nil
+}
+
+// StatusInfo is the RAFT state of a node, as returned by ClusterStatus.
+// Writable and Readable are the availability of the cluster for Saves
+// and Loads respectively, as determined by that node. See raft.Status.
+type StatusInfo struct {
+	NodeId       uint64
+	Term         uint64
+	CommitIndex  uint64
+	AppliedIndex uint64
+	Leader       uint64
+	Writable     bool
+	Readable     bool
+}
+
+// ClusterStatus returns the RAFT term, commit index, applied index,
+// leader and the availability of the cluster as known to the node this
+// client is connected to.
+func (this *NexusClient) ClusterStatus() (*StatusInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	res, err := this.nexusCli.ClusterStatus(ctx, &empty.Empty{})
+	if err != nil {
+		return nil, toError(err)
+	} else if res.Status.Code != 0 {
+		return nil, statusErr(responseStatus(res.Status))
+	}
+	return &StatusInfo{
+		NodeId:       res.NodeId,
+		Term:         res.Term,
+		CommitIndex:  res.CommitIndex,
+		AppliedIndex: res.AppliedIndex,
+		Leader:       res.Leader,
+		Writable:     res.Writable,
+		Readable:     res.Readable,
+	}, nil
 }
 
 func (this *NexusClient) Close() error {
+	this.leaderMu.Lock()
+	if this.leaderCli != nil {
+		this.leaderCli.Close()
+		this.leaderCli = nil
+	}
+	this.leaderMu.Unlock()
 	return this.cliConn.Close()
 }
@@ -0,0 +1,531 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flipkart-incubator/nexus/pkg/raft"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const defaultTopologyRefreshInterval = 5 * time.Second
+
+// ClusterClient is a client of an entire Nexus cluster, discovered from
+// one or more seed nodes. It tracks the members and the leader of the
+// cluster by periodically listing the nodes, and routes the requests to
+// the current leader, re-discovering it when the leadership changes.
+// Connections to the members are pooled by their service addresses.
+type ClusterClient struct {
+	seedAddrs        []string
+	svcAddrFunc      func(nodeUrl string) (string, error)
+	refreshInterval  time.Duration
+	clientOpts       []ClientOption
+	creds            ggrpc.DialOption
+	loadsOnAnyMember bool
+	nextMember       uint32
+
+	mu       sync.RWMutex
+	leader   uint64
+	members  map[uint64]string
+	svcAddrs map[uint64]string // advertised by the members
+	clients  map[string]*NexusClient
+
+	stopc     chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type ClusterClientOption func(*ClusterClient)
+
+// WithServiceAddrFunc sets the function that maps the RAFT URL of a
+// member to the address of its gRPC service, for the members that do
+// not advertise their service address. By default, the host of the RAFT
+// URL is used along with the port of the seed address, which suits
+// deployments that run the gRPC service on the same port on every node.
+func WithServiceAddrFunc(fn func(nodeUrl string) (string, error)) ClusterClientOption {
+	return func(cc *ClusterClient) {
+		cc.svcAddrFunc = fn
+	}
+}
+
+// WithTopologyRefreshInterval sets how often the members and the
+// leader of the cluster are listed. It defaults to 5 seconds.
+func WithTopologyRefreshInterval(interval time.Duration) ClusterClientOption {
+	return func(cc *ClusterClient) {
+		cc.refreshInterval = interval
+	}
+}
+
+// WithClientOptions sets the options of the clients of each node.
+func WithClientOptions(opts ...ClientOption) ClusterClientOption {
+	return func(cc *ClusterClient) {
+		cc.clientOpts = opts
+	}
+}
+
+// WithTLS makes the clients of each node connect over TLS using the
+// given config, instead of over insecure connections. A nil config
+// verifies the server certificates against the system cert pool.
+func WithTLS(tlsConf *tls.Config) ClusterClientOption {
+	return func(cc *ClusterClient) {
+		if tlsConf == nil {
+			tlsConf = &tls.Config{}
+		}
+		cc.creds = ggrpc.WithTransportCredentials(credentials.NewTLS(tlsConf))
+	}
+}
+
+// WithLoadsOnAnyMember makes Loads be spread across all the members
+// instead of being made on the leader, failing over to another member
+// if one is unavailable. Saves and membership changes are still routed
+// to the leader. Loads remain linearizable unless their consistency is
+// overridden, as followers confirm their read index with the leader.
+func WithLoadsOnAnyMember() ClusterClientOption {
+	return func(cc *ClusterClient) {
+		cc.loadsOnAnyMember = true
+	}
+}
+
+// NewClusterClient connects to the given seed node and discovers all
+// the members of its cluster along with the leader, failing if that
+// cannot be done within Timeout.
+func NewClusterClient(seedAddr string, opts ...ClusterClientOption) (*ClusterClient, error) {
+	return NewLeaderAwareClient([]string{seedAddr}, opts...)
+}
+
+// NewLeaderAwareClient is similar to NewClusterClient except that the
+// cluster is discovered from any of the given seed nodes, so that the
+// client can be created even if some of them are down. Members are
+// connected to at the service addresses they advertise, else by default
+// at the service port of the first seed.
+func NewLeaderAwareClient(seedAddrs []string, opts ...ClusterClientOption) (*ClusterClient, error) {
+	if len(seedAddrs) == 0 {
+		return nil, errors.New("at least one seed address must be given")
+	}
+	for _, seedAddr := range seedAddrs {
+		if _, _, err := net.SplitHostPort(seedAddr); err != nil {
+			return nil, err
+		}
+	}
+	_, seedPort, _ := net.SplitHostPort(seedAddrs[0])
+	cc := &ClusterClient{
+		seedAddrs:       seedAddrs,
+		svcAddrFunc:     func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, seedPort) },
+		refreshInterval: defaultTopologyRefreshInterval,
+		members:         make(map[uint64]string),
+		svcAddrs:        make(map[uint64]string),
+		clients:         make(map[string]*NexusClient),
+		creds:           ggrpc.WithInsecure(),
+		stopc:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(cc)
+	}
+	if err := cc.Refresh(); err != nil {
+		cc.Close()
+		return nil, err
+	}
+	cc.wg.Add(1)
+	go cc.refreshPeriodically()
+	return cc, nil
+}
+
+func sameServicePort(nodeUrl, port string) (string, error) {
+	if u, err := url.Parse(nodeUrl); err != nil {
+		return "", err
+	} else {
+		return net.JoinHostPort(u.Hostname(), port), nil
+	}
+}
+
+// Leader returns the ID of the current leader, 0 if there is none.
+func (this *ClusterClient) Leader() uint64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.leader
+}
+
+// Members returns the RAFT URLs of all the members of the cluster.
+func (this *ClusterClient) Members() map[uint64]string {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	members := make(map[uint64]string, len(this.members))
+	for id, nodeUrl := range this.members {
+		members[id] = nodeUrl
+	}
+	return members
+}
+
+// Refresh lists the nodes of the cluster and updates the members and
+// the leader known to this client. The leader is asked first, falling
+// back to the other members and finally the seed nodes. Connections to
+// the nodes that are no longer members are closed.
+func (this *ClusterClient) Refresh() error {
+	var lastErr error
+	for _, svcAddr := range this.candidateAddrs() {
+		nc, err := this.client(svcAddr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		leader, nodes, _, err := nc.ListNodesAuthoritative()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		this.mu.Lock()
+		this.leader, this.members, this.svcAddrs = leader, memberUrls(nodes), memberServiceAddrs(nodes)
+		departed := this.removeDepartedClients()
+		this.mu.Unlock()
+		for _, nc := range departed {
+			nc.Close()
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to discover the cluster, error: %v", lastErr)
+}
+
+// removeDepartedClients removes and returns the clients of the nodes
+// that are neither members nor seeds. It must be invoked with mu held.
+func (this *ClusterClient) removeDepartedClients() []*NexusClient {
+	known := make(map[string]bool, len(this.members)+len(this.seedAddrs))
+	for id := range this.members {
+		if svcAddr, err := this.memberAddr(id); err == nil {
+			known[svcAddr] = true
+		}
+	}
+	for _, seedAddr := range this.seedAddrs {
+		known[seedAddr] = true
+	}
+	var departed []*NexusClient
+	for svcAddr, nc := range this.clients {
+		if !known[svcAddr] {
+			departed = append(departed, nc)
+			delete(this.clients, svcAddr)
+		}
+	}
+	return departed
+}
+
+// candidateAddrs returns the addresses of the nodes to be asked for the
+// topology of the cluster, in the order of preference.
+func (this *ClusterClient) candidateAddrs() []string {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	var addrs []string
+	if svcAddr, err := this.memberAddr(this.leader); err == nil {
+		addrs = append(addrs, svcAddr)
+	}
+	for id := range this.members {
+		if id == this.leader {
+			continue
+		}
+		if svcAddr, err := this.memberAddr(id); err == nil {
+			addrs = append(addrs, svcAddr)
+		}
+	}
+	return append(addrs, this.seedAddrs...)
+}
+
+// memberAddrs returns the addresses of all the members, starting from
+// a different one on every call so as to spread the requests.
+func (this *ClusterClient) memberAddrs() []string {
+	this.mu.RLock()
+	var addrs []string
+	for id := range this.members {
+		if svcAddr, err := this.memberAddr(id); err == nil {
+			addrs = append(addrs, svcAddr)
+		}
+	}
+	this.mu.RUnlock()
+	if len(addrs) == 0 {
+		return nil
+	}
+	sort.Strings(addrs)
+	start := int(atomic.AddUint32(&this.nextMember, 1) % uint32(len(addrs)))
+	return append(addrs[start:], addrs[:start]...)
+}
+
+// memberAddr returns the service address of the member with the given
+// ID, which is the one it advertises, if any. It must be invoked with
+// mu held.
+func (this *ClusterClient) memberAddr(id uint64) (string, error) {
+	if svcAddr, present := this.svcAddrs[id]; present {
+		return svcAddr, nil
+	}
+	nodeUrl, present := this.members[id]
+	if !present {
+		return "", fmt.Errorf("unknown member: %x", id)
+	}
+	return this.svcAddrFunc(nodeUrl)
+}
+
+func (this *ClusterClient) refreshPeriodically() {
+	defer this.wg.Done()
+	ticker := time.NewTicker(this.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stopc:
+			return
+		case <-ticker.C:
+			if err := this.Refresh(); err != nil {
+				log.Printf("[WARN] Unable to refresh the topology of the cluster. Error: %v", err)
+			}
+		}
+	}
+}
+
+// client returns the client of the node at the given address,
+// connecting to it if not done already.
+func (this *ClusterClient) client(svcAddr string) (*NexusClient, error) {
+	this.mu.RLock()
+	nc, present := this.clients[svcAddr]
+	this.mu.RUnlock()
+	if present {
+		return nc, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	// Saves must not be forwarded by a former leader, so that they
+	// are retried on the new leader as is done for the other requests
+	opts := append([]ClientOption{withLeaderRequired()}, this.clientOpts...)
+	nc, err := dialNexusClient(ctx, svcAddr, this.creds, opts...)
+	if err != nil {
+		return nil, err
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if existing, present := this.clients[svcAddr]; present {
+		nc.Close()
+		return existing, nil
+	}
+	this.clients[svcAddr] = nc
+	return nc, nil
+}
+
+// LeaderClient returns the client of the current leader.
+func (this *ClusterClient) LeaderClient() (*NexusClient, error) {
+	this.mu.RLock()
+	_, present := this.members[this.leader]
+	svcAddr, err := this.memberAddr(this.leader)
+	this.mu.RUnlock()
+	if !present {
+		return nil, errors.New("no leader in the cluster currently")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return this.client(svcAddr)
+}
+
+// Save saves the given data via the current leader. If the leadership
+// has changed in the meantime, the topology is refreshed and the Save
+// is retried once on the new leader. Saves failing as the leader is
+// unavailable are not retried, since they may have been committed.
+func (this *ClusterClient) Save(data []byte, params map[string][]byte) ([]byte, error) {
+	var res []byte
+	err := this.onLeader(func(nc *NexusClient) *status.Status {
+		var st *status.Status
+		res, st = nc.SaveWithStatus(data, params)
+		return st
+	}, false)
+	return res, err
+}
+
+// Load loads the given data via the current leader, retrying once on
+// the new leader similar to Save. If configured with
+// WithLoadsOnAnyMember, it is instead made on any member.
+func (this *ClusterClient) Load(data []byte, params map[string][]byte) ([]byte, error) {
+	var res []byte
+	load := func(nc *NexusClient) *status.Status {
+		var st *status.Status
+		res, st = nc.LoadWithStatus(data, params)
+		return st
+	}
+	if this.loadsOnAnyMember {
+		return res, this.onAnyMember(load)
+	}
+	return res, this.onLeader(load, true)
+}
+
+// AddNode adds the node at the given URL as a member via the current
+// leader, retrying once on the new leader similar to Save.
+func (this *ClusterClient) AddNode(nodeUrl string) error {
+	return this.onLeader(func(nc *NexusClient) *status.Status {
+		return status.Convert(nc.AddNode(nodeUrl))
+	}, true)
+}
+
+// RemoveNode removes the member at the given URL via the current
+// leader, retrying once on the new leader similar to Save.
+func (this *ClusterClient) RemoveNode(nodeUrl string) error {
+	return this.onLeader(func(nc *NexusClient) *status.Status {
+		return status.Convert(nc.RemoveNode(nodeUrl))
+	}, true)
+}
+
+// onAnyMember makes the given request on the members in turn, till one
+// of them is available to serve it.
+func (this *ClusterClient) onAnyMember(req func(*NexusClient) *status.Status) error {
+	lastErr := errors.New("no members in the cluster currently")
+	for _, svcAddr := range this.memberAddrs() {
+		nc, err := this.client(svcAddr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		st := req(nc)
+		if st.Code() != codes.Unavailable {
+			return st.Err()
+		}
+		lastErr = st.Err()
+	}
+	return lastErr
+}
+
+// onLeader makes the given request on the current leader. It is
+// retried once on the new leader if the request failed as the node is
+// not the leader, or if it is unavailable and retryUnavailable is set.
+func (this *ClusterClient) onLeader(req func(*NexusClient) *status.Status, retryUnavailable bool) error {
+	nc, err := this.LeaderClient()
+	if err == nil {
+		st := req(nc)
+		if code := st.Code(); code != codes.FailedPrecondition && (code != codes.Unavailable || !retryUnavailable) {
+			return st.Err()
+		}
+	}
+	if err := this.Refresh(); err != nil {
+		return err
+	}
+	if nc, err = this.LeaderClient(); err != nil {
+		return err
+	}
+	return req(nc).Err()
+}
+
+// NodeLoad is the outcome of loading from the store of a single member.
+type NodeLoad struct {
+	NodeId       uint64
+	Res          []byte
+	AppliedIndex uint64
+	Err          error
+}
+
+// QuorumLoadError is returned by QuorumLoad when a quorum of the members
+// does not agree on the loaded value, along with the outcome on each.
+type QuorumLoadError struct {
+	Loads []NodeLoad
+}
+
+func (this *QuorumLoadError) Error() string {
+	return fmt.Sprintf("no quorum of members agree on the loaded value, loads: %v", this.Loads)
+}
+
+// Diverged reports whether any two members returned different values
+// at the same applied index, which indicates that their stores have
+// silently diverged. Otherwise the disagreement may be due to members
+// applying further entries while being read from.
+func (this *QuorumLoadError) Diverged() bool {
+	for i, a := range this.Loads {
+		for _, b := range this.Loads[i+1:] {
+			if a.Err == nil && b.Err == nil && a.AppliedIndex == b.AppliedIndex && !bytes.Equal(a.Res, b.Res) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// QuorumLoad loads the given data from the local stores of all the
+// members, after each has applied the entries committed at the time of
+// the call, and returns the value only if a quorum of them agree on it.
+// Otherwise it fails with a QuorumLoadError. This is meant for verifying
+// the consistency of the stores, as it costs a Load on every member.
+func (this *ClusterClient) QuorumLoad(data []byte, params map[string][]byte) ([]byte, error) {
+	leader, err := this.LeaderClient()
+	if err != nil {
+		return nil, err
+	}
+	freshness, err := leader.Freshness()
+	if err != nil {
+		return nil, err
+	}
+	this.mu.RLock()
+	ids := make([]uint64, 0, len(this.members))
+	for id := range this.members {
+		ids = append(ids, id)
+	}
+	this.mu.RUnlock()
+	loads := make(chan NodeLoad, len(ids))
+	for _, id := range ids {
+		go func(id uint64) {
+			load := NodeLoad{NodeId: id}
+			this.mu.RLock()
+			svcAddr, err := this.memberAddr(id)
+			this.mu.RUnlock()
+			if err != nil {
+				load.Err = err
+			} else if nc, err := this.client(svcAddr); err != nil {
+				load.Err = err
+			} else {
+				var nodeFreshness raft.Freshness
+				load.Res, nodeFreshness, load.Err = nc.localLoad(data, params, freshness.CommittedIndex)
+				load.AppliedIndex = nodeFreshness.AppliedIndex
+			}
+			loads <- load
+		}(id)
+	}
+	var nodeLoads []NodeLoad
+	for range ids {
+		nodeLoads = append(nodeLoads, <-loads)
+	}
+	sort.Slice(nodeLoads, func(i, j int) bool { return nodeLoads[i].NodeId < nodeLoads[j].NodeId })
+
+	quorum := len(ids)/2 + 1
+	for _, load := range nodeLoads {
+		if load.Err != nil {
+			continue
+		}
+		agreed := 0
+		for _, other := range nodeLoads {
+			if other.Err == nil && bytes.Equal(load.Res, other.Res) {
+				agreed++
+			}
+		}
+		if agreed >= quorum {
+			return load.Res, nil
+		}
+	}
+	return nil, &QuorumLoadError{Loads: nodeLoads}
+}
+
+// Close stops tracking the topology and closes the clients of all the
+// nodes. It may be invoked more than once.
+func (this *ClusterClient) Close() error {
+	this.closeOnce.Do(func() { close(this.stopc) })
+	this.wg.Wait()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var lastErr error
+	for svcAddr, nc := range this.clients {
+		if err := nc.Close(); err != nil {
+			lastErr = err
+		}
+		delete(this.clients, svcAddr)
+	}
+	return lastErr
+}
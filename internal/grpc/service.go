@@ -2,22 +2,166 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/flipkart-incubator/nexus/models"
 	"github.com/flipkart-incubator/nexus/pkg/api"
+	"github.com/flipkart-incubator/nexus/pkg/raft"
 	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // for decompressing requests
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// ReadConsistencyHeader is the gRPC metadata key using which callers
+// can override the consistency of an individual Load. Supported values
+// are "linearizable" (default), "stale" and "leader-only". It takes
+// precedence over the consistency set on the LoadRequest.
+const ReadConsistencyHeader = "nexus-read-consistency"
+
+// PriorityHeader is the gRPC metadata key using which callers can set
+// the priority of an individual Save. Supported values are "high",
+// "normal" (default) and "bulk". Priorities only affect the order in
+// which Saves are admitted for proposing on the receiving node, and
+// not their order in the RAFT log.
+const PriorityHeader = "nexus-save-priority"
+
+// AckLevelHeader is the gRPC metadata key using which callers can set
+// the point at which an individual Save is acknowledged. Supported
+// values are "applied-local" (default), "committed" and "quorum-confirmed".
+// See raft.AckLevel for the tradeoffs of each level.
+const AckLevelHeader = "nexus-save-ack-level"
+
+// RedirectHeader is the gRPC trailer key carrying the RAFT URLs of the
+// healthy peers to which Loads must be redirected, when refused by a
+// node that is draining. Clients must map these URLs to the service
+// addresses of the peers that are not found in RedirectAddrsHeader,
+// as LoadOrRedirect does.
+const RedirectHeader = "nexus-redirect-to"
+
+// RedirectAddrsHeader is the gRPC trailer key carrying the service
+// addresses of the peers in RedirectHeader, in the same order. It is
+// blank for the peers that do not advertise their service address.
+const RedirectAddrsHeader = "nexus-redirect-addrs"
+
+// RetryAfterHeader is the gRPC trailer key carrying the number of
+// milliseconds after which a Save rejected with ResourceExhausted, as
+// the node is shedding load, may be retried.
+const RetryAfterHeader = "nexus-retry-after-ms"
+
+// LeaderHeader is the gRPC trailer key carrying the RAFT URL of the
+// leader, when a Save fails on a node other than the leader. Similar to
+// RedirectHeader, clients must map this URL to a service address, if
+// LeaderAddrHeader is not set.
+const LeaderHeader = "nexus-leader-url"
+
+// LeaderAddrHeader is the gRPC trailer key carrying the service address
+// of the leader along with LeaderHeader, if the leader advertises it.
+const LeaderAddrHeader = "nexus-leader-addr"
+
+// LeaderRequiredHeader is the gRPC metadata key, which when set on a
+// Save, makes a node other than the leader reject it with ErrNotLeader
+// and the LeaderHeader trailer, instead of forwarding it to the leader.
+// See raft.WithLeaderRequired.
+const LeaderRequiredHeader = "nexus-leader-required"
+
+// ErrDraining is returned for Loads made on a node that is draining.
+var ErrDraining = errors.New("node is draining, retry on another replica")
+
+// ErrTooManyRequests is returned for Saves and Loads rejected by a node
+// having too many of them in flight, as configured via
+// WithAdmissionControl. It is the same as raft.ErrTooManyRequests.
+var ErrTooManyRequests = raft.ErrTooManyRequests
+
+// Services accepted by Check, to distinguish the liveness of a node
+// from its readiness to serve traffic.
+const (
+	LivenessService  = "liveness"
+	ReadinessService = "readiness"
+)
+
+// defaultMaxReadyApplyLag is the number of committed entries the store
+// may be yet to apply, for a node to still be considered ready, unless
+// set using WithMaxReadyApplyLag.
+const defaultMaxReadyApplyLag = 1000
+
 type NexusService struct {
-	port uint
-	repl api.RaftReplicator
+	port      uint
+	repl      api.RaftReplicator
+	draining  int32
+	codec     encoding.Codec
+	admission *admission
+	maxLag    uint64
+	maxSize   int
+}
+
+type ServiceOption func(*NexusService)
+
+// WithServerCodec makes the service encode and decode all the messages
+// using the given codec instead of protobuf, for optimizing how the
+// Save and Load payloads are serialized. The codec must handle all the
+// request and response messages of the service, and clients must be
+// configured with the same codec using WithCodec.
+func WithServerCodec(codec encoding.Codec) ServiceOption {
+	return func(ns *NexusService) {
+		ns.codec = codec
+	}
 }
 
-func NewNexusService(port uint, repl api.RaftReplicator) *NexusService {
-	return &NexusService{port, repl}
+// WithAdmissionControl makes the service reject Saves and Loads with
+// ResourceExhausted, before they reach the replicator, once the number
+// of them being served reaches the given high watermark. Requests are
+// admitted again only after that number drops to the low watermark.
+// Health checks and administrative RPCs are never rejected. The option
+// is ignored unless the high watermark is positive and the low one is
+// not negative, since requests would never be admitted again otherwise.
+func WithAdmissionControl(highWatermark, lowWatermark int) ServiceOption {
+	return func(ns *NexusService) {
+		if highWatermark > 0 && lowWatermark >= 0 {
+			ns.admission = newAdmission(highWatermark, lowWatermark)
+		}
+	}
+}
+
+// WithMaxReadyApplyLag sets the number of committed entries the store
+// may be yet to apply, beyond which this node is reported as not ready.
+func WithMaxReadyApplyLag(maxLag uint64) ServiceOption {
+	return func(ns *NexusService) {
+		ns.maxLag = maxLag
+	}
+}
+
+// WithMaxSaveSize makes SaveStream reject a Save with
+// raft.ErrProposalTooLarge as soon as the chunks received for it exceed
+// the given size in bytes, instead of buffering all of them only for
+// the replicator to reject it. It must be set to the same size as
+// raft.MaxProposalSize. A size of 0 is unlimited.
+func WithMaxSaveSize(size int) ServiceOption {
+	return func(ns *NexusService) {
+		ns.maxSize = size
+	}
+}
+
+func NewNexusService(port uint, repl api.RaftReplicator, opts ...ServiceOption) *NexusService {
+	ns := &NexusService{port: port, repl: repl, maxLag: defaultMaxReadyApplyLag}
+	for _, opt := range opts {
+		opt(ns)
+	}
+	return ns
 }
 
 func (this *NexusService) ListenAndServe() {
@@ -26,7 +170,15 @@ func (this *NexusService) ListenAndServe() {
 }
 
 func (this *NexusService) NewGRPCServer() *ggrpc.Server {
-	grpcServer := ggrpc.NewServer()
+	var srvOpts []ggrpc.ServerOption
+	if this.codec != nil {
+		srvOpts = append(srvOpts, ggrpc.CustomCodec(serverCodec{this.codec}))
+	}
+	if this.admission != nil {
+		srvOpts = append(srvOpts, ggrpc.UnaryInterceptor(this.admission.unaryInterceptor),
+			ggrpc.StreamInterceptor(this.admission.streamInterceptor))
+	}
+	grpcServer := ggrpc.NewServer(srvOpts...)
 	api.RegisterNexusServer(grpcServer, this)
 	return grpcServer
 }
@@ -41,53 +193,593 @@ func (this *NexusService) NewListener() net.Listener {
 }
 
 func (this *NexusService) Close() error {
-	this.repl.Stop()
-	return nil
+	return this.repl.Stop()
 }
 
+// Check reports the liveness of this node by default, which only
+// requires its RAFT event loop to be running. When the service in the
+// request is ReadinessService, it instead reports whether this node is
+// ready to serve traffic, which requires a leader reachable over the
+// transport and the store to have applied nearly all the committed
+// entries. Either way, the response carries the lag of the store and
+// whether a leader is known.
 func (this *NexusService) Check(ctx context.Context, req *api.HealthCheckRequest) (*api.HealthCheckResponse, error) {
-	return &api.HealthCheckResponse{Status: api.HealthCheckResponse_SERVING}, nil
+	health := this.repl.Health()
+	res := &api.HealthCheckResponse{LeaderKnown: health.Leader != 0, Connected: health.Connected}
+	if health.CommitIndex > health.AppliedIndex {
+		res.Lag = health.CommitIndex - health.AppliedIndex
+	}
+	serving := health.Alive
+	switch req.Service {
+	case "", LivenessService:
+	case ReadinessService:
+		serving = serving && !health.Shadow && res.LeaderKnown && res.Connected && res.Lag <= this.maxLag
+	default:
+		return &api.HealthCheckResponse{Status: api.HealthCheckResponse_UNKNOWN}, status.Errorf(codes.NotFound, "unknown service: %s", req.Service)
+	}
+	if serving {
+		res.Status = api.HealthCheckResponse_SERVING
+	} else {
+		res.Status = api.HealthCheckResponse_NOT_SERVING
+	}
+	return res, nil
 }
 
 func (this *NexusService) Save(ctx context.Context, req *api.SaveRequest) (*api.SaveResponse, error) {
 	if replReq, err := req.Encode(); err != nil {
 		return nil, err
 	} else {
+		if ctx, err = withPriority(ctx); err != nil {
+			return &api.SaveResponse{Status: &api.Status{Code: int32(codes.InvalidArgument), Message: err.Error()}, ReqData: req.Data}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if ctx, err = withAckLevel(ctx); err != nil {
+			return &api.SaveResponse{Status: &api.Status{Code: int32(codes.InvalidArgument), Message: err.Error()}, ReqData: req.Data}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		ctx = withLeaderRequired(ctx)
+		trace := &raft.RequestTrace{CorrelationId: req.CorrelationId, IdempotencyKey: req.IdempotencyKey}
+		ctx = raft.WithRequestTrace(ctx, trace)
 		if res, err := this.repl.Save(ctx, replReq); err != nil {
-			return &api.SaveResponse{Status: &api.Status{Code: -1, Message: err.Error()}, ReqData: req.Data}, err
+			setRetryAfter(ctx, err)
+			if leader := this.leaderNode(); leader != nil {
+				ggrpc.SetTrailer(ctx, leaderTrailer(leader))
+			}
+			return &api.SaveResponse{Status: errorStatus(err), ReqData: req.Data,
+				RequestId: trace.RequestId, CorrelationId: trace.CorrelationId}, statusError(err)
 		} else {
-			return &api.SaveResponse{Status: &api.Status{}, ReqData: req.Data, ResData: res}, nil
+			return &api.SaveResponse{Status: &api.Status{}, ReqData: req.Data, ResData: res,
+				RequestId: trace.RequestId, CorrelationId: trace.CorrelationId, Index: trace.AppliedIndex}, nil
+		}
+	}
+}
+
+// SaveStream reassembles the chunks streamed by the client into a
+// single SaveRequest and replicates it as one proposal. Data of all the
+// chunks is concatenated in order while their args are merged. Receiving
+// is abandoned once the chunks exceed the size set via WithMaxSaveSize.
+func (this *NexusService) SaveStream(stream api.Nexus_SaveStreamServer) error {
+	req := &api.SaveRequest{Args: make(map[string][]byte)}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if this.maxSize > 0 && len(req.Data)+len(chunk.Data) > this.maxSize {
+			return statusError(fmt.Errorf("%w: streamed chunks exceed %d bytes", raft.ErrProposalTooLarge, this.maxSize))
+		}
+		req.Data = append(req.Data, chunk.Data...)
+		if chunk.CorrelationId != "" {
+			req.CorrelationId = chunk.CorrelationId
 		}
+		if chunk.IdempotencyKey != "" {
+			req.IdempotencyKey = chunk.IdempotencyKey
+		}
+		for k, v := range chunk.Args {
+			req.Args[k] = v
+		}
+	}
+	res, err := this.Save(stream.Context(), req)
+	if res == nil {
+		return err
 	}
+	// avoid echoing back the entire payload
+	res.ReqData = nil
+	if sendErr := stream.SendAndClose(res); sendErr != nil {
+		return sendErr
+	}
+	return err
 }
 
 func (this *NexusService) Load(ctx context.Context, req *api.LoadRequest) (*api.LoadResponse, error) {
 	if replReq, err := req.Encode(); err != nil {
 		return nil, err
 	} else {
+		freshness := new(raft.Freshness)
+		if ctx, err = this.loadContext(ctx, req, freshness); err != nil {
+			return &api.LoadResponse{Status: errorStatus(err), ReqData: req.Data}, err
+		}
 		if res, err := this.repl.Load(ctx, replReq); err != nil {
-			return &api.LoadResponse{Status: &api.Status{Code: -1, Message: err.Error()}, ReqData: req.Data}, err
+			if errors.Is(err, raft.ErrRecovering) {
+				this.redirectLoad(ctx)
+			}
+			return &api.LoadResponse{Status: errorStatus(err), ReqData: req.Data}, statusError(err)
 		} else {
-			return &api.LoadResponse{Status: &api.Status{}, ReqData: req.Data, ResData: res}, nil
+			return &api.LoadResponse{Status: &api.Status{}, ReqData: req.Data, ResData: res,
+				CommittedIndex: freshness.CommittedIndex, AppliedIndex: freshness.AppliedIndex}, nil
 		}
 	}
 }
 
+// LoadStreamChunkSize is the maximum size of the response data sent in
+// a single frame of LoadStream, kept well under the default gRPC limit.
+const LoadStreamChunkSize = 1 << 20
+
+// LoadStream is similar to Load except that the response data is sent
+// in frames of at most LoadStreamChunkSize bytes, for reads too large
+// for a single message. All the frames belong to the same read, whose
+// freshness is carried by the first frame.
+func (this *NexusService) LoadStream(req *api.LoadRequest, stream api.Nexus_LoadStreamServer) error {
+	replReq, err := req.Encode()
+	if err != nil {
+		return err
+	}
+	freshness := new(raft.Freshness)
+	ctx, err := this.loadContext(stream.Context(), req, freshness)
+	if err != nil {
+		return err
+	}
+	first := true
+	err = this.repl.LoadStream(ctx, replReq, LoadStreamChunkSize, func(chunk []byte) error {
+		res := &api.LoadResponse{Status: &api.Status{}, ResData: chunk}
+		if first {
+			res.CommittedIndex, res.AppliedIndex = freshness.CommittedIndex, freshness.AppliedIndex
+			first = false
+		}
+		return stream.Send(res)
+	})
+	if err != nil {
+		return statusError(err)
+	}
+	return nil
+}
+
+// loadContext prepares the context of the given Load as per its request
+// and headers, returning a gRPC status error if it cannot be served.
+func (this *NexusService) loadContext(ctx context.Context, req *api.LoadRequest, freshness *raft.Freshness) (context.Context, error) {
+	if atomic.LoadInt32(&this.draining) == 1 {
+		this.redirectLoad(ctx)
+		return ctx, status.Error(codes.Unavailable, ErrDraining.Error())
+	}
+	if req.Consistency != api.LoadRequest_LINEARIZABLE {
+		ctx = raft.WithReadConsistency(ctx, raft.ReadConsistency(req.Consistency))
+	}
+	ctx, err := withReadConsistency(ctx)
+	if err != nil {
+		return ctx, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.MinIndex > 0 {
+		ctx = raft.WithMinIndex(ctx, req.MinIndex)
+	}
+	return raft.WithFreshness(ctx, freshness), nil
+}
+
+// Drain puts this node into, or takes it out of, drain mode. While
+// draining, Loads are refused with the addresses of other replicas to
+// redirect them to, for cleanly draining connections prior to Stop.
+func (this *NexusService) Drain(ctx context.Context, req *api.DrainRequest) (*api.Status, error) {
+	var draining int32
+	if req.Draining {
+		draining = 1
+	}
+	if atomic.SwapInt32(&this.draining, draining) != draining {
+		log.Printf("[Node %x] Draining: %t", this.repl.Id(), req.Draining)
+	}
+	return &api.Status{}, nil
+}
+
+// ListInflightOps lists the operations waiting to be served on this
+// node, oldest first, for finding out what is stuck during incidents.
+func (this *NexusService) ListInflightOps(_ context.Context, _ *empty.Empty) (*api.InflightOpsResponse, error) {
+	res := &api.InflightOpsResponse{Status: &api.Status{}}
+	for _, op := range this.repl.InflightOps() {
+		inflightOp := &api.InflightOp{Id: op.Id, Type: string(op.Type), AgeMillis: int64(op.Age / time.Millisecond)}
+		if !op.Deadline.IsZero() {
+			inflightOp.DeadlineUnixMillis = op.Deadline.UnixNano() / int64(time.Millisecond)
+		}
+		res.Ops = append(res.Ops, inflightOp)
+	}
+	return res, nil
+}
+
+// ClusterStatus returns the RAFT term, commit index, applied index
+// and leader as known to this node, for diagnosing lagging nodes and
+// split brains by comparing them across the cluster.
+func (this *NexusService) ClusterStatus(_ context.Context, _ *empty.Empty) (*api.ClusterStatusResponse, error) {
+	status := this.repl.Status()
+	return &api.ClusterStatusResponse{
+		Status:       &api.Status{},
+		NodeId:       this.repl.Id(),
+		Term:         status.Term,
+		CommitIndex:  status.CommitIndex,
+		AppliedIndex: status.AppliedIndex,
+		Leader:       status.Leader,
+		Writable:     status.Writable,
+		Readable:     status.Readable,
+	}, nil
+}
+
+// redirectLoad sets the URLs of the healthy peers, other than this
+// node, as the trailer of the response to the Load being served, along
+// with the service addresses they advertise.
+func (this *NexusService) redirectLoad(ctx context.Context) {
+	_, members := this.clientMembers()
+	var peers []*models.NodeInfo
+	for id, member := range members {
+		healthy := member.Status == models.NodeInfo_LEADER || member.Status == models.NodeInfo_FOLLOWER
+		if id != this.repl.Id() && healthy {
+			peers = append(peers, member)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].NodeUrl < peers[j].NodeUrl })
+	urls, svcAddrs := make([]string, len(peers)), make([]string, len(peers))
+	advertised := false
+	for i, peer := range peers {
+		urls[i], svcAddrs[i] = peer.NodeUrl, peer.ServiceAddr
+		advertised = advertised || peer.ServiceAddr != ""
+	}
+	trailer := metadata.Pairs(RedirectHeader, strings.Join(urls, ","))
+	if advertised {
+		trailer.Set(RedirectAddrsHeader, strings.Join(svcAddrs, ","))
+	}
+	ggrpc.SetTrailer(ctx, trailer)
+}
+
+// leaderNode returns the current leader, if known and if it is not
+// this node.
+func (this *NexusService) leaderNode() *models.NodeInfo {
+	ldr := this.repl.Health().Leader
+	if ldr == 0 || ldr == this.repl.Id() {
+		return nil
+	}
+	_, members := this.repl.ListMembers()
+	return members[ldr]
+}
+
+// leaderTrailer returns the trailer hinting the given leader to the
+// client of a failed Save.
+func leaderTrailer(leader *models.NodeInfo) metadata.MD {
+	trailer := metadata.Pairs(LeaderHeader, leader.NodeUrl)
+	if leader.ServiceAddr != "" {
+		trailer.Set(LeaderAddrHeader, leader.ServiceAddr)
+	}
+	return trailer
+}
+
+// statusError converts the given error into a gRPC status error whose
+// code lets clients decide whether and where to retry.
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		code = codes.FailedPrecondition
+	case errors.Is(err, raft.ErrNoLeader), errors.Is(err, raft.ErrApplyLagging), errors.Is(err, raft.ErrConfChangeInProgress), errors.Is(err, raft.ErrNoQuorum),
+		errors.Is(err, raft.ErrRestoreFailed), errors.Is(err, raft.ErrRecovering), errors.Is(err, raft.ErrShadowMember),
+		errors.Is(err, raft.ErrLeaderChanged), errors.Is(err, raft.ErrNodeRemoved), errors.Is(err, raft.ErrShuttingDown):
+		code = codes.Unavailable
+	case errors.Is(err, raft.ErrProposalTooLarge), errors.Is(err, raft.ErrProposalDropped), errors.Is(err, raft.ErrOverloaded),
+		errors.Is(err, raft.ErrTooManyRequests):
+		code = codes.ResourceExhausted
+	case errors.Is(err, raft.ErrCompacted):
+		code = codes.OutOfRange
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	st := status.New(code, err.Error())
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			if withInfo, e := st.WithDetails(&errdetails.ErrorInfo{Reason: known.reason, Domain: errorDomain}); e == nil {
+				st = withInfo
+			}
+			break
+		}
+	}
+	return st.Err()
+}
+
+// errorStatus returns the status to be set in the response of a request
+// failing with the given error, with the same gRPC code as the error
+// returned for it by statusError.
+func errorStatus(err error) *api.Status {
+	st := status.Convert(statusError(err))
+	return &api.Status{Code: int32(st.Code()), Message: st.Message()}
+}
+
+// setRetryAfter sets the time after which the Save being served may be
+// retried as the trailer of its response, if it failed as the node is
+// shedding load.
+func setRetryAfter(ctx context.Context, err error) {
+	var overloaded *raft.OverloadedError
+	if errors.As(err, &overloaded) {
+		retryAfterMs := int64(overloaded.RetryAfter / time.Millisecond)
+		ggrpc.SetTrailer(ctx, metadata.Pairs(RetryAfterHeader, strconv.FormatInt(retryAfterMs, 10)))
+	}
+}
+
+func withReadConsistency(ctx context.Context) (context.Context, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(ReadConsistencyHeader); len(vals) > 0 {
+			rc, err := raft.ParseReadConsistency(vals[0])
+			if err != nil {
+				return ctx, err
+			}
+			return raft.WithReadConsistency(ctx, rc), nil
+		}
+	}
+	return ctx, nil
+}
+
+func withPriority(ctx context.Context) (context.Context, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(PriorityHeader); len(vals) > 0 {
+			p, err := raft.ParsePriority(vals[0])
+			if err != nil {
+				return ctx, err
+			}
+			return raft.WithPriority(ctx, p), nil
+		}
+	}
+	return ctx, nil
+}
+
+func withAckLevel(ctx context.Context) (context.Context, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(AckLevelHeader); len(vals) > 0 {
+			al, err := raft.ParseAckLevel(vals[0])
+			if err != nil {
+				return ctx, err
+			}
+			return raft.WithAckLevel(ctx, al), nil
+		}
+	}
+	return ctx, nil
+}
+
+func withLeaderRequired(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(LeaderRequiredHeader)) > 0 {
+		return raft.WithLeaderRequired(ctx)
+	}
+	return ctx
+}
+
+// AddNode adds the node at the given URL to the cluster. With dryRun,
+// the node is only validated and checked to be reachable, and the
+// returned status indicates whether the addition would succeed.
 func (this *NexusService) AddNode(ctx context.Context, req *api.AddNodeRequest) (*api.Status, error) {
-	if err := this.repl.AddMember(ctx, req.NodeUrl); err != nil {
-		return &api.Status{Code: -1, Message: err.Error()}, err
+	if req.DryRun {
+		ctx = raft.WithDryRun(ctx)
+	}
+	addMember := this.repl.AddMember
+	if req.Shadow {
+		addMember = this.repl.AddShadow
+	} else if req.Learner {
+		addMember = this.repl.AddLearner
+	}
+	if err := addMember(ctx, req.NodeUrl); err != nil {
+		return errorStatus(err), statusError(err)
 	}
 	return &api.Status{}, nil
 }
 
+func (this *NexusService) PromoteNode(ctx context.Context, req *api.PromoteNodeRequest) (*api.Status, error) {
+	if err := this.repl.PromoteLearner(ctx, req.NodeId); err != nil {
+		return errorStatus(err), statusError(err)
+	}
+	return &api.Status{}, nil
+}
+
+// RemoveNode removes the node at the given URL from the cluster. With
+// dryRun, the returned status only indicates whether the removal would
+// succeed.
 func (this *NexusService) RemoveNode(ctx context.Context, req *api.RemoveNodeRequest) (*api.Status, error) {
+	if req.DryRun {
+		ctx = raft.WithDryRun(ctx)
+	}
 	if err := this.repl.RemoveMember(ctx, req.NodeUrl); err != nil {
-		return &api.Status{Code: -1, Message: err.Error()}, err
+		return errorStatus(err), statusError(err)
+	}
+	return &api.Status{}, nil
+}
+
+func (this *NexusService) ReplaceNode(ctx context.Context, req *api.ReplaceNodeRequest) (*api.Status, error) {
+	if err := this.repl.ReplaceMember(ctx, req.OldNodeId, req.NodeUrl); err != nil {
+		return errorStatus(err), statusError(err)
+	}
+	return &api.Status{}, nil
+}
+
+// TransferLeadership hands over the leadership of the cluster to the
+// given voter, waiting till it becomes the leader or the request expires.
+func (this *NexusService) TransferLeadership(ctx context.Context, req *api.TransferLeadershipRequest) (*api.Status, error) {
+	if err := this.repl.TransferLeadership(ctx, req.NodeId); err != nil {
+		return errorStatus(err), statusError(err)
 	}
 	return &api.Status{}, nil
 }
 
+func (this *NexusService) CompactLog(ctx context.Context, req *api.CompactLogRequest) (*api.Status, error) {
+	if err := this.repl.CompactLog(req.Index); err != nil {
+		return errorStatus(err), statusError(err)
+	}
+	return &api.Status{}, nil
+}
+
+// Snapshot makes this node take a snapshot of its store right away and
+// returns the RAFT index of the snapshot.
+func (this *NexusService) Snapshot(ctx context.Context, _ *empty.Empty) (*api.SnapshotResponse, error) {
+	if index, err := this.repl.Snapshot(ctx); err != nil {
+		return &api.SnapshotResponse{Status: errorStatus(err)}, statusError(err)
+	} else {
+		return &api.SnapshotResponse{Status: &api.Status{}, Index: index}, nil
+	}
+}
+
+// HasApplied reports whether this node has applied all the entries up
+// to the given index, so that clients can route reads to followers that
+// have caught up with their writes.
+func (this *NexusService) HasApplied(ctx context.Context, req *api.HasAppliedRequest) (*api.HasAppliedResponse, error) {
+	appliedIndex := this.repl.AppliedIndex()
+	return &api.HasAppliedResponse{Status: &api.Status{}, Applied: appliedIndex >= req.Index, AppliedIndex: appliedIndex}, nil
+}
+
+// Freshness reports the commit index of the leader along with the
+// applied index of this node, using which clients can determine how
+// stale the data served by this node is.
+func (this *NexusService) Freshness(ctx context.Context, _ *empty.Empty) (*api.FreshnessResponse, error) {
+	if freshness, err := this.repl.Freshness(ctx); err != nil {
+		return &api.FreshnessResponse{Status: errorStatus(err)}, statusError(err)
+	} else {
+		return &api.FreshnessResponse{Status: &api.Status{}, CommittedIndex: freshness.CommittedIndex, AppliedIndex: freshness.AppliedIndex}, nil
+	}
+}
+
+// ListNodes lists the members of the cluster. The status of members is
+// authoritative only when served by the leader, as only the leader
+// tracks the progress of all the members. Elsewhere, it is inferred from
+// the connectivity of this node to the others, which is flagged in the
+// response. Since service addresses of peers are not tracked, requests
+// cannot be forwarded to the leader.
 func (this *NexusService) ListNodes(ctx context.Context, _ *empty.Empty) (*api.ListNodesResponse, error) {
+	ldr, clusNodes := this.clientMembers()
+	return &api.ListNodesResponse{Status: &api.Status{}, Leader: ldr, Nodes: clusNodes, Authoritative: ldr != 0 && ldr == this.repl.Id()}, nil
+}
+
+// clientMembers returns the leader along with the members of the
+// cluster that clients may send requests to, leaving out shadows.
+func (this *NexusService) clientMembers() (uint64, map[uint64]*models.NodeInfo) {
 	ldr, clusNodes := this.repl.ListMembers()
-	return &api.ListNodesResponse{Status: &api.Status{}, Leader: ldr, Nodes: clusNodes}, nil
+	for id, node := range clusNodes {
+		if node.IsShadow {
+			delete(clusNodes, id)
+		}
+	}
+	return ldr, clusNodes
+}
+
+const topologyPollInterval = 500 * time.Millisecond
+
+// WatchTopology streams the members of the cluster along with its
+// leader, first as soon as the stream is opened and then whenever
+// the set of members, the leader or the members that are OFFLINE
+// change.
+func (this *NexusService) WatchTopology(_ *empty.Empty, stream api.Nexus_WatchTopologyServer) error {
+	ticker := time.NewTicker(topologyPollInterval)
+	defer ticker.Stop()
+	var lastLeader uint64
+	var lastMembers map[uint64]string
+	var lastOffline map[uint64]bool
+	for {
+		ldr, clusNodes := this.clientMembers()
+		members, offline := memberUrls(clusNodes), offlineMembers(clusNodes)
+		if lastMembers == nil || ldr != lastLeader || !reflect.DeepEqual(members, lastMembers) || !reflect.DeepEqual(offline, lastOffline) {
+			if err := stream.Send(&api.ListNodesResponse{Status: &api.Status{}, Leader: ldr, Nodes: clusNodes}); err != nil {
+				return err
+			}
+			lastLeader, lastMembers, lastOffline = ldr, members, offline
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+const (
+	commitsPollInterval = 100 * time.Millisecond
+	commitsBatchSize    = 256
+)
+
+// WatchCommits streams the Saves committed and applied on this node,
+// starting from the given index, or from the next entry to be applied
+// if it is 0. Consumers persisting the index of the latest commit they
+// processed can resume from the one following it. If the entries from
+// the given index are compacted away, the stream fails with OutOfRange
+// and the consumer must re-bootstrap from a snapshot.
+func (this *NexusService) WatchCommits(req *api.WatchCommitsRequest, stream api.Nexus_WatchCommitsServer) error {
+	ticker := time.NewTicker(commitsPollInterval)
+	defer ticker.Stop()
+	next := req.FromIndex
+	if next == 0 {
+		next = this.repl.AppliedIndex() + 1
+	}
+	for {
+		commits, nextIndex, err := this.repl.Commits(next, commitsBatchSize)
+		if err != nil {
+			return statusError(err)
+		}
+		for _, commit := range commits {
+			if err := stream.Send(&api.WatchCommitsResponse{Index: commit.Index, Term: commit.Term, Data: commit.Data}); err != nil {
+				return err
+			}
+		}
+		if nextIndex > next {
+			next = nextIndex
+			continue
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func memberUrls(nodes map[uint64]*models.NodeInfo) map[uint64]string {
+	res := make(map[uint64]string, len(nodes))
+	for id, node := range nodes {
+		res[id] = node.NodeUrl
+	}
+	return res
+}
+
+// memberServiceAddrs returns the service addresses advertised by the
+// given members, leaving out the ones that have not advertised any.
+func memberServiceAddrs(nodes map[uint64]*models.NodeInfo) map[uint64]string {
+	res := make(map[uint64]string, len(nodes))
+	for id, node := range nodes {
+		if node.ServiceAddr != "" {
+			res[id] = node.ServiceAddr
+		}
+	}
+	return res
+}
+
+func offlineMembers(nodes map[uint64]*models.NodeInfo) map[uint64]bool {
+	res := make(map[uint64]bool)
+	for id, node := range nodes {
+		if node.Status == models.NodeInfo_OFFLINE {
+			res[id] = true
+		}
+	}
+	return res
+}
+
+// serverCodec adapts an encoding.Codec to the older grpc.Codec, which
+// is what the gRPC server accepts for overriding the default codec.
+type serverCodec struct {
+	encoding.Codec
+}
+
+func (this serverCodec) String() string {
+	return this.Codec.Name()
 }
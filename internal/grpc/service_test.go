@@ -1,15 +1,34 @@
 package grpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/gob"
 	"errors"
 	"fmt"
 	"github.com/flipkart-incubator/nexus/models"
+	"github.com/flipkart-incubator/nexus/pkg/db"
 	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/flipkart-incubator/nexus/pkg/api"
+	"github.com/flipkart-incubator/nexus/pkg/raft"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -35,6 +54,943 @@ func TestNexusService(t *testing.T) {
 			replicate(t, nc, data)
 			assertRepl(t, repl, data)
 		}
+		bulk := bytes.Repeat([]byte("bulk_load_"), 1000)
+		if _, err := nc.SaveInChunks(bulk, nil, 64); err != nil {
+			t.Fatal(err)
+		}
+		assertRepl(t, repl, bulk)
+		checkLoadStream(t, nc, bulk)
+		checkReadYourWrites(t, svcAddr, repl)
+		checkCompression(t, svcAddr, repl)
+		checkCallerContext(t, nc)
+		checkClientCorrelationId(t, nc, repl)
+		checkWatchCommits(t, nc, repl)
+		checkListNodes(t, nc)
+		checkSnapshot(t, nc, repl)
+		checkDialOptions(t, svcAddr)
+		checkDrain(t, nc)
+		checkInflightOps(t, nc)
+		checkClusterStatus(t, nc, repl)
+	}
+}
+
+func checkLoadStream(t *testing.T, nc *NexusClient, data []byte) {
+	hsh, _ := hashCode(data)
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, hsh)
+	rdr, err := nc.LoadStream(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	if res, err := ioutil.ReadAll(rdr); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(res, data) {
+		t.Errorf("Expected %d bytes from LoadStream, Actual: %d bytes", len(data), len(res))
+	}
+}
+
+func checkDialOptions(t *testing.T, svcAddr string) {
+	var calls []string
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *ggrpc.ClientConn, invoker ggrpc.UnaryInvoker, opts ...ggrpc.CallOption) error {
+		calls = append(calls, method)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	nc, err := NewInSecureNexusClient(svcAddr, WithDialOptions(ggrpc.WithUnaryInterceptor(interceptor)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("intercepted"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "/nexus.api.Nexus/Save" {
+		t.Errorf("Expected Save to be intercepted, Actual calls: %v", calls)
+	}
+}
+
+func checkInflightOps(t *testing.T, nc *NexusClient) {
+	if ops, err := nc.ListInflightOps(); err != nil {
+		t.Fatal(err)
+	} else if len(ops) != 1 || ops[0].Type != raft.OpSave || ops[0].Age != time.Second || !ops[0].Deadline.IsZero() {
+		t.Errorf("Unexpected inflight ops: %v", ops)
+	}
+}
+
+func checkClusterStatus(t *testing.T, nc *NexusClient, repl *mockRepl) {
+	expected := &StatusInfo{Term: 1, CommitIndex: repl.saveIndex, AppliedIndex: repl.saveIndex, Leader: 1, Writable: true, Readable: true}
+	if status, err := nc.ClusterStatus(); err != nil {
+		t.Fatal(err)
+	} else if *status != *expected {
+		t.Errorf("Expected status: %+v, Actual: %+v", expected, status)
+	}
+}
+
+func checkDrain(t *testing.T, nc *NexusClient) {
+	if err := nc.Drain(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := nc.LoadOrRedirect(make([]byte, 4), nil); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Load on draining node to fail with code: %s, Actual: %v", codes.Unavailable, err)
+	}
+	if err := nc.Drain(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, redirects, err := nc.LoadOrRedirect(make([]byte, 4), nil); err != nil || len(redirects) > 0 {
+		t.Errorf("Expected Load to succeed after draining. Redirects: %v, Error: %v", redirects, err)
+	}
+}
+
+// maskingCodec encodes messages as protobuf with every byte flipped, so
+// that neither end can decode them without this codec.
+type maskingCodec struct {
+	marshals, unmarshals int32
+}
+
+func (this *maskingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&this.marshals, 1)
+	data, err := proto.Marshal(v.(proto.Message))
+	for i := range data {
+		data[i] ^= 0xff
+	}
+	return data, err
+}
+
+func (this *maskingCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt32(&this.unmarshals, 1)
+	unmasked := make([]byte, len(data))
+	for i := range data {
+		unmasked[i] = data[i] ^ 0xff
+	}
+	return proto.Unmarshal(unmasked, v.(proto.Message))
+}
+
+func (this *maskingCodec) Name() string {
+	return "masking"
+}
+
+func TestCustomCodec(t *testing.T) {
+	repl := newMockRepl()
+	serverCodec, clientCodec := &maskingCodec{}, &maskingCodec{}
+	ns := NewNexusService(svcPort+1, repl, WithServerCodec(serverCodec))
+	defer ns.Close()
+	go ns.ListenAndServe()
+
+	nc, err := NewInSecureNexusClient(fmt.Sprintf("%s:%d", svcHost, svcPort+1), WithCodec(clientCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	data := []byte("encoded_by_codec")
+	replicate(t, nc, data)
+	assertRepl(t, repl, data)
+	hsh, _ := hashCode(data)
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, hsh)
+	if res, err := nc.Load(key, nil); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(res, data) {
+		t.Errorf("Expected Load to return: %q, Actual: %q", data, res)
+	}
+	for _, codec := range []*maskingCodec{serverCodec, clientCodec} {
+		if atomic.LoadInt32(&codec.marshals) == 0 || atomic.LoadInt32(&codec.unmarshals) == 0 {
+			t.Errorf("Expected the codec to be used on both ends, marshals: %d, unmarshals: %d", codec.marshals, codec.unmarshals)
+		}
+	}
+}
+
+func TestLoadRedirect(t *testing.T) {
+	repl := newMockRepl()
+	repl.members = map[uint64]*models.NodeInfo{
+		0: {NodeId: 0, NodeUrl: "http://127.0.0.1:9020", Status: models.NodeInfo_LEADER},
+		2: {NodeId: 2, NodeUrl: "http://127.0.0.2:9020", Status: models.NodeInfo_FOLLOWER},
+		3: {NodeId: 3, NodeUrl: "http://127.0.0.3:9020", Status: models.NodeInfo_OFFLINE},
+	}
+	ns := NewNexusService(svcPort+3, repl)
+	defer ns.Close()
+	go ns.ListenAndServe()
+
+	svcAddr := fmt.Sprintf("%s:%d", svcHost, svcPort+3)
+	for expected, opts := range map[string][]ClientOption{
+		fmt.Sprintf("127.0.0.2:%d", svcPort+3): nil,
+		"127.0.0.2:9121":                       {WithPeerAddrFunc(func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, "9121") })},
+	} {
+		nc, err := NewInSecureNexusClient(svcAddr, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nc.Drain(true); err != nil {
+			t.Fatal(err)
+		}
+		if _, redirects, err := nc.LoadOrRedirect(make([]byte, 4), nil); status.Code(err) != codes.Unavailable {
+			t.Errorf("Expected Load on draining node to fail with code: %s, Actual: %v", codes.Unavailable, err)
+		} else if len(redirects) != 1 || redirects[0] != expected {
+			t.Errorf("Expected redirect to the healthy peer at: %s, Actual: %v", expected, redirects)
+		}
+		nc.Close()
+	}
+}
+
+func TestLoadReadConsistencyHeader(t *testing.T) {
+	repl := newMockRepl()
+	ns := NewNexusService(svcPort, repl)
+	req := &api.LoadRequest{Data: make([]byte, 4)}
+
+	if _, err := ns.Load(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if repl.readConsistency != raft.Linearizable {
+		t.Errorf("Expected linearizable reads by default. Got: %s", repl.readConsistency)
+	}
+
+	for _, rc := range []raft.ReadConsistency{raft.Stale, raft.LeaderOnly, raft.Linearizable} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ReadConsistencyHeader, rc.String()))
+		if _, err := ns.Load(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		if repl.readConsistency != rc {
+			t.Errorf("Read consistency mismatch. Expected: %s, Actual: %s", rc, repl.readConsistency)
+		}
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ReadConsistencyHeader, "eventual"))
+	if _, err := ns.Load(ctx, req); err == nil {
+		t.Error("Expected error for unknown read consistency but got none")
+	}
+}
+
+func TestLoadReadConsistency(t *testing.T) {
+	repl := newMockRepl()
+	ns := NewNexusService(svcPort, repl)
+	req := &api.LoadRequest{Data: make([]byte, 4), Consistency: api.LoadRequest_STALE}
+
+	if _, err := ns.Load(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if repl.readConsistency != raft.Stale {
+		t.Errorf("Read consistency mismatch. Expected: %s, Actual: %s", raft.Stale, repl.readConsistency)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ReadConsistencyHeader, raft.Linearizable.String()))
+	if _, err := ns.Load(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if repl.readConsistency != raft.Linearizable {
+		t.Errorf("Expected header to override read consistency of the request. Got: %s", repl.readConsistency)
+	}
+}
+
+func TestSaveAckLevelHeader(t *testing.T) {
+	repl := newMockRepl()
+	ns := NewNexusService(svcPort, repl)
+	req := &api.SaveRequest{Data: []byte("acked")}
+	for _, al := range []raft.AckLevel{raft.AckCommitted, raft.AckQuorumConfirmed, raft.AckAppliedLocal} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AckLevelHeader, al.String()))
+		if _, err := ns.Save(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		if repl.ackLevel != al {
+			t.Errorf("Ack level mismatch. Expected: %s, Actual: %s", al, repl.ackLevel)
+		}
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AckLevelHeader, "durable"))
+	if _, err := ns.Save(ctx, req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected error with code: %s for unknown ack level, Actual: %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestSaveCorrelationId(t *testing.T) {
+	repl := newMockRepl()
+	ns := NewNexusService(svcPort, repl)
+	req := &api.SaveRequest{Data: []byte("traced"), CorrelationId: "corr-123"}
+	if res, err := ns.Save(context.Background(), req); err != nil {
+		t.Fatal(err)
+	} else {
+		if res.CorrelationId != req.CorrelationId {
+			t.Errorf("Expected correlation ID: %s, Actual: %s", req.CorrelationId, res.CorrelationId)
+		}
+		if expId, _ := hashCode(req.Data); res.RequestId != uint64(expId) {
+			t.Errorf("Expected request ID: %d, Actual: %d", expId, res.RequestId)
+		}
+	}
+}
+
+type chunkStream struct {
+	ggrpc.ServerStream
+	chunks []*api.SaveRequest
+}
+
+func (this *chunkStream) Recv() (*api.SaveRequest, error) {
+	if len(this.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := this.chunks[0]
+	this.chunks = this.chunks[1:]
+	return chunk, nil
+}
+
+func (this *chunkStream) SendAndClose(*api.SaveResponse) error {
+	return nil
+}
+
+func (this *chunkStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestSaveStreamTooLarge(t *testing.T) {
+	ns := NewNexusService(svcPort, newMockRepl(), WithMaxSaveSize(100))
+	stream := &chunkStream{}
+	for i := 0; i < 4; i++ {
+		stream.chunks = append(stream.chunks, &api.SaveRequest{Data: bytes.Repeat([]byte("a"), 40)})
+	}
+	if err := ns.SaveStream(stream); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected code: %v, Actual error: %v", codes.ResourceExhausted, err)
+	}
+	if len(stream.chunks) != 1 {
+		t.Errorf("Expected receiving to stop at the chunk exceeding the limit, chunks left: %d", len(stream.chunks))
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tooLarge := fmt.Errorf("%w: too big", raft.ErrProposalTooLarge)
+	overloaded := &raft.OverloadedError{RetryAfter: time.Second}
+	cases := map[error]codes.Code{
+		raft.ErrNotLeader:          codes.FailedPrecondition,
+		raft.ErrNoLeader:           codes.Unavailable,
+		tooLarge:                   codes.ResourceExhausted,
+		raft.ErrProposalDropped:    codes.ResourceExhausted,
+		overloaded:                 codes.ResourceExhausted,
+		context.DeadlineExceeded:   codes.DeadlineExceeded,
+		errors.New("some failure"): codes.Unknown,
+	}
+	for err, code := range cases {
+		if st := status.Convert(statusError(err)); st.Code() != code {
+			t.Errorf("Code mismatch for %v. Expected: %s, Actual: %s", err, code, st.Code())
+		} else if st.Message() != err.Error() {
+			t.Errorf("Message mismatch. Expected: %s, Actual: %s", err.Error(), st.Message())
+		}
+	}
+}
+
+func TestListNodesHidesShadows(t *testing.T) {
+	repl := newMockRepl()
+	repl.members = map[uint64]*models.NodeInfo{
+		1: {NodeId: 1, NodeUrl: "http://node1:9020"},
+		2: {NodeId: 2, NodeUrl: "http://node2:9020", IsShadow: true},
+	}
+	ns := NewNexusService(svcPort, repl)
+	res, err := ns.ListNodes(context.Background(), &empty.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, present := res.Nodes[2]; present || len(res.Nodes) != 1 {
+		t.Errorf("Expected only non shadow members to be listed. Got: %v", res.Nodes)
+	}
+}
+
+func TestTopologyEvents(t *testing.T) {
+	members := map[uint64]string{1: "http://node1:9020", 2: "http://node2:9020"}
+	res := &api.ListNodesResponse{Leader: 3, Nodes: map[uint64]*models.NodeInfo{
+		1: {NodeId: 1, NodeUrl: "http://node1:9020"},
+		3: {NodeId: 3, NodeUrl: "http://node3:9020"},
+	}}
+	expected := []ClusterEvent{
+		{Type: NodeJoined, NodeId: 3, NodeUrl: "http://node3:9020"},
+		{Type: NodeLeft, NodeId: 2, NodeUrl: "http://node2:9020"},
+		{Type: LeaderChanged, NodeId: 3, NodeUrl: "http://node3:9020"},
+	}
+	if events := topologyEvents(2, members, nil, res); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events: %v, Actual: %v", expected, events)
+	}
+	if events := topologyEvents(3, memberUrls(res.Nodes), nil, res); len(events) != 0 {
+		t.Errorf("Expected no events, Actual: %v", events)
+	}
+
+	res.Nodes[3].Status = models.NodeInfo_OFFLINE
+	offline := map[uint64]bool{1: true}
+	expected = []ClusterEvent{
+		{Type: NodeOffline, NodeId: 3, NodeUrl: "http://node3:9020"},
+		{Type: NodeOnline, NodeId: 1, NodeUrl: "http://node1:9020"},
+	}
+	if events := topologyEvents(3, memberUrls(res.Nodes), offline, res); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events: %v, Actual: %v", expected, events)
+	}
+	if events := topologyEvents(3, memberUrls(res.Nodes), offlineMembers(res.Nodes), res); len(events) != 0 {
+		t.Errorf("Expected no events, Actual: %v", events)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	nc := &NexusClient{timeout: Timeout}
+	WithTimeout(0)(nc)
+	if nc.timeout != Timeout {
+		t.Errorf("Expected default timeout: %s, Actual: %s", Timeout, nc.timeout)
+	}
+	WithTimeout(time.Minute)(nc)
+	if nc.timeout != time.Minute {
+		t.Errorf("Expected timeout: %s, Actual: %s", time.Minute, nc.timeout)
+	}
+}
+
+func TestClusterClientServiceAddr(t *testing.T) {
+	if svcAddr, err := sameServicePort("http://node1:9020", "9121"); err != nil {
+		t.Fatal(err)
+	} else if svcAddr != "node1:9121" {
+		t.Errorf("Expected service address: node1:9121, Actual: %s", svcAddr)
+	}
+	if _, err := NewClusterClient("node1"); err == nil {
+		t.Error("Expected error for seed address without port but got none")
+	}
+	if _, err := NewLeaderAwareClient(nil); err == nil {
+		t.Error("Expected error for no seed addresses but got none")
+	}
+	if _, err := NewLeaderAwareClient([]string{"node1:9121", "node2"}); err == nil {
+		t.Error("Expected error for a seed address without port but got none")
+	}
+}
+
+func TestClusterClientMemberAddrs(t *testing.T) {
+	cc := &ClusterClient{
+		svcAddrFunc: func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, "9121") },
+		members:     map[uint64]string{1: "http://node1:9020", 2: "http://node2:9020", 3: "http://node3:9020"},
+	}
+	first, second := cc.memberAddrs(), cc.memberAddrs()
+	if len(first) != 3 || len(second) != 3 {
+		t.Fatalf("Expected addresses of all 3 members, Actual: %v, %v", first, second)
+	}
+	if first[0] == second[0] {
+		t.Errorf("Expected successive calls to start from different members, Actual: %v, %v", first, second)
+	}
+}
+
+func TestAdvertisedServiceAddrs(t *testing.T) {
+	cc := &ClusterClient{
+		svcAddrFunc: func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, "9121") },
+		members:     map[uint64]string{1: "http://node1:9020", 2: "http://node2:9020"},
+		svcAddrs: memberServiceAddrs(map[uint64]*models.NodeInfo{
+			1: {NodeId: 1, NodeUrl: "http://node1:9020", ServiceAddr: "node1:9500"},
+			2: {NodeId: 2, NodeUrl: "http://node2:9020"},
+		}),
+	}
+	if svcAddr, err := cc.memberAddr(1); err != nil || svcAddr != "node1:9500" {
+		t.Errorf("Expected advertised service address: node1:9500, Actual: %s, error: %v", svcAddr, err)
+	}
+	if svcAddr, err := cc.memberAddr(2); err != nil || svcAddr != "node2:9121" {
+		t.Errorf("Expected service address: node2:9121, Actual: %s, error: %v", svcAddr, err)
+	}
+	if _, err := cc.memberAddr(3); err == nil {
+		t.Error("Expected error for an unknown member but got none")
+	}
+
+	nc := &NexusClient{peerAddrFunc: func(nodeUrl string) (string, error) { return sameServicePort(nodeUrl, "9121") }}
+	nodeUrls := []string{"http://node1:9020", "http://node2:9020"}
+	if addrs := nc.peerAddrs(nodeUrls, []string{"node1:9500", ""}); !reflect.DeepEqual(addrs, []string{"node1:9500", "node2:9121"}) {
+		t.Errorf("Expected redirect addresses: [node1:9500 node2:9121], Actual: %v", addrs)
+	}
+	if addrs := nc.peerAddrs(nodeUrls, nil); !reflect.DeepEqual(addrs, []string{"node1:9121", "node2:9121"}) {
+		t.Errorf("Expected redirect addresses: [node1:9121 node2:9121], Actual: %v", addrs)
+	}
+}
+
+// unavailableLeaderRepl is the sole member and the leader of its
+// cluster, failing all the Saves as it is shutting down.
+type unavailableLeaderRepl struct {
+	*mockRepl
+	saves int32
+}
+
+func (this *unavailableLeaderRepl) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
+	return 1, map[uint64]*models.NodeInfo{1: {NodeId: 1, NodeUrl: "http://127.0.0.1:9020", Status: models.NodeInfo_LEADER}}
+}
+
+func (this *unavailableLeaderRepl) Save(context.Context, []byte) ([]byte, error) {
+	atomic.AddInt32(&this.saves, 1)
+	return nil, raft.ErrShuttingDown
+}
+
+func TestClusterClient(t *testing.T) {
+	repl := &unavailableLeaderRepl{mockRepl: newMockRepl()}
+	ns := NewNexusService(svcPort+2, repl)
+	defer ns.Close()
+	go ns.ListenAndServe()
+
+	svcAddr := fmt.Sprintf("%s:%d", svcHost, svcPort+2)
+	cc, err := NewClusterClient(svcAddr, WithServiceAddrFunc(func(string) (string, error) { return svcAddr, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc.Leader() != 1 || len(cc.Members()) != 1 {
+		t.Errorf("Expected node 1 to be the leader and sole member, Actual leader: %d, members: %v", cc.Leader(), cc.Members())
+	}
+
+	// Saves may have been committed on unavailable leaders
+	if _, err := cc.Save([]byte("unavailable"), nil); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected code: %s, Actual: %v", codes.Unavailable, err)
+	}
+	if saves := atomic.LoadInt32(&repl.saves); saves != 1 {
+		t.Errorf("Expected the Save to not be retried, Actual attempts: %d", saves)
+	}
+
+	// stands in for a node that is no longer a member
+	departedAddr := fmt.Sprintf("127.0.0.1:%d", svcPort+2)
+	if _, err := cc.client(departedAddr); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	cc.mu.RLock()
+	_, present := cc.clients[departedAddr]
+	cc.mu.RUnlock()
+	if present {
+		t.Errorf("Expected the client of %s to be closed on refreshing", departedAddr)
+	}
+
+	if err := cc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.Close(); err != nil {
+		t.Errorf("Expected closing again to succeed, Actual: %v", err)
+	}
+}
+
+func TestQuorumLoadDivergence(t *testing.T) {
+	lagging := &QuorumLoadError{Loads: []NodeLoad{
+		{NodeId: 1, Res: []byte("v2"), AppliedIndex: 11},
+		{NodeId: 2, Res: []byte("v1"), AppliedIndex: 10},
+		{NodeId: 3, Err: errors.New("unreachable")},
+	}}
+	if lagging.Diverged() {
+		t.Errorf("Expected no divergence across applied indexes: %v", lagging.Loads)
+	}
+	diverged := &QuorumLoadError{Loads: []NodeLoad{
+		{NodeId: 1, Res: []byte("v2"), AppliedIndex: 10},
+		{NodeId: 2, Res: []byte("v1"), AppliedIndex: 10},
+	}}
+	if !diverged.Diverged() {
+		t.Errorf("Expected divergence at the same applied index: %v", diverged.Loads)
+	}
+}
+
+func checkSnapshot(t *testing.T, nc *NexusClient, repl *mockRepl) {
+	if index, err := nc.Snapshot(); err != nil {
+		t.Fatal(err)
+	} else if index != repl.saveIndex {
+		t.Errorf("Expected snapshot index: %d, Actual: %d", repl.saveIndex, index)
+	}
+}
+
+func checkListNodes(t *testing.T, nc *NexusClient) {
+	if _, nodes, err := nc.ListNodes(); err != nil {
+		t.Fatal(err)
+	} else if len(nodes) != 0 {
+		t.Errorf("Expected no nodes, Actual: %v", nodes)
+	}
+}
+
+func checkCallerContext(t *testing.T, nc *NexusClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := nc.SaveContext(ctx, []byte("ctx"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nc.LoadContext(ctx, make([]byte, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := nc.SaveContext(ctx, []byte("ctx"), nil); status.Code(err) != codes.Canceled {
+		t.Errorf("Expected code: %s on a cancelled Save, Actual: %v", codes.Canceled, err)
+	}
+	if _, err := nc.LoadContext(ctx, make([]byte, 4), nil); status.Code(err) != codes.Canceled {
+		t.Errorf("Expected code: %s on a cancelled Load, Actual: %v", codes.Canceled, err)
+	}
+}
+
+// memStore is a store that retains all the data saved onto it.
+type memStore struct {
+	mu    sync.Mutex
+	saves [][]byte
+	entry db.RaftEntry
+}
+
+func (this *memStore) Close() error {
+	return nil
+}
+
+func (this *memStore) GetLastAppliedEntry() (db.RaftEntry, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.entry, nil
+}
+
+func (this *memStore) Save(entry db.RaftEntry, data []byte) ([]byte, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.saves = append(this.saves, data)
+	this.entry = entry
+	return nil, nil
+}
+
+func (this *memStore) Load([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (this *memStore) Backup(db.SnapshotState) (io.ReadCloser, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(this.saves); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+func (this *memStore) Restore(data io.ReadCloser) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return gob.NewDecoder(data).Decode(&this.saves)
+}
+
+func (this *memStore) count() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.saves)
+}
+
+func TestSaveLeaderRedirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nexus_redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// RAFT URL and service address of each node
+	nodeUrls := []string{"http://127.0.0.1:9351", "http://127.0.0.1:9352", "http://127.0.0.1:9353"}
+	svcAddrs := make(map[string]string)
+	stores := make([]*memStore, len(nodeUrls))
+	repls := make([]api.RaftReplicator, len(nodeUrls))
+	for i, nodeUrl := range nodeUrls {
+		stores[i] = &memStore{}
+		repl, err := api.NewRaftReplicator(stores[i], raft.NodeUrl(nodeUrl), raft.ClusterUrl(strings.Join(nodeUrls, ",")),
+			raft.LogDir(dir+"/logs"), raft.SnapDir(dir+"/snap"), raft.ReplicationTimeout(3*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repls[i] = repl
+		repl.Start()
+		defer repl.Stop()
+		port := svcPort + 4 + i
+		ns := NewNexusService(uint(port), repl)
+		defer ns.Close()
+		go ns.ListenAndServe()
+		svcAddrs[nodeUrl] = fmt.Sprintf("%s:%d", svcHost, port)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var follower int
+	for i, repl := range repls {
+		if err := repl.WaitForLeader(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if repl.Health().Leader != repl.Id() {
+			follower = i
+		}
+	}
+	followerAddr := svcAddrs[nodeUrls[follower]]
+
+	// without redirecting, followers forward Saves to the leader
+	nc, err := NewInSecureNexusClient(followerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("forwarded"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err = NewInSecureNexusClient(followerAddr, withLeaderRequired())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("rejected"), nil); !errors.Is(err, raft.ErrNotLeader) {
+		t.Errorf("Expected error: %v on a follower, Actual: %v", raft.ErrNotLeader, err)
+	}
+
+	nc, err = NewInSecureNexusClient(followerAddr, WithLeaderRedirect(func(nodeUrl string) (string, error) {
+		return svcAddrs[nodeUrl], nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("redirected"), nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	for i, store := range stores {
+		if count := store.count(); count != 2 {
+			t.Errorf("Expected 2 Saves on node %s, Actual: %d", nodeUrls[i], count)
+		}
+	}
+}
+
+type dryRunRepl struct {
+	*mockRepl
+	dryRuns []bool
+}
+
+func (this *dryRunRepl) RemoveMember(ctx context.Context, nodeUrl string) error {
+	this.dryRuns = append(this.dryRuns, raft.IsDryRun(ctx))
+	return nil
+}
+
+func TestRemoveNodeDryRun(t *testing.T) {
+	repl := &dryRunRepl{mockRepl: newMockRepl()}
+	ns := NewNexusService(svcPort, repl)
+	for _, dryRun := range []bool{true, false} {
+		if res, err := ns.RemoveNode(context.Background(), &api.RemoveNodeRequest{NodeUrl: "http://127.0.0.1:9021", DryRun: dryRun}); err != nil || res.Code != 0 {
+			t.Fatalf("Expected removal to succeed. Status: %v, Error: %v", res, err)
+		}
+	}
+	if !reflect.DeepEqual(repl.dryRuns, []bool{true, false}) {
+		t.Errorf("Expected dry run to be passed on to the replicator, Actual: %v", repl.dryRuns)
+	}
+}
+
+func TestAdmissionControl(t *testing.T) {
+	adm := newAdmission(3, 1)
+	save := &ggrpc.UnaryServerInfo{FullMethod: "/nexus.api.Nexus/Save"}
+	check := &ggrpc.UnaryServerInfo{FullMethod: "/nexus.api.Nexus/Check"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	if !adm.admit() || !adm.admit() || !adm.admit() {
+		t.Fatal("Expected requests to be admitted below the high watermark")
+	}
+	if _, err := adm.unaryInterceptor(context.Background(), nil, save, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected code: %s at the high watermark, Actual: %v", codes.ResourceExhausted, err)
+	}
+	if _, err := adm.unaryInterceptor(context.Background(), nil, check, handler); err != nil {
+		t.Errorf("Expected health checks to not be rejected, Actual: %v", err)
+	}
+	adm.done()
+	if _, err := adm.unaryInterceptor(context.Background(), nil, save, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected code: %s above the low watermark, Actual: %v", codes.ResourceExhausted, err)
+	}
+	adm.done()
+	if _, err := adm.unaryInterceptor(context.Background(), nil, save, handler); err != nil {
+		t.Errorf("Expected request to be admitted at the low watermark, Actual: %v", err)
+	}
+
+	ns := &NexusService{}
+	WithAdmissionControl(3, -1)(ns)
+	if ns.admission != nil {
+		t.Error("Expected admission control to be ignored for a negative low watermark")
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	cases := []struct {
+		err      error
+		code     codes.Code
+		expected error
+	}{
+		{raft.ErrNotLeader, codes.FailedPrecondition, raft.ErrNotLeader},
+		{fmt.Errorf("unable to add node: %w", raft.ErrNoQuorum), codes.Unavailable, raft.ErrNoQuorum},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, raft.ErrTimeout},
+		{&raft.OverloadedError{RetryAfter: time.Second}, codes.ResourceExhausted, raft.ErrOverloaded},
+	}
+	for _, c := range cases {
+		st := errorStatus(c.err)
+		if codes.Code(st.Code) != c.code {
+			t.Errorf("Expected code: %s for %v, Actual: %d", c.code, c.err, st.Code)
+		}
+		err := statusErr(responseStatus(st))
+		if !errors.Is(err, c.expected) {
+			t.Errorf("Expected error to match: %v, Actual: %v", c.expected, err)
+		}
+		if status.Code(err) != c.code {
+			t.Errorf("Expected code: %s retained by %v", c.code, err)
+		}
+	}
+	// The ErrorInfo reason is matched regardless of the message.
+	st, _ := status.New(codes.Unavailable, "node is going away").WithDetails(&errdetails.ErrorInfo{Reason: "SHUTTING_DOWN", Domain: errorDomain})
+	if err := statusErr(st); !errors.Is(err, raft.ErrShuttingDown) {
+		t.Errorf("Expected error to match: %v, Actual: %v", raft.ErrShuttingDown, err)
+	}
+	if err := toError(statusError(raft.ErrCompacted)); !errors.Is(err, raft.ErrCompacted) {
+		t.Errorf("Expected error to match: %v, Actual: %v", raft.ErrCompacted, err)
+	}
+	if err := statusErr(responseStatus(&api.Status{Code: -1, Message: "failed"})); status.Code(err) != codes.Unknown || errors.Unwrap(err) != nil {
+		t.Errorf("Expected unknown error for legacy status, Actual: %v", err)
+	}
+}
+
+func checkClientCorrelationId(t *testing.T, nc *NexusClient, repl *mockRepl) {
+	if _, err := nc.Save([]byte("traced"), nil, "corr-456"); err != nil {
+		t.Fatal(err)
+	}
+	if repl.correlationId != "corr-456" {
+		t.Errorf("Expected correlation ID: corr-456, Actual: %s", repl.correlationId)
+	}
+	if _, err := nc.Save([]byte("untraced"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if repl.correlationId != "" {
+		t.Errorf("Expected no correlation ID, Actual: %s", repl.correlationId)
+	}
+}
+
+func checkWatchCommits(t *testing.T, nc *NexusClient, repl *mockRepl) {
+	fromIndex := repl.saveIndex
+	if _, err := nc.Save([]byte("watched"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var commits []raft.Commit
+	errDone := errors.New("done")
+	err := nc.WatchCommits(context.Background(), fromIndex, func(commit raft.Commit) error {
+		if commits = append(commits, commit); len(commits) == 2 {
+			return errDone
+		}
+		return nil
+	})
+	if err != errDone {
+		t.Fatal(err)
+	}
+	if commits[0].Index != fromIndex || commits[1].Index != fromIndex+1 {
+		t.Errorf("Expected commits at indices: %d, %d, Actual: %d, %d", fromIndex, fromIndex+1, commits[0].Index, commits[1].Index)
+	}
+	req := new(api.SaveRequest)
+	if err := req.Decode(commits[1].Data[0]); err != nil || string(req.Data) != "watched" {
+		t.Errorf("Expected the data of the latest Save to be streamed, Actual: %q, Error: %v", req.Data, err)
+	}
+
+	repl.firstIndex = fromIndex + 1
+	defer func() { repl.firstIndex = 0 }()
+	err = nc.WatchCommits(context.Background(), fromIndex, func(raft.Commit) error { return nil })
+	if !errors.Is(err, raft.ErrCompacted) {
+		t.Errorf("Expected error: %v on watching compacted entries, Actual: %v", raft.ErrCompacted, err)
+	}
+}
+
+// droppingRepl fails the first stream of commits as if the node was
+// shutting down, after another Save got committed in the meantime.
+type droppingRepl struct {
+	*mockRepl
+	dropped bool
+}
+
+func (this *droppingRepl) Commits(fromIndex uint64, maxEntries int) ([]raft.Commit, uint64, error) {
+	if !this.dropped {
+		this.dropped = true
+		data, _ := (&api.SaveRequest{Data: []byte("while_dropped")}).Encode()
+		if _, err := this.Save(context.Background(), data); err != nil {
+			return nil, fromIndex, err
+		}
+		return nil, fromIndex, raft.ErrShuttingDown
+	}
+	return this.mockRepl.Commits(fromIndex, maxEntries)
+}
+
+func TestWatchCommitsDroppedEarly(t *testing.T) {
+	repl := &droppingRepl{mockRepl: newMockRepl()}
+	ns := NewNexusService(svcPort+7, repl)
+	defer ns.Close()
+	go ns.ListenAndServe()
+
+	nc, err := NewInSecureNexusClient(fmt.Sprintf("%s:%d", svcHost, svcPort+7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("before_watching"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var commits []raft.Commit
+	errDone := errors.New("done")
+	err = nc.WatchCommits(ctx, 0, func(commit raft.Commit) error {
+		commits = append(commits, commit)
+		return errDone
+	})
+	if err != errDone {
+		t.Fatal(err)
+	}
+	if !repl.dropped {
+		t.Fatal("Expected the first stream to be dropped")
+	}
+	// the commit made before the stream got re-opened is not missed
+	if commits[0].Index != 2 {
+		t.Errorf("Expected the first commit at index: 2, Actual: %d", commits[0].Index)
+	}
+}
+
+func checkCompression(t *testing.T, svcAddr string, repl *mockRepl) {
+	nc, err := NewInSecureNexusClient(svcAddr, WithCompression(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	data := bytes.Repeat([]byte("compressible"), 100)
+	if _, err := nc.Save(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	hsh, _ := hashCode(data)
+	if !bytes.Equal(repl.data[hsh], data) {
+		t.Errorf("Expected compressed Save to be received intact, Actual: %d bytes", len(repl.data[hsh]))
+	}
+}
+
+func checkReadYourWrites(t *testing.T, svcAddr string, repl *mockRepl) {
+	nc, err := NewInSecureNexusClient(svcAddr, WithReadYourWrites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if _, err := nc.Save([]byte("ryw"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, freshness, st := nc.LoadWithFreshness(make([]byte, 4), nil); st.Err() != nil {
+		t.Fatal(st.Err())
+	} else if freshness.AppliedIndex != repl.saveIndex {
+		t.Errorf("Expected applied index of Load: %d, Actual: %d", repl.saveIndex, freshness.AppliedIndex)
+	}
+	if repl.minIndex != repl.saveIndex {
+		t.Errorf("Expected min index of Load: %d, Actual: %d", repl.saveIndex, repl.minIndex)
+	}
+	if freshness, err := nc.Freshness(); err != nil {
+		t.Fatal(err)
+	} else if freshness.CommittedIndex != repl.saveIndex {
+		t.Errorf("Expected committed index: %d, Actual: %d", repl.saveIndex, freshness.CommittedIndex)
+	}
+	if applied, err := nc.HasApplied(nc.LastSaveIndex()); err != nil {
+		t.Fatal(err)
+	} else if !applied {
+		t.Errorf("Expected index: %d to be applied", nc.LastSaveIndex())
+	}
+	if applied, err := nc.HasApplied(nc.LastSaveIndex() + 1); err != nil {
+		t.Fatal(err)
+	} else if applied {
+		t.Errorf("Expected index: %d to not be applied", nc.LastSaveIndex()+1)
+	}
+	if appliedIndex, err := nc.AppliedIndex(); err != nil {
+		t.Fatal(err)
+	} else if appliedIndex != repl.saveIndex {
+		t.Errorf("Expected applied index: %d, Actual: %d", repl.saveIndex, appliedIndex)
+	}
+
+	sc, err := NewInSecureNexusClient(svcAddr, WithSessionConsistency())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if _, err := sc.Save([]byte("session"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Load(make([]byte, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if repl.readConsistency != raft.Stale || repl.minIndex != sc.LastSaveIndex() {
+		t.Errorf("Expected a stale Load with min index: %d, Actual: %s Load with min index: %d", sc.LastSaveIndex(), repl.readConsistency, repl.minIndex)
 	}
 }
 
@@ -43,6 +999,78 @@ func checkHealth(t *testing.T, nc *NexusClient) {
 	if res != api.HealthCheckResponse_SERVING {
 		t.Fatalf("Bad health of Nexus GRPC service. Status: %s", res.String())
 	}
+	if res := nc.HealthCheckFor(ReadinessService); res != api.HealthCheckResponse_SERVING {
+		t.Fatalf("Bad readiness of Nexus GRPC service. Status: %s", res.String())
+	}
+	if res := nc.HealthCheckFor("unknown"); res != api.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected unknown service to not be served. Status: %s", res.String())
+	}
+	if res, err := nc.CheckHealth(ReadinessService); err != nil {
+		t.Fatal(err)
+	} else if !res.LeaderKnown || !res.Connected || res.Lag != 0 {
+		t.Errorf("Expected a known and connected leader without lag. Response: %v", res)
+	}
+}
+
+type notLeaderStreamRepl struct {
+	*mockRepl
+}
+
+func (notLeaderStreamRepl) LoadStream(context.Context, []byte, int, func([]byte) error) error {
+	return raft.ErrNotLeader
+}
+
+func TestClientErrors(t *testing.T) {
+	ns := NewNexusService(svcPort+8, notLeaderStreamRepl{newMockRepl()})
+	defer ns.Close()
+	go ns.ListenAndServe()
+	nc, err := NewNexusClient(fmt.Sprintf("%s:%d", svcHost, svcPort+8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := nc.LoadStream([]byte("key"))
+	if err == nil {
+		_, err = ioutil.ReadAll(rdr)
+		rdr.Close()
+	}
+	if !errors.Is(err, raft.ErrNotLeader) {
+		t.Errorf("Expected LoadStream to fail with: %v, Actual: %v", raft.ErrNotLeader, err)
+	}
+
+	// calls on a closed connection fail with codes.Canceled
+	nc.Close()
+	var clientErr *Error
+	if _, _, err := nc.ListNodes(); !errors.As(err, &clientErr) {
+		t.Errorf("Expected ListNodes to fail with an Error, Actual: %v", err)
+	}
+	if _, _, _, err := nc.ListNodesAuthoritative(); !errors.As(err, &clientErr) {
+		t.Errorf("Expected ListNodesAuthoritative to fail with an Error, Actual: %v", err)
+	}
+}
+
+type laggingRepl struct {
+	*mockRepl
+}
+
+func (laggingRepl) Health() raft.Health {
+	return raft.Health{Alive: true, Leader: 1, CommitIndex: 50, AppliedIndex: 10, Connected: true}
+}
+
+func TestReadinessLag(t *testing.T) {
+	req := &api.HealthCheckRequest{Service: ReadinessService}
+	ns := NewNexusService(svcPort, laggingRepl{newMockRepl()}, WithMaxReadyApplyLag(30))
+	if res, err := ns.Check(context.Background(), req); err != nil {
+		t.Fatal(err)
+	} else if res.Status != api.HealthCheckResponse_NOT_SERVING || res.Lag != 40 {
+		t.Errorf("Expected node lagging by 40 entries to not be ready. Response: %v", res)
+	}
+	ns = NewNexusService(svcPort, laggingRepl{newMockRepl()}, WithMaxReadyApplyLag(40))
+	if res, err := ns.Check(context.Background(), req); err != nil {
+		t.Fatal(err)
+	} else if res.Status != api.HealthCheckResponse_SERVING {
+		t.Errorf("Expected node lagging within the threshold to be ready. Response: %v", res)
+	}
 }
 
 func replicate(t *testing.T, nc *NexusClient, data []byte) {
@@ -58,7 +1086,15 @@ func assertRepl(t *testing.T, repl *mockRepl, data []byte) {
 }
 
 type mockRepl struct {
-	data map[uint32][]byte
+	data            map[uint32][]byte
+	readConsistency raft.ReadConsistency
+	ackLevel        raft.AckLevel
+	saveIndex       uint64
+	correlationId   string
+	commits         []raft.Commit
+	firstIndex      uint64
+	minIndex        uint64
+	members         map[uint64]*models.NodeInfo
 }
 
 func newMockRepl() *mockRepl {
@@ -72,37 +1108,185 @@ func (this *mockRepl) Id() uint64 {
 func (this *mockRepl) Start() {
 }
 
-func (this *mockRepl) Stop() {
+func (this *mockRepl) Stop() error {
+	return nil
+}
+
+func (this *mockRepl) StopWithTimeout(time.Duration) error {
+	return nil
 }
 
-func (this *mockRepl) Load(_ context.Context, data []byte) ([]byte, error) {
+func (this *mockRepl) Load(ctx context.Context, data []byte) ([]byte, error) {
+	this.readConsistency = raft.ReadConsistencyFrom(ctx)
+	this.minIndex = raft.MinIndexFrom(ctx)
+	if freshness := raft.FreshnessFrom(ctx); freshness != nil {
+		freshness.CommittedIndex, freshness.AppliedIndex = this.saveIndex, this.saveIndex
+	}
 	req := new(api.LoadRequest)
 	_ = req.Decode(data)
 	id := binary.BigEndian.Uint32(req.Data)
 	return this.data[id], nil
 }
 
-func (this *mockRepl) Save(_ context.Context, data []byte) ([]byte, error) {
+func (this *mockRepl) LoadStream(ctx context.Context, data []byte, chunkSize int, send func([]byte) error) error {
+	res, err := this.Load(ctx, data)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(res); off += chunkSize {
+		end := off + chunkSize
+		if end > len(res) {
+			end = len(res)
+		}
+		if err := send(res[off:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *mockRepl) Save(ctx context.Context, data []byte) ([]byte, error) {
 	req := new(api.SaveRequest)
 	_ = req.Decode(data)
 	if hsh, err := hashCode(req.Data); err != nil {
 		return nil, err
 	} else {
+		this.saveIndex++
+		this.commits = append(this.commits, raft.Commit{Index: this.saveIndex, Data: [][]byte{data}})
+		this.ackLevel = raft.AckLevelFrom(ctx)
+		if trace := raft.RequestTraceFrom(ctx); trace != nil {
+			trace.RequestId = uint64(hsh)
+			this.correlationId = trace.CorrelationId
+			trace.AppliedIndex = this.saveIndex
+		}
 		this.data[hsh] = req.Data
 		return nil, nil
 	}
 }
 
+func (this *mockRepl) SaveBatch(ctx context.Context, batch [][]byte) ([][]byte, error) {
+	res, errs, failed := make([][]byte, len(batch)), make([]error, len(batch)), false
+	for i, data := range batch {
+		if res[i], errs[i] = this.Save(ctx, data); errs[i] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return res, &raft.BatchError{Errs: errs}
+	}
+	return res, nil
+}
+
 func (this *mockRepl) AddMember(context.Context, string) error {
 	return errors.New("mockRepl::AddMember not implemented")
 }
 
+func (this *mockRepl) AddLearner(context.Context, string) error {
+	return errors.New("mockRepl::AddLearner not implemented")
+}
+
+func (this *mockRepl) AddShadow(context.Context, string) error {
+	return errors.New("mockRepl::AddShadow not implemented")
+}
+
+func (this *mockRepl) PromoteLearner(context.Context, uint64) error {
+	return errors.New("mockRepl::PromoteLearner not implemented")
+}
+
 func (this *mockRepl) RemoveMember(context.Context, string) error {
 	return errors.New("mockRepl::RemoveMember not implemented")
 }
 
+func (this *mockRepl) ReplaceMember(context.Context, uint64, string) error {
+	return errors.New("mockRepl::ReplaceMember not implemented")
+}
+
 func (this *mockRepl) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
-	return uint64(0), nil
+	return uint64(0), this.members
+}
+
+func (this *mockRepl) ConfChangeCount() uint64 {
+	return 0
+}
+
+func (this *mockRepl) ResetConfChangeCount() uint64 {
+	return 0
+}
+
+func (this *mockRepl) Status() raft.Status {
+	return raft.Status{Term: 1, CommitIndex: this.saveIndex, AppliedIndex: this.saveIndex, Leader: 1, Writable: true, Readable: true}
+}
+
+func (this *mockRepl) ReplicationFactor() (int, int) {
+	return 1, 1
+}
+
+func (this *mockRepl) SetLogLevel(raft.LogLevel) raft.LogLevel {
+	return raft.InfoLevel
+}
+
+func (this *mockRepl) TransferLeadership(context.Context, uint64) error {
+	return errors.New("mockRepl::TransferLeadership not implemented")
+}
+
+func (this *mockRepl) CompactLog(uint64) error {
+	return errors.New("mockRepl::CompactLog not implemented")
+}
+
+func (this *mockRepl) Snapshot(context.Context) (uint64, error) {
+	return this.saveIndex, nil
+}
+
+func (this *mockRepl) AppliedIndex() uint64 {
+	return this.saveIndex
+}
+
+func (this *mockRepl) WaitForLeader(context.Context) error {
+	return nil
+}
+
+func (this *mockRepl) WatchMembers(context.Context) (<-chan raft.MemberEvent, error) {
+	return make(chan raft.MemberEvent), nil
+}
+
+func (this *mockRepl) Freshness(context.Context) (raft.Freshness, error) {
+	return raft.Freshness{CommittedIndex: this.saveIndex, AppliedIndex: this.saveIndex}, nil
+}
+
+func (this *mockRepl) PendingMemberAdds() map[string]raft.MemberAddState {
+	return nil
+}
+
+func (this *mockRepl) InflightOps() []raft.InflightOp {
+	return []raft.InflightOp{{Id: 1, Type: raft.OpSave, Age: time.Second}}
+}
+
+func (this *mockRepl) Commits(fromIndex uint64, maxEntries int) ([]raft.Commit, uint64, error) {
+	if fromIndex < this.firstIndex {
+		return nil, fromIndex, &raft.CompactedError{FirstIndex: this.firstIndex, SnapshotIndex: this.firstIndex - 1}
+	}
+	var commits []raft.Commit
+	for _, commit := range this.commits {
+		if commit.Index >= fromIndex && len(commits) < maxEntries {
+			commits = append(commits, commit)
+		}
+	}
+	if len(commits) == 0 {
+		return nil, fromIndex, nil
+	}
+	return commits, commits[len(commits)-1].Index + 1, nil
+}
+
+func (this *mockRepl) Health() raft.Health {
+	return raft.Health{Alive: true, Leader: 1, CommitIndex: this.saveIndex, AppliedIndex: this.saveIndex, Connected: true}
+}
+
+func (this *mockRepl) CheckQuorumConnectivity() (bool, []uint64, error) {
+	return true, []uint64{1}, nil
+}
+
+func (this *mockRepl) ExportConfig() ([]byte, error) {
+	return nil, errors.New("mockRepl::ExportConfig not implemented")
 }
 
 func (this *mockRepl) hasData(data []byte) bool {
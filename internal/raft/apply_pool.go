@@ -0,0 +1,122 @@
+package raft
+
+import "sync"
+
+type applyTask struct {
+	index uint64
+	done  chan struct{}
+}
+
+// applyPool applies committed requests in parallel across a fixed set
+// of workers. Requests of the same partition are always applied by the
+// same worker, in the order of commit. Irrespective of the order in
+// which requests get applied, applied indexes are reported strictly in
+// the order of commit.
+type applyPool struct {
+	workers   []chan func()
+	tasks     chan *applyTask
+	onApplied func(uint64)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int  // submitted tasks not yet reported as applied
+	paused  bool // set while a snapshot of the store is being taken
+}
+
+func newApplyPool(numWorkers int, onApplied func(uint64)) *applyPool {
+	pool := &applyPool{
+		workers:   make([]chan func(), numWorkers),
+		tasks:     make(chan *applyTask, numWorkers*applyQueueSizePerWorker),
+		onApplied: onApplied,
+	}
+	pool.cond = sync.NewCond(&pool.mu)
+	for i := range pool.workers {
+		pool.workers[i] = make(chan func(), applyQueueSizePerWorker)
+		go pool.runWorker(pool.workers[i])
+	}
+	go pool.reportApplied()
+	return pool
+}
+
+const applyQueueSizePerWorker = 128
+
+func (this *applyPool) runWorker(work <-chan func()) {
+	for fn := range work {
+		fn()
+	}
+}
+
+func (this *applyPool) reportApplied() {
+	for task := range this.tasks {
+		<-task.done
+		this.onApplied(task.index)
+		this.mu.Lock()
+		this.pending--
+		this.cond.Broadcast()
+		this.mu.Unlock()
+	}
+}
+
+// submit schedules the given function on the worker owning the given
+// partition, to be reported as applied at the given index.
+func (this *applyPool) submit(index, partition uint64, fn func()) {
+	task := &applyTask{index, make(chan struct{})}
+	this.enqueue(task)
+	this.workers[partition%uint64(len(this.workers))] <- func() {
+		defer close(task.done)
+		fn()
+	}
+}
+
+// applied reports the given index as applied once all the
+// previously submitted requests are applied.
+func (this *applyPool) applied(index uint64) {
+	task := &applyTask{index, make(chan struct{})}
+	close(task.done)
+	this.enqueue(task)
+}
+
+func (this *applyPool) enqueue(task *applyTask) {
+	this.mu.Lock()
+	for this.paused {
+		this.cond.Wait()
+	}
+	this.pending++
+	this.mu.Unlock()
+	this.tasks <- task
+}
+
+// drain blocks until all the submitted requests are applied.
+func (this *applyPool) drain() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for this.pending > 0 {
+		this.cond.Wait()
+	}
+}
+
+// pause drains the pool and holds back any further submissions
+// until the returned function is called, so that the store can be
+// backed up at a consistent applied index.
+func (this *applyPool) pause() (resume func()) {
+	this.mu.Lock()
+	this.paused = true
+	for this.pending > 0 {
+		this.cond.Wait()
+	}
+	this.mu.Unlock()
+	return func() {
+		this.mu.Lock()
+		this.paused = false
+		this.cond.Broadcast()
+		this.mu.Unlock()
+	}
+}
+
+func (this *applyPool) stop() {
+	this.drain()
+	for _, work := range this.workers {
+		close(work)
+	}
+	close(this.tasks)
+}
@@ -0,0 +1,63 @@
+package raft
+
+import (
+	"time"
+
+	"github.com/flipkart-incubator/nexus/internal/stats"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// auditor hands over audit records to the configured AuditFunc via a
+// bounded queue, so that slow auditing does not hold up the apply loop
+// until the queue fills up. Records are never dropped, hence a full
+// queue eventually blocks applying entries.
+type auditor struct {
+	records  chan pkg_raft.AuditRecord
+	fn       pkg_raft.AuditFunc
+	stopc    <-chan struct{}
+	statsCli stats.Client
+}
+
+func newAuditor(fn pkg_raft.AuditFunc, queueSize int, stopc <-chan struct{}, statsCli stats.Client) *auditor {
+	return &auditor{
+		records:  make(chan pkg_raft.AuditRecord, queueSize),
+		fn:       fn,
+		stopc:    stopc,
+		statsCli: statsCli,
+	}
+}
+
+func (this *auditor) audit(record pkg_raft.AuditRecord) {
+	select {
+	case this.records <- record:
+		return
+	default:
+		this.statsCli.Incr("audit.queue.full", 1)
+	}
+	queueStart := time.Now()
+	select {
+	case this.records <- record:
+	case <-this.stopc:
+	}
+	this.statsCli.Timing("audit.queue.wait.ms", queueStart)
+}
+
+// run invokes the AuditFunc with all the queued records until stopped,
+// after which the records still in the queue are audited as well.
+func (this *auditor) run() {
+	for {
+		select {
+		case record := <-this.records:
+			this.fn(record)
+		case <-this.stopc:
+			for {
+				select {
+				case record := <-this.records:
+					this.fn(record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
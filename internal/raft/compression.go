@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/flipkart-incubator/nexus/models"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// compressPayloads compresses the payloads of the given request using
+// the given codec, if they are at least of the given size in total and
+// shrink on being compressed. Otherwise the request is left as is.
+func compressPayloads(replReq *models.NexusInternalRequest, compression pkg_raft.Compression, threshold int) error {
+	if compression == pkg_raft.NoCompression {
+		return nil
+	}
+	payloads := replReq.Batch
+	if len(payloads) == 0 {
+		payloads = [][]byte{replReq.Req}
+	}
+	size := 0
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+	if size < threshold {
+		return nil
+	}
+	compressed, compressedSize := make([][]byte, len(payloads)), 0
+	for i, payload := range payloads {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		compressed[i] = buf.Bytes()
+		compressedSize += buf.Len()
+	}
+	if compressedSize >= size {
+		return nil
+	}
+	if len(replReq.Batch) > 0 {
+		replReq.Batch = compressed
+	} else {
+		replReq.Req = compressed[0]
+	}
+	replReq.Compression = uint32(compression)
+	return nil
+}
+
+// decompressPayloads reverses compressPayloads, leaving the request
+// with the payloads as given to Save.
+func decompressPayloads(replReq *models.NexusInternalRequest) error {
+	switch compression := pkg_raft.Compression(replReq.Compression); compression {
+	case pkg_raft.NoCompression:
+		return nil
+	case pkg_raft.GzipCompression:
+	default:
+		return fmt.Errorf("unknown compression of request: %v", compression)
+	}
+	decompress := func(payload []byte) ([]byte, error) {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	}
+	if len(replReq.Batch) > 0 {
+		for i, payload := range replReq.Batch {
+			data, err := decompress(payload)
+			if err != nil {
+				return err
+			}
+			replReq.Batch[i] = data
+		}
+	} else {
+		data, err := decompress(replReq.Req)
+		if err != nil {
+			return err
+		}
+		replReq.Req = data
+	}
+	replReq.Compression = uint32(pkg_raft.NoCompression)
+	return nil
+}
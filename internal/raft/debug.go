@@ -0,0 +1,76 @@
+package raft
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+func (this *replicator) startDebugServer() {
+	addr := this.opts.DebugServerAddr()
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/raft/status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, this.node.node.Status())
+	})
+	mux.HandleFunc("/debug/raft/members", func(w http.ResponseWriter, _ *http.Request) {
+		lead, members := this.ListMembers()
+		voters, quorum := this.ReplicationFactor()
+		writeJSON(w, map[string]interface{}{"leader": lead, "members": members, "pendingAdds": this.PendingMemberAdds(),
+			"voters": voters, "quorum": quorum})
+	})
+
+	mux.HandleFunc("/debug/raft/inflight", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, this.InflightOps())
+	})
+	mux.HandleFunc("/debug/raft/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			http.Error(w, "use PUT or POST with a 'level' query parameter", http.StatusMethodNotAllowed)
+			return
+		}
+		level, err := pkg_raft.ParseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prevLevel := this.SetLogLevel(level)
+		writeJSON(w, map[string]string{"previous": prevLevel.String(), "current": level.String()})
+	})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		this.logger.Warnf("[Node %x] Unable to start debug server at %s. Error: %v", this.node.id, addr, err)
+		return
+	}
+	this.debugSrv = &http.Server{Handler: mux}
+	go func(srv *http.Server) {
+		this.logger.Infof("[Node %x] Serving debug endpoints at %s", this.node.id, addr)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			this.logger.Warnf("[Node %x] Debug server stopped. Error: %v", this.node.id, err)
+		}
+	}(this.debugSrv)
+}
+
+func (this *replicator) stopDebugServer() {
+	if this.debugSrv != nil {
+		this.debugSrv.Close()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,118 @@
+package raft
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/coreos/etcd/raft/raftpb"
+	"github.com/flipkart-incubator/nexus/models"
+	"github.com/golang/protobuf/proto"
+)
+
+// maxAppliedKeys bounds the number of idempotency keys remembered by
+// every node, beyond which the least recently used ones are forgotten.
+const maxAppliedKeys = 1 << 16
+
+// appliedKeys remembers the outcome of the requests applied with an
+// idempotency key, so that a retried request carrying the same key is
+// not applied again, whether or not the earlier one failed. Since the
+// keys are retained in RAFT snapshots, and rebuilt from the log for the
+// entries the store applied before a restart, every node agrees on
+// which requests are duplicates. Only the index of the request is known
+// for the keys retained this way, not its response.
+//
+// Keys are evicted in LRU order. A key being retried is found again on
+// every retry, keeping it remembered for as long as its client retries.
+type appliedKeys struct {
+	mu      sync.Mutex
+	results map[string]*list.Element
+	lru     *list.List // of *appliedResult, most recently used first
+}
+
+type appliedResult struct {
+	key string
+	res internalNexusResponse
+}
+
+func newAppliedKeys() *appliedKeys {
+	return &appliedKeys{results: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns the outcome of the request applied earlier with the
+// given key, if any, marking the key as recently used.
+func (this *appliedKeys) get(key string) (internalNexusResponse, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	elem, ok := this.results[key]
+	if !ok {
+		return internalNexusResponse{}, false
+	}
+	this.lru.MoveToFront(elem)
+	return elem.Value.(*appliedResult).res, true
+}
+
+// put records the outcome of the request applied with the given key,
+// evicting the least recently used key if the limit is reached.
+func (this *appliedKeys) put(key string, res internalNexusResponse) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if elem, ok := this.results[key]; ok {
+		this.lru.MoveToFront(elem)
+		return
+	}
+	if this.lru.Len() >= maxAppliedKeys {
+		oldest := this.lru.Back()
+		this.lru.Remove(oldest)
+		delete(this.results, oldest.Value.(*appliedResult).key)
+	}
+	this.results[key] = this.lru.PushFront(&appliedResult{key, res})
+}
+
+// appliedKey is an idempotency key retained in RAFT snapshots, along
+// with the index at which its request got applied.
+type appliedKey struct {
+	Key   string `json:"key"`
+	Index uint64 `json:"index"`
+}
+
+// snapshot returns the keys remembered, from the least to the most
+// recently used.
+func (this *appliedKeys) snapshot() []appliedKey {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	keys := make([]appliedKey, 0, this.lru.Len())
+	for elem := this.lru.Back(); elem != nil; elem = elem.Prev() {
+		applied := elem.Value.(*appliedResult)
+		keys = append(keys, appliedKey{applied.key, applied.res.Index})
+	}
+	return keys
+}
+
+// restore replaces the keys remembered with the given ones, listed
+// from the least to the most recently used.
+func (this *appliedKeys) restore(keys []appliedKey) {
+	this.mu.Lock()
+	this.results, this.lru = make(map[string]*list.Element), list.New()
+	this.mu.Unlock()
+	for _, key := range keys {
+		this.put(key.Key, internalNexusResponse{Index: key.Index})
+	}
+}
+
+// putEntries remembers the keys of the requests in the given entries,
+// which have already been applied onto the store.
+func (this *appliedKeys) putEntries(ents []raftpb.Entry) error {
+	for _, entry := range ents {
+		if entry.Type != raftpb.EntryNormal || len(entry.Data) == 0 {
+			continue
+		}
+		var replReq models.NexusInternalRequest
+		if err := proto.Unmarshal(entry.Data, &replReq); err != nil {
+			return err
+		}
+		if replReq.IdempotencyKey != "" {
+			this.put(replReq.IdempotencyKey, internalNexusResponse{Index: entry.Index})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package raft
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// maxDigestCheckpoints bounds the number of recent checkpoints whose
+// digests are remembered by every node for comparing with the digests
+// reported by the other nodes.
+const maxDigestCheckpoints = 64
+
+// applyDigest accumulates a digest of the outcome of saving every entry
+// onto the store, over windows of a fixed number of entries. The digest
+// of an entry covers its index, the response of the store and the error,
+// if any. Digests of entries are combined by addition, so that the
+// digest of a window does not depend on the order in which its entries
+// were applied, such as when applying in parallel.
+//
+// Only the digests of windows applied entirely by this node are
+// recorded, since entries restored via a snapshot or replayed prior to
+// a restart are not observed.
+type applyDigest struct {
+	interval    uint64
+	sum         uint64
+	windowStart uint64
+	mu          sync.Mutex
+	checkpoints map[uint64]uint64
+}
+
+func newApplyDigest(interval uint64) *applyDigest {
+	return &applyDigest{interval: interval, checkpoints: make(map[uint64]uint64)}
+}
+
+// add accumulates the outcome of applying the entry at the given index.
+// It is safe to be invoked concurrently by the apply workers.
+func (this *applyDigest) add(index uint64, replRes *internalNexusResponse) {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], index)
+	h.Write(buf[:])
+	h.Write(replRes.Res)
+	for _, res := range replRes.BatchRes {
+		binary.BigEndian.PutUint64(buf[:], uint64(len(res)))
+		h.Write(buf[:])
+		h.Write(res)
+	}
+	if replRes.Err != nil {
+		h.Write([]byte(replRes.Err.Error()))
+	}
+	atomic.AddUint64(&this.sum, h.Sum64())
+}
+
+// observe must be invoked with the index of every committed entry, in
+// order, once the entry has been applied. At the end of every window,
+// it returns the digest of the window if the window was entirely
+// observed.
+func (this *applyDigest) observe(index uint64) (uint64, bool) {
+	if this.windowStart == 0 {
+		this.windowStart = index
+	}
+	if index%this.interval != 0 {
+		return 0, false
+	}
+	complete := this.windowStart+this.interval == index+1
+	sum := atomic.SwapUint64(&this.sum, 0)
+	this.windowStart = index + 1
+	if !complete {
+		return 0, false
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkpoints[index] = sum
+	if index > maxDigestCheckpoints*this.interval {
+		delete(this.checkpoints, index-maxDigestCheckpoints*this.interval)
+	}
+	return sum, true
+}
+
+// reset discards the partially observed window, such as on restoring
+// the store from a snapshot.
+func (this *applyDigest) reset() {
+	atomic.StoreUint64(&this.sum, 0)
+	this.windowStart = 0
+}
+
+// verify compares the given digest reported for the checkpoint at the
+// given index with the one recorded by this node. The returned known
+// flag is false if this node has no digest recorded for the checkpoint.
+func (this *applyDigest) verify(index, digest uint64) (match bool, known bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	sum, known := this.checkpoints[index]
+	return known && sum == digest, known
+}
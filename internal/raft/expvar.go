@@ -0,0 +1,96 @@
+package raft
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// expvarVars tracks the expvar keys published by the replicators in this
+// process. As expvar cannot unpublish a key, a stopped replicator is only
+// detached from its key, which a replicator started later may then reuse.
+var expvarVars = struct {
+	sync.Mutex
+	byKey map[string]*expvarVar
+}{byKey: make(map[string]*expvarVar)}
+
+// expvarVar is published in place of the replicator itself, so that
+// the replicator is not kept alive by expvar after it is stopped.
+type expvarVar struct {
+	mu   sync.RWMutex
+	repl *replicator
+}
+
+func (this *expvarVar) metrics() interface{} {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if this.repl == nil {
+		return nil
+	}
+	return this.repl.expvarMetrics()
+}
+
+func (this *expvarVar) attach(repl *replicator) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.repl != nil {
+		return false
+	}
+	this.repl = repl
+	return true
+}
+
+func (this *expvarVar) detach(repl *replicator) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.repl == repl {
+		this.repl = nil
+	}
+}
+
+// publishExpvar publishes the key RAFT metrics of this node via expvar,
+// if configured. These are computed afresh every time they are read.
+func (this *replicator) publishExpvar() {
+	key := this.opts.ExpvarNamespace()
+	if key == "" {
+		return
+	}
+	expvarVars.Lock()
+	defer expvarVars.Unlock()
+	if v, present := expvarVars.byKey[key]; present {
+		if v.attach(this) {
+			this.expvarVar = v
+			return
+		}
+	} else if expvar.Get(key) == nil {
+		v = &expvarVar{repl: this}
+		expvar.Publish(key, expvar.Func(v.metrics))
+		expvarVars.byKey[key] = v
+		this.expvarVar = v
+		return
+	}
+	this.logger.Warnf("[Node %x] Unable to publish RAFT metrics via expvar, key: %s is already in use", this.node.id, key)
+}
+
+// unpublishExpvar detaches this node from its expvar key, which then
+// reads as null till another replicator publishes under it.
+func (this *replicator) unpublishExpvar() {
+	if this.expvarVar != nil {
+		this.expvarVar.detach(this)
+	}
+}
+
+func (this *replicator) expvarMetrics() interface{} {
+	status := this.node.node.Status()
+	return map[string]interface{}{
+		"node_id":             this.node.id,
+		"leader_id":           status.Lead,
+		"term":                status.Term,
+		"commit_index":        status.Commit,
+		"applied_index":       this.AppliedIndex(),
+		"inflight_proposals":  atomic.LoadInt64(&this.inflightProposals),
+		"proposals_made":      atomic.LoadUint64(&this.proposals.made),
+		"proposals_committed": atomic.LoadUint64(&this.proposals.committed),
+		"proposals_failed":    atomic.LoadUint64(&this.proposals.failed),
+	}
+}
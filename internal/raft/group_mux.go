@@ -0,0 +1,115 @@
+package raft
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/coreos/etcd/pkg/types"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// clusterIdHeader is set by rafthttp on all the requests it sends to
+// peers, carrying the ID of the sender's cluster.
+const clusterIdHeader = "X-Etcd-Cluster-ID"
+
+var (
+	groupListenersMu sync.Mutex
+	// groupListeners are the listeners shared by the RAFT groups of
+	// this process, keyed by the address they listen on.
+	groupListeners = make(map[string]*groupListener)
+)
+
+// groupListener serves the rafthttp traffic of all the RAFT groups of
+// this process sharing a node URL, routing every request to the group
+// whose cluster ID it carries. Since GroupId is part of the cluster ID,
+// each group gets a distinct one.
+type groupListener struct {
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+	stopc    chan struct{}
+	donec    chan struct{}
+}
+
+func (this *groupListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mu.RLock()
+	handler, present := this.handlers[r.Header.Get(clusterIdHeader)]
+	if !present && r.Header.Get(clusterIdHeader) == "" {
+		// requests such as probes carry no cluster ID
+		// and are served alike by all the groups
+		for _, handler = range this.handlers {
+			present = true
+			break
+		}
+	}
+	this.mu.RUnlock()
+	if !present {
+		http.Error(w, "unknown RAFT group", http.StatusPreconditionFailed)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// shareListener serves the given rafthttp handler of the group with the
+// given cluster ID on the listener shared at the given address, which is
+// created if this is the first group served on it. The returned function
+// stops serving the group, closing the listener once no groups are left.
+func shareListener(addr string, cid types.ID, handler http.Handler, logger pkg_raft.Logger) (func(), error) {
+	groupListenersMu.Lock()
+	defer groupListenersMu.Unlock()
+	gl, present := groupListeners[addr]
+	if !present {
+		gl = &groupListener{handlers: make(map[string]http.Handler), stopc: make(chan struct{}), donec: make(chan struct{})}
+		ln, err := newStoppableListener(addr, gl.stopc)
+		if err != nil {
+			return nil, err
+		}
+		groupListeners[addr] = gl
+		go func() {
+			err := (&http.Server{Handler: gl}).Serve(ln)
+			select {
+			case <-gl.stopc:
+			default:
+				logger.Fatalf("nexus.raft: Failed to serve rafthttp on %s (%v)", addr, err)
+			}
+			close(gl.donec)
+		}()
+	}
+
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	if _, present := gl.handlers[cid.String()]; present {
+		return nil, fmt.Errorf("RAFT group of cluster %s is already served on %s", cid, addr)
+	}
+	gl.handlers[cid.String()] = handler
+	return func() { releaseListener(addr, gl, cid) }, nil
+}
+
+// releaseListener stops serving the group with the given cluster ID on
+// the given shared listener. The listener is closed once no groups are
+// left, before any group can share the address again.
+func releaseListener(addr string, gl *groupListener, cid types.ID) {
+	groupListenersMu.Lock()
+	defer groupListenersMu.Unlock()
+	gl.mu.Lock()
+	delete(gl.handlers, cid.String())
+	last := len(gl.handlers) == 0
+	gl.mu.Unlock()
+	if last {
+		close(gl.stopc)
+		<-gl.donec
+		delete(groupListeners, addr)
+	}
+}
+
+// serveGroup serves the rafthttp traffic of this node on the listener
+// shared with the other RAFT groups of this process, till stopHTTP.
+func (rc *raftNode) serveGroup(addr string) {
+	release, err := shareListener(addr, types.ID(rc.cid), rc.transport.Handler(), rc.logger)
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] Failed to listen rafthttp (%v)", rc.id, err)
+	}
+	<-rc.httpstopc
+	release()
+	close(rc.httpdonec)
+}
@@ -0,0 +1,51 @@
+package raft
+
+import (
+	"sync"
+	"time"
+)
+
+// loadShedder rejects Saves for a while once too many of them time out
+// within a window, so that an overloaded cluster gets to drain the
+// proposals it already has instead of collapsing under new ones.
+type loadShedder struct {
+	mu          sync.Mutex
+	maxTimeouts int
+	window      time.Duration
+	windowStart time.Time
+	timeouts    int
+	shedUntil   time.Time
+}
+
+func newLoadShedder(maxTimeouts int, window time.Duration) *loadShedder {
+	return &loadShedder{maxTimeouts: maxTimeouts, window: window}
+}
+
+// timedOut records a Save having timed out at the given time, and
+// reports whether it starts the shedding of Saves.
+func (this *loadShedder) timedOut(now time.Time) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if now.Sub(this.windowStart) > this.window {
+		this.windowStart, this.timeouts = now, 0
+	}
+	this.timeouts++
+	if this.timeouts < this.maxTimeouts {
+		return false
+	}
+	shedding := now.Before(this.shedUntil)
+	this.shedUntil = now.Add(this.window)
+	this.windowStart, this.timeouts = now, 0
+	return !shedding
+}
+
+// retryAfter returns the time after which Saves are admitted again,
+// or 0 if they are being admitted at the given time.
+func (this *loadShedder) retryAfter(now time.Time) time.Duration {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if now.Before(this.shedUntil) {
+		return this.shedUntil.Sub(now)
+	}
+	return 0
+}
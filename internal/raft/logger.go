@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/coreos/etcd/raft"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// raftLog is the logger used by the etcd RAFT library. Since the
+// library only supports a global logger, its level is shared by all
+// the replicators within a process.
+var raftLog = newRaftLogger(pkg_raft.InfoLevel)
+
+func init() {
+	raft.SetLogger(raftLog)
+}
+
+// raftLogger filters the messages logged by the etcd RAFT library
+// based on a level that can be changed at runtime.
+type raftLogger struct {
+	level int32
+	*raft.DefaultLogger
+}
+
+func newRaftLogger(level pkg_raft.LogLevel) *raftLogger {
+	defLogger := &raft.DefaultLogger{Logger: log.New(os.Stderr, "raft", log.LstdFlags)}
+	defLogger.EnableDebug()
+	return &raftLogger{level: int32(level), DefaultLogger: defLogger}
+}
+
+func (this *raftLogger) setLevel(level pkg_raft.LogLevel) pkg_raft.LogLevel {
+	return pkg_raft.LogLevel(atomic.SwapInt32(&this.level, int32(level)))
+}
+
+func (this *raftLogger) enabled(level pkg_raft.LogLevel) bool {
+	return level >= pkg_raft.LogLevel(atomic.LoadInt32(&this.level))
+}
+
+func (this *raftLogger) Debug(v ...interface{}) {
+	if this.enabled(pkg_raft.DebugLevel) {
+		this.DefaultLogger.Debug(v...)
+	}
+}
+
+func (this *raftLogger) Debugf(format string, v ...interface{}) {
+	if this.enabled(pkg_raft.DebugLevel) {
+		this.DefaultLogger.Debugf(format, v...)
+	}
+}
+
+func (this *raftLogger) Info(v ...interface{}) {
+	if this.enabled(pkg_raft.InfoLevel) {
+		this.DefaultLogger.Info(v...)
+	}
+}
+
+func (this *raftLogger) Infof(format string, v ...interface{}) {
+	if this.enabled(pkg_raft.InfoLevel) {
+		this.DefaultLogger.Infof(format, v...)
+	}
+}
+
+func (this *raftLogger) Warning(v ...interface{}) {
+	if this.enabled(pkg_raft.WarnLevel) {
+		this.DefaultLogger.Warning(v...)
+	}
+}
+
+func (this *raftLogger) Warningf(format string, v ...interface{}) {
+	if this.enabled(pkg_raft.WarnLevel) {
+		this.DefaultLogger.Warningf(format, v...)
+	}
+}
+
+func (this *raftLogger) Error(v ...interface{}) {
+	if this.enabled(pkg_raft.ErrorLevel) {
+		this.DefaultLogger.Error(v...)
+	}
+}
+
+func (this *raftLogger) Errorf(format string, v ...interface{}) {
+	if this.enabled(pkg_raft.ErrorLevel) {
+		this.DefaultLogger.Errorf(format, v...)
+	}
+}
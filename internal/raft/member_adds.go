@@ -0,0 +1,76 @@
+package raft
+
+import (
+	"context"
+	"sync"
+
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// memberAdds throttles the number of members being added concurrently,
+// so that the leader does not send out several snapshots at once to
+// new members catching up with it. It only throttles the additions made
+// via this node, and does so only while this node is the leader, since
+// followers cannot tell how far the new members have caught up.
+type memberAdds struct {
+	slots  chan struct{}
+	mu     sync.Mutex
+	states map[string]pkg_raft.MemberAddState
+}
+
+func newMemberAdds(concurrency int) *memberAdds {
+	return &memberAdds{
+		slots:  make(chan struct{}, concurrency),
+		states: make(map[string]pkg_raft.MemberAddState),
+	}
+}
+
+// acquire blocks until the member with the given URL can be added,
+// or the given context expires.
+func (this *memberAdds) acquire(ctx context.Context, nodeUrl string) error {
+	this.setState(nodeUrl, pkg_raft.MemberAddQueued)
+	select {
+	case this.slots <- struct{}{}:
+		this.setState(nodeUrl, pkg_raft.MemberAddInProgress)
+		return nil
+	case <-ctx.Done():
+		this.clearState(nodeUrl)
+		return ctx.Err()
+	}
+}
+
+// release marks the addition of the member with the given URL as
+// complete, letting the next queued addition proceed.
+func (this *memberAdds) release(nodeUrl string) {
+	this.clearState(nodeUrl)
+	<-this.slots
+}
+
+// full reports whether as many members as allowed are being added,
+// in which case another addition would have to wait.
+func (this *memberAdds) full() bool {
+	return len(this.slots) == cap(this.slots)
+}
+
+// pending returns the states of all the additions yet to complete.
+func (this *memberAdds) pending() map[string]pkg_raft.MemberAddState {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	res := make(map[string]pkg_raft.MemberAddState, len(this.states))
+	for nodeUrl, state := range this.states {
+		res[nodeUrl] = state
+	}
+	return res
+}
+
+func (this *memberAdds) setState(nodeUrl string, state pkg_raft.MemberAddState) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.states[nodeUrl] = state
+}
+
+func (this *memberAdds) clearState(nodeUrl string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	delete(this.states, nodeUrl)
+}
@@ -15,21 +15,25 @@
 package raft
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	internal_snap "github.com/coreos/etcd/snap"
 	"github.com/flipkart-incubator/nexus/pkg/db"
 	"io"
-	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/flipkart-incubator/nexus/internal/raft/snap"
@@ -59,13 +63,19 @@ type raftNode struct {
 
 	id          uint64 // client ID for raft session
 	cid         uint64 //clusterId
+	groupId     uint64 // RAFT group sharing the listener of this process, if non-zero
 	join        bool   // node is joining an existing cluster
 	waldir      string // path to WAL directory
 	snapdir     string // path to snapshot directory
+	dbsnapdir   string // path to directory of DB snapshots received from leader
+	joinSnap    string // path to snapshot to seed this node from when joining
+	snapStore   pkg_raft.SnapshotStore
 	getSnapshot func(db.SnapshotState) (io.ReadCloser, error)
-	lastIndex   uint64 // index of log at start
+	appliedKeys *appliedKeys // idempotency keys retained in snapshots, if any
+	lastIndex   uint64       // index of log at start
 
-	confState     raftpb.ConfState
+	confState     raftpb.ConfState // written only by the RAFT loop, under peersMu
+	voters        int32            // number of voters in confState, read concurrently
 	snapshotIndex uint64
 	appliedIndex  uint64
 
@@ -81,11 +91,32 @@ type raftNode struct {
 	httpstopc  chan struct{} // signals http server to shutdown
 	httpdonec  chan struct{} // signals http server shutdown complete
 	readOption raft.ReadOnlyOption
-	statsCli   stats.Client
-	rpeers     map[uint64]string
+	noElection bool
+	preVote    bool
+
+	heartbeatTick, electionTick int
+	tickInterval                time.Duration
+	statsCli                    stats.Client
+	logger                      pkg_raft.Logger
+	lastTick                    int64                    // unix nanos when the event loop last ticked
+	snapshotReqC                chan chan snapshotResult // snapshots forced by operators, taken by the event loop
+
+	storeEntry         db.RaftEntry // last entry applied by store at start
+	termMismatchPolicy pkg_raft.TermMismatchPolicy
+	restoreStore       func(raftpb.SnapshotMetadata) error // restores a diverging store from the given snapshot
+	rpeers             map[uint64]string
+	peersMu            sync.RWMutex      // guards rpeers, confState, shadows and serviceAddrs, which are read outside of the RAFT loop
+	shadows            map[uint64]bool   // members that must not be visible to clients
+	serviceAddrs       map[uint64]string // gRPC service addresses advertised by the members
+	shadow             int32             // whether this node is a shadow, read concurrently
+	removed            int32             // whether this node got removed from the cluster, read concurrently
 
 	snapCount              uint64
 	snapshotCatchUpEntries uint64
+	maxInMemLogEntries     uint64
+	minSnapInterval        time.Duration
+	lastSnapAt             time.Time
+	snapSkipped            bool // whether the snapshot due was skipped for the interval
 	maxSnapFiles           uint
 	maxWALFiles            uint
 }
@@ -108,17 +139,33 @@ func NewRaftNode(opts pkg_raft.Options, statsCli stats.Client, store db.Store) *
 		errorC:                 errorC,
 		id:                     nodeId,
 		rpeers:                 opts.ClusterUrls(),
+		shadows:                make(map[uint64]bool),
+		serviceAddrs:           make(map[uint64]string),
+		snapshotReqC:           make(chan chan snapshotResult),
 		join:                   opts.Join(),
 		waldir:                 opts.LogDir(),
 		snapdir:                opts.SnapDir(),
+		dbsnapdir:              opts.DBSnapDir(),
+		joinSnap:               opts.JoinSnapshot(),
+		snapStore:              opts.SnapshotStore(),
+		groupId:                opts.GroupId(),
 		getSnapshot:            store.Backup,
 		snapCount:              opts.SnapshotCount(),
 		snapshotCatchUpEntries: opts.SnapshotCatchUpEntries(),
+		maxInMemLogEntries:     opts.MaxInMemLogEntries(),
+		minSnapInterval:        opts.MinSnapshotInterval(),
 		stopc:                  make(chan struct{}),
 		httpstopc:              make(chan struct{}),
 		httpdonec:              make(chan struct{}),
 		readOption:             opts.ReadOption(),
+		noElection:             opts.DisableElection(),
+		preVote:                opts.PreVote(),
+		heartbeatTick:          opts.HeartbeatTick(),
+		electionTick:           opts.ElectionTick(),
+		tickInterval:           opts.TickInterval(),
+		termMismatchPolicy:     opts.TermMismatchPolicy(),
 		statsCli:               statsCli,
+		logger:                 opts.Logger(),
 		maxSnapFiles:           opts.MaxSnapFiles(),
 		maxWALFiles:            opts.MaxWALFiles(),
 		// rest of structure populated after WAL replay
@@ -126,6 +173,13 @@ func NewRaftNode(opts pkg_raft.Options, statsCli stats.Client, store db.Store) *
 
 	if lastAppliedEntry, err := store.GetLastAppliedEntry(); err == nil {
 		rc.appliedIndex = lastAppliedEntry.Index
+		rc.storeEntry = lastAppliedEntry
+	}
+
+	if rc.maxInMemLogEntries != 0 && rc.maxInMemLogEntries <= rc.snapshotCatchUpEntries {
+		rc.logger.Warnf("nexus.raft: [Node %x] Ignoring max in-memory log entries: %d as it must exceed snapshot catch-up entries: %d",
+			nodeId, rc.maxInMemLogEntries, rc.snapshotCatchUpEntries)
+		rc.maxInMemLogEntries = 0
 	}
 
 	if rc.cid = opts.ClusterId(); rc.cid == 0 {
@@ -161,7 +215,7 @@ func (rc *raftNode) entriesToApply(ents []raftpb.Entry) (nents []raftpb.Entry) {
 	}
 	firstIdx := ents[0].Index
 	if firstIdx > rc.appliedIndex+1 {
-		log.Fatalf("[Node %x] first index of committed entry[%d] should <= progress.appliedIndex[%d]+1", rc.id, firstIdx, rc.appliedIndex)
+		rc.logger.Fatalf("[Node %x] first index of committed entry[%d] should <= progress.appliedIndex[%d]+1", rc.id, firstIdx, rc.appliedIndex)
 	}
 	if rc.appliedIndex-firstIdx+1 < uint64(len(ents)) {
 		nents = ents[rc.appliedIndex-firstIdx+1:]
@@ -182,24 +236,38 @@ func (rc *raftNode) publishEntries(ents []raftpb.Entry) bool {
 		case raftpb.EntryConfChange:
 			var cc raftpb.ConfChange
 			cc.Unmarshal(ents[i].Data)
-			rc.confState = *rc.node.ApplyConfChange(cc)
+			prevConfState := rc.confState
+			rc.setConfState(*rc.node.ApplyConfChange(cc))
+			rc.recordMembershipChange(prevConfState, cc.NodeID)
 			switch cc.Type {
-			case raftpb.ConfChangeAddNode:
+			case raftpb.ConfChangeAddNode, raftpb.ConfChangeAddLearnerNode:
 				if len(cc.Context) > 0 {
-					rc.transport.AddPeer(types.ID(cc.NodeID), []string{string(cc.Context)})
-					rc.rpeers[cc.NodeID] = string(cc.Context)
+					peerUrl, shadow := parseMemberContext(cc.Context)
+					rc.transport.AddPeer(types.ID(cc.NodeID), []string{peerUrl})
+					rc.peersMu.Lock()
+					rc.rpeers[cc.NodeID] = peerUrl
+					rc.peersMu.Unlock()
+					rc.setShadow(cc.NodeID, shadow)
 				}
+			case raftpb.ConfChangeUpdateNode:
+				// members advertise their service address by updating themselves
+				rc.setServiceAddr(cc.NodeID, string(cc.Context))
 			case raftpb.ConfChangeRemoveNode:
 				if cc.NodeID == rc.id {
-					log.Printf("[Node %x] I've been removed from the cluster! Shutting down.", rc.id)
+					rc.logger.Infof("[Node %x] I've been removed from the cluster! Shutting down.", rc.id)
+					atomic.StoreInt32(&rc.removed, 1)
 					// TODO: In this case, check if its OK to not publish to rc.commitC
 					return false
 				}
 				if _, ok := rc.rpeers[cc.NodeID]; !ok {
-					log.Printf("[Node %x] WARNING Ignoring request to remove non-existing Node with ID: %v from the cluster.", rc.id, cc.NodeID)
+					rc.logger.Infof("[Node %x] WARNING Ignoring request to remove non-existing Node with ID: %v from the cluster.", rc.id, cc.NodeID)
 				} else {
 					rc.transport.RemovePeer(types.ID(cc.NodeID))
+					rc.peersMu.Lock()
 					delete(rc.rpeers, cc.NodeID)
+					rc.peersMu.Unlock()
+					rc.setShadow(cc.NodeID, false)
+					rc.setServiceAddr(cc.NodeID, "")
 				}
 			}
 		}
@@ -227,7 +295,7 @@ func (rc *raftNode) publishEntries(ents []raftpb.Entry) bool {
 func (rc *raftNode) loadSnapshot() *raftpb.Snapshot {
 	snapshot, data, err := rc.snapshotter.LoadSnapshot()
 	if err != nil && err != snap.ErrNoSnapshot {
-		log.Fatalf("nexus.raft: [Node %x] error loading snapshot (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] error loading snapshot (%v)", rc.id, err)
 	}
 	if snapshot != nil && data != nil {
 		defer data.Close()
@@ -239,12 +307,12 @@ func (rc *raftNode) loadSnapshot() *raftpb.Snapshot {
 func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot) *wal.WAL {
 	if !wal.Exist(rc.waldir) {
 		if err := os.MkdirAll(rc.waldir, 0750); err != nil {
-			log.Fatalf("nexus.raft: [Node %x] cannot create dir for wal (%v)", rc.id, err)
+			rc.logger.Fatalf("nexus.raft: [Node %x] cannot create dir for wal (%v)", rc.id, err)
 		}
 
 		w, err := wal.Create(rc.waldir, nil)
 		if err != nil {
-			log.Fatalf("nexus.raft: [Node %x] create wal error (%v)", rc.id, err)
+			rc.logger.Fatalf("nexus.raft: [Node %x] create wal error (%v)", rc.id, err)
 		}
 		w.Close()
 	}
@@ -253,27 +321,98 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot) *wal.WAL {
 	if snapshot != nil {
 		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
 	}
-	log.Printf("[Node %x] loading WAL at term %d and index %d", rc.id, walsnap.Term, walsnap.Index)
+	rc.logger.Infof("[Node %x] loading WAL at term %d and index %d", rc.id, walsnap.Term, walsnap.Index)
 	w, err := wal.Open(rc.waldir, walsnap)
 	if err != nil {
-		log.Fatalf("nexus.raft: [Node %x] error loading wal (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] error loading wal (%v)", rc.id, err)
 	}
 
 	return w
 }
 
+// seedFromSnapshot stages the snapshot given for joining as if this node
+// had already received it from the leader, so that it restarts from the
+// index of this snapshot and only the entries following it get shipped.
+func (rc *raftNode) seedFromSnapshot() {
+	snapshot, data, err := snap.ReadSnapshotFile(rc.joinSnap)
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot read snapshot to join from (%v)", rc.id, err)
+	}
+	defer data.Close()
+	if raft.IsEmptySnap(*snapshot) {
+		rc.logger.Fatalf("nexus.raft: [Node %x] snapshot to join from is empty: %s", rc.id, rc.joinSnap)
+	}
+	rc.seedFrom(snapshot, data)
+}
+
+// seedFromSnapshotStore seeds this node, joining the cluster, from the
+// latest snapshot on the snapshot store, if any, such as for recovering
+// it after losing its disk.
+func (rc *raftNode) seedFromSnapshotStore() {
+	snapshot, data, err := rc.snapshotter.LoadBackendSnapshot()
+	if err == snap.ErrNoSnapshot {
+		rc.logger.Infof("[Node %x] no snapshot on the snapshot store to seed from", rc.id)
+		return
+	}
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot read snapshot from the snapshot store (%v)", rc.id, err)
+	}
+	defer data.Close()
+	if raft.IsEmptySnap(*snapshot) {
+		return
+	}
+	rc.seedFrom(snapshot, data)
+}
+
+// seedFrom seeds the snapshot dirs and the WAL of this node from the
+// given snapshot, followed by the given DB snapshot.
+func (rc *raftNode) seedFrom(snapshot *raftpb.Snapshot, data io.Reader) {
+	snapIdx, snapTerm := snapshot.Metadata.Index, snapshot.Metadata.Term
+	rc.logger.Infof("[Node %x] seeding from snapshot at index: %d, term: %d", rc.id, snapIdx, snapTerm)
+
+	if err := rc.snapshotter.SaveDBSnapshot(snapIdx, data); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot save DB snapshot to join from (%v)", rc.id, err)
+	}
+	body, err := rc.snapshotter.LoadDBSnapshot()
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot load DB snapshot to join from (%v)", rc.id, err)
+	}
+	defer body.Close()
+	// the body is retained in the RAFT snapshot too, so that it
+	// can be shipped to other nodes once this node turns leader
+	if err := rc.snapshotter.SaveSnapshot(*snapshot, body); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot save snapshot to join from (%v)", rc.id, err)
+	}
+
+	if err := os.MkdirAll(rc.waldir, 0750); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot create dir for wal (%v)", rc.id, err)
+	}
+	w, err := wal.Create(rc.waldir, nil)
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] create wal error (%v)", rc.id, err)
+	}
+	defer w.Close()
+	if err := w.SaveSnapshot(walpb.Snapshot{Index: snapIdx, Term: snapTerm}); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot save snapshot to WAL (%v)", rc.id, err)
+	}
+	if err := w.Save(raftpb.HardState{Term: snapTerm, Commit: snapIdx}, nil); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot save hard state to WAL (%v)", rc.id, err)
+	}
+}
+
 // replayWAL replays WAL entries into the raft instance.
 func (rc *raftNode) replayWAL() *wal.WAL {
-	log.Printf("[Node %x] replaying WAL", rc.id)
+	rc.logger.Infof("[Node %x] replaying WAL", rc.id)
 	snapshot := rc.loadSnapshot()
 	w := rc.openWAL(snapshot)
 	_, st, ents, err := w.ReadAll()
 	if err != nil {
-		log.Fatalf("nexus.raft: [Node %x] failed to read WAL (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] failed to read WAL (%v)", rc.id, err)
 	}
 	rc.raftStorage = raft.NewMemoryStorage()
 	if snapshot != nil {
 		rc.raftStorage.ApplySnapshot(*snapshot)
+		rc.restoreSnapshotData(*snapshot)
 	}
 	rc.raftStorage.SetHardState(st)
 
@@ -290,6 +429,7 @@ func (rc *raftNode) replayWAL() *wal.WAL {
 
 func (rc *raftNode) writeError(err error) {
 	rc.stopHTTP()
+	rc.snapshotter.Close()
 	close(rc.commitC)
 	rc.errorC <- err
 	close(rc.errorC)
@@ -314,16 +454,79 @@ func (rc *raftNode) genClusterID() {
 	//log.Printf("genClusterID %+v Members %+v \n B Array %+v", rc.cid, mIDs, b)
 }
 
+// checkStoreConsistency verifies that the last entry applied by the store
+// agrees with the replayed RAFT log and resolves any divergence as per the
+// configured TermMismatchPolicy.
+func (rc *raftNode) checkStoreConsistency() {
+	if rc.storeEntry.Index == 0 {
+		return
+	}
+	hardState, _, err := rc.raftStorage.InitialState()
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] unable to read RAFT hard state (%v)", rc.id, err)
+	}
+
+	var mismatch string
+	if rc.storeEntry.Index > hardState.Commit {
+		mismatch = fmt.Sprintf("store applied index %d beyond RAFT commit index %d", rc.storeEntry.Index, hardState.Commit)
+	} else if term, err := rc.raftStorage.Term(rc.storeEntry.Index); err == nil && term != rc.storeEntry.Term {
+		mismatch = fmt.Sprintf("store applied index %d at term %d whereas RAFT has it at term %d", rc.storeEntry.Index, rc.storeEntry.Term, term)
+	}
+	if mismatch == "" {
+		return
+	}
+
+	rc.statsCli.Incr("raft.store.term.mismatch", 1)
+	switch rc.termMismatchPolicy {
+	case pkg_raft.TrustRaft:
+		snap, err := rc.raftStorage.Snapshot()
+		if err != nil {
+			rc.logger.Fatalf("nexus.raft: [Node %x] unable to read RAFT snapshot (%v)", rc.id, err)
+		}
+		// rewinding the applied index alone would leave behind whatever
+		// the store applied beyond the snapshot
+		if raft.IsEmptySnap(snap) || rc.restoreStore == nil {
+			rc.logger.Fatalf("nexus.raft: [Node %x] Store diverges from RAFT, %s, and there is no snapshot to restore it from. Halting.", rc.id, mismatch)
+		}
+		rc.logger.Warnf("nexus.raft: [Node %x] Store diverges from RAFT, %s. Restoring it from snapshot at index %d and re-applying entries after it.", rc.id, mismatch, snap.Metadata.Index)
+		if err := rc.restoreStore(snap.Metadata); err != nil {
+			rc.logger.Fatalf("nexus.raft: [Node %x] unable to restore store from snapshot at index %d (%v)", rc.id, snap.Metadata.Index, err)
+		}
+		rc.appliedIndex = snap.Metadata.Index
+		rc.storeEntry = db.RaftEntry{Index: snap.Metadata.Index, Term: snap.Metadata.Term}
+	default:
+		rc.logger.Fatalf("nexus.raft: [Node %x] Store diverges from RAFT, %s. Halting.", rc.id, mismatch)
+	}
+}
+
 func (rc *raftNode) startRaft() {
 	if !fileutil.Exist(rc.snapdir) {
 		if err := os.MkdirAll(rc.snapdir, 0750); err != nil {
-			log.Fatalf("nexus.raft: [Node %x] cannot create dir for snapshot (%v)", rc.id, err)
+			rc.logger.Fatalf("nexus.raft: [Node %x] cannot create dir for snapshot (%v)", rc.id, err)
 		}
 	}
-	rc.snapshotter = snap.New(rc.snapdir)
+	if err := fileutil.TouchDirAll(rc.dbsnapdir); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] cannot create dir for DB snapshot (%v)", rc.id, err)
+	}
+	if err := fileutil.IsDirWriteable(rc.dbsnapdir); err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] dir for DB snapshot is not writable (%v)", rc.id, err)
+	}
+	rc.snapshotter = snap.NewWithDBDir(rc.snapdir, rc.dbsnapdir)
+	if rc.snapStore != nil {
+		rc.snapshotter.WithBackend(rc.snapStore, rc.maxSnapFiles)
+	}
 
+	// a former member must not be seeded, as it would lose its RAFT
+	// hard state, hence only the ones joining afresh are seeded
+	if rc.join && rc.joinSnap != "" && !wal.Exist(rc.waldir) {
+		rc.seedFromSnapshot()
+	} else if rc.join && rc.snapStore != nil && !wal.Exist(rc.waldir) {
+		rc.seedFromSnapshotStore()
+	}
 	oldwal := wal.Exist(rc.waldir)
 	rc.wal = rc.replayWAL()
+	rc.checkStoreConsistency()
+	rc.rebuildFromLog()
 
 	var rpeers []raft.Peer
 	for id, peer := range rc.rpeers {
@@ -331,14 +534,18 @@ func (rc *raftNode) startRaft() {
 	}
 	c := &raft.Config{
 		ID:              rc.id,
-		ElectionTick:    10,
-		HeartbeatTick:   1,
+		ElectionTick:    rc.electionTick,
+		HeartbeatTick:   rc.heartbeatTick,
 		Storage:         rc.raftStorage,
 		MaxSizePerMsg:   1024 * 1024,
 		MaxInflightMsgs: 256,
 		ReadOnlyOption:  rc.readOption,
 		CheckQuorum:     rc.readOption == raft.ReadOnlyLeaseBased,
 		Applied:         rc.appliedIndex,
+		// With elections disabled, campaigns begin with a pre-vote that
+		// never leaves this node (see sendToTransport), so the term is
+		// never bumped and the current leader is not disrupted.
+		PreVote: rc.preVote || rc.noElection,
 	}
 
 	if oldwal {
@@ -358,7 +565,7 @@ func (rc *raftNode) startRaft() {
 		ServerStats: etcd_stats.NewServerStats("", ""),
 		LeaderStats: etcd_stats.NewLeaderStats(strconv.Itoa(int(rc.id))),
 		ErrorC:      make(chan error),
-		Snapshotter: internal_snap.New(rc.snapdir),
+		Snapshotter: internal_snap.New(rc.dbsnapdir),
 	}
 
 	rc.transport.Start()
@@ -375,6 +582,7 @@ func (rc *raftNode) startRaft() {
 // stop closes http, closes all channels, and stops raft.
 func (rc *raftNode) stop() {
 	rc.stopHTTP()
+	rc.snapshotter.Close()
 	close(rc.commitC)
 	close(rc.errorC)
 	rc.node.Stop()
@@ -391,47 +599,113 @@ func (rc *raftNode) publishSnapshot(snapshotToSave raftpb.Snapshot) {
 		return
 	}
 
-	log.Printf("nexus.raft: [Node %x] publishing snapshot at index %d", rc.id, rc.snapshotIndex)
-	defer log.Printf("nexus.raft: [Node %x] finished publishing snapshot at index %d", rc.id, rc.snapshotIndex)
+	rc.logger.Infof("nexus.raft: [Node %x] publishing snapshot at index %d", rc.id, rc.snapshotIndex)
+	defer rc.logger.Infof("nexus.raft: [Node %x] finished publishing snapshot at index %d", rc.id, rc.snapshotIndex)
 
 	if snapshotToSave.Metadata.Index <= rc.appliedIndex {
-		log.Fatalf("nexus.raft: [Node %x] snapshot index [%d] should > progress.appliedIndex [%d]", rc.id, snapshotToSave.Metadata.Index, rc.appliedIndex)
+		rc.logger.Fatalf("nexus.raft: [Node %x] snapshot index [%d] should > progress.appliedIndex [%d]", rc.id, snapshotToSave.Metadata.Index, rc.appliedIndex)
 	}
 	rc.commitC <- nil // trigger kvstore to load snapshot
 
-	rc.confState = snapshotToSave.Metadata.ConfState
+	rc.setConfState(snapshotToSave.Metadata.ConfState)
+	rc.restoreSnapshotData(snapshotToSave)
 	rc.snapshotIndex = snapshotToSave.Metadata.Index
 	rc.appliedIndex = snapshotToSave.Metadata.Index
 }
 
+// inMemLogFull reports whether the number of applied log entries held
+// in the RAFT storage exceeds the configured limit. Entries not applied
+// yet are left out, as a snapshot cannot compact them, else a node that
+// lags in applying would snapshot on every Ready.
+func (rc *raftNode) inMemLogFull() bool {
+	first, err := rc.raftStorage.FirstIndex()
+	if err != nil {
+		return false
+	}
+	last, err := rc.raftStorage.LastIndex()
+	if err != nil || last < first {
+		return false
+	}
+	rc.statsCli.Gauge("raft.log.inmem.entries", int64(last-first+1))
+	if rc.appliedIndex < first {
+		return false
+	}
+	numApplied := rc.appliedIndex - first + 1
+	return rc.maxInMemLogEntries != 0 && numApplied > rc.maxInMemLogEntries
+}
+
 func (rc *raftNode) maybeTriggerSnapshot() {
-	if rc.appliedIndex-rc.snapshotIndex <= rc.snapCount {
+	if rc.appliedIndex == rc.snapshotIndex {
+		return
+	}
+	inMemLogFull := rc.inMemLogFull()
+	if rc.appliedIndex-rc.snapshotIndex <= rc.snapCount && !inMemLogFull {
 		return
 	}
+	if !inMemLogFull && rc.minSnapInterval > 0 && time.Since(rc.lastSnapAt) < rc.minSnapInterval {
+		// counted once for every snapshot skipped, not every Ready
+		if !rc.snapSkipped {
+			rc.snapSkipped = true
+			rc.statsCli.Incr("raft.snapshot.skipped.interval", 1)
+		}
+		return
+	}
+	if err := rc.takeSnapshot(); err != nil {
+		panic(err)
+	}
+}
+
+type snapshotResult struct {
+	index uint64
+	err   error
+}
 
-	log.Printf("nexus.raft: [Node %x] start snapshot [applied index: %d | last snapshot index: %d]", rc.id, rc.appliedIndex, rc.snapshotIndex)
+// forceSnapshot takes a snapshot right away, regardless of the number
+// of entries applied since the last one, and returns its index. It is
+// a no-op if nothing has been applied since the last snapshot. Unlike
+// the automatic snapshots, failures are returned instead of panicking.
+func (rc *raftNode) forceSnapshot() (uint64, error) {
+	if rc.appliedIndex == rc.snapshotIndex {
+		return rc.snapshotIndex, nil
+	}
+	if err := rc.takeSnapshot(); err != nil {
+		return 0, err
+	}
+	rc.statsCli.Incr("raft.snapshot.forced", 1)
+	return rc.snapshotIndex, nil
+}
+
+func (rc *raftNode) takeSnapshot() error {
+	rc.logger.Infof("nexus.raft: [Node %x] start snapshot [applied index: %d | last snapshot index: %d]", rc.id, rc.appliedIndex, rc.snapshotIndex)
 	data, err := rc.getSnapshot(db.SnapshotState{SnapshotIndex: rc.snapshotIndex, AppliedIndex: rc.appliedIndex})
 	if err != nil {
-		log.Panic(err)
+		rc.logger.Errorf("nexus.raft: [Node %x] unable to back up store for snapshot (%v)", rc.id, err)
+		return err
 	}
 	defer data.Close()
-	snapshot, err := rc.raftStorage.CreateSnapshot(rc.appliedIndex, &rc.confState, nil)
+	snapshot, err := rc.raftStorage.CreateSnapshot(rc.appliedIndex, &rc.confState, rc.encodeSnapshotData())
 	if err != nil {
-		panic(err)
+		return err
 	}
 	if err := rc.saveSnap(snapshot, data); err != nil {
-		panic(err)
+		return err
 	}
 
 	if rc.appliedIndex > rc.snapshotCatchUpEntries {
 		compactIndex := rc.appliedIndex - rc.snapshotCatchUpEntries
-		if err := rc.raftStorage.Compact(compactIndex); err != nil {
-			panic(err)
+		// the log may already be compacted beyond this via CompactLog
+		if err := rc.raftStorage.Compact(compactIndex); err == nil {
+			rc.logger.Infof("nexus.raft: [Node %x] compacted log at index %d", rc.id, compactIndex)
+		} else if err != raft.ErrCompacted {
+			return err
 		}
-		log.Printf("nexus.raft: [Node %x] compacted log at index %d", rc.id, compactIndex)
 	}
 
 	rc.snapshotIndex = rc.appliedIndex
+	rc.lastSnapAt = time.Now()
+	rc.snapSkipped = false
+	rc.statsCli.Incr("raft.snapshot.taken", 1)
+	return nil
 }
 
 func (rc *raftNode) publishReadStates(readStates []raft.ReadState) bool {
@@ -452,7 +726,7 @@ func (rc *raftNode) serveChannels() {
 	if err != nil {
 		panic(err)
 	}
-	rc.confState = snap.Metadata.ConfState
+	rc.setConfState(snap.Metadata.ConfState)
 	rc.snapshotIndex = snap.Metadata.Index
 	// Set appliedIndex only if its not already initialised
 	// Note that we also set appliedIndex during init from
@@ -463,13 +737,15 @@ func (rc *raftNode) serveChannels() {
 
 	defer rc.wal.Close()
 
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(rc.tickInterval)
 	defer ticker.Stop()
+	var prevHardState raftpb.HardState
 
 	// event loop on raft state machine updates
 	for {
 		select {
 		case tick := <-ticker.C:
+			atomic.StoreInt64(&rc.lastTick, tick.UnixNano())
 			rc.node.Tick()
 			rc.statsCli.Timing("raft.tick.processing.latency.ms", tick)
 
@@ -479,20 +755,38 @@ func (rc *raftNode) serveChannels() {
 				rc.stop()
 				return
 			}
+			readyStart := time.Now()
 			rc.wal.Save(rd.HardState, rd.Entries)
+			rc.statsCli.Timing("raft.ready.wal.append.ms", readyStart)
+			if mustSyncWAL(rd.HardState, prevHardState, len(rd.Entries)) {
+				rc.statsCli.Timing("wal.fsync.ms", readyStart)
+			}
+			if !raft.IsEmptyHardState(rd.HardState) {
+				prevHardState = rd.HardState
+			}
 			if !raft.IsEmptySnap(rd.Snapshot) {
-				rc.saveSnap(rd.Snapshot, bytes.NewReader(rd.Snapshot.Data))
+				// the DB snapshot is received separately into the DB snapshot dir
+				rc.saveSnap(rd.Snapshot, nil)
 				rc.raftStorage.ApplySnapshot(rd.Snapshot)
 				rc.publishSnapshot(rd.Snapshot)
 			}
 			rc.raftStorage.Append(rd.Entries)
+			sendStart := time.Now()
 			rc.sendToTransport(rd.Messages)
+			rc.statsCli.Timing("raft.ready.msg.send.ms", sendStart)
+			commitStart := time.Now()
 			if ok := rc.publishEntries(rc.entriesToApply(rd.CommittedEntries)); !ok {
 				rc.stop()
 				return
 			}
+			rc.statsCli.Timing("raft.ready.commit.delivery.ms", commitStart)
 			rc.maybeTriggerSnapshot()
 			rc.node.Advance()
+			rc.statsCli.Timing("raft.ready.process.ms", readyStart)
+
+		case resC := <-rc.snapshotReqC:
+			index, err := rc.forceSnapshot()
+			resC <- snapshotResult{index, err}
 
 		case err := <-rc.transport.ErrorC:
 			rc.writeError(err)
@@ -514,10 +808,14 @@ func (rc *raftNode) serveChannels() {
 func (rc *raftNode) sendToTransport(msgs []raftpb.Message) {
 	var nonSnapMsgs []raftpb.Message
 	for _, msg := range msgs {
+		if rc.noElection && msg.Type == raftpb.MsgPreVote {
+			rc.statsCli.Incr("raft.prevote.suppressed", 1)
+			continue
+		}
 		if msg.Type == raftpb.MsgSnap {
 			snapReader, err := rc.snapshotter.LoadSnapshotBody(msg.Snapshot)
 			if err != nil {
-				log.Fatalf("nexus.raft: [Node %x] Error while loading snapshot - %v", rc.id, err)
+				rc.logger.Fatalf("nexus.raft: [Node %x] Error while loading snapshot - %v", rc.id, err)
 			}
 			snapMsg := internal_snap.NewMessage(msg, snapReader, 0)
 			// Overwrite the builtin ReadCloser post init which requires
@@ -529,11 +827,11 @@ func (rc *raftNode) sendToTransport(msgs []raftpb.Message) {
 				defer cancel()
 				select {
 				case <-timeout.Done():
-					log.Printf("[WARN] nexus.raft: [Node %x] Timed out sending snapshot, waited for %s", rc.id, sendSnapTimeout)
-				case ok := <- snapMsg.CloseNotify():
-					log.Printf("nexus.raft: [Node %x] Completed sending snapshot. Result: %v", rc.id, ok)
+					rc.logger.Warnf("nexus.raft: [Node %x] Timed out sending snapshot, waited for %s", rc.id, sendSnapTimeout)
+				case ok := <-snapMsg.CloseNotify():
+					rc.logger.Infof("nexus.raft: [Node %x] Completed sending snapshot. Result: %v", rc.id, ok)
 				}
-			} ()
+			}()
 		} else {
 			nonSnapMsgs = append(nonSnapMsgs, msg)
 		}
@@ -542,26 +840,36 @@ func (rc *raftNode) sendToTransport(msgs []raftpb.Message) {
 }
 
 func (rc *raftNode) serveRaft() {
-	url, err := url.Parse(rc.rpeers[rc.id])
+	url, err := url.Parse(rc.peerUrl(rc.id))
 	if err != nil {
-		log.Fatalf("nexus.raft: [Node %x] Failed parsing URL (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] Failed parsing URL (%v)", rc.id, err)
+	}
+
+	if rc.groupId != 0 {
+		rc.serveGroup(url.Host)
+		return
 	}
 
 	ln, err := newStoppableListener(url.Host, rc.httpstopc)
 	if err != nil {
-		log.Fatalf("nexus.raft: [Node %x] Failed to listen rafthttp (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] Failed to listen rafthttp (%v)", rc.id, err)
 	}
 
 	err = (&http.Server{Handler: rc.transport.Handler()}).Serve(ln)
 	select {
 	case <-rc.httpstopc:
 	default:
-		log.Fatalf("nexus.raft: [Node %x] Failed to serve rafthttp (%v)", rc.id, err)
+		rc.logger.Fatalf("nexus.raft: [Node %x] Failed to serve rafthttp (%v)", rc.id, err)
 	}
 	close(rc.httpdonec)
 }
 
 func (rc *raftNode) Process(ctx context.Context, m raftpb.Message) error {
+	if rc.noElection && m.Type == raftpb.MsgTimeoutNow {
+		// leadership transfers skip the pre-vote, so refuse them outright
+		rc.logger.Warnf("nexus.raft: [Node %x] Ignoring leadership transfer from %x as elections are disabled", rc.id, m.From)
+		return nil
+	}
 	return rc.node.Step(ctx, m)
 }
 func (rc *raftNode) IsIDRemoved(id uint64) bool                           { return false }
@@ -582,10 +890,12 @@ func newStoppableListener(addr string, stopc <-chan struct{}) (*stoppableListene
 }
 
 func (rc *raftNode) purgeFile() {
-	log.Printf("nexus.raft: [Node %x] Starting purgeFile() \n", rc.id)
-	var serrc, werrc <-chan error
+	rc.logger.Infof("nexus.raft: [Node %x] Starting purgeFile() \n", rc.id)
+	var serrc, derrc, werrc <-chan error
 	if rc.maxSnapFiles > 0 {
 		serrc = fileutil.PurgeFile(rc.snapdir, "snap", rc.maxSnapFiles, purgeFileInterval, rc.stopc)
+		// DB snapshots end with ".snap.db", hence are not purged above
+		derrc = fileutil.PurgeFile(rc.dbsnapdir, "snap.db", rc.maxSnapFiles, purgeFileInterval, rc.stopc)
 	}
 	if rc.maxWALFiles > 0 {
 		werrc = fileutil.PurgeFile(rc.waldir, "wal", rc.maxWALFiles, purgeFileInterval, rc.stopc)
@@ -593,9 +903,11 @@ func (rc *raftNode) purgeFile() {
 
 	select {
 	case e := <-serrc:
-		log.Fatalf("nexus.raft: [Node %x] failed to purge snap file %s", rc.id, e.Error())
+		rc.logger.Fatalf("nexus.raft: [Node %x] failed to purge snap file %s", rc.id, e.Error())
+	case e := <-derrc:
+		rc.logger.Fatalf("nexus.raft: [Node %x] failed to purge DB snap file %s", rc.id, e.Error())
 	case e := <-werrc:
-		log.Fatalf("nexus.raft: [Node %x] failed to purge wal file %s", rc.id, e.Error())
+		rc.logger.Fatalf("nexus.raft: [Node %x] failed to purge wal file %s", rc.id, e.Error())
 	case <-rc.stopc:
 		return
 	}
@@ -623,3 +935,288 @@ func (ln stoppableListener) Accept() (c net.Conn, err error) {
 		return tc, nil
 	}
 }
+
+const (
+	addVoterChange   = "add_voter"
+	addLearnerChange = "add_learner"
+	promoteChange    = "promote"
+	removeChange     = "remove"
+)
+
+// recordMembershipChange logs and emits a metric describing how the
+// membership of the given node changed from the given configuration
+// to the one currently in effect.
+func (rc *raftNode) recordMembershipChange(prev raftpb.ConfState, nodeID uint64) {
+	if change := membershipChange(prev, rc.confState, nodeID); change != "" {
+		rc.logger.Infof("[Node %x] Membership change: %s of Node %x. Voters: %v, Learners: %v", rc.id, change, nodeID, rc.confState.Nodes, rc.confState.Learners)
+		rc.statsCli.IncrWithTags("raft.membership.change", 1, stats.NewTag("type", change))
+	}
+}
+
+// membershipChange classifies the transition of the given node between
+// two configurations. An empty string is returned if the role of the
+// node is the same in both.
+func membershipChange(prev, next raftpb.ConfState, nodeID uint64) string {
+	wasVoter, wasLearner := containsID(prev.Nodes, nodeID), containsID(prev.Learners, nodeID)
+	isVoter, isLearner := containsID(next.Nodes, nodeID), containsID(next.Learners, nodeID)
+	switch {
+	case isVoter && wasLearner:
+		return promoteChange
+	case isVoter && !wasVoter:
+		return addVoterChange
+	case isLearner && !wasLearner && !wasVoter:
+		return addLearnerChange
+	case !isVoter && !isLearner && (wasVoter || wasLearner):
+		return removeChange
+	}
+	return ""
+}
+
+func containsID(ids []uint64, id uint64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfState records the given ConfState, along with the number of
+// voters in it for reading outside of the RAFT loop.
+func (rc *raftNode) setConfState(cs raftpb.ConfState) {
+	rc.peersMu.Lock()
+	rc.confState = cs
+	rc.peersMu.Unlock()
+	atomic.StoreInt32(&rc.voters, int32(len(cs.Nodes)))
+}
+
+// members returns a copy of the URLs of the members, along with the
+// ConfState currently in effect, for reading outside of the RAFT loop.
+func (rc *raftNode) members() (map[uint64]string, raftpb.ConfState) {
+	rc.peersMu.RLock()
+	defer rc.peersMu.RUnlock()
+	peers := make(map[uint64]string, len(rc.rpeers))
+	for id, peer := range rc.rpeers {
+		peers[id] = peer
+	}
+	return peers, rc.confState
+}
+
+// peerUrl returns the URL of the member with the given ID, if known.
+func (rc *raftNode) peerUrl(nodeID uint64) string {
+	rc.peersMu.RLock()
+	defer rc.peersMu.RUnlock()
+	return rc.rpeers[nodeID]
+}
+
+// shadowContextPrefix precedes the URL in the context of the conf change
+// adding a shadow member.
+const shadowContextPrefix = "shadow:"
+
+// memberContext returns the context of the conf change adding the node
+// at the given URL, as a shadow member if so specified.
+func memberContext(peerUrl string, shadow bool) []byte {
+	if shadow {
+		return []byte(shadowContextPrefix + peerUrl)
+	}
+	return []byte(peerUrl)
+}
+
+// parseMemberContext returns the URL of the node being added by a conf
+// change with the given context, and whether it is a shadow member.
+func parseMemberContext(ctx []byte) (string, bool) {
+	peerUrl := string(ctx)
+	if strings.HasPrefix(peerUrl, shadowContextPrefix) {
+		return strings.TrimPrefix(peerUrl, shadowContextPrefix), true
+	}
+	return peerUrl, false
+}
+
+// setShadow records whether the member with the given ID is a shadow.
+// Promoting a shadow member to a voter makes it visible to clients.
+func (rc *raftNode) setShadow(nodeID uint64, shadow bool) {
+	rc.peersMu.Lock()
+	if shadow {
+		rc.shadows[nodeID] = true
+	} else {
+		delete(rc.shadows, nodeID)
+	}
+	rc.peersMu.Unlock()
+	if nodeID == rc.id {
+		var flag int32
+		if shadow {
+			flag = 1
+			rc.logger.Infof("[Node %x] Added to the cluster as a shadow member, refusing client requests", rc.id)
+		}
+		atomic.StoreInt32(&rc.shadow, flag)
+	}
+}
+
+// isShadowMember reports whether the member with the given ID is a shadow.
+func (rc *raftNode) isShadowMember(nodeID uint64) bool {
+	rc.peersMu.RLock()
+	defer rc.peersMu.RUnlock()
+	return rc.shadows[nodeID]
+}
+
+// setServiceAddr records the service address advertised by the member
+// with the given ID, forgetting it if the address is empty.
+func (rc *raftNode) setServiceAddr(nodeID uint64, addr string) {
+	rc.peersMu.Lock()
+	defer rc.peersMu.Unlock()
+	if addr == "" {
+		delete(rc.serviceAddrs, nodeID)
+		return
+	}
+	if rc.serviceAddrs == nil {
+		rc.serviceAddrs = make(map[uint64]string)
+	}
+	rc.serviceAddrs[nodeID] = addr
+}
+
+// serviceAddr returns the service address advertised by the member with
+// the given ID, which is empty if it has not advertised one.
+func (rc *raftNode) serviceAddr(nodeID uint64) string {
+	rc.peersMu.RLock()
+	defer rc.peersMu.RUnlock()
+	return rc.serviceAddrs[nodeID]
+}
+
+// snapshotData is recorded in the RAFT snapshots taken by this node, to
+// retain the shadow members, the service addresses of the members and
+// the idempotency keys applied once the entries bearing them are no
+// longer in the log.
+type snapshotData struct {
+	Shadows      []uint64          `json:"shadows,omitempty"`
+	ServiceAddrs map[uint64]string `json:"serviceAddrs,omitempty"`
+	AppliedKeys  []appliedKey      `json:"appliedKeys,omitempty"`
+}
+
+// encodeSnapshotData returns the data to be recorded in a RAFT snapshot
+// taken now, which is nil if there is nothing to record.
+func (rc *raftNode) encodeSnapshotData() []byte {
+	var data snapshotData
+	rc.peersMu.RLock()
+	for id := range rc.shadows {
+		data.Shadows = append(data.Shadows, id)
+	}
+	if len(rc.serviceAddrs) > 0 {
+		data.ServiceAddrs = make(map[uint64]string, len(rc.serviceAddrs))
+		for id, addr := range rc.serviceAddrs {
+			data.ServiceAddrs[id] = addr
+		}
+	}
+	rc.peersMu.RUnlock()
+	sort.Slice(data.Shadows, func(i, j int) bool { return data.Shadows[i] < data.Shadows[j] })
+	if rc.appliedKeys != nil {
+		data.AppliedKeys = rc.appliedKeys.snapshot()
+	}
+	if len(data.Shadows) == 0 && len(data.ServiceAddrs) == 0 && len(data.AppliedKeys) == 0 {
+		return nil
+	}
+	bts, err := json.Marshal(data)
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] unable to encode snapshot data (%v)", rc.id, err)
+	}
+	return bts
+}
+
+// restoreSnapshotData replaces the shadow members, the service addresses
+// and the idempotency keys applied with the ones recorded in the given
+// RAFT snapshot.
+func (rc *raftNode) restoreSnapshotData(snapshot raftpb.Snapshot) {
+	var data snapshotData
+	if len(snapshot.Data) > 0 {
+		if err := json.Unmarshal(snapshot.Data, &data); err != nil {
+			rc.logger.Warnf("nexus.raft: [Node %x] Ignoring unreadable data of snapshot at index %d (%v)", rc.id, snapshot.Metadata.Index, err)
+		}
+	}
+	rc.peersMu.Lock()
+	rc.shadows = make(map[uint64]bool)
+	rc.serviceAddrs = make(map[uint64]string)
+	for id, addr := range data.ServiceAddrs {
+		rc.serviceAddrs[id] = addr
+	}
+	rc.peersMu.Unlock()
+	rc.setShadow(rc.id, false)
+	for _, id := range data.Shadows {
+		rc.setShadow(id, true)
+	}
+	if rc.appliedKeys != nil {
+		rc.appliedKeys.restore(data.AppliedKeys)
+	}
+}
+
+// rebuildFromLog remembers the idempotency keys and the service
+// addresses advertised in the entries following the last snapshot that
+// the store applied before restarting, as those entries are not
+// published again.
+func (rc *raftNode) rebuildFromLog() {
+	first, _ := rc.raftStorage.FirstIndex()
+	last, _ := rc.raftStorage.LastIndex()
+	if last > rc.appliedIndex {
+		last = rc.appliedIndex
+	}
+	if last < first {
+		return
+	}
+	ents, err := rc.raftStorage.Entries(first, last+1, math.MaxUint64)
+	if err == nil && rc.appliedKeys != nil {
+		err = rc.appliedKeys.putEntries(ents)
+	}
+	if err != nil {
+		rc.logger.Fatalf("nexus.raft: [Node %x] unable to rebuild idempotency keys from the log (%v)", rc.id, err)
+	}
+	for _, entry := range ents {
+		if entry.Type != raftpb.EntryConfChange {
+			continue
+		}
+		var cc raftpb.ConfChange
+		cc.Unmarshal(entry.Data)
+		switch cc.Type {
+		case raftpb.ConfChangeUpdateNode:
+			rc.setServiceAddr(cc.NodeID, string(cc.Context))
+		case raftpb.ConfChangeRemoveNode:
+			rc.setServiceAddr(cc.NodeID, "")
+		}
+	}
+}
+
+// isRemoved reports whether this node has been removed from the cluster.
+func (rc *raftNode) isRemoved() bool {
+	return atomic.LoadInt32(&rc.removed) == 1
+}
+
+// isShadow reports whether this node is a shadow member.
+func (rc *raftNode) isShadow() bool {
+	return atomic.LoadInt32(&rc.shadow) == 1
+}
+
+// mustSyncWAL reports whether saving the given hard state and number of
+// entries onto the WAL makes it fsync, which is when entries are appended
+// or the term or vote change, as per the RAFT library.
+func mustSyncWAL(st, prevst raftpb.HardState, entsnum int) bool {
+	if raft.IsEmptyHardState(st) {
+		return entsnum != 0
+	}
+	return entsnum != 0 || st.Vote != prevst.Vote || st.Term != prevst.Term
+}
+
+// raftLoopStallThreshold is the duration without ticks beyond which the
+// RAFT event loop is deemed to be stuck. It is kept well above the tick
+// interval to tolerate slow WAL syncs and snapshots, and is raised to
+// raftLoopStallTicks ticks for long tick intervals.
+const (
+	raftLoopStallThreshold = 10 * time.Second
+	raftLoopStallTicks     = 10
+)
+
+// isAlive reports whether the RAFT event loop is running.
+func (rc *raftNode) isAlive() bool {
+	threshold := raftLoopStallThreshold
+	if stall := raftLoopStallTicks * rc.tickInterval; stall > threshold {
+		threshold = stall
+	}
+	lastTick := atomic.LoadInt64(&rc.lastTick)
+	return lastTick > 0 && time.Since(time.Unix(0, lastTick)) < threshold
+}
@@ -0,0 +1,105 @@
+package raft
+
+import (
+	"context"
+	"sync"
+
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// admissionOrder lists the priorities in the order
+// in which waiting Saves are admitted.
+var admissionOrder = []pkg_raft.Priority{pkg_raft.HighPriority, pkg_raft.NormalPriority, pkg_raft.BulkPriority}
+
+// proposeQueue limits the number of proposals in flight, from the time
+// they are proposed till they are applied. Saves beyond the limit wait
+// and are admitted in the order of their priority, and among the ones
+// with the same priority, in the order of their arrival.
+type proposeQueue struct {
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	waiting  map[pkg_raft.Priority][]chan struct{}
+}
+
+func newProposeQueue(limit int) *proposeQueue {
+	return &proposeQueue{limit: limit, waiting: make(map[pkg_raft.Priority][]chan struct{})}
+}
+
+// acquire blocks until a proposal of the given priority can be made,
+// or the given context expires.
+func (this *proposeQueue) acquire(ctx context.Context, priority pkg_raft.Priority) error {
+	if priority != pkg_raft.HighPriority && priority != pkg_raft.BulkPriority {
+		priority = pkg_raft.NormalPriority
+	}
+	this.mu.Lock()
+	if this.inflight < this.limit && this.numWaiting() == 0 {
+		this.inflight++
+		this.mu.Unlock()
+		return nil
+	}
+	admitted := make(chan struct{})
+	this.waiting[priority] = append(this.waiting[priority], admitted)
+	this.mu.Unlock()
+
+	select {
+	case <-admitted:
+		return nil
+	case <-ctx.Done():
+		this.mu.Lock()
+		if this.remove(priority, admitted) {
+			this.mu.Unlock()
+		} else {
+			// admitted concurrently, so pass on the slot
+			this.mu.Unlock()
+			this.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// tryAcquire reserves the slot of a proposal without waiting, returning
+// false if the limit is reached or other Saves are already waiting.
+func (this *proposeQueue) tryAcquire() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.inflight < this.limit && this.numWaiting() == 0 {
+		this.inflight++
+		return true
+	}
+	return false
+}
+
+// release frees up the slot of a proposal, admitting the longest
+// waiting Save of the highest priority, if any.
+func (this *proposeQueue) release() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, priority := range admissionOrder {
+		if waiting := this.waiting[priority]; len(waiting) > 0 {
+			this.waiting[priority] = waiting[1:]
+			close(waiting[0])
+			return
+		}
+	}
+	this.inflight--
+}
+
+func (this *proposeQueue) numWaiting() int {
+	num := 0
+	for _, waiting := range this.waiting {
+		num += len(waiting)
+	}
+	return num
+}
+
+func (this *proposeQueue) remove(priority pkg_raft.Priority, admitted chan struct{}) bool {
+	waiting := this.waiting[priority]
+	for i, ch := range waiting {
+		if ch == admitted {
+			this.waiting[priority] = append(waiting[:i:i], waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
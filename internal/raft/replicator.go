@@ -3,16 +3,24 @@ package raft
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/coreos/etcd/pkg/types"
 	"github.com/golang/protobuf/proto"
-	"log"
+	"io"
+	"math"
 	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/coreos/etcd/pkg/idutil"
 	"github.com/coreos/etcd/pkg/wait"
+	"github.com/coreos/etcd/raft"
 	"github.com/coreos/etcd/raft/raftpb"
 	"github.com/flipkart-incubator/nexus/internal/raft/snap"
 	"github.com/flipkart-incubator/nexus/internal/stats"
@@ -22,8 +30,10 @@ import (
 )
 
 type internalNexusResponse struct {
-	Res []byte
-	Err error
+	Res      []byte
+	Err      error
+	Index    uint64   // RAFT index at which the request got applied
+	BatchRes [][]byte // Responses of a batch request, in its order
 }
 
 type replicator struct {
@@ -31,21 +41,70 @@ type replicator struct {
 	store           db.Store
 	confChangeCount uint64
 	waiter          wait.Wait
+	commitWaiter    wait.Wait // Saves to be acknowledged on commit
 	applyWait       wait.WaitTime
 	idGen           *idutil.Generator
 	statsCli        stats.Client
+	logger          pkg_raft.Logger
 	opts            pkg_raft.Options
+
+	peerLock          sync.Mutex
+	peerInactiveSince map[uint64]time.Time
+	offlinePeers      map[uint64]bool
+	memberWatchers    map[chan pkg_raft.MemberEvent]struct{}
+
+	debugSrv *http.Server
+
+	expvarVar *expvarVar // published under the expvar namespace, if any
+
+	lastSnapIndex, lastSnapTerm uint64
+
+	applyPool    *applyPool
+	appliedIndex uint64
+
+	uncommittedSize   int64
+	inflightProposals int64
+	commitWaits       int64 // Saves registered on commitWaiter
+	proposals         proposalCounts
+	restoreFailed     int32
+	restoring         int32
+	restoreMu         sync.RWMutex // held for writing while the store is restored
+	stopped           int32
+	shuttingDown      int32
+	advertising       int32 // whether the service address is being advertised
+	appliedKeys       *appliedKeys
+
+	pendingConfChanges    int32
+	savesDuringConfChange int64
+
+	memberAdds   *memberAdds
+	proposeQueue *proposeQueue
+	auditor      *auditor
+	loadShedder  *loadShedder
+	digest       *applyDigest
 }
 
 const (
-	MetricPrefix     = "nexus."
-	NodeIdDefaultTag = "nexusNode"
+	MetricPrefix      = "nexus."
+	NodeIdDefaultTag  = "nexusNode"
+	GroupIdDefaultTag = "nexusGroup"
 )
 
 func initStatsD(opts pkg_raft.Options) stats.Client {
+	// groups sharing a node URL are told apart by their group ID
+	defTags := []stats.Tag{
+		stats.NewTag(NodeIdDefaultTag, opts.NodeUrl().Host),
+		stats.NewTag(GroupIdDefaultTag, strconv.FormatUint(opts.GroupId(), 10)),
+	}
+	if reg := opts.PrometheusRegisterer(); reg != nil {
+		statsCli, err := stats.NewPrometheusClient(reg, defTags...)
+		if err == nil {
+			return statsCli
+		}
+		opts.Logger().Warnf("Unable to register Prometheus metrics, disabling them. Error: %v", err)
+	}
 	if statsdAddr := opts.StatsDAddr(); statsdAddr != "" {
-		return stats.NewStatsDClient(statsdAddr, MetricPrefix,
-			stats.NewTag(NodeIdDefaultTag, opts.NodeUrl().Host))
+		return stats.NewStatsDClient(statsdAddr, MetricPrefix, defTags...)
 	}
 	return stats.NewNoOpClient()
 }
@@ -57,11 +116,42 @@ func NewReplicator(store db.Store, options pkg_raft.Options) *replicator {
 		node:            raftNode,
 		store:           store,
 		confChangeCount: uint64(0),
-		waiter:          wait.New(),
+		waiter:          newTimedWait(),
+		commitWaiter:    newTimedWait(),
 		applyWait:       wait.NewTimeList(),
 		idGen:           idutil.NewGenerator(uint16(raftNode.id), time.Now()),
 		statsCli:        statsCli,
+		logger:          options.Logger(),
 		opts:            options,
+
+		peerInactiveSince: make(map[uint64]time.Time),
+		offlinePeers:      make(map[uint64]bool),
+		memberWatchers:    make(map[chan pkg_raft.MemberEvent]struct{}),
+		appliedKeys:       newAppliedKeys(),
+		memberAdds:        newMemberAdds(options.MaxConcurrentMemberAdds()),
+	}
+	raftNode.appliedKeys = repl.appliedKeys
+	raftNode.restoreStore = repl.restoreDiverged
+	if auditFn, queueSize := options.Auditor(); auditFn != nil {
+		repl.auditor = newAuditor(auditFn, queueSize, raftNode.stopc, statsCli)
+	}
+	if interval := options.DeterminismCheckInterval(); interval > 0 {
+		repl.digest = newApplyDigest(interval)
+	}
+	if limit := options.MaxInflightProposals(); limit > 0 {
+		repl.proposeQueue = newProposeQueue(limit)
+	}
+	if maxTimeouts, window := options.LoadShedding(); maxTimeouts > 0 {
+		repl.loadShedder = newLoadShedder(maxTimeouts, window)
+	}
+	if numWorkers := options.ApplyWorkers(); numWorkers > 1 {
+		repl.applyPool = newApplyPool(numWorkers, repl.markApplied)
+		// ensure snapshots include all the requests being applied,
+		// and nothing beyond them
+		raftNode.getSnapshot = func(state db.SnapshotState) (io.ReadCloser, error) {
+			defer repl.applyPool.pause()()
+			return store.Backup(state)
+		}
 	}
 	return repl
 }
@@ -71,16 +161,118 @@ func (this *replicator) Id() uint64 {
 }
 
 func (this *replicator) Start() {
+	// the store has already applied the entries up to where it left off
+	this.markApplied(this.node.storeEntry.Index)
 	go this.readCommits()
 	go this.readReadStates()
 	this.node.startRaft()
 	go this.node.purgeFile()
+	go this.reportInflightAge()
+	go this.watchPeers()
+	if this.auditor != nil {
+		go this.auditor.run()
+	}
+	this.startDebugServer()
+	this.publishExpvar()
+}
+
+// WaitForLeader blocks till this node knows of a leader of the cluster,
+// such as after starting, or till the given context expires in which
+// case its error is returned. It fails with ErrNoLeader if the
+// replicator is stopped while waiting.
+func (this *replicator) WaitForLeader(ctx context.Context) error {
+	ticker := time.NewTicker(leaderPollInterval)
+	defer ticker.Stop()
+	for {
+		if this.node.isAlive() && this.node.getLeaderId() != 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-this.node.stopc:
+			return pkg_raft.ErrNoLeader
+		case <-ticker.C:
+		}
+	}
+}
+
+const inflightAgeReportInterval = 10 * time.Second
+
+// reportInflightAge periodically reports the age of the oldest request
+// waiting to be served, along with the number of requests waiting. A
+// growing age indicates that requests are stuck, for instance due to
+// the lack of a leader or a lagging store.
+func (this *replicator) reportInflightAge() {
+	waiter, ok := this.waiter.(*timedWait)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(inflightAgeReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.statsCli.Gauge("raft.inflight.oldest.age.seconds", int64(waiter.oldestAge()/time.Second))
+			this.statsCli.Gauge("raft.proposal.pending", int64(waiter.pending()))
+		case <-this.node.stopc:
+			return
+		}
+	}
+}
+
+const peerWatchInterval = time.Second
+
+// watchPeers periodically refreshes the statuses of the members, so
+// that peers going OFFLINE or coming back online are detected even if
+// the members are not being listed.
+func (this *replicator) watchPeers() {
+	ticker := time.NewTicker(peerWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.ListMembers()
+			this.advertiseServiceAddr()
+		case <-this.node.stopc:
+			return
+		}
+	}
 }
 
+// advertiseServiceAddr makes this node advertise the address of its
+// gRPC service to the other members, if one is configured and is not
+// what the cluster knows of, by proposing a conf change that updates
+// this node with it. It is retried on the next tick till it succeeds.
+func (this *replicator) advertiseServiceAddr() {
+	addr := this.opts.ServiceAddr()
+	if addr == "" || this.node.isRemoved() || this.node.getLeaderId() == 0 || this.node.serviceAddr(this.node.id) == addr {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.advertising, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&this.advertising, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), this.opts.ReplTimeout())
+		defer cancel()
+		cc := raftpb.ConfChange{Type: raftpb.ConfChangeUpdateNode, NodeID: this.node.id, Context: []byte(addr)}
+		if err := this.proposeConfigChange(ctx, cc); err != nil {
+			this.logger.Warnf("[Node %x] Unable to advertise service address: %s. Error: %v", this.node.id, addr, err)
+		}
+	}()
+}
+
+// ListMembers returns the leader along with all the members of the
+// cluster. Only the leader tracks the progress of every member, so the
+// statuses and lag reported by followers are best effort, inferred from
+// their own connectivity to the other members.
 func (repl *replicator) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
 	lead := repl.node.getLeaderId()
+	raftStatus := repl.node.node.Status()
 	members := make(map[uint64]*models.NodeInfo)
-	for id, url := range repl.node.rpeers {
+	peers, confState := repl.node.members()
+	for id, url := range peers {
 		activeSince := repl.node.transport.ActiveSince(types.ID(id))
 		nodeInfo := models.NodeInfo{
 			NodeUrl: url,
@@ -90,7 +282,7 @@ func (repl *replicator) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
 			nodeInfo.Status = models.NodeInfo_LEADER
 		} else if id == repl.node.id {
 			//get current node status.
-			status := repl.node.node.Status().RaftState.String()
+			status := raftStatus.RaftState.String()
 			if status == "StateFollower" {
 				nodeInfo.Status = models.NodeInfo_FOLLOWER
 			} else if status == "StateCandidate" || status == "StatePreCandidate" {
@@ -99,7 +291,7 @@ func (repl *replicator) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
 				nodeInfo.Status = models.NodeInfo_UNKNOWN
 			}
 		} else if activeSince.IsZero() {
-			nodeInfo.Status = models.NodeInfo_OFFLINE
+			nodeInfo.Status = repl.inactivePeerStatus(id)
 		} else if lead != 0 {
 			//This is best effort info.
 			nodeInfo.Status = models.NodeInfo_FOLLOWER
@@ -107,118 +299,1018 @@ func (repl *replicator) ListMembers() (uint64, map[uint64]*models.NodeInfo) {
 			nodeInfo.Status = models.NodeInfo_UNKNOWN
 		}
 
+		if !activeSince.IsZero() {
+			repl.markPeerActive(id)
+			nodeInfo.ActiveSince = activeSince.UnixNano() / int64(time.Millisecond)
+		}
+		// replication lag is known only on the leader
+		if pr, present := raftStatus.Progress[id]; present && raftStatus.Commit > pr.Match {
+			nodeInfo.Lag = raftStatus.Commit - pr.Match
+		}
+		if id == repl.node.id {
+			nodeInfo.AppliedIndex = repl.AppliedIndex()
+		}
+		nodeInfo.IsLearner = containsID(confState.Learners, id)
+		nodeInfo.IsShadow = repl.node.isShadowMember(id)
+		nodeInfo.ServiceAddr = repl.node.serviceAddr(id)
 		members[id] = &nodeInfo
 	}
 	return lead, members
 }
 
+// ExportConfig returns the membership topology of the cluster as known
+// to this node, which can be used for bootstrapping a new cluster with
+// the same members using BootstrapFromConfig.
+func (this *replicator) ExportConfig() ([]byte, error) {
+	peers, confState := this.node.members()
+	config := &pkg_raft.ClusterConfig{ClusterId: this.opts.ClusterId()}
+	for id, url := range peers {
+		config.Members = append(config.Members, pkg_raft.ClusterMember{Id: id, Url: url, Learner: containsID(confState.Learners, id)})
+	}
+	sort.Slice(config.Members, func(i, j int) bool { return config.Members[i].Id < config.Members[j].Id })
+	return config.Marshal()
+}
+
+// inactivePeerStatus reports a peer whose transport is inactive as
+// SUSPECT until it has been observed to be inactive for longer than
+// the configured grace period, after which it is reported OFFLINE.
+func (repl *replicator) inactivePeerStatus(id uint64) models.NodeInfo_NodeStatus {
+	gracePeriod := repl.opts.OfflineGracePeriod()
+	repl.peerLock.Lock()
+	defer repl.peerLock.Unlock()
+	if gracePeriod > 0 {
+		inactiveSince, present := repl.peerInactiveSince[id]
+		if !present {
+			inactiveSince = time.Now()
+			repl.peerInactiveSince[id] = inactiveSince
+		}
+		if time.Since(inactiveSince) < gracePeriod {
+			return models.NodeInfo_SUSPECT
+		}
+	}
+	if !repl.offlinePeers[id] {
+		repl.offlinePeers[id] = true
+		repl.logger.Warnf("[Node %x] Peer %x is OFFLINE", repl.node.id, id)
+		repl.statsCli.Incr("peer.offline", 1)
+		repl.notifyMemberWatchers(pkg_raft.MemberOffline, id)
+	}
+	return models.NodeInfo_OFFLINE
+}
+
+func (repl *replicator) markPeerActive(id uint64) {
+	repl.peerLock.Lock()
+	defer repl.peerLock.Unlock()
+	delete(repl.peerInactiveSince, id)
+	if repl.offlinePeers[id] {
+		delete(repl.offlinePeers, id)
+		repl.logger.Infof("[Node %x] Peer %x is back online", repl.node.id, id)
+		repl.statsCli.Incr("peer.online", 1)
+		repl.notifyMemberWatchers(pkg_raft.MemberOnline, id)
+	}
+}
+
+const memberEventBufSize = 64
+
+// WatchMembers streams the peers of this node going OFFLINE and coming
+// back online, as detected from the activity of their transports, till
+// the given context expires after which the returned channel is closed.
+// Peers are checked every second, irrespective of the members being
+// listed. Events are dropped if the consumer falls behind by more than
+// the size of the channel's buffer.
+func (this *replicator) WatchMembers(ctx context.Context) (<-chan pkg_raft.MemberEvent, error) {
+	if atomic.LoadInt32(&this.stopped) == 1 {
+		return nil, errors.New("replicator is stopped")
+	}
+	events := make(chan pkg_raft.MemberEvent, memberEventBufSize)
+	this.peerLock.Lock()
+	this.memberWatchers[events] = struct{}{}
+	this.peerLock.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-this.node.stopc:
+		}
+		this.peerLock.Lock()
+		defer this.peerLock.Unlock()
+		delete(this.memberWatchers, events)
+		close(events)
+	}()
+	return events, nil
+}
+
+// notifyMemberWatchers must be invoked with the peerLock held.
+func (repl *replicator) notifyMemberWatchers(typ pkg_raft.MemberEventType, id uint64) {
+	event := pkg_raft.MemberEvent{Type: typ, NodeId: id, NodeUrl: repl.node.peerUrl(id)}
+	for events := range repl.memberWatchers {
+		select {
+		case events <- event:
+		default:
+			repl.statsCli.Incr("peer.event.dropped", 1)
+		}
+	}
+}
+
 func (this *replicator) Save(ctx context.Context, data []byte) ([]byte, error) {
 	// TODO: Validate raft state to check if Start() has been invoked
 	defer this.statsCli.Timing("save.latency.ms", time.Now())
+	if max := this.opts.MaxProposalSize(); max > 0 && len(data) > max {
+		this.statsCli.Incr("save.too.large.error", 1)
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", pkg_raft.ErrProposalTooLarge, len(data), max)
+	}
 	repl_req := &models.NexusInternalRequest{ID: this.idGen.Next(), Req: data}
+	if repl_res, err := this.replicate(ctx, repl_req); err != nil {
+		return nil, err
+	} else {
+		return repl_res.Res, repl_res.Err
+	}
+}
+
+// SaveBatch saves all the given payloads via a single RAFT proposal, to
+// amortize its cost across them. The payloads are applied in order onto
+// the store at the same RAFT index, each by a separate store Save. The
+// responses are returned in the same order. If some of the payloads fail
+// to be saved, the others still are, and a *raft.BatchError is returned
+// with the error of each payload.
+func (this *replicator) SaveBatch(ctx context.Context, batch [][]byte) ([][]byte, error) {
+	defer this.statsCli.Timing("save.batch.latency.ms", time.Now())
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	size := 0
+	for _, data := range batch {
+		size += len(data)
+	}
+	if max := this.opts.MaxProposalSize(); max > 0 && size > max {
+		this.statsCli.Incr("save.too.large.error", 1)
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", pkg_raft.ErrProposalTooLarge, size, max)
+	}
+	this.statsCli.Gauge("save.batch.size", int64(len(batch)))
+	repl_req := &models.NexusInternalRequest{ID: this.idGen.Next(), Batch: batch}
+	if repl_res, err := this.replicate(ctx, repl_req); err != nil {
+		return nil, err
+	} else if repl_res.Err != nil {
+		return repl_res.BatchRes, repl_res.Err
+	} else {
+		return repl_res.BatchRes, nil
+	}
+}
+
+// replicate proposes the given request to RAFT and waits for it as per
+// the ack level of the context. Failures to replicate are returned as
+// errors, while the outcome of applying the request is in the response.
+func (this *replicator) replicate(ctx context.Context, repl_req *models.NexusInternalRequest) (*internalNexusResponse, error) {
+	// counted before checking for shutdown, so that StopWithTimeout
+	// either refuses this Save or waits for it
+	atomic.AddInt64(&this.inflightProposals, 1)
+	defer atomic.AddInt64(&this.inflightProposals, -1)
+	if atomic.LoadInt32(&this.shuttingDown) == 1 {
+		this.statsCli.Incr("save.shutting.down.error", 1)
+		return nil, pkg_raft.ErrShuttingDown
+	}
+	if this.node.isRemoved() {
+		this.statsCli.Incr("save.removed.error", 1)
+		return nil, pkg_raft.ErrNodeRemoved
+	}
+	if this.node.isShadow() {
+		this.statsCli.Incr("save.shadow.error", 1)
+		return nil, pkg_raft.ErrShadowMember
+	}
+	if pkg_raft.IsLeaderRequired(ctx) {
+		// fail fast instead of having RAFT forward the proposal,
+		// or drop it silently if there is no leader
+		if lead := this.node.getLeaderId(); lead == raft.None {
+			this.statsCli.Incr("save.no_leader", 1)
+			return nil, pkg_raft.ErrNoLeader
+		} else if lead != this.node.id {
+			this.statsCli.Incr("save.not.leader.error", 1)
+			return nil, pkg_raft.ErrNotLeader
+		}
+	}
+	if this.loadShedder != nil {
+		if retryAfter := this.loadShedder.retryAfter(time.Now()); retryAfter > 0 {
+			this.statsCli.Incr("save.shed", 1)
+			return nil, &pkg_raft.OverloadedError{RetryAfter: retryAfter}
+		}
+	}
+	trace := pkg_raft.RequestTraceFrom(ctx)
+	if trace != nil {
+		trace.RequestId = repl_req.ID
+		repl_req.CorrelationId = trace.CorrelationId
+		repl_req.IdempotencyKey = trace.IdempotencyKey
+	}
+	if compression, threshold := this.opts.PayloadCompression(); compression != pkg_raft.NoCompression {
+		if err := compressPayloads(repl_req, compression, threshold); err != nil {
+			this.statsCli.Incr("save.compress.error", 1)
+			return nil, err
+		}
+	}
 	if repl_req_data, err := proto.Marshal(repl_req); err != nil {
 		this.statsCli.Incr("save.marshal.error", 1)
 		return nil, err
+	} else if err := this.checkMessageSize(len(repl_req_data)); err != nil {
+		return nil, err
+	} else if err := this.reserveUncommitted(len(repl_req_data)); err != nil {
+		return nil, err
+	} else if err := this.checkConfChange(); err != nil {
+		this.releaseUncommitted(len(repl_req_data))
+		return nil, err
 	} else {
-		ch := this.waiter.Register(repl_req.ID)
+		defer this.releaseUncommitted(len(repl_req_data))
+		ackLevel := pkg_raft.AckLevelFrom(ctx)
+		waiter := this.waiter
+		if ackLevel == pkg_raft.AckCommitted {
+			waiter = this.commitWaiter
+			atomic.AddInt64(&this.commitWaits, 1)
+			defer atomic.AddInt64(&this.commitWaits, -1)
+		}
 		child_ctx, cancel := context.WithTimeout(ctx, this.opts.ReplTimeout())
 		defer cancel()
-		if err := this.node.node.Propose(child_ctx, repl_req_data); err != nil {
-			log.Printf("[WARN] [Node %x] Error while proposing to Raft. Message: %v.", this.node.id, err)
-			this.waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: err})
+		rejectOverLimit := this.proposeQueue != nil && this.opts.RejectOverInflightLimit()
+		if rejectOverLimit {
+			if !this.proposeQueue.tryAcquire() {
+				this.statsCli.Incr("save.rejected", 1)
+				return nil, pkg_raft.ErrTooManyRequests
+			}
+			defer this.proposeQueue.release()
+		}
+		ch := registerOp(waiter, repl_req.ID, pkg_raft.OpSave, child_ctx)
+		if this.proposeQueue != nil && !rejectOverLimit {
+			queueStart := time.Now()
+			if err := this.proposeQueue.acquire(child_ctx, pkg_raft.PriorityFrom(ctx)); err != nil {
+				waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: err})
+				this.statsCli.Incr("save.propose.queue.timeout.error", 1)
+				return nil, err
+			}
+			defer this.proposeQueue.release()
+			this.statsCli.Timing("save.propose.queue.wait.ms", queueStart)
+		}
+		proposeStart := time.Now()
+		this.countProposal(&this.proposals.made, "save.proposals.made")
+		err := this.node.node.Propose(child_ctx, repl_req_data)
+		this.statsCli.Timing("raft.propose.block.ms", proposeStart)
+		if err != nil {
+			this.logger.Warnf("[Node %x] %s Error while proposing to Raft. Message: %v.", this.node.id, requestTag(repl_req), err)
+			waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: err})
 			this.statsCli.Incr("raft.propose.error", 1)
+			this.countProposal(&this.proposals.failed, "save.proposals.failed")
 			return nil, err
 		}
+		if repl_req.CorrelationId != "" {
+			this.logger.Infof("[Node %x] %s Proposed to Raft", this.node.id, requestTag(repl_req))
+		}
 		select {
 		case res := <-ch:
 			repl_res := res.(*internalNexusResponse)
-			return repl_res.Res, repl_res.Err
+			this.countProposal(&this.proposals.committed, "save.proposals.committed")
+			if trace != nil {
+				trace.AppliedIndex = repl_res.Index
+			}
+			if repl_req.CorrelationId != "" {
+				this.logger.Infof("[Node %x] %s Responding with error: %v", this.node.id, requestTag(repl_req), repl_res.Err)
+			}
+			if ackLevel == pkg_raft.AckQuorumConfirmed && repl_res.Err == nil {
+				if _, err := this.readIndex(child_ctx); err != nil {
+					this.logger.Warnf("[Node %x] %s Unable to confirm commit with a quorum. Message: %v.", this.node.id, requestTag(repl_req), err)
+					return nil, err
+				}
+			}
+			return repl_res, nil
+		case <-this.node.stopc:
+			waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: pkg_raft.ErrShuttingDown})
+			this.countProposal(&this.proposals.failed, "save.proposals.failed")
+			return nil, pkg_raft.ErrShuttingDown
 		case <-child_ctx.Done():
 			err := child_ctx.Err()
-			this.waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: err})
+			this.logger.Warnf("[Node %x] %s Timed out waiting for request to be applied. Message: %v.", this.node.id, requestTag(repl_req), err)
+			waiter.Trigger(repl_req.ID, &internalNexusResponse{Err: err})
 			this.statsCli.Incr("save.timeout.error", 1)
+			this.countProposal(&this.proposals.failed, "save.proposals.failed")
+			if this.loadShedder != nil && this.loadShedder.timedOut(time.Now()) {
+				_, window := this.opts.LoadShedding()
+				this.logger.Warnf("[Node %x] Too many Saves timing out, shedding Saves for %s", this.node.id, window)
+				this.statsCli.Incr("save.shed.started", 1)
+			}
 			return nil, err
 		}
 	}
 }
 
+// proposalCounts are the number of Saves proposed from this node since
+// it started, along with how many of those got committed and how many
+// failed to, either on proposing or by timing out. The rest are in flight.
+type proposalCounts struct {
+	made      uint64
+	committed uint64
+	failed    uint64
+}
+
+func (this *replicator) countProposal(count *uint64, metric string) {
+	atomic.AddUint64(count, 1)
+	this.statsCli.Incr(metric, 1)
+}
+
+// reserveUncommitted accounts for a proposal of the given size among
+// those pending to be applied, failing with ErrProposalDropped if that
+// takes the pending bytes beyond the configured limit. RAFT itself
+// buffers such proposals without bound, for instance on a leader
+// partitioned away from a quorum.
+func (this *replicator) reserveUncommitted(size int) error {
+	max := this.opts.MaxUncommittedSize()
+	pending := atomic.AddInt64(&this.uncommittedSize, int64(size))
+	if max > 0 && pending > max && pending != int64(size) {
+		atomic.AddInt64(&this.uncommittedSize, -int64(size))
+		this.statsCli.Incr("save.proposal.dropped", 1)
+		return fmt.Errorf("%w: %d bytes pending exceeds limit of %d bytes", pkg_raft.ErrProposalDropped, pending-int64(size), max)
+	}
+	return nil
+}
+
+func (this *replicator) releaseUncommitted(size int) {
+	atomic.AddInt64(&this.uncommittedSize, -int64(size))
+}
+
+const (
+	// maxRaftMsgSize is the size beyond which the RAFT transport
+	// refuses to decode a message, which then never reaches the
+	// follower. Entries are sent individually when they exceed the
+	// MaxSizePerMsg batching limit, so this bounds every entry.
+	maxRaftMsgSize = 512 * 1024 * 1024
+	// raftMsgOverhead approximates the space taken by the headers of
+	// a RAFT append message carrying a single entry.
+	raftMsgOverhead = 1024
+	// raftMsgWarnSize is the size (80% of maxRaftMsgSize) beyond which
+	// entries are reported to be close to the limit.
+	raftMsgWarnSize = maxRaftMsgSize / 5 * 4
+)
+
+// checkMessageSize fails proposals that cannot be replicated to
+// followers due to exceeding the limit on RAFT message size.
+func (this *replicator) checkMessageSize(entrySize int) error {
+	msgSize := entrySize + raftMsgOverhead
+	if msgSize > maxRaftMsgSize {
+		this.statsCli.Incr("save.msg.too.large.error", 1)
+		return fmt.Errorf("%w: entry of %d bytes cannot be sent to followers, limit is %d bytes", pkg_raft.ErrProposalTooLarge, entrySize, maxRaftMsgSize-raftMsgOverhead)
+	}
+	if msgSize > raftMsgWarnSize {
+		this.logger.Warnf("[Node %x] Proposing entry of %d bytes close to the RAFT message limit of %d bytes", this.node.id, entrySize, maxRaftMsgSize)
+		this.statsCli.Incr("save.msg.near.limit", 1)
+	}
+	return nil
+}
+
 func (this *replicator) Load(ctx context.Context, data []byte) ([]byte, error) {
 	// TODO: Validate raft state to check if Start() has been invoked
 	defer this.statsCli.Timing("load.latency.ms", time.Now())
-	readReqId := this.idGen.Next()
-	ch := this.waiter.Register(readReqId)
+	if this.node.isRemoved() {
+		this.statsCli.Incr("load.removed.error", 1)
+		return nil, pkg_raft.ErrNodeRemoved
+	}
+	if atomic.LoadInt32(&this.restoreFailed) == 1 {
+		this.statsCli.Incr("load.restore.failed.error", 1)
+		return nil, pkg_raft.ErrRestoreFailed
+	}
+	if this.opts.RejectLoadsWhileRestoring() && atomic.LoadInt32(&this.restoring) == 1 {
+		this.statsCli.Incr("load.restoring.error", 1)
+		return nil, pkg_raft.ErrRecovering
+	}
+	if this.node.isShadow() {
+		this.statsCli.Incr("load.shadow.error", 1)
+		return nil, pkg_raft.ErrShadowMember
+	}
+	readConsistency := pkg_raft.ReadConsistencyFrom(ctx)
+	if readConsistency != pkg_raft.Stale && this.node.getLeaderId() == raft.None {
+		// fail fast instead of waiting on ReadIndex, which
+		// cannot make progress until a leader gets elected
+		this.statsCli.Incr("load.no_leader", 1)
+		return nil, pkg_raft.ErrNoLeader
+	}
+	if minIndex := pkg_raft.MinIndexFrom(ctx); minIndex > 0 && readConsistency != pkg_raft.Linearizable {
+		// linearizable reads anyway observe all the writes before them
+		child_ctx, cancel := context.WithTimeout(ctx, this.opts.ReplTimeout())
+		defer cancel()
+		if err := this.waitForApply(child_ctx, minIndex); err != nil {
+			return nil, err
+		}
+	}
+	freshness := pkg_raft.FreshnessFrom(ctx)
+	switch readConsistency {
+	case pkg_raft.Stale:
+		this.statsCli.Incr("load.stale", 1)
+		this.localFreshness(freshness)
+		return this.loadStore(data)
+	case pkg_raft.LeaderOnly:
+		if this.node.getLeaderId() != this.node.id {
+			this.statsCli.Incr("load.not.leader.error", 1)
+			return nil, pkg_raft.ErrNotLeader
+		}
+		this.localFreshness(freshness)
+		return this.loadStore(data)
+	default:
+		return this.linearizableLoad(ctx, data, freshness)
+	}
+}
+
+// LoadStream is similar to Load except that the response of the store
+// is passed on to the given function in chunks of at most the given
+// size, in order. All the chunks belong to the same read of the store,
+// which honours the read consistency of the context just like Load.
+func (this *replicator) LoadStream(ctx context.Context, data []byte, chunkSize int, send func([]byte) error) error {
+	if chunkSize <= 0 {
+		return errors.New("chunkSize must be positive")
+	}
+	res, err := this.Load(ctx, data)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(res); off += chunkSize {
+		end := off + chunkSize
+		if end > len(res) {
+			end = len(res)
+		}
+		if err := send(res[off:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *replicator) linearizableLoad(ctx context.Context, data []byte, freshness *pkg_raft.Freshness) ([]byte, error) {
 	child_ctx, cancel := context.WithTimeout(ctx, this.opts.ReplTimeout())
 	defer cancel()
+	lead, term := this.leaderTerm()
+	index, err := this.readIndex(child_ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := this.waitForApply(child_ctx, index); err != nil {
+		return nil, err
+	}
+	if this.opts.VerifyLeaderOnRead() {
+		if currLead, currTerm := this.leaderTerm(); currLead == raft.None || currLead != lead || currTerm != term {
+			this.statsCli.Incr("load.leader.changed.error", 1)
+			return nil, pkg_raft.ErrLeaderChanged
+		}
+	}
+	if freshness != nil {
+		freshness.CommittedIndex = index
+		freshness.AppliedIndex = this.AppliedIndex()
+	}
+	return this.loadStore(data)
+}
+
+// loadStore reads the store, never while it is being restored. Loads
+// made while restoring wait till the store is restored, unless
+// configured to be rejected with ErrRecovering.
+func (this *replicator) loadStore(data []byte) ([]byte, error) {
+	this.restoreMu.RLock()
+	defer this.restoreMu.RUnlock()
+	if this.opts.RejectLoadsWhileRestoring() && atomic.LoadInt32(&this.restoring) == 1 {
+		this.statsCli.Incr("load.restoring.error", 1)
+		return nil, pkg_raft.ErrRecovering
+	}
+	return this.store.Load(data)
+}
+
+// leaderTerm returns the leader as known to this node along with the
+// current term.
+func (this *replicator) leaderTerm() (uint64, uint64) {
+	status := this.node.node.Status()
+	return status.Lead, status.Term
+}
+
+// readIndex obtains the commit index of the leader, which is the
+// index up to which entries must be applied for a linearizable read.
+func (this *replicator) readIndex(ctx context.Context) (uint64, error) {
+	readReqId := this.idGen.Next()
+	ch := registerOp(this.waiter, readReqId, pkg_raft.OpLoad, ctx)
 	idData := make([]byte, 8)
 	binary.BigEndian.PutUint64(idData, readReqId)
-	if err := this.node.node.ReadIndex(child_ctx, idData); err != nil {
-		log.Printf("[WARN] [Node %x] Error while reading index in Raft. Message: %v.", this.node.id, err)
+	readIndexStart := time.Now()
+	if err := this.node.node.ReadIndex(ctx, idData); err != nil {
+		this.logger.Warnf("[Node %x] Error while reading index in Raft. Message: %v.", this.node.id, err)
 		this.waiter.Trigger(readReqId, &internalNexusResponse{Err: err})
-		return nil, err
+		return 0, err
 	}
 	select {
 	case res := <-ch:
+		this.statsCli.Timing("load.read.index.latency.ms", readIndexStart)
 		if inr := res.(*internalNexusResponse); inr.Err != nil {
 			this.statsCli.Incr("raft.read.index.error", 1)
-			return nil, inr.Err
+			return 0, inr.Err
 		} else {
-			index := binary.BigEndian.Uint64(inr.Res)
-			select {
-			case <-this.applyWait.Wait(index):
-			case <-child_ctx.Done():
-				return nil, child_ctx.Err()
-			}
-			res, err := this.store.Load(data)
-			return res, err
+			return binary.BigEndian.Uint64(inr.Res), nil
 		}
-	case <-child_ctx.Done():
-		err := child_ctx.Err()
+	case <-ctx.Done():
+		err := ctx.Err()
 		this.waiter.Trigger(readReqId, &internalNexusResponse{Err: err})
 		this.statsCli.Incr("load.timeout.error", 1)
-		return nil, err
+		return 0, err
+	}
+}
+
+// localFreshness populates the given freshness using the commit index
+// known locally, which a follower learns from the leader's heartbeats.
+func (this *replicator) localFreshness(freshness *pkg_raft.Freshness) {
+	if freshness != nil {
+		freshness.AppliedIndex = this.AppliedIndex()
+		freshness.CommittedIndex = this.node.node.Status().Commit
+	}
+}
+
+// Freshness returns the commit index of the leader, obtained from the
+// leader itself, along with the applied index of this node.
+func (this *replicator) Freshness(ctx context.Context) (pkg_raft.Freshness, error) {
+	if this.node.getLeaderId() == raft.None {
+		return pkg_raft.Freshness{}, pkg_raft.ErrNoLeader
+	}
+	child_ctx, cancel := context.WithTimeout(ctx, this.opts.ReplTimeout())
+	defer cancel()
+	appliedIndex := this.AppliedIndex()
+	if index, err := this.readIndex(child_ctx); err != nil {
+		return pkg_raft.Freshness{}, err
+	} else {
+		return pkg_raft.Freshness{CommittedIndex: index, AppliedIndex: appliedIndex}, nil
+	}
+}
+
+// waitForApply blocks until the entry at the given index is applied
+// onto the store, failing with ErrApplyLagging if it takes longer than
+// the configured apply wait timeout.
+func (this *replicator) waitForApply(ctx context.Context, index uint64) error {
+	defer this.statsCli.Timing("load.apply.wait.latency.ms", time.Now())
+	if waiter, ok := this.waiter.(*timedWait); ok {
+		waitId := this.idGen.Next()
+		waiter.track(waitId, pkg_raft.OpApplyWait, ctx)
+		defer waiter.untrack(waitId)
+	}
+	var lagC <-chan time.Time
+	if timeout := this.opts.ApplyWaitTimeout(); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		lagC = timer.C
+	}
+	select {
+	case <-this.applyWait.Wait(index):
+		return nil
+	case <-lagC:
+		this.statsCli.Incr("load.apply.lagging.error", 1)
+		return pkg_raft.ErrApplyLagging
+	case <-ctx.Done():
+		this.statsCli.Incr("load.apply.wait.timeout.error", 1)
+		return ctx.Err()
 	}
 }
 
 func (this *replicator) AddMember(ctx context.Context, nodeUrl string) error {
+	return this.addMember(ctx, nodeUrl, raftpb.ConfChangeAddNode, false)
+}
+
+// AddLearner adds the node at the given URL as a learner, which receives
+// the RAFT log but does not vote, so that it does not affect the quorum
+// while catching up. It can be made a voter later with PromoteLearner.
+func (this *replicator) AddLearner(ctx context.Context, nodeUrl string) error {
+	return this.addMember(ctx, nodeUrl, raftpb.ConfChangeAddLearnerNode, false)
+}
+
+// AddShadow adds the node at the given URL as a shadow member. Like a
+// learner, it replicates and applies the RAFT log without voting. Unlike
+// one, it is left out of the members listed to clients and refuses
+// client requests, so that a new store can be validated against live
+// traffic. Promoting it with PromoteLearner makes it a regular voter.
+// Shadow members must be enabled via EnableShadowMembers.
+func (this *replicator) AddShadow(ctx context.Context, nodeUrl string) error {
+	if !this.opts.ShadowMembers() {
+		return errors.New("shadow members are not enabled on this node")
+	}
+	return this.addMember(ctx, nodeUrl, raftpb.ConfChangeAddLearnerNode, true)
+}
+
+func (this *replicator) addMember(ctx context.Context, nodeUrl string, ccType raftpb.ConfChangeType, shadow bool) error {
 	nodeOpts, err := pkg_raft.NewOptions(pkg_raft.NodeUrl(nodeUrl))
 	if err != nil {
 		return err
 	}
+	ctx, cancel := context.WithTimeout(ctx, this.opts.ConfChangeTimeout())
+	defer cancel()
 	nodeAddr := nodeOpts.NodeUrl()
-	if _, err := net.Dial("tcp", nodeAddr.Host); err != nil {
+	if err := this.checkReachable(ctx, nodeAddr); err != nil {
+		return err
+	}
+	if pkg_raft.IsDryRun(ctx) {
+		return this.dryRunAdd(nodeOpts)
+	}
+	if err := this.memberAdds.acquire(ctx, nodeAddr.String()); err != nil {
+		return fmt.Errorf("timed out waiting on the addition of other members, error: %v", err)
+	}
+	cc := raftpb.ConfChange{
+		Type:    ccType,
+		NodeID:  nodeOpts.NodeId(),
+		Context: memberContext(nodeAddr.String(), shadow),
+	}
+	if err := this.proposeConfigChange(ctx, cc); err != nil {
+		this.memberAdds.release(nodeAddr.String())
+		return err
+	}
+	go this.awaitCatchUp(cc.NodeID, nodeAddr.String())
+	return nil
+}
+
+// checkReachable verifies that the RAFT service of the given node is
+// accepting connections, within the configured reachability timeout.
+func (this *replicator) checkReachable(ctx context.Context, nodeAddr *url.URL) error {
+	if timeout := this.opts.ReachabilityTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", nodeAddr.Host)
+	if err != nil {
 		return fmt.Errorf("unable to verify RAFT service running at %s, error: %v", nodeAddr, err)
 	}
+	return conn.Close()
+}
+
+// CheckQuorumConnectivity reports whether a majority of the voters are
+// currently reachable from this node, along with the reachable voters.
+// It is meant to be checked before operations that could wedge the
+// cluster without a quorum, and fails with ErrNotLeader on followers
+// since only the leader tracks the progress of all the voters.
+func (this *replicator) CheckQuorumConnectivity() (bool, []uint64, error) {
+	status := this.node.node.Status()
+	if status.RaftState != raft.StateLeader {
+		return false, nil, pkg_raft.ErrNotLeader
+	}
+	voters, reachable := this.reachableVoters(status)
+	healthy := len(reachable) > voters/2
+	if !healthy {
+		this.logger.Warnf("[Node %x] Only %d of %d voters are reachable: %v", this.node.id, len(reachable), voters, reachable)
+	}
+	return healthy, reachable, nil
+}
+
+// checkQuorum fails unless a majority of the voters are reachable from
+// this node, refusing the given operation. It fails with ErrNotLeader on
+// followers instead of letting the operation bypass the check.
+func (this *replicator) checkQuorum(op string) error {
+	healthy, _, err := this.CheckQuorumConnectivity()
+	if err != nil {
+		return err
+	}
+	if !healthy {
+		return fmt.Errorf("%w: refusing to %s", pkg_raft.ErrNoQuorum, op)
+	}
+	return nil
+}
+
+// reachableVoters returns the number of voters as per the progress
+// tracked by the leader in the given status, along with the voters
+// currently reachable from this node, including itself.
+func (this *replicator) reachableVoters(status raft.Status) (int, []uint64) {
+	var voters int
+	var reachable []uint64
+	for id, pr := range status.Progress {
+		if pr.IsLearner {
+			continue
+		}
+		voters++
+		if id == this.node.id || !this.node.transport.ActiveSince(types.ID(id)).IsZero() {
+			reachable = append(reachable, id)
+		}
+	}
+	sort.Slice(reachable, func(i, j int) bool { return reachable[i] < reachable[j] })
+	return voters, reachable
+}
+
+// memberCatchUpTimeout bounds the time for which a newly added member
+// holds up the addition of other members while catching up.
+const memberCatchUpTimeout = 5 * time.Minute
+
+// awaitCatchUp waits for the newly added member to catch up with the
+// commit index of the leader at the time of its addition, before
+// letting other queued additions proceed. Progress of followers is
+// known only on the leader, hence this returns right away elsewhere.
+func (this *replicator) awaitCatchUp(nodeId uint64, nodeUrl string) {
+	defer this.memberAdds.release(nodeUrl)
+	target := this.node.node.Status().Commit
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(memberCatchUpTimeout)
+	for {
+		pr, present := this.node.node.Status().Progress[nodeId]
+		if !present {
+			return
+		}
+		if pr.Match >= target {
+			this.logger.Infof("[Node %x] Node %x caught up till index: %d", this.node.id, nodeId, pr.Match)
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			this.logger.Warnf("[Node %x] Node %x did not catch up within %s, index: %d, target: %d", this.node.id, nodeId, memberCatchUpTimeout, pr.Match, target)
+			this.statsCli.Incr("member.catch.up.timeout", 1)
+			return
+		case <-this.node.stopc:
+			return
+		}
+	}
+}
+
+// PromoteLearner makes the learner with the given ID a voter, once it
+// has caught up with the commit index of the leader at the time of the
+// call, failing if it does not do so before the given context expires.
+// Progress of learners is known only on the leader, hence this fails
+// with ErrNotLeader elsewhere.
+func (this *replicator) PromoteLearner(ctx context.Context, nodeId uint64) error {
+	if _, confState := this.node.members(); !containsID(confState.Learners, nodeId) {
+		return fmt.Errorf("%w: %x is not a learner", pkg_raft.ErrUnknownMember, nodeId)
+	}
+	if this.node.node.Status().RaftState != raft.StateLeader {
+		return pkg_raft.ErrNotLeader
+	}
+	if err := this.awaitLearner(ctx, nodeId); err != nil {
+		return err
+	}
+	this.logger.Infof("[Node %x] Promoting learner %x to voter", this.node.id, nodeId)
 	cc := raftpb.ConfChange{
 		Type:    raftpb.ConfChangeAddNode,
-		NodeID:  nodeOpts.NodeId(),
-		Context: []byte(nodeAddr.String()),
+		NodeID:  nodeId,
+		Context: []byte(this.node.peerUrl(nodeId)),
 	}
 	return this.proposeConfigChange(ctx, cc)
 }
 
+// awaitLearner waits for the learner with the given ID to catch up with
+// the commit index of the leader at the time of the call, failing if it
+// does not do so before the given context expires.
+func (this *replicator) awaitLearner(ctx context.Context, nodeId uint64) error {
+	target := this.node.node.Status().Commit
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pr, present := this.node.node.Status().Progress[nodeId]
+		if !present {
+			return fmt.Errorf("%w: %x is no longer a learner", pkg_raft.ErrUnknownMember, nodeId)
+		}
+		if pr.Match >= target {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("learner %x did not catch up, index: %d, target: %d, error: %w", nodeId, pr.Match, target, ctx.Err())
+		}
+	}
+}
+
+// PendingMemberAdds returns the state of the member additions made via
+// this node that are either queued or yet to catch up with the leader.
+func (this *replicator) PendingMemberAdds() map[string]pkg_raft.MemberAddState {
+	return this.memberAdds.pending()
+}
+
+// RemoveMember removes the member at the given URL from the cluster,
+// provided a quorum of the voters is reachable. Reachability of voters
+// is known only on the leader, hence this fails with ErrNotLeader
+// elsewhere.
 func (this *replicator) RemoveMember(ctx context.Context, nodeUrl string) error {
 	nodeOpts, err := pkg_raft.NewOptions(pkg_raft.NodeUrl(nodeUrl))
 	if err != nil {
 		return err
 	}
+	if err := this.checkQuorum("remove " + nodeUrl); err != nil {
+		return err
+	}
+	if pkg_raft.IsDryRun(ctx) {
+		return this.dryRunRemove(nodeOpts)
+	}
 	cc := raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: nodeOpts.NodeId()}
 	return this.proposeConfigChange(ctx, cc)
 }
 
-func (this *replicator) Stop() {
+// dryRunAdd checks whether the node with the given options, already
+// found to be reachable, can be added to the cluster right away.
+func (this *replicator) dryRunAdd(nodeOpts pkg_raft.Options) error {
+	lead, members := this.ListMembers()
+	if lead == raft.None {
+		return pkg_raft.ErrNoLeader
+	}
+	if _, present := members[nodeOpts.NodeId()]; present {
+		return fmt.Errorf("node at %s is already a member of the cluster", nodeOpts.NodeUrl())
+	}
+	if this.memberAdds.full() {
+		return fmt.Errorf("node at %s would wait on the addition of other members: %v", nodeOpts.NodeUrl(), this.memberAdds.pending())
+	}
+	this.logger.Infof("[Node %x] Dry run of adding node at %s with ID %x succeeded", this.node.id, nodeOpts.NodeUrl(), nodeOpts.NodeId())
+	return nil
+}
+
+// dryRunRemove checks whether the node with the given options can be
+// removed from the cluster right away.
+func (this *replicator) dryRunRemove(nodeOpts pkg_raft.Options) error {
+	lead, members := this.ListMembers()
+	if lead == raft.None {
+		return pkg_raft.ErrNoLeader
+	}
+	if _, present := members[nodeOpts.NodeId()]; !present {
+		return fmt.Errorf("%w: %s", pkg_raft.ErrUnknownMember, nodeOpts.NodeUrl())
+	}
+	this.logger.Infof("[Node %x] Dry run of removing node at %s with ID %x succeeded", this.node.id, nodeOpts.NodeUrl(), nodeOpts.NodeId())
+	return nil
+}
+
+// ReplaceMember swaps the member with the given ID for a new node at
+// the given URL, which may carry an explicit ID of the new node. As the
+// RAFT library in use does not support joint consensus, the swap takes
+// several conf changes, ordered so that the quorum is never weakened.
+// The new node is first added as a learner, which does not vote. Once
+// it has caught up with the leader, the old member is removed and the
+// learner is promoted to a voter. Progress of the new node is known
+// only on the leader, hence this fails with ErrNotLeader elsewhere, and
+// the leader must hand over its leadership before being replaced. If a
+// step fails, the returned error tells which steps are left. Replacing
+// again resumes from a learner that was added but not yet caught up.
+func (this *replicator) ReplaceMember(ctx context.Context, oldId uint64, newUrl string) error {
+	nodeOpts, err := pkg_raft.NewOptions(pkg_raft.NodeUrl(newUrl))
+	if err != nil {
+		return err
+	}
+	if this.node.node.Status().RaftState != raft.StateLeader {
+		return pkg_raft.ErrNotLeader
+	}
+	if oldId == this.node.id {
+		return fmt.Errorf("leader %x cannot replace itself, transfer the leadership first", oldId)
+	}
+	_, members := this.ListMembers()
+	if _, present := members[oldId]; !present {
+		return fmt.Errorf("%w: %x", pkg_raft.ErrUnknownMember, oldId)
+	}
+	newId, nodeAddr := nodeOpts.NodeId(), nodeOpts.NodeUrl()
+	newMember, staged := members[newId]
+	if staged && !newMember.IsLearner {
+		return fmt.Errorf("node at %s is already a member of the cluster", nodeAddr)
+	}
+	if err := this.checkReachable(ctx, nodeAddr); err != nil {
+		return err
+	}
+	if err := this.checkQuorum(fmt.Sprintf("replace %x", oldId)); err != nil {
+		return err
+	}
+
+	this.logger.Infof("[Node %x] Replacing node %x with %s", this.node.id, oldId, nodeAddr)
+	if !staged {
+		// the given URL may carry an explicit ID of the new node
+		if err := this.AddLearner(ctx, newUrl); err != nil {
+			return err
+		}
+	}
+	if err := this.awaitLearner(ctx, newId); err != nil {
+		return fmt.Errorf("added %s as learner %x, retry replacing once it catches up. Error: %w", nodeAddr, newId, err)
+	}
+	cc := raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: oldId}
+	if err := this.proposeConfigChange(ctx, cc); err != nil {
+		return fmt.Errorf("added %s as learner %x but failed to remove node %x, retry replacing. Error: %w", nodeAddr, newId, oldId, err)
+	}
+	if err := this.PromoteLearner(ctx, newId); err != nil {
+		return fmt.Errorf("removed node %x but failed to promote learner %x, retry promoting it. Error: %w", oldId, newId, err)
+	}
+	return nil
+}
+
+// leaderPollInterval is the interval at which the leader is checked
+// while waiting on a leader to be elected or on a leadership transfer.
+const leaderPollInterval = 100 * time.Millisecond
+
+// TransferLeadership hands over the leadership of the cluster to the
+// voter with the given ID, such as before restarting the current leader,
+// to avoid an election. It waits till that voter becomes the leader or
+// the given context expires. The RAFT library aborts the transfer if the
+// voter does not catch up within an election timeout, in which case this
+// waits till the context expires.
+func (this *replicator) TransferLeadership(ctx context.Context, nodeId uint64) error {
+	if _, confState := this.node.members(); !containsID(confState.Nodes, nodeId) {
+		return fmt.Errorf("%w: %x is not a voter", pkg_raft.ErrUnknownMember, nodeId)
+	}
+	lead := this.node.getLeaderId()
+	if lead == nodeId {
+		return nil
+	}
+	if lead == raft.None {
+		return pkg_raft.ErrNoLeader
+	}
+	this.logger.Infof("[Node %x] Transferring leadership from %x to %x", this.node.id, lead, nodeId)
+	defer this.statsCli.Timing("raft.leader.transfer.latency.ms", time.Now())
+	this.node.node.TransferLeadership(ctx, lead, nodeId)
+	ticker := time.NewTicker(leaderPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if this.node.getLeaderId() == nodeId {
+				this.logger.Infof("[Node %x] Leadership transferred to %x", this.node.id, nodeId)
+				return nil
+			}
+		case <-ctx.Done():
+			this.logger.Warnf("[Node %x] Timed out transferring leadership to %x. Message: %v.", this.node.id, nodeId, ctx.Err())
+			this.statsCli.Incr("raft.leader.transfer.error", 1)
+			return ctx.Err()
+		}
+	}
+}
+
+const drainPollInterval = 10 * time.Millisecond
+
+// StopWithTimeout is similar to Stop except that it first stops accepting
+// new Saves and waits up to the given timeout for the ones proposed from
+// this node to be applied, along with all the entries committed so far.
+// Saves still pending at the timeout fail with ErrShuttingDown.
+func (this *replicator) StopWithTimeout(timeout time.Duration) error {
+	atomic.StoreInt32(&this.shuttingDown, 1)
+	deadline := time.Now().Add(timeout)
+	for !this.drained() {
+		if time.Now().After(deadline) {
+			this.logger.Warnf("[Node %x] Saves did not drain within %s, proceeding with shutdown", this.node.id, timeout)
+			this.statsCli.Incr("stop.drain.timeout", 1)
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return this.Stop()
+}
+
+// drained reports whether no Saves made on this node are pending, be it
+// in the propose queue, in Propose or waiting to be applied, and all the
+// entries committed so far are applied.
+func (this *replicator) drained() bool {
+	if atomic.LoadInt64(&this.inflightProposals) > 0 {
+		return false
+	}
+	return this.AppliedIndex() >= this.node.node.Status().Commit
+}
+
+// Stop shuts down this node along with its store. New Saves are refused
+// and the requests pending on this node fail with ErrShuttingDown, before
+// the store is closed. If the store does not close within the configured
+// stop timeout, Stop returns without waiting any further, with an error
+// indicating the same.
+func (this *replicator) Stop() error {
+	atomic.StoreInt32(&this.shuttingDown, 1)
+	this.stopDebugServer()
+	this.unpublishExpvar()
+	atomic.StoreInt32(&this.stopped, 1)
 	close(this.node.stopc)
-	this.store.Close()
-	this.statsCli.Close()
+	defer this.statsCli.Close()
+	this.failPending(pkg_raft.ErrShuttingDown)
+
+	closeC := make(chan error, 1)
+	go func() { closeC <- this.store.Close() }()
+	timeout := this.opts.StopTimeout()
+	if timeout <= 0 {
+		return <-closeC
+	}
+	select {
+	case err := <-closeC:
+		return err
+	case <-time.After(timeout):
+		this.logger.Warnf("[Node %x] Store did not close within %s, proceeding with shutdown", this.node.id, timeout)
+		this.statsCli.Incr("stop.timeout.error", 1)
+		return fmt.Errorf("%w: store did not close within %s", pkg_raft.ErrStopTimeout, timeout)
+	}
+}
+
+// ConfChangeCount returns the number of config changes proposed
+// by this node since it was started.
+func (this *replicator) ConfChangeCount() uint64 {
+	return atomic.LoadUint64(&this.confChangeCount)
+}
+
+// ResetConfChangeCount resets the number of config changes proposed
+// by this node and returns the count prior to the reset.
+func (this *replicator) ResetConfChangeCount() uint64 {
+	return atomic.SwapUint64(&this.confChangeCount, 0)
+}
+
+// nextConfChangeID returns the ID for a new config change. Since the
+// count of config changes is not persisted, IDs are drawn from idGen
+// instead, which is seeded with the node ID and its start time. This
+// ensures that config changes replayed from the WAL after a restart
+// never trigger waiters registered by the new incarnation.
+func (this *replicator) nextConfChangeID() uint64 {
+	atomic.AddUint64(&this.confChangeCount, 1)
+	return this.idGen.Next()
 }
 
 func (this *replicator) proposeConfigChange(ctx context.Context, confChange raftpb.ConfChange) error {
 	defer this.statsCli.Timing("config.change.latency.ms", time.Now())
-	confChange.ID = atomic.AddUint64(&this.confChangeCount, 1)
-	ch := this.waiter.Register(confChange.ID)
-	child_ctx, cancel := context.WithTimeout(ctx, this.opts.ReplTimeout())
+	confChange.ID = this.nextConfChangeID()
+	atomic.AddInt32(&this.pendingConfChanges, 1)
+	defer this.endConfChange()
+	child_ctx, cancel := context.WithTimeout(ctx, this.opts.ConfChangeTimeout())
 	defer cancel()
+	ch := registerOp(this.waiter, confChange.ID, pkg_raft.OpConfChange, child_ctx)
 	if err := this.node.node.ProposeConfChange(ctx, confChange); err != nil {
-		log.Printf("[WARN] [Node %x] Error while proposing config change to Raft. Message: %v.", this.node.id, err)
+		this.logger.Warnf("[Node %x] Error while proposing config change to Raft. Message: %v.", this.node.id, err)
 		this.waiter.Trigger(confChange.ID, &internalNexusResponse{Err: err})
 		return err
 	}
@@ -237,50 +1329,601 @@ func (this *replicator) proposeConfigChange(ctx context.Context, confChange raft
 	}
 }
 
+// checkConfChange accounts for a Save made while a membership change
+// proposed from this node is in progress, rejecting it if configured to.
+func (this *replicator) checkConfChange() error {
+	if atomic.LoadInt32(&this.pendingConfChanges) == 0 {
+		return nil
+	}
+	if this.opts.RejectSavesDuringConfChange() {
+		this.statsCli.Incr("save.conf.change.rejected", 1)
+		return pkg_raft.ErrConfChangeInProgress
+	}
+	atomic.AddInt64(&this.savesDuringConfChange, 1)
+	this.statsCli.Incr("save.during.conf.change", 1)
+	return nil
+}
+
+func (this *replicator) endConfChange() {
+	if atomic.AddInt32(&this.pendingConfChanges, -1) == 0 {
+		if saves := atomic.SwapInt64(&this.savesDuringConfChange, 0); saves > 0 {
+			this.logger.Infof("[Node %x] %d save(s) were proposed during the membership change", this.node.id, saves)
+		}
+	}
+}
+
 func (this *replicator) readCommits() {
 	for entry := range this.node.commitC {
 		if entry == nil {
-			log.Printf("[Node %x] Received a message in the commit channel with no data", this.node.id)
+			this.logger.Infof("[Node %x] Received a message in the commit channel with no data", this.node.id)
 			data, err := this.node.snapshotter.LoadDBSnapshot()
 			if err == snap.ErrNoSnapshot {
-				log.Printf("[Node %x] WARNING - Received no snapshot error", this.node.id)
+				this.logger.Infof("[Node %x] WARNING - Received no snapshot error", this.node.id)
 				continue
 			}
-			if err != nil {
-				log.Panic(err)
+			if this.applyPool != nil {
+				this.applyPool.drain()
 			}
-			log.Printf("[Node %x] Loaded DB snapshot", this.node.id)
-			if err := this.store.Restore(data); err != nil {
-				log.Panic(err)
+			snapMeta := this.loadedSnapshotMetadata()
+			this.logger.Infof("[Node %x] Loaded DB snapshot at index: %d, term: %d", this.node.id, snapMeta.Index, snapMeta.Term)
+			if err == nil {
+				err = this.restore(data)
 			}
+			if err != nil && !this.retryRestore(snapMeta, err) {
+				continue
+			}
+			if this.digest != nil {
+				this.digest.reset()
+			}
+			atomic.StoreUint64(&this.lastSnapIndex, snapMeta.Index)
+			atomic.StoreUint64(&this.lastSnapTerm, snapMeta.Term)
+			if snapMeta.Index > this.AppliedIndex() {
+				this.markApplied(snapMeta.Index)
+			}
+			this.statsCli.Gauge("snapshot.loaded.index", int64(snapMeta.Index))
 		} else {
-			if len(entry.Data) > 0 {
-				switch entry.Type {
-				case raftpb.EntryNormal:
-					var replReq models.NexusInternalRequest
-					if err := proto.Unmarshal(entry.Data, &replReq); err != nil {
-						log.Fatal(err)
-					} else {
-						replRes := internalNexusResponse{}
-						raftEntry := db.RaftEntry{Index: entry.Index, Term: entry.Term}
-						replRes.Res, replRes.Err = this.store.Save(raftEntry, replReq.Req)
-						this.waiter.Trigger(replReq.ID, &replRes)
-					}
-				case raftpb.EntryConfChange:
-					var cc raftpb.ConfChange
-					if err := cc.Unmarshal(entry.Data); err != nil {
-						log.Fatal(err)
-					} else {
-						this.waiter.Trigger(cc.ID, &internalNexusResponse{entry.Data, nil})
-					}
+			this.applyEntry(entry)
+			if this.digest != nil {
+				this.checkpointDigest(entry.Index)
+			}
+		}
+	}
+	if this.applyPool != nil {
+		this.applyPool.stop()
+	}
+	this.commitsClosed()
+}
+
+// applyEntry applies the given committed entry onto the store, either
+// directly or via the apply pool, and signals the waiters on it.
+func (this *replicator) applyEntry(entry *raftpb.Entry) {
+	if len(entry.Data) > 0 {
+		switch entry.Type {
+		case raftpb.EntryNormal:
+			var replReq models.NexusInternalRequest
+			if err := proto.Unmarshal(entry.Data, &replReq); err != nil {
+				this.logger.Fatalf("%v", err)
+			} else if err := decompressPayloads(&replReq); err != nil {
+				this.logger.Fatalf("[Node %x] Unable to decompress entry at index: %d. Error: %v", this.node.id, entry.Index, err)
+			} else if replReq.DigestIndex > 0 {
+				this.verifyDigest(&replReq)
+			} else {
+				raftEntry := db.RaftEntry{Index: entry.Index, Term: entry.Term}
+				if atomic.LoadInt64(&this.commitWaits) > 0 {
+					this.commitWaiter.Trigger(replReq.ID, &internalNexusResponse{Index: entry.Index})
 				}
+				if this.applyPool != nil && len(replReq.Batch) == 0 {
+					partition := this.opts.PartitionFunc()(replReq.Req)
+					this.applyPool.submit(entry.Index, partition, func() { this.applyRequest(raftEntry, &replReq) })
+					return
+				}
+				// A batch may span partitions, so it is applied only
+				// after all the requests preceding it are applied.
+				if this.applyPool != nil {
+					this.applyPool.drain()
+				}
+				this.applyRequest(raftEntry, &replReq)
+			}
+		case raftpb.EntryConfChange:
+			var cc raftpb.ConfChange
+			if err := cc.Unmarshal(entry.Data); err != nil {
+				this.logger.Fatalf("%v", err)
+			} else {
+				this.waiter.Trigger(cc.ID, &internalNexusResponse{Res: entry.Data, Index: entry.Index})
 			}
-			// signal any linearizable reads blocked for this index
-			this.applyWait.Trigger(entry.Index)
 		}
 	}
-	if err, present := <-this.node.errorC; present {
-		log.Fatal(err)
+	// signal any linearizable reads blocked for this index
+	if this.applyPool != nil {
+		this.applyPool.applied(entry.Index)
+	} else {
+		this.markApplied(entry.Index)
+	}
+}
+
+// checkpointDigest records the digest of the window of entries ending
+// at the given index, if it is a checkpoint, and reports it to the
+// other nodes via RAFT.
+func (this *replicator) checkpointDigest(index uint64) {
+	if index%this.opts.DeterminismCheckInterval() != 0 {
+		this.digest.observe(index)
+		return
+	}
+	if this.applyPool != nil {
+		this.applyPool.drain()
+	}
+	if digest, ok := this.digest.observe(index); ok {
+		go this.reportDigest(index, digest)
+	}
+}
+
+// reportDigest proposes the digest of this node for the checkpoint at
+// the given index, to be verified by the leader once committed.
+func (this *replicator) reportDigest(index, digest uint64) {
+	data, err := proto.Marshal(&models.NexusInternalRequest{ID: this.idGen.Next(), DigestIndex: index, Digest: digest, DigestNode: this.node.id})
+	if err != nil {
+		this.logger.Warnf("[Node %x] Unable to marshal the digest for index: %d. Error: %v", this.node.id, index, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.opts.ReplTimeout())
+	defer cancel()
+	if err := this.node.node.Propose(ctx, data); err != nil {
+		this.statsCli.Incr("store.digest.report.error", 1)
+		this.logger.Warnf("[Node %x] Unable to report the digest for index: %d. Error: %v", this.node.id, index, err)
+	}
+}
+
+// verifyDigest compares the digest reported by a node for a checkpoint
+// with the one recorded by this node, if it is the leader. A mismatch
+// implies that the store produced different results on the two nodes
+// for the same entries.
+func (this *replicator) verifyDigest(replReq *models.NexusInternalRequest) {
+	if this.digest == nil || replReq.DigestNode == this.node.id || this.node.getLeaderId() != this.node.id {
+		return
+	}
+	match, known := this.digest.verify(replReq.DigestIndex, replReq.Digest)
+	switch {
+	case !known:
+		this.logger.Infof("[Node %x] Skipping verification of the digest reported by node %x for index: %d, as none is recorded locally", this.node.id, replReq.DigestNode, replReq.DigestIndex)
+	case match:
+		this.statsCli.Incr("store.digest.match", 1)
+	default:
+		this.statsCli.Incr("store.digest.mismatch", 1)
+		this.logger.Errorf("[Node %x] Store diverged on node %x: digest of entries up to index: %d does not match the one of this node", this.node.id, replReq.DigestNode, replReq.DigestIndex)
+	}
+}
+
+// commitsClosed handles the commit channel having been closed. This is
+// expected on stopping the replicator, in which case any error from the
+// RAFT node is only logged. It is also expected once this node has been
+// removed from the cluster, in which case ErrNodeRemoved is reported to
+// the configured callback, if any, while the process is kept running.
+// Otherwise the error is reported to the callback, or else the process
+// exits.
+func (this *replicator) commitsClosed() {
+	err, present := <-this.node.errorC
+	if atomic.LoadInt32(&this.stopped) == 1 {
+		if present && err != nil {
+			this.logger.Warnf("[Node %x] Commit channel closed on stopping. Error: %v", this.node.id, err)
+		} else {
+			this.logger.Infof("[Node %x] Commit channel closed on stopping", this.node.id)
+		}
+		return
+	}
+	if this.node.isRemoved() {
+		this.logger.Warnf("[Node %x] Commit channel closed after removal from the cluster, rejecting further requests", this.node.id)
+		this.statsCli.Incr("raft.node.removed", 1)
+		this.failPending(pkg_raft.ErrNodeRemoved)
+		if onClosed := this.opts.OnCommitClosed(); onClosed != nil {
+			onClosed(pkg_raft.ErrNodeRemoved)
+		}
+		return
+	}
+	if !present || err == nil {
+		err = pkg_raft.ErrCommitClosed
+	}
+	this.statsCli.Incr("raft.commit.closed.error", 1)
+	if onClosed := this.opts.OnCommitClosed(); onClosed != nil {
+		this.logger.Warnf("[Node %x] Commit channel closed unexpectedly. Error: %v", this.node.id, err)
+		onClosed(err)
+		return
+	}
+	this.logger.Fatalf("%v", err)
+}
+
+// failPending fails all the requests pending on this node with the
+// given error.
+func (this *replicator) failPending(err error) {
+	pending := &internalNexusResponse{Err: err}
+	for _, w := range []wait.Wait{this.waiter, this.commitWaiter} {
+		if tw, ok := w.(*timedWait); ok {
+			tw.triggerAll(pending)
+		}
+	}
+}
+
+// restore restores the store from the given DB snapshot, flagging
+// the restore as in progress for Loads to be rejected till then.
+func (this *replicator) restore(data io.ReadCloser) error {
+	// flagged before locking, for the Loads holding the lock to see it
+	atomic.StoreInt32(&this.restoring, 1)
+	this.restoreMu.Lock()
+	defer this.restoreMu.Unlock()
+	defer atomic.StoreInt32(&this.restoring, 0)
+	return this.store.Restore(data)
+}
+
+// restoreDiverged restores the store from the DB snapshot taken along
+// with the given RAFT snapshot, when it is found on starting up to have
+// diverged from RAFT. The entries following the snapshot are applied
+// afresh afterwards.
+func (this *replicator) restoreDiverged(snapMeta raftpb.SnapshotMetadata) error {
+	data, err := this.node.snapshotter.LoadDBSnapshot()
+	if err == nil {
+		err = this.restore(data)
+	}
+	if err != nil {
+		this.statsCli.Incr("snapshot.restore.error", 1)
+		return err
+	}
+	atomic.StoreUint64(&this.lastSnapIndex, snapMeta.Index)
+	atomic.StoreUint64(&this.lastSnapTerm, snapMeta.Term)
+	this.markApplied(snapMeta.Index)
+	return nil
+}
+
+const (
+	restoreMinBackoff = time.Second
+	restoreMaxBackoff = 30 * time.Second
+)
+
+// retryRestore retries restoring the store from the latest DB snapshot
+// with exponential backoff, after it failed with the given error. Till
+// then, this node is fenced off by reporting it as not alive and
+// refusing Loads, while no further entries get applied. It returns
+// whether the store got restored, which is not the case if this node
+// is stopped in the meantime.
+func (this *replicator) retryRestore(snapMeta raftpb.SnapshotMetadata, err error) bool {
+	this.statsCli.Incr("snapshot.restore.error", 1)
+	if this.opts.PanicOnRestoreFailure() {
+		this.logger.Errorf("[Node %x] Unable to restore from snapshot at index: %d. Error: %v", this.node.id, snapMeta.Index, err)
+		panic(err)
+	}
+	atomic.StoreInt32(&this.restoreFailed, 1)
+	defer atomic.StoreInt32(&this.restoreFailed, 0)
+	backoff := restoreMinBackoff
+	for attempt := 1; ; attempt++ {
+		this.logger.Warnf("[Node %x] Unable to restore store from snapshot at index: %d, term: %d, retrying in %s. Error: %v",
+			this.node.id, snapMeta.Index, snapMeta.Term, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-this.node.stopc:
+			return false
+		}
+		var data io.ReadCloser
+		if data, err = this.node.snapshotter.LoadDBSnapshot(); err == nil {
+			err = this.restore(data)
+		}
+		if err == nil {
+			this.logger.Infof("[Node %x] Restored store from snapshot at index: %d after %d retries", this.node.id, snapMeta.Index, attempt)
+			return true
+		}
+		this.statsCli.Incr("snapshot.restore.error", 1)
+		if backoff *= 2; backoff > restoreMaxBackoff {
+			backoff = restoreMaxBackoff
+		}
+	}
+}
+
+// InflightOps returns the operations waiting to be served on this node,
+// oldest first, for finding out what is stuck while debugging. It is
+// safe to call concurrently with the operations themselves.
+func (this *replicator) InflightOps() []pkg_raft.InflightOp {
+	var ops []pkg_raft.InflightOp
+	for _, w := range []wait.Wait{this.waiter, this.commitWaiter} {
+		if tw, ok := w.(*timedWait); ok {
+			ops = append(ops, tw.inflight()...)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Age > ops[j].Age })
+	return ops
+}
+
+// Commits returns the Saves committed from the given index onwards, up
+// to the given number of entries, that have been applied onto the store
+// of this node. It also returns the index from which to continue, which
+// moves past the entries carrying no Saves, such as membership changes.
+// Fails with a *CompactedError if the given index is no longer retained
+// in the RAFT log.
+func (this *replicator) Commits(fromIndex uint64, maxEntries int) ([]pkg_raft.Commit, uint64, error) {
+	firstIndex, err := this.node.raftStorage.FirstIndex()
+	if err != nil {
+		return nil, fromIndex, err
+	}
+	if fromIndex < firstIndex {
+		return nil, fromIndex, &pkg_raft.CompactedError{FirstIndex: firstIndex, SnapshotIndex: firstIndex - 1}
+	}
+	hi := this.AppliedIndex() + 1
+	if fromIndex >= hi {
+		return nil, fromIndex, nil
+	}
+	if hi-fromIndex > uint64(maxEntries) {
+		hi = fromIndex + uint64(maxEntries)
+	}
+	ents, err := this.node.raftStorage.Entries(fromIndex, hi, math.MaxUint64)
+	if err == raft.ErrCompacted {
+		firstIndex, _ = this.node.raftStorage.FirstIndex()
+		return nil, fromIndex, &pkg_raft.CompactedError{FirstIndex: firstIndex, SnapshotIndex: firstIndex - 1}
+	}
+	if err != nil {
+		return nil, fromIndex, err
+	}
+	var commits []pkg_raft.Commit
+	for _, entry := range ents {
+		if entry.Type != raftpb.EntryNormal || len(entry.Data) == 0 {
+			continue
+		}
+		var replReq models.NexusInternalRequest
+		if err := proto.Unmarshal(entry.Data, &replReq); err != nil {
+			return nil, fromIndex, err
+		}
+		if err := decompressPayloads(&replReq); err != nil {
+			return nil, fromIndex, err
+		}
+		if replReq.DigestIndex > 0 {
+			continue
+		}
+		commit := pkg_raft.Commit{Index: entry.Index, Term: entry.Term, Data: replReq.Batch}
+		if len(replReq.Batch) == 0 {
+			commit.Data = [][]byte{replReq.Req}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, hi, nil
+}
+
+// markApplied records that all the entries up to the given index
+// have been applied and unblocks the reads waiting on them.
+func (this *replicator) markApplied(index uint64) {
+	atomic.StoreUint64(&this.appliedIndex, index)
+	this.applyWait.Trigger(index)
+}
+
+// Health returns the state of this node for determining its liveness
+// and readiness. Liveness does not require the cluster to have a leader.
+func (this *replicator) Health() pkg_raft.Health {
+	restoreFailed := atomic.LoadInt32(&this.restoreFailed) == 1
+	health := pkg_raft.Health{Alive: this.node.isAlive() && !restoreFailed, AppliedIndex: this.AppliedIndex(), Shadow: this.node.isShadow()}
+	if health.Alive {
+		status := this.node.node.Status()
+		health.Leader, health.CommitIndex = status.Lead, status.Commit
+		health.Connected = this.writable(status)
+	}
+	return health
+}
+
+// AppliedIndex returns the index up to which all the committed
+// entries have been applied onto the store of this node.
+func (this *replicator) AppliedIndex() uint64 {
+	return atomic.LoadUint64(&this.appliedIndex)
+}
+
+func (this *replicator) applyRequest(raftEntry db.RaftEntry, replReq *models.NexusInternalRequest) {
+	// Retries of a request carry its idempotency key and hash onto the
+	// same partition, hence they are never applied concurrently.
+	if key := replReq.IdempotencyKey; key != "" {
+		if replRes, present := this.appliedKeys.get(key); present {
+			this.logger.Infof("[Node %x] %s Skipping duplicate of request applied at index: %d", this.node.id, requestTag(replReq), replRes.Index)
+			this.statsCli.Incr("save.duplicate", 1)
+			this.waiter.Trigger(replReq.ID, &replRes)
+			return
+		}
+	}
+	replRes := internalNexusResponse{Index: raftEntry.Index}
+	if len(replReq.Batch) > 0 {
+		this.applyBatch(raftEntry, replReq, &replRes)
+	} else {
+		if !this.opts.LogOnly() {
+			replRes.Res, replRes.Err = this.store.Save(raftEntry, replReq.Req)
+		}
+		if replRes.Err == nil {
+			this.onApplied(raftEntry, replReq, replReq.Req)
+		}
+	}
+	if replReq.IdempotencyKey != "" {
+		this.appliedKeys.put(replReq.IdempotencyKey, replRes)
+	}
+	if this.digest != nil {
+		this.digest.add(raftEntry.Index, &replRes)
+	}
+	if replReq.CorrelationId != "" {
+		this.logger.Infof("[Node %x] %s Applied at index: %d, term: %d, error: %v", this.node.id, requestTag(replReq), raftEntry.Index, raftEntry.Term, replRes.Err)
+	}
+	this.waiter.Trigger(replReq.ID, &replRes)
+}
+
+// applyBatch saves each payload of the given batch request onto the
+// store in order. Failure of a payload does not prevent the ones after
+// it from being saved, the errors are reported as a *raft.BatchError.
+func (this *replicator) applyBatch(raftEntry db.RaftEntry, replReq *models.NexusInternalRequest, replRes *internalNexusResponse) {
+	replRes.BatchRes = make([][]byte, len(replReq.Batch))
+	errs, failed := make([]error, len(replReq.Batch)), false
+	for i, data := range replReq.Batch {
+		if !this.opts.LogOnly() {
+			replRes.BatchRes[i], errs[i] = this.store.Save(raftEntry, data)
+		}
+		if errs[i] != nil {
+			failed = true
+		} else {
+			this.onApplied(raftEntry, replReq, data)
+		}
+	}
+	if failed {
+		this.statsCli.Incr("save.batch.partial.error", 1)
+		replRes.Err = &pkg_raft.BatchError{Errs: errs}
+	}
+}
+
+// onApplied notifies the apply callback and the auditor, if any, of
+// the given payload having been saved onto the store.
+func (this *replicator) onApplied(raftEntry db.RaftEntry, replReq *models.NexusInternalRequest, data []byte) {
+	if onApply := this.opts.OnApply(); onApply != nil {
+		onApply(raftEntry, data)
+	}
+	if this.auditor != nil {
+		this.auditor.audit(pkg_raft.AuditRecord{
+			RequestId:     replReq.ID,
+			CorrelationId: replReq.CorrelationId,
+			Size:          len(data),
+			Index:         raftEntry.Index,
+			Term:          raftEntry.Term,
+			AppliedAt:     time.Now(),
+		})
+	}
+}
+
+// requestTag identifies the given request in log lines. Requests with
+// a correlation ID are logged at every stage of their lifecycle.
+func requestTag(replReq *models.NexusInternalRequest) string {
+	if replReq.CorrelationId == "" {
+		return fmt.Sprintf("[Req %x]", replReq.ID)
+	}
+	return fmt.Sprintf("[Req %x, CorrelationId %s]", replReq.ID, replReq.CorrelationId)
+}
+
+// loadedSnapshotMetadata returns the metadata of the latest snapshot
+// applied to the RAFT storage, which is the one whose DB snapshot is
+// handed over to the store for restoring.
+func (this *replicator) loadedSnapshotMetadata() raftpb.SnapshotMetadata {
+	if snap, err := this.node.raftStorage.Snapshot(); err != nil {
+		this.logger.Warnf("[Node %x] Unable to read snapshot metadata. Error: %v", this.node.id, err)
+		return raftpb.SnapshotMetadata{}
+	} else {
+		return snap.Metadata
+	}
+}
+
+func (this *replicator) Status() pkg_raft.Status {
+	voters, quorum := this.ReplicationFactor()
+	raftStatus := this.node.node.Status()
+	return pkg_raft.Status{
+		Term:              raftStatus.Term,
+		CommitIndex:       raftStatus.Commit,
+		AppliedIndex:      this.AppliedIndex(),
+		Leader:            raftStatus.Lead,
+		LastSnapshotIndex: atomic.LoadUint64(&this.lastSnapIndex),
+		LastSnapshotTerm:  atomic.LoadUint64(&this.lastSnapTerm),
+		Voters:            voters,
+		Quorum:            quorum,
+
+		ProposalsMade:      atomic.LoadUint64(&this.proposals.made),
+		ProposalsCommitted: atomic.LoadUint64(&this.proposals.committed),
+		ProposalsFailed:    atomic.LoadUint64(&this.proposals.failed),
+
+		Writable: this.writable(raftStatus),
+		Readable: this.readable(raftStatus),
+	}
+}
+
+// maxReadableLag is the number of committed entries a replica may be
+// yet to apply, or replicate in case of peers, to be deemed readable.
+const maxReadableLag = 1000
+
+// writable reports whether the cluster can commit Saves currently, as
+// per the given status of this node. See pkg_raft.Status.Writable.
+func (this *replicator) writable(status raft.Status) bool {
+	switch {
+	case status.Lead == raft.None:
+		return false
+	case status.RaftState == raft.StateLeader:
+		voters, reachable := this.reachableVoters(status)
+		return len(reachable) > voters/2
+	default:
+		return !this.node.transport.ActiveSince(types.ID(status.Lead)).IsZero()
+	}
+}
+
+// readable reports whether some replica can serve Loads currently, as
+// per the given status of this node. See pkg_raft.Status.Readable.
+func (this *replicator) readable(status raft.Status) bool {
+	if !this.node.isShadow() && atomic.LoadInt32(&this.restoreFailed) == 0 &&
+		this.AppliedIndex()+maxReadableLag >= status.Commit {
+		return true
+	}
+	for id, pr := range status.Progress {
+		if id == this.node.id || this.node.isShadowMember(id) || this.node.transport.ActiveSince(types.ID(id)).IsZero() {
+			continue
+		}
+		if pr.Match+maxReadableLag >= status.Commit {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplicationFactor returns the number of voters in the cluster along
+// with the quorum size, as per the membership last applied on this
+// node. Learners are not counted. Quorum is 0 if there are no voters.
+func (this *replicator) ReplicationFactor() (voters int, quorum int) {
+	if voters = int(atomic.LoadInt32(&this.node.voters)); voters > 0 {
+		quorum = voters/2 + 1
+	}
+	return voters, quorum
+}
+
+// SetLogLevel changes the verbosity of the RAFT library logs at
+// runtime and returns the previous level. Note that this level is
+// shared by all the replicators running within the process.
+func (this *replicator) SetLogLevel(level pkg_raft.LogLevel) pkg_raft.LogLevel {
+	prevLevel := raftLog.setLevel(level)
+	this.logger.Infof("[Node %x] Changed RAFT log level from %s to %s", this.node.id, prevLevel, level)
+	return prevLevel
+}
+
+// CompactLog discards all the entries of the in-memory RAFT log up to
+// and including the given index. The index must not be beyond that of
+// the latest snapshot, so that lagging followers can still catch up
+// using it.
+func (this *replicator) CompactLog(index uint64) error {
+	snap, err := this.node.raftStorage.Snapshot()
+	if err != nil {
+		return err
+	}
+	if snapIndex := snap.Metadata.Index; index == 0 || index > snapIndex {
+		return fmt.Errorf("compaction index %d must be within 1 and the latest snapshot index %d", index, snapIndex)
+	}
+	if err := this.node.raftStorage.Compact(index); err != nil {
+		return fmt.Errorf("unable to compact log at index %d, error: %v", index, err)
+	}
+	this.logger.Infof("[Node %x] Compacted log at index %d", this.node.id, index)
+	return nil
+}
+
+// Snapshot takes a snapshot of the store right away, such as prior to
+// maintenance, and returns its RAFT index. The snapshot is taken by the
+// RAFT event loop, so it never overlaps with the automatic snapshots.
+// If nothing has been applied since the latest snapshot, its index is
+// returned without taking another one.
+func (this *replicator) Snapshot(ctx context.Context) (uint64, error) {
+	resC := make(chan snapshotResult, 1)
+	select {
+	case this.node.snapshotReqC <- resC:
+	case <-this.node.stopc:
+		return 0, errors.New("replicator is stopped")
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	select {
+	case res := <-resC:
+		if res.err != nil {
+			this.statsCli.Incr("raft.snapshot.forced.error", 1)
+			this.logger.Errorf("[Node %x] Unable to take snapshot. Error: %v", this.node.id, res.err)
+			return 0, res.err
+		}
+		this.logger.Infof("[Node %x] Took snapshot at index: %d on request", this.node.id, res.index)
+		return res.index, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
 }
 
@@ -289,6 +1932,6 @@ func (this *replicator) readReadStates() {
 		id := binary.BigEndian.Uint64(rd.RequestCtx)
 		indexData := make([]byte, 8)
 		binary.BigEndian.PutUint64(indexData, rd.Index)
-		this.waiter.Trigger(id, &internalNexusResponse{indexData, nil})
+		this.waiter.Trigger(id, &internalNexusResponse{Res: indexData})
 	}
 }
@@ -3,23 +3,40 @@ package raft
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"github.com/flipkart-incubator/nexus/models"
 	"github.com/flipkart-incubator/nexus/pkg/db"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/coreos/etcd/pkg/idutil"
+	"github.com/coreos/etcd/pkg/types"
+	"github.com/coreos/etcd/pkg/wait"
+	etcd_raft "github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
+	"github.com/coreos/etcd/wal"
+	"github.com/flipkart-incubator/nexus/internal/raft/snap"
+	"github.com/flipkart-incubator/nexus/internal/stats"
 	"github.com/flipkart-incubator/nexus/pkg/raft"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -28,6 +45,11 @@ const (
 	snapDir     = "/tmp/nexus_test/snap"
 	clusterUrl  = "http://127.0.0.1:9321,http://127.0.0.1:9322,http://127.0.0.1:9323"
 	peer4Url    = "http://127.0.0.1:9324"
+	peer5Url    = "http://127.0.0.1:9325"
+	peer6Url    = "http://127.0.0.1:9326"
+	peer7Url    = "http://127.0.0.1:9327"
+	peer8Url    = "http://127.0.0.1:9328"
+	peer9Url    = "http://127.0.0.1:9329"
 	replTimeout = 3 * time.Second
 )
 
@@ -42,13 +64,1621 @@ func TestReplicator(t *testing.T) {
 	t.Run("testSaveLoadLargeData", testSaveLoadLargeData)
 	t.Run("testLoadDuringRestarts", testLoadDuringRestarts)
 	t.Run("testForNewNexusNodeJoinLeaveCluster", testForNewNexusNodeJoinLeaveCluster)
+	t.Run("testJoinFromSnapshot", testJoinFromSnapshot)
+	t.Run("testPromoteAndTransferLeadership", testPromoteAndTransferLeadership)
+	t.Run("testDryRunMembership", testDryRunMembership)
+	t.Run("testReplaceMember", testReplaceMember)
+	t.Run("testAdvertiseServiceAddr", testAdvertiseServiceAddr)
 	t.Run("testForNodeRestart", testForNodeRestart)
 }
 
+func TestInactivePeerStatus(t *testing.T) {
+	gracePeriod := 200 * time.Millisecond
+	opts, err := raft.NewOptions(raft.OfflineGracePeriod(gracePeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl := newTestReplicator(t, opts)
+	repl.node.id = 2
+	peerId := uint64(1)
+
+	if status := repl.inactivePeerStatus(peerId); status != models.NodeInfo_SUSPECT {
+		t.Errorf("Expected status: %s, Actual: %s", models.NodeInfo_SUSPECT, status)
+	}
+	<-time.After(gracePeriod)
+	if status := repl.inactivePeerStatus(peerId); status != models.NodeInfo_OFFLINE {
+		t.Errorf("Expected status: %s, Actual: %s", models.NodeInfo_OFFLINE, status)
+	}
+	if !repl.offlinePeers[peerId] {
+		t.Error("Expected peer to be tracked as offline")
+	}
+	repl.markPeerActive(peerId)
+	if repl.offlinePeers[peerId] {
+		t.Error("Expected peer to not be tracked as offline once active")
+	}
+	if status := repl.inactivePeerStatus(peerId); status != models.NodeInfo_SUSPECT {
+		t.Errorf("Expected status: %s, Actual: %s", models.NodeInfo_SUSPECT, status)
+	}
+}
+
+func TestWatchMembers(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	repl.node.id, repl.node.rpeers = 2, map[uint64]string{1: "http://node1:9020"}
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := repl.WatchMembers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl.inactivePeerStatus(1)
+	repl.inactivePeerStatus(1)
+	repl.markPeerActive(1)
+	repl.markPeerActive(1)
+	for _, typ := range []raft.MemberEventType{raft.MemberOffline, raft.MemberOnline} {
+		if event := <-events; event.Type != typ || event.NodeId != 1 || event.NodeUrl != "http://node1:9020" {
+			t.Errorf("Expected %s event for node 1, got: %+v", typ, event)
+		}
+	}
+	cancel()
+	if event, ok := <-events; ok {
+		t.Errorf("Expected events to be closed, got: %+v", event)
+	}
+}
+
+func TestConfChangeIDAcrossRestart(t *testing.T) {
+	nodeId, startTime := uint16(1), time.Now()
+	repl := newTestReplicator(t, nil)
+	repl.waiter, repl.idGen = wait.New(), idutil.NewGenerator(nodeId, startTime)
+	pendingId := repl.nextConfChangeID()
+	if cnt := repl.ConfChangeCount(); cnt != 1 {
+		t.Errorf("Expected conf change count: 1, Actual: %d", cnt)
+	}
+
+	// simulate a restart while the above conf change is still pending
+	repl = newTestReplicator(t, nil)
+	repl.waiter, repl.idGen = wait.New(), idutil.NewGenerator(nodeId, startTime.Add(time.Second))
+	if cnt := repl.ConfChangeCount(); cnt != 0 {
+		t.Errorf("Expected conf change count: 0, Actual: %d", cnt)
+	}
+	newId := repl.nextConfChangeID()
+	if newId == pendingId {
+		t.Fatalf("Conf change ID: %d reused after restart", newId)
+	}
+	ch := repl.waiter.Register(newId)
+	// replaying the pending conf change from WAL must not trigger the new one
+	repl.waiter.Trigger(pendingId, &internalNexusResponse{})
+	select {
+	case <-ch:
+		t.Error("Waiter of new conf change triggered by replayed conf change")
+	default:
+	}
+	repl.waiter.Trigger(newId, &internalNexusResponse{})
+
+	if cnt := repl.ResetConfChangeCount(); cnt != 1 {
+		t.Errorf("Expected conf change count: 1, Actual: %d", cnt)
+	}
+	if cnt := repl.ConfChangeCount(); cnt != 0 {
+		t.Errorf("Expected conf change count after reset: 0, Actual: %d", cnt)
+	}
+}
+
+func TestRaftLogLevel(t *testing.T) {
+	logger := newRaftLogger(raft.InfoLevel)
+	if logger.enabled(raft.DebugLevel) || !logger.enabled(raft.InfoLevel) {
+		t.Errorf("Expected only info and above to be logged")
+	}
+	if prevLevel := logger.setLevel(raft.DebugLevel); prevLevel != raft.InfoLevel {
+		t.Errorf("Expected previous level: %s, Actual: %s", raft.InfoLevel, prevLevel)
+	}
+	if !logger.enabled(raft.DebugLevel) {
+		t.Errorf("Expected debug logs to be enabled")
+	}
+	logger.setLevel(raft.ErrorLevel)
+	if logger.enabled(raft.WarnLevel) || !logger.enabled(raft.ErrorLevel) {
+		t.Errorf("Expected only errors to be logged")
+	}
+}
+
+func TestApplyPoolOrdering(t *testing.T) {
+	var appliedIdxs []uint64
+	pool := newApplyPool(4, func(idx uint64) { appliedIdxs = append(appliedIdxs, idx) })
+
+	var mu sync.Mutex
+	partitionIdxs := make(map[uint64][]uint64)
+	for idx := uint64(1); idx <= 100; idx++ {
+		if idx%10 == 0 {
+			pool.applied(idx)
+			continue
+		}
+		i, partition := idx, idx%7
+		pool.submit(i, partition, func() {
+			time.Sleep(time.Duration(i%3) * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			partitionIdxs[partition] = append(partitionIdxs[partition], i)
+		})
+	}
+	pool.stop()
+
+	if len(appliedIdxs) != 100 {
+		t.Fatalf("Expected 100 applied indexes, Actual: %d", len(appliedIdxs))
+	}
+	for i, idx := range appliedIdxs {
+		if idx != uint64(i+1) {
+			t.Fatalf("Applied indexes reported out of order: %v", appliedIdxs)
+		}
+	}
+	for partition, idxs := range partitionIdxs {
+		if !sort.SliceIsSorted(idxs, func(i, j int) bool { return idxs[i] < idxs[j] }) {
+			t.Errorf("Requests of partition %d applied out of order: %v", partition, idxs)
+		}
+	}
+}
+func TestApplyPoolPause(t *testing.T) {
+	var applied uint64
+	pool := newApplyPool(2, func(idx uint64) { atomic.StoreUint64(&applied, idx) })
+	defer pool.stop()
+
+	pool.submit(1, 0, func() { time.Sleep(50 * time.Millisecond) })
+	resume := pool.pause()
+	if idx := atomic.LoadUint64(&applied); idx != 1 {
+		t.Fatalf("Expected pause to drain the pool. Applied index: %d", idx)
+	}
+
+	submitted := make(chan struct{})
+	go func() {
+		pool.submit(2, 1, func() {})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("Expected submissions to be held back while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	resume()
+	<-submitted
+	pool.drain()
+	if idx := atomic.LoadUint64(&applied); idx != 2 {
+		t.Errorf("Expected index 2 to be applied after resuming. Actual: %d", idx)
+	}
+}
+
+func TestLoadBeforeLeaderElection(t *testing.T) {
+	opts, err := raft.NewOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the node is never ticked and hence never elects a leader
+	node := etcd_raft.StartNode(&etcd_raft.Config{
+		ID:              1,
+		ElectionTick:    10,
+		HeartbeatTick:   1,
+		Storage:         etcd_raft.NewMemoryStorage(),
+		MaxSizePerMsg:   1024 * 1024,
+		MaxInflightMsgs: 256,
+	}, []etcd_raft.Peer{{ID: 1}})
+	defer node.Stop()
+	repl := newTestReplicator(t, opts)
+	repl.node.node = node
+
+	for _, rc := range []raft.ReadConsistency{raft.Linearizable, raft.LeaderOnly} {
+		ctx := raft.WithReadConsistency(context.Background(), rc)
+		if _, err := repl.Load(ctx, nil); err != raft.ErrNoLeader {
+			t.Errorf("Expected error: %v for %s read, Actual: %v", raft.ErrNoLeader, rc, err)
+		}
+	}
+}
+
+// leaderChangingNode is a RAFT node whose term moves on while serving
+// a read index, as it does when the leader gets deposed meanwhile.
+type leaderChangingNode struct {
+	etcd_raft.Node
+	repl   *replicator
+	status etcd_raft.Status
+}
+
+func (this *leaderChangingNode) Status() etcd_raft.Status {
+	return this.status
+}
+
+func (this *leaderChangingNode) ReadIndex(_ context.Context, rctx []byte) error {
+	this.status.Term++
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, 10)
+	this.repl.waiter.Trigger(binary.BigEndian.Uint64(rctx), &internalNexusResponse{Res: index})
+	return nil
+}
+
+func TestVerifyLeaderOnRead(t *testing.T) {
+	req := &kvReq{"key", "val"}
+	data, err := req.toBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, verify := range []bool{false, true} {
+		opts, err := raft.NewOptions(raft.VerifyLeaderOnRead(verify))
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := newInMemKVStore()
+		store.content[req.Key] = req.Val
+		repl := newTestReplicator(t, opts)
+		repl.store = store
+		node := &leaderChangingNode{repl: repl}
+		node.status.Lead, node.status.Term = 1, 2
+		repl.node.node = node
+		repl.applyWait.Trigger(10)
+
+		_, err = repl.linearizableLoad(context.Background(), data, nil)
+		if verify && !errors.Is(err, raft.ErrLeaderChanged) {
+			t.Errorf("Expected error: %v on a change of term, Actual: %v", raft.ErrLeaderChanged, err)
+		} else if !verify && err != nil {
+			t.Errorf("Expected no error without verifying the leader, Actual: %v", err)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	const key = "nexus_test_expvar"
+	opts, err := raft.NewOptions(raft.PublishExpvar(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRepl := func(id uint64) *replicator {
+		node := &leaderChangingNode{}
+		node.status.Lead, node.status.Term = id, 2
+		repl := newTestReplicator(t, opts)
+		repl.node.id, repl.node.node = id, node
+		return repl
+	}
+	readNodeId := func() interface{} {
+		metrics := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(expvar.Get(key).String()), &metrics); err != nil {
+			t.Fatal(err)
+		}
+		return metrics["node_id"]
+	}
+
+	repl1, repl2 := newRepl(1), newRepl(2)
+	repl1.publishExpvar()
+	atomic.StoreInt64(&repl1.inflightProposals, 3)
+	if nodeId := readNodeId(); nodeId != float64(1) {
+		t.Errorf("Expected node_id: 1, Actual: %v", nodeId)
+	}
+	if metrics := expvar.Get(key).String(); !strings.Contains(metrics, `"inflight_proposals":3`) {
+		t.Errorf("Expected 3 inflight proposals, Actual: %s", metrics)
+	}
+	repl2.publishExpvar()
+	if repl2.expvarVar != nil {
+		t.Errorf("Expected key: %s to stay with node 1 while it runs", key)
+	}
+
+	// once stopped, the key no longer refers to the replicator
+	repl1.unpublishExpvar()
+	if metrics := expvar.Get(key).String(); metrics != "null" {
+		t.Errorf("Expected null metrics after stopping, Actual: %s", metrics)
+	}
+	if repl1.expvarVar.repl != nil {
+		t.Errorf("Expected the stopped replicator to be released by expvar")
+	}
+	repl2.publishExpvar()
+	if nodeId := readNodeId(); nodeId != float64(2) {
+		t.Errorf("Expected node_id: 2 after reusing the key, Actual: %v", nodeId)
+	}
+	repl2.unpublishExpvar()
+}
+
+func TestCompactLog(t *testing.T) {
+	storage := etcd_raft.NewMemoryStorage()
+	var ents []raftpb.Entry
+	for i := uint64(1); i <= 20; i++ {
+		ents = append(ents, raftpb.Entry{Index: i, Term: 1})
+	}
+	if err := storage.Append(ents); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.CreateSnapshot(15, &raftpb.ConfState{Nodes: []uint64{1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	repl := newTestReplicator(t, nil)
+	repl.node.raftStorage = storage
+
+	if err := repl.CompactLog(0); err == nil {
+		t.Error("Expected error while compacting at index 0")
+	}
+	if err := repl.CompactLog(16); err == nil {
+		t.Error("Expected error while compacting beyond the snapshot index")
+	}
+	if err := repl.CompactLog(12); err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := storage.FirstIndex(); first != 13 {
+		t.Errorf("Expected first index: 13, Actual: %d", first)
+	}
+	if err := repl.CompactLog(12); err == nil {
+		t.Error("Expected error while compacting at an already compacted index")
+	}
+
+	// snapshots taken later must not fail on the log compacted beyond them
+	dir, err := ioutil.TempDir("", "nexus_compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := repl.node
+	if node.wal, err = wal.Create(dir+"/wal", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer node.wal.Close()
+	node.snapshotter, node.statsCli = snap.New(dir), stats.NewNoOpClient()
+	node.getSnapshot = func(db.SnapshotState) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("db")), nil
+	}
+	node.appliedIndex, node.snapshotCatchUpEntries = 20, 10
+	if err := node.takeSnapshot(); err != nil {
+		t.Fatalf("Expected snapshot to succeed, Actual error: %v", err)
+	}
+	if node.snapshotIndex != 20 || node.lastSnapAt.IsZero() {
+		t.Errorf("Expected snapshot index: 20 to be recorded, Actual: %d", node.snapshotIndex)
+	}
+}
+
+// countingStats counts the increments of every metric.
+type countingStats struct {
+	stats.Client
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (this *countingStats) Incr(name string, value int64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.counts[name] += value
+}
+
+func (this *countingStats) count(name string) int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.counts[name]
+}
+
+func TestMinSnapshotInterval(t *testing.T) {
+	storage := etcd_raft.NewMemoryStorage()
+	var ents []raftpb.Entry
+	for i := uint64(1); i <= 20; i++ {
+		ents = append(ents, raftpb.Entry{Index: i, Term: 1})
+	}
+	if err := storage.Append(ents); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "nexus_snap_interval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statsCli := &countingStats{Client: stats.NewNoOpClient(), counts: make(map[string]int64)}
+	node := &raftNode{id: 1, logger: raft.StdLogger{}, raftStorage: storage, statsCli: statsCli, snapshotter: snap.New(dir),
+		confState: raftpb.ConfState{Nodes: []uint64{1}}, snapCount: 5, minSnapInterval: time.Hour, lastSnapAt: time.Now()}
+	if node.wal, err = wal.Create(dir+"/wal", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer node.wal.Close()
+	node.getSnapshot = func(db.SnapshotState) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("db")), nil
+	}
+
+	for node.appliedIndex = 10; node.appliedIndex < 13; node.appliedIndex++ {
+		node.maybeTriggerSnapshot()
+	}
+	if node.snapshotIndex != 0 {
+		t.Errorf("Expected no snapshot within the interval, Actual snapshot index: %d", node.snapshotIndex)
+	}
+	if skipped := statsCli.count("raft.snapshot.skipped.interval"); skipped != 1 {
+		t.Errorf("Expected the skipped snapshot to be counted once, Actual: %d", skipped)
+	}
+
+	node.lastSnapAt = time.Now().Add(-time.Hour)
+	node.maybeTriggerSnapshot()
+	if node.snapshotIndex != 13 {
+		t.Errorf("Expected snapshot at index: 13 once the interval elapsed, Actual: %d", node.snapshotIndex)
+	}
+	for node.appliedIndex = 19; node.appliedIndex <= 20; node.appliedIndex++ {
+		node.maybeTriggerSnapshot()
+	}
+	if skipped := statsCli.count("raft.snapshot.skipped.interval"); skipped != 2 {
+		t.Errorf("Expected the next skipped snapshot to be counted, Actual: %d", skipped)
+	}
+}
+
+// fatalLogger panics on Fatalf instead of exiting, for tests to check
+// that a node halts.
+type fatalLogger struct {
+	raft.StdLogger
+}
+
+func (fatalLogger) Fatalf(format string, v ...interface{}) {
+	panic(fmt.Sprintf(format, v...))
+}
+
+func TestCheckStoreConsistency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nexus_store_consistency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapStore := newInMemKVStore()
+	data, _ := (&kvReq{Key: "a", Val: "a"}).toBytes()
+	snapStore.Save(db.RaftEntry{Index: 2, Term: 2}, data)
+	backup, _ := snapStore.Backup(db.SnapshotState{})
+	if err := snap.New(dir).SaveDBSnapshot(2, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// RAFT has entries up to index 5 at term 2, following a snapshot at
+	// index 2 if requested, whereas the store applied the given entry
+	newRepl := func(policy raft.TermMismatchPolicy, withSnap bool, storeEntry db.RaftEntry) *replicator {
+		storage := etcd_raft.NewMemoryStorage()
+		first := uint64(1)
+		if withSnap {
+			storage.ApplySnapshot(raftpb.Snapshot{Metadata: raftpb.SnapshotMetadata{Index: 2, Term: 2}})
+			first = 3
+		}
+		var ents []raftpb.Entry
+		for i := first; i <= 5; i++ {
+			ents = append(ents, raftpb.Entry{Index: i, Term: 2})
+		}
+		storage.Append(ents)
+		storage.SetHardState(raftpb.HardState{Term: 2, Commit: 5})
+
+		store := newInMemKVStore()
+		data, _ := (&kvReq{Key: "diverged", Val: "diverged"}).toBytes()
+		store.Save(storeEntry, data)
+		repl := newTestReplicator(t, nil)
+		repl.store = store
+		repl.node = &raftNode{id: 1, logger: fatalLogger{}, raftStorage: storage, statsCli: repl.statsCli, snapshotter: snap.New(dir),
+			termMismatchPolicy: policy, storeEntry: storeEntry, appliedIndex: storeEntry.Index, restoreStore: repl.restoreDiverged}
+		repl.markApplied(storeEntry.Index)
+		return repl
+	}
+	halts := func(repl *replicator) (halted bool) {
+		defer func() { halted = recover() != nil }()
+		repl.node.checkStoreConsistency()
+		return
+	}
+	wrongTerm, ahead := db.RaftEntry{Index: 4, Term: 1}, db.RaftEntry{Index: 7, Term: 2}
+
+	if repl := newRepl(raft.HaltOnMismatch, true, wrongTerm); !halts(repl) {
+		t.Error("Expected node to halt on a store with the wrong term")
+	}
+	if repl := newRepl(raft.TrustRaft, false, wrongTerm); !halts(repl) {
+		t.Error("Expected node to halt without a snapshot to restore the store from")
+	}
+	if repl := newRepl(raft.TrustRaft, true, db.RaftEntry{Index: 4, Term: 2}); halts(repl) || repl.node.appliedIndex != 4 {
+		t.Errorf("Expected consistent store to be left as is, Actual applied index: %d", repl.node.appliedIndex)
+	}
+
+	for _, storeEntry := range []db.RaftEntry{wrongTerm, ahead} {
+		repl := newRepl(raft.TrustRaft, true, storeEntry)
+		if halts(repl) {
+			t.Fatalf("Expected store applied upto %v to be restored from the snapshot", storeEntry)
+		}
+		store := repl.store.(*inMemKVStore)
+		if _, present := store.content["diverged"]; present {
+			t.Error("Expected the entry applied by the diverging store to be undone")
+		}
+		if _, present := store.content["a"]; !present {
+			t.Error("Expected the store to have the entries of the snapshot")
+		}
+		if repl.node.appliedIndex != 2 || repl.AppliedIndex() != 2 {
+			t.Errorf("Expected entries after the snapshot to be re-applied, Actual applied index: %d, of replicator: %d", repl.node.appliedIndex, repl.AppliedIndex())
+		}
+	}
+}
+
+func TestMaxInMemLogEntries(t *testing.T) {
+	storage := etcd_raft.NewMemoryStorage()
+	var ents []raftpb.Entry
+	for i := uint64(1); i <= 20; i++ {
+		ents = append(ents, raftpb.Entry{Index: i, Term: 1})
+	}
+	if err := storage.Append(ents); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "nexus_inmem_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := &raftNode{id: 1, logger: raft.StdLogger{}, raftStorage: storage, statsCli: stats.NewNoOpClient(), snapshotter: snap.New(dir),
+		confState: raftpb.ConfState{Nodes: []uint64{1}}, snapCount: 100, snapshotCatchUpEntries: 2, maxInMemLogEntries: 10,
+		minSnapInterval: time.Hour, lastSnapAt: time.Now()}
+	if node.wal, err = wal.Create(dir+"/wal", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer node.wal.Close()
+	node.getSnapshot = func(db.SnapshotState) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("db")), nil
+	}
+
+	// entries yet to be applied cannot be compacted by a snapshot
+	for node.appliedIndex = 1; node.appliedIndex <= 10; node.appliedIndex++ {
+		node.maybeTriggerSnapshot()
+	}
+	if node.snapshotIndex != 0 {
+		t.Errorf("Expected no snapshot for entries not applied, Actual snapshot index: %d", node.snapshotIndex)
+	}
+
+	node.appliedIndex = 11
+	node.maybeTriggerSnapshot()
+	if node.snapshotIndex != 11 {
+		t.Errorf("Expected snapshot at index: 11 despite the interval, Actual: %d", node.snapshotIndex)
+	}
+	if first, _ := storage.FirstIndex(); first != 10 {
+		t.Errorf("Expected log to be compacted upto index: 9, Actual first index: %d", first)
+	}
+	for node.appliedIndex = 12; node.appliedIndex <= 19; node.appliedIndex++ {
+		node.maybeTriggerSnapshot()
+	}
+	if node.snapshotIndex != 11 {
+		t.Errorf("Expected no snapshot till the applied entries exceed the cap again, Actual snapshot index: %d", node.snapshotIndex)
+	}
+}
+
+func TestWaitForApply(t *testing.T) {
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"), raft.ApplyWaitTimeout(50*time.Millisecond))
+	statsCli := &countingStats{Client: stats.NewNoOpClient(), counts: make(map[string]int64)}
+	repl := newTestReplicator(t, opts)
+	repl.statsCli = statsCli
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the store never applies the entry read from
+	start := time.Now()
+	if err := repl.waitForApply(ctx, 10); err != raft.ErrApplyLagging {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrApplyLagging, err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected to fail well before the read timeout, Actual wait: %s", elapsed)
+	}
+	if lagging := statsCli.count("load.apply.lagging.error"); lagging != 1 {
+		t.Errorf("Expected the lagging store to be counted once, Actual: %d", lagging)
+	}
+
+	repl.markApplied(10)
+	if err := repl.waitForApply(ctx, 10); err != nil {
+		t.Errorf("Expected no error once the entry is applied, Actual: %v", err)
+	}
+}
+
+func TestCheckMessageSize(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	if err := repl.checkMessageSize(1024); err != nil {
+		t.Error(err)
+	}
+	if err := repl.checkMessageSize(raftMsgWarnSize); err != nil {
+		t.Error(err)
+	}
+	if err := repl.checkMessageSize(maxRaftMsgSize); !errors.Is(err, raft.ErrProposalTooLarge) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrProposalTooLarge, err)
+	}
+}
+
+func TestReserveUncommitted(t *testing.T) {
+	opts, err := raft.NewOptions(raft.MaxUncommittedSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl := newTestReplicator(t, opts)
+	if err := repl.reserveUncommitted(150); err != nil {
+		t.Errorf("Expected a single proposal to be admitted, got: %v", err)
+	}
+	if err := repl.reserveUncommitted(10); !errors.Is(err, raft.ErrProposalDropped) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrProposalDropped, err)
+	}
+	repl.releaseUncommitted(150)
+	if err := repl.reserveUncommitted(60); err != nil {
+		t.Error(err)
+	}
+	if err := repl.reserveUncommitted(40); err != nil {
+		t.Error(err)
+	}
+	if err := repl.reserveUncommitted(1); !errors.Is(err, raft.ErrProposalDropped) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrProposalDropped, err)
+	}
+}
+
+func TestAppliedKeys(t *testing.T) {
+	keys := newAppliedKeys()
+	keys.put("key-0", internalNexusResponse{Index: 1})
+	keys.put("key-0", internalNexusResponse{Index: 2})
+	if res, present := keys.get("key-0"); !present || res.Index != 1 {
+		t.Errorf("Expected key to be recorded at index: 1, got: %v, present: %t", res.Index, present)
+	}
+	for i := 1; i < maxAppliedKeys; i++ {
+		keys.put(fmt.Sprintf("key-%d", i), internalNexusResponse{Index: uint64(i + 1)})
+	}
+	// a retry finding key-0 keeps it from being evicted next
+	keys.get("key-0")
+	keys.put(fmt.Sprintf("key-%d", maxAppliedKeys), internalNexusResponse{Index: maxAppliedKeys + 1})
+	if _, present := keys.get("key-1"); present {
+		t.Error("Expected least recently used key to be evicted")
+	}
+	if _, present := keys.get("key-0"); !present {
+		t.Error("Expected recently used key to be present")
+	}
+	if _, present := keys.get(fmt.Sprintf("key-%d", maxAppliedKeys)); !present {
+		t.Error("Expected latest key to be present")
+	}
+
+	// keys are retained in snapshots in the order of eviction
+	node := &raftNode{id: 1, logger: raft.StdLogger{}, shadows: make(map[uint64]bool), appliedKeys: keys}
+	data := node.encodeSnapshotData()
+	node.appliedKeys = newAppliedKeys()
+	node.restoreSnapshotData(raftpb.Snapshot{Data: data})
+	if res, present := node.appliedKeys.get("key-3"); !present || res.Index != 4 {
+		t.Errorf("Expected key to be restored at index: 4, got: %v, present: %t", res.Index, present)
+	}
+	node.appliedKeys.put("key-new", internalNexusResponse{Index: maxAppliedKeys + 2})
+	if _, present := node.appliedKeys.get("key-2"); present {
+		t.Error("Expected least recently used restored key to be evicted")
+	}
+	if _, present := node.appliedKeys.get("key-0"); !present {
+		t.Error("Expected recently used restored key to be present")
+	}
+
+	replReq, _ := proto.Marshal(&models.NexusInternalRequest{ID: 1, IdempotencyKey: "key-log"})
+	if err := node.appliedKeys.putEntries([]raftpb.Entry{{Index: 7, Type: raftpb.EntryNormal, Data: replReq}}); err != nil {
+		t.Fatal(err)
+	}
+	if res, present := node.appliedKeys.get("key-log"); !present || res.Index != 7 {
+		t.Errorf("Expected key to be rebuilt from the log at index: 7, got: %v, present: %t", res.Index, present)
+	}
+}
+
+func TestSaveDuringConfChange(t *testing.T) {
+	opts, err := raft.NewOptions(raft.RejectSavesDuringConfChange(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl := newTestReplicator(t, opts)
+	if err := repl.checkConfChange(); err != nil {
+		t.Error(err)
+	}
+	repl.pendingConfChanges = 1
+	if err := repl.checkConfChange(); !errors.Is(err, raft.ErrConfChangeInProgress) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrConfChangeInProgress, err)
+	}
+	repl.endConfChange()
+	if err := repl.checkConfChange(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemberAddsThrottling(t *testing.T) {
+	adds := newMemberAdds(1)
+	if err := adds.acquire(context.Background(), "http://node1:9020"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	acquired := make(chan error)
+	go func() { acquired <- adds.acquire(ctx, "http://node2:9020") }()
+	time.Sleep(20 * time.Millisecond)
+	if state := adds.pending()["http://node2:9020"]; state != raft.MemberAddQueued {
+		t.Errorf("Expected second addition to be queued, got: %s", state)
+	}
+	adds.release("http://node1:9020")
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	pending := adds.pending()
+	if _, present := pending["http://node1:9020"]; present || pending["http://node2:9020"] != raft.MemberAddInProgress {
+		t.Errorf("Unexpected pending additions: %v", pending)
+	}
+}
+
+func TestTimedWait(t *testing.T) {
+	waiter := newTimedWait()
+	if age := waiter.oldestAge(); age != 0 {
+		t.Errorf("Expected no age without waiters, got: %s", age)
+	}
+	ch := waiter.Register(1)
+	time.Sleep(20 * time.Millisecond)
+	waiter.Register(2)
+	if age := waiter.oldestAge(); age < 20*time.Millisecond {
+		t.Errorf("Expected age of the first waiter, got: %s", age)
+	}
+	waiter.Trigger(1, &internalNexusResponse{})
+	<-ch
+	if age := waiter.oldestAge(); age >= 20*time.Millisecond {
+		t.Errorf("Expected age of the second waiter, got: %s", age)
+	}
+	waiter.Trigger(2, &internalNexusResponse{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	waiter.registerOp(3, raft.OpSave, ctx)
+	time.Sleep(time.Millisecond)
+	waiter.track(4, raft.OpApplyWait, nil)
+	ops := waiter.inflight()
+	if len(ops) != 2 || ops[0].Id != 3 || ops[0].Type != raft.OpSave || ops[0].Deadline.IsZero() {
+		t.Errorf("Unexpected inflight ops: %v", ops)
+	}
+	if pending := waiter.pending(); pending != 2 {
+		t.Errorf("Expected 2 pending ops, got: %d", pending)
+	}
+	waiter.untrack(4)
+	waiter.Trigger(3, &internalNexusResponse{})
+	if ops := waiter.inflight(); len(ops) != 0 {
+		t.Errorf("Expected no inflight ops, got: %v", ops)
+	}
+}
+
+func TestMustSyncWAL(t *testing.T) {
+	prev := raftpb.HardState{Term: 2, Vote: 1, Commit: 10}
+	if mustSyncWAL(raftpb.HardState{}, prev, 0) || mustSyncWAL(raftpb.HardState{Term: 2, Vote: 1, Commit: 11}, prev, 0) {
+		t.Error("Expected no fsync without entries or a change in term or vote")
+	}
+	if !mustSyncWAL(raftpb.HardState{}, prev, 1) || !mustSyncWAL(raftpb.HardState{Term: 3, Vote: 1, Commit: 10}, prev, 0) {
+		t.Error("Expected fsync on appending entries or a change in term")
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	repl.shuttingDown = 1
+	if _, err := repl.replicate(context.Background(), &models.NexusInternalRequest{ID: 1, Req: []byte("late")}); !errors.Is(err, raft.ErrShuttingDown) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrShuttingDown, err)
+	}
+	waiter := repl.waiter.(*timedWait)
+	chs := []<-chan interface{}{waiter.Register(1), waiter.Register(2)}
+	waiter.triggerAll(&internalNexusResponse{Err: raft.ErrShuttingDown})
+	for _, ch := range chs {
+		if res := (<-ch).(*internalNexusResponse); !errors.Is(res.Err, raft.ErrShuttingDown) {
+			t.Errorf("Expected pending request to fail with: %v, Actual: %v", raft.ErrShuttingDown, res.Err)
+		}
+	}
+	if ops := waiter.inflight(); len(ops) != 0 {
+		t.Errorf("Expected no inflight ops, got: %v", ops)
+	}
+	if pending := atomic.LoadInt64(&repl.inflightProposals); pending != 0 {
+		t.Errorf("Expected refused Saves not to be counted, got: %d", pending)
+	}
+
+	// a Save waiting in the propose queue keeps the node from draining
+	opts, err := raft.NewOptions(raft.ReplicationTimeout(200 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := newProposeQueue(1)
+	if err := queue.acquire(context.Background(), raft.NormalPriority); err != nil {
+		t.Fatal(err)
+	}
+	repl = newTestReplicator(t, opts)
+	repl.proposeQueue = queue
+	errc := make(chan error, 1)
+	go func() {
+		_, err := repl.replicate(context.Background(), &models.NexusInternalRequest{ID: 2, Req: []byte("queued")})
+		errc <- err
+	}()
+	<-time.After(50 * time.Millisecond)
+	if pending := atomic.LoadInt64(&repl.inflightProposals); pending != 1 {
+		t.Errorf("Expected the queued Save to be counted, got: %d", pending)
+	}
+	if err := <-errc; err == nil {
+		t.Error("Expected the queued Save to time out")
+	}
+	if pending := atomic.LoadInt64(&repl.inflightProposals); pending != 0 {
+		t.Errorf("Expected no Saves to be counted once done, got: %d", pending)
+	}
+}
+
+func TestProposeQueuePriority(t *testing.T) {
+	queue := newProposeQueue(1)
+	if err := queue.acquire(context.Background(), raft.NormalPriority); err != nil {
+		t.Fatal(err)
+	}
+	admitted := make(chan raft.Priority, 3)
+	for _, priority := range []raft.Priority{raft.BulkPriority, raft.NormalPriority, raft.HighPriority} {
+		go func(priority raft.Priority) {
+			if err := queue.acquire(context.Background(), priority); err == nil {
+				admitted <- priority
+			}
+		}(priority)
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, expected := range []raft.Priority{raft.HighPriority, raft.NormalPriority, raft.BulkPriority} {
+		queue.release()
+		if priority := <-admitted; priority != expected {
+			t.Errorf("Expected priority: %s to be admitted, Actual: %s", expected, priority)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := queue.acquire(ctx, raft.HighPriority); err != context.DeadlineExceeded {
+		t.Errorf("Expected error: %v, Actual: %v", context.DeadlineExceeded, err)
+	}
+	queue.release()
+	if err := queue.acquire(context.Background(), raft.BulkPriority); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProposeQueueTryAcquire(t *testing.T) {
+	queue := newProposeQueue(1)
+	if !queue.tryAcquire() {
+		t.Fatal("Expected the first proposal to be admitted")
+	}
+	if queue.tryAcquire() {
+		t.Error("Expected a proposal beyond the limit to be rejected")
+	}
+	queue.release()
+	if !queue.tryAcquire() {
+		t.Error("Expected a proposal to be admitted once a slot is released")
+	}
+}
+
+func TestShareListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	groupHandler := func(group int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("group", strconv.Itoa(group))
+		})
+	}
+	var releases []func()
+	for group := 1; group <= 2; group++ {
+		release, err := shareListener(addr, types.ID(group), groupHandler(group), raft.StdLogger{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := shareListener(addr, types.ID(1), groupHandler(1), raft.StdLogger{}); err == nil {
+		t.Error("Expected an error serving the same group twice")
+	}
+	for group := 1; group <= 3; group++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/raft", nil)
+		req.Header.Set(clusterIdHeader, types.ID(group).String())
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if group <= 2 && res.Header.Get("group") != strconv.Itoa(group) {
+			t.Errorf("Expected request to be served by group: %d, Actual: %s", group, res.Header.Get("group"))
+		} else if group > 2 && res.StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("Expected status: %d for unknown group, Actual: %d", http.StatusPreconditionFailed, res.StatusCode)
+		}
+	}
+	for _, release := range releases {
+		release()
+	}
+	if _, present := groupListeners[addr]; present {
+		t.Error("Expected the listener to be closed once all the groups are released")
+	}
+}
+
+func TestGroupsShareListener(t *testing.T) {
+	if err := createRaftDirs(); err != nil {
+		t.Fatal(err)
+	}
+	groupsUrl := "http://127.0.0.1:9331,http://127.0.0.1:9332,http://127.0.0.1:9333"
+	// the groups share the registerer, as they do in a process
+	reg := prometheus.NewRegistry()
+	groups := make(map[uint64]*cluster)
+	for _, group := range []uint64{1, 2} {
+		clus := &cluster{}
+		for _, peerAddr := range strings.Split(groupsUrl, ",") {
+			opts, err := raft.NewOptions(
+				raft.NodeUrl(peerAddr),
+				raft.LogDir(logDir),
+				raft.SnapDir(snapDir),
+				raft.ClusterUrl(groupsUrl),
+				raft.GroupId(group),
+				raft.ReplicationTimeout(replTimeout),
+				raft.LeaseBasedReads(false),
+				raft.PrometheusMetrics(reg),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := newInMemKVStore()
+			repl := NewReplicator(db, opts)
+			clus.peers = append(clus.peers, &peer{repl.node.id, db, repl})
+		}
+		groups[group] = clus
+	}
+	for _, clus := range groups {
+		for _, peer := range clus.peers {
+			peer.start()
+		}
+	}
+	defer func() {
+		for _, clus := range groups {
+			clus.stop()
+		}
+	}()
+	sleep(3)
+
+	reqs := map[uint64]*kvReq{1: {"group1_key", "group1_val"}, 2: {"group2_key", "group2_val"}}
+	for group, clus := range groups {
+		clus.leader(t).save(t, reqs[group])
+	}
+	sleep(1)
+	for group, clus := range groups {
+		clus.assertDB(t, reqs[group])
+		for other, req := range reqs {
+			if other == group {
+				continue
+			}
+			for _, peer := range clus.peers {
+				if _, present := peer.db.content[req.Key]; present {
+					t.Errorf("Expected key: %s of group %d not to be replicated to group %d", req.Key, other, group)
+				}
+			}
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricGroups := make(map[string]bool)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == GroupIdDefaultTag {
+					metricGroups[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	if !metricGroups["1"] || !metricGroups["2"] {
+		t.Errorf("Expected metrics of both the groups, Actual: %v", metricGroups)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	var audited []uint64
+	stopc := make(chan struct{})
+	aud := newAuditor(func(record raft.AuditRecord) { audited = append(audited, record.Index) }, 2, stopc, stats.NewNoOpClient())
+	for i := uint64(1); i <= 2; i++ {
+		aud.audit(raft.AuditRecord{Index: i})
+	}
+	done := make(chan struct{})
+	go func() {
+		aud.run()
+		close(done)
+	}()
+	aud.audit(raft.AuditRecord{Index: 3})
+	close(stopc)
+	<-done
+	if len(audited) != 3 || audited[0] != 1 || audited[2] != 3 {
+		t.Errorf("Expected all records to be audited in order, got: %v", audited)
+	}
+}
+
+func TestRetryRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nexus_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapshotter := snap.New(dir)
+	if err := snapshotter.SaveDBSnapshot(1, strings.NewReader("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	repl := newTestReplicator(t, opts)
+	repl.node.snapshotter = snapshotter
+
+	done := make(chan bool)
+	go func() { done <- repl.retryRestore(raftpb.SnapshotMetadata{Index: 1}, errors.New("restore failed")) }()
+	<-time.After(100 * time.Millisecond)
+	if _, err := repl.Load(context.Background(), nil); err != raft.ErrRestoreFailed {
+		t.Errorf("Expected error: %v while restoring, Actual: %v", raft.ErrRestoreFailed, err)
+	}
+	backup, _ := newInMemKVStore().Backup(db.SnapshotState{})
+	if err := snapshotter.SaveDBSnapshot(1, backup); err != nil {
+		t.Fatal(err)
+	}
+	if restored := <-done; !restored {
+		t.Fatal("Expected store to be restored on retrying")
+	}
+	if failed := atomic.LoadInt32(&repl.restoreFailed); failed != 0 {
+		t.Error("Expected node to not be fenced after restoring")
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	store := newInMemKVStore()
+	repl := newTestReplicator(t, opts)
+	repl.store = store
+
+	var batch [][]byte
+	for _, key := range []string{"a", "b", "a", "c"} {
+		data, _ := (&kvReq{Key: key, Val: key}).toBytes()
+		batch = append(batch, data)
+	}
+	replReq := &models.NexusInternalRequest{ID: 1, Batch: batch}
+	ch := repl.waiter.Register(replReq.ID)
+	repl.applyRequest(db.RaftEntry{Term: 1, Index: 5}, replReq)
+	replRes := (<-ch).(*internalNexusResponse)
+
+	batchErr, ok := replRes.Err.(*raft.BatchError)
+	if !ok {
+		t.Fatalf("Expected batch error, Actual: %v", replRes.Err)
+	}
+	for i, err := range batchErr.Errs {
+		if (err != nil) != (i == 2) {
+			t.Errorf("Unexpected error for batch entry %d: %v", i, err)
+		}
+	}
+	if len(replRes.BatchRes) != len(batch) {
+		t.Errorf("Expected %d responses, Actual: %d", len(batch), len(replRes.BatchRes))
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, present := store.content[key]; !present {
+			t.Errorf("Expected key: %s to be saved", key)
+		}
+	}
+}
+
+func TestApplyDuplicate(t *testing.T) {
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	store := newInMemKVStore()
+	repl := newTestReplicator(t, opts)
+	repl.store = store
+	apply := func(id, index uint64, val string) *internalNexusResponse {
+		data, _ := (&kvReq{Key: "k", Val: val}).toBytes()
+		replReq := &models.NexusInternalRequest{ID: id, Req: data, IdempotencyKey: "key-1"}
+		ch := repl.waiter.Register(id)
+		repl.applyRequest(db.RaftEntry{Term: 1, Index: index}, replReq)
+		return (<-ch).(*internalNexusResponse)
+	}
+	first := apply(1, 5, "v1")
+	if first.Err != nil {
+		t.Fatal(first.Err)
+	}
+	retry := apply(2, 6, "v2")
+	if retry.Err != nil || retry.Index != first.Index {
+		t.Errorf("Expected retry to get the outcome at index: %d, Actual index: %d, error: %v", first.Index, retry.Index, retry.Err)
+	}
+	if val := store.content["k"]; val != "v1" {
+		t.Errorf("Expected retry to not be applied again, Actual value: %v", val)
+	}
+}
+
+// triggerCounter counts the IDs triggered on it.
+type triggerCounter struct {
+	wait.Wait
+	triggers int
+}
+
+func (this *triggerCounter) Trigger(id uint64, x interface{}) {
+	this.triggers++
+	this.Wait.Trigger(id, x)
+}
+
+func TestCommitWaiter(t *testing.T) {
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	commitWaiter := &triggerCounter{Wait: wait.New()}
+	repl := newTestReplicator(t, opts)
+	repl.commitWaiter = commitWaiter
+	entry := func(id, index uint64) *raftpb.Entry {
+		data, _ := (&kvReq{Key: "k", Val: "v"}).toBytes()
+		entryData, _ := proto.Marshal(&models.NexusInternalRequest{ID: id, Req: data})
+		return &raftpb.Entry{Term: 1, Index: index, Type: raftpb.EntryNormal, Data: entryData}
+	}
+	repl.applyEntry(entry(1, 1))
+	if commitWaiter.triggers != 0 {
+		t.Errorf("Expected no triggers without commit-level Saves pending, Actual: %d", commitWaiter.triggers)
+	}
+
+	atomic.AddInt64(&repl.commitWaits, 1)
+	ch := commitWaiter.Register(2)
+	repl.applyEntry(entry(2, 2))
+	if res := (<-ch).(*internalNexusResponse); res.Index != 2 {
+		t.Errorf("Expected the commit-level Save to be acknowledged at index: 2, Actual: %d", res.Index)
+	}
+}
+
+func TestCommitsClosed(t *testing.T) {
+	var reported []error
+	opts, _ := raft.NewOptions(
+		raft.NodeUrl("http://127.0.0.1:9321"),
+		raft.OnCommitClosed(func(err error) { reported = append(reported, err) }),
+	)
+	newRepl := func() *replicator {
+		repl := newTestReplicator(t, opts)
+		repl.node.errorC = make(chan error, 1)
+		return repl
+	}
+
+	repl := newRepl()
+	repl.stopped = 1
+	close(repl.node.errorC)
+	repl.commitsClosed()
+	repl = newRepl()
+	repl.stopped = 1
+	repl.node.errorC <- errors.New("transport stopped")
+	close(repl.node.errorC)
+	repl.commitsClosed()
+	if len(reported) != 0 {
+		t.Errorf("Expected no error to be reported on stopping, Actual: %v", reported)
+	}
+
+	repl = newRepl()
+	transportErr := errors.New("transport failed")
+	repl.node.errorC <- transportErr
+	close(repl.node.errorC)
+	repl.commitsClosed()
+	if len(reported) != 1 || reported[0] != transportErr {
+		t.Errorf("Expected error: %v to be reported, Actual: %v", transportErr, reported)
+	}
+
+	repl = newRepl()
+	close(repl.node.errorC)
+	repl.commitsClosed()
+	if len(reported) != 2 || reported[1] != raft.ErrCommitClosed {
+		t.Errorf("Expected error: %v to be reported, Actual: %v", raft.ErrCommitClosed, reported)
+	}
+
+	repl = newRepl()
+	repl.node.removed = 1
+	repl.waiter = newTimedWait()
+	pending := repl.waiter.Register(1)
+	close(repl.node.errorC)
+	repl.commitsClosed()
+	if len(reported) != 3 || reported[2] != raft.ErrNodeRemoved {
+		t.Errorf("Expected error: %v to be reported, Actual: %v", raft.ErrNodeRemoved, reported)
+	}
+	if res := (<-pending).(*internalNexusResponse); res.Err != raft.ErrNodeRemoved {
+		t.Errorf("Expected pending request to fail with: %v, Actual: %v", raft.ErrNodeRemoved, res.Err)
+	}
+	if _, err := repl.Save(context.Background(), nil); err != raft.ErrNodeRemoved {
+		t.Errorf("Expected error: %v on Save, Actual: %v", raft.ErrNodeRemoved, err)
+	}
+	if _, err := repl.Load(context.Background(), nil); err != raft.ErrNodeRemoved {
+		t.Errorf("Expected error: %v on Load, Actual: %v", raft.ErrNodeRemoved, err)
+	}
+}
+
+func TestLoadShedder(t *testing.T) {
+	shedder := newLoadShedder(3, time.Second)
+	now := time.Now()
+	shedder.timedOut(now)
+	shedder.timedOut(now.Add(2 * time.Second))
+	if started := shedder.timedOut(now.Add(2500 * time.Millisecond)); started {
+		t.Error("Expected timeouts of an earlier window to not be counted")
+	}
+	if started := shedder.timedOut(now.Add(2800 * time.Millisecond)); !started {
+		t.Error("Expected shedding to start on too many timeouts")
+	}
+	if retryAfter := shedder.retryAfter(now.Add(3 * time.Second)); retryAfter != 800*time.Millisecond {
+		t.Errorf("Expected retry after: %s, Actual: %s", 800*time.Millisecond, retryAfter)
+	}
+	if retryAfter := shedder.retryAfter(now.Add(4 * time.Second)); retryAfter != 0 {
+		t.Errorf("Expected Saves to be admitted after the window, Actual retry after: %s", retryAfter)
+	}
+}
+
+func TestTransferLeadershipToNonVoter(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	repl.node.confState = raftpb.ConfState{Nodes: []uint64{1, 2}, Learners: []uint64{3}}
+	for _, nodeId := range []uint64{3, 4} {
+		if err := repl.TransferLeadership(context.Background(), nodeId); !errors.Is(err, raft.ErrUnknownMember) {
+			t.Errorf("Expected error: %v for node %d, Actual: %v", raft.ErrUnknownMember, nodeId, err)
+		}
+	}
+}
+
+func TestPromoteNonLearner(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	repl.node.confState = raftpb.ConfState{Nodes: []uint64{1, 2}, Learners: []uint64{3}}
+	for _, nodeId := range []uint64{2, 4} {
+		if err := repl.PromoteLearner(context.Background(), nodeId); !errors.Is(err, raft.ErrUnknownMember) {
+			t.Errorf("Expected error: %v for node %d, Actual: %v", raft.ErrUnknownMember, nodeId, err)
+		}
+	}
+}
+
+func TestShadowMember(t *testing.T) {
+	for _, shadow := range []bool{true, false} {
+		if peerUrl, isShadow := parseMemberContext(memberContext("http://127.0.0.1:9321", shadow)); peerUrl != "http://127.0.0.1:9321" || isShadow != shadow {
+			t.Errorf("Member context mismatch. Url: %s, Shadow: %t, Expected shadow: %t", peerUrl, isShadow, shadow)
+		}
+	}
+
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	repl := newTestReplicator(t, opts)
+	repl.node.shadows = make(map[uint64]bool)
+	repl.node.setShadow(1, true)
+	if _, err := repl.Load(context.Background(), nil); err != raft.ErrShadowMember {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrShadowMember, err)
+	}
+	if _, err := repl.Save(context.Background(), nil); err != raft.ErrShadowMember {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrShadowMember, err)
+	}
+	repl.node.setShadow(1, false)
+	if repl.node.isShadow() || len(repl.node.shadows) != 0 {
+		t.Error("Expected node to not be a shadow after promotion")
+	}
+
+	// shadow members are retained across snapshots
+	repl.node.setShadow(2, true)
+	repl.node.setShadow(3, true)
+	data := repl.node.encodeSnapshotData()
+	repl.node.restoreSnapshotData(raftpb.Snapshot{})
+	if repl.node.isShadowMember(2) || repl.node.isShadowMember(3) {
+		t.Error("Expected no shadow members after restoring a snapshot without them")
+	}
+	repl.node.restoreSnapshotData(raftpb.Snapshot{Data: data})
+	if !repl.node.isShadowMember(2) || !repl.node.isShadowMember(3) || repl.node.isShadow() {
+		t.Errorf("Expected nodes 2 and 3 to be restored as shadow members. Actual: %v", repl.node.shadows)
+	}
+
+	if err := repl.AddShadow(context.Background(), "http://127.0.0.1:9324"); err == nil {
+		t.Error("Expected shadow members to be disabled by default")
+	}
+}
+
+func TestServiceAddrs(t *testing.T) {
+	node := &raftNode{id: 1, logger: raft.StdLogger{}}
+	node.setServiceAddr(2, "node2:9121")
+	node.setServiceAddr(3, "node3:9121")
+	node.setServiceAddr(3, "")
+	if addr := node.serviceAddr(2); addr != "node2:9121" {
+		t.Errorf("Expected service address: node2:9121, Actual: %s", addr)
+	}
+	if addr := node.serviceAddr(3); addr != "" {
+		t.Errorf("Expected service address to be forgotten, Actual: %s", addr)
+	}
+
+	// service addresses are retained across snapshots
+	data := node.encodeSnapshotData()
+	node.restoreSnapshotData(raftpb.Snapshot{})
+	if addr := node.serviceAddr(2); addr != "" {
+		t.Errorf("Expected no service address after restoring a snapshot without it, Actual: %s", addr)
+	}
+	node.restoreSnapshotData(raftpb.Snapshot{Data: data})
+	if addr := node.serviceAddr(2); addr != "node2:9121" {
+		t.Errorf("Expected service address: node2:9121 to be restored, Actual: %s", addr)
+	}
+
+	// and rebuilt from the entries applied before restarting
+	confChange := func(index uint64, cc raftpb.ConfChange) raftpb.Entry {
+		data, _ := cc.Marshal()
+		return raftpb.Entry{Index: index, Term: 1, Type: raftpb.EntryConfChange, Data: data}
+	}
+	node.raftStorage = etcd_raft.NewMemoryStorage()
+	node.raftStorage.Append([]raftpb.Entry{
+		confChange(1, raftpb.ConfChange{Type: raftpb.ConfChangeUpdateNode, NodeID: 3, Context: []byte("node3:9121")}),
+		confChange(2, raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 2}),
+		confChange(3, raftpb.ConfChange{Type: raftpb.ConfChangeUpdateNode, NodeID: 4, Context: []byte("node4:9121")}),
+	})
+	node.appliedIndex = 2
+	node.rebuildFromLog()
+	if addr := node.serviceAddr(3); addr != "node3:9121" {
+		t.Errorf("Expected service address: node3:9121 to be rebuilt, Actual: %s", addr)
+	}
+	if addr := node.serviceAddr(2); addr != "" {
+		t.Errorf("Expected service address of the removed node to be forgotten, Actual: %s", addr)
+	}
+	if addr := node.serviceAddr(4); addr != "" {
+		t.Errorf("Expected service address in an entry not applied to be left out, Actual: %s", addr)
+	}
+}
+
+func TestLoadWhileRestoring(t *testing.T) {
+	opts, _ := raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"), raft.RejectLoadsWhileRestoring(true))
+	repl := newTestReplicator(t, opts)
+	repl.restoring = 1
+	ctx := raft.WithReadConsistency(context.Background(), raft.Stale)
+	if _, err := repl.Load(ctx, nil); err != raft.ErrRecovering {
+		t.Errorf("Expected error: %v while restoring, Actual: %v", raft.ErrRecovering, err)
+	}
+
+	repl.opts, _ = raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	if _, err := repl.Load(ctx, nil); err == raft.ErrRecovering {
+		t.Error("Expected Load to not be rejected unless configured")
+	}
+	repl.opts = opts
+	atomic.StoreInt32(&repl.restoring, 0)
+	if _, err := repl.Load(ctx, nil); err == raft.ErrRecovering {
+		t.Error("Expected Load to not be rejected after restoring")
+	}
+
+	// Loads must never read the store while it is being restored
+	repl.opts, _ = raft.NewOptions(raft.NodeUrl("http://127.0.0.1:9321"))
+	repl.restoreMu.Lock()
+	loaded := make(chan struct{})
+	go func() {
+		repl.Load(ctx, nil)
+		close(loaded)
+	}()
+	select {
+	case <-loaded:
+		t.Error("Expected Load to wait till the store is restored")
+	case <-time.After(50 * time.Millisecond):
+	}
+	repl.restoreMu.Unlock()
+	<-loaded
+}
+
+func TestAvailability(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	repl.appliedIndex = 2000
+	if repl.writable(etcd_raft.Status{}) {
+		t.Error("Expected cluster to not be writable without a leader")
+	}
+	status := etcd_raft.Status{HardState: raftpb.HardState{Commit: 2500}}
+	if !repl.readable(status) {
+		t.Error("Expected cluster to be readable with a caught up replica")
+	}
+	status.Commit = 5000
+	if repl.readable(status) {
+		t.Error("Expected cluster to not be readable without a caught up replica")
+	}
+}
+
+func TestApplyDigest(t *testing.T) {
+	results := []internalNexusResponse{{Res: []byte("a")}, {Res: []byte("b")}, {Err: errors.New("c")}, {BatchRes: [][]byte{[]byte("d")}}}
+	inOrder, reversed := newApplyDigest(4), newApplyDigest(4)
+	for i := range results {
+		inOrder.add(uint64(i+1), &results[i])
+		reversed.add(uint64(len(results)-i), &results[len(results)-i-1])
+	}
+	var digest uint64
+	for idx := uint64(1); idx <= 4; idx++ {
+		inOrder.observe(idx)
+		digest, _ = reversed.observe(idx)
+	}
+	if match, known := inOrder.verify(4, digest); !known || !match {
+		t.Errorf("Expected digests to match regardless of the order of applying. Known: %v, Match: %v", known, match)
+	}
+	if match, _ := inOrder.verify(4, digest+1); match {
+		t.Error("Expected differing digests to not match")
+	}
+
+	partial := newApplyDigest(4)
+	for idx := uint64(3); idx <= 4; idx++ {
+		partial.add(idx, &results[0])
+		if _, ok := partial.observe(idx); ok {
+			t.Errorf("Expected no digest for a window not observed entirely, at index: %d", idx)
+		}
+	}
+	if _, known := partial.verify(4, digest); known {
+		t.Error("Expected no digest to be recorded for a window not observed entirely")
+	}
+}
+
+func TestDeterminismDigests(t *testing.T) {
+	if err := createRaftDirs(); err != nil {
+		t.Fatal(err)
+	}
+	digestUrl := "http://127.0.0.1:9341,http://127.0.0.1:9342,http://127.0.0.1:9343"
+	interval := uint64(5)
+	clus := &cluster{}
+	for _, peerAddr := range strings.Split(digestUrl, ",") {
+		opts, err := raft.NewOptions(
+			raft.NodeUrl(peerAddr),
+			raft.LogDir(logDir),
+			raft.SnapDir(snapDir),
+			raft.ClusterUrl(digestUrl),
+			raft.ReplicationTimeout(replTimeout),
+			raft.LeaseBasedReads(false),
+			raft.VerifyDeterminism(interval),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := newInMemKVStore()
+		repl := NewReplicator(db, opts)
+		clus.peers = append(clus.peers, &peer{repl.node.id, db, repl})
+	}
+	clus.start()
+	defer clus.stop()
+
+	leader := clus.leader(t)
+	for i := 0; i < 3*int(interval); i++ {
+		req := &kvReq{fmt.Sprintf("digest_key_%d", i), fmt.Sprintf("digest_val_%d", i)}
+		data, err := req.toBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := leader.repl.Save(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sleep(2)
+
+	// every checkpoint recorded by the leader must be recorded alike
+	// by the followers that applied the same window entirely
+	leader.repl.digest.mu.Lock()
+	checkpoints := make(map[uint64]uint64, len(leader.repl.digest.checkpoints))
+	for index, digest := range leader.repl.digest.checkpoints {
+		checkpoints[index] = digest
+	}
+	leader.repl.digest.mu.Unlock()
+	if len(checkpoints) == 0 {
+		t.Fatal("Expected the leader to record digests of checkpoints")
+	}
+	for _, peer := range clus.peers {
+		verified := 0
+		for index, digest := range checkpoints {
+			if match, known := peer.repl.digest.verify(index, digest); known && !match {
+				t.Errorf("peer %x -> Digest mismatch for checkpoint at index: %d", peer.id, index)
+			} else if known {
+				verified++
+			}
+		}
+		if verified == 0 {
+			t.Errorf("peer %x -> Expected digests of checkpoints in common with the leader", peer.id)
+		}
+	}
+}
+
+func TestCompressPayloads(t *testing.T) {
+	compressible := bytes.Repeat([]byte("nexus"), 1000)
+	replReq := &models.NexusInternalRequest{Req: compressible}
+	if err := compressPayloads(replReq, raft.GzipCompression, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if replReq.Compression != uint32(raft.GzipCompression) || len(replReq.Req) >= len(compressible) {
+		t.Errorf("Expected payload to be compressed. Compression: %d, Size: %d", replReq.Compression, len(replReq.Req))
+	}
+	if err := decompressPayloads(replReq); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replReq.Req, compressible) {
+		t.Error("Expected decompressed payload to match the original")
+	}
+
+	incompressible := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+	replReq = &models.NexusInternalRequest{Batch: [][]byte{incompressible}}
+	if err := compressPayloads(replReq, raft.GzipCompression, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if replReq.Compression != uint32(raft.NoCompression) || !bytes.Equal(replReq.Batch[0], incompressible) {
+		t.Errorf("Expected incompressible payload to be left as is. Compression: %d, Size: %d", replReq.Compression, len(replReq.Batch[0]))
+	}
+
+	small := []byte("small")
+	replReq = &models.NexusInternalRequest{Req: small}
+	if err := compressPayloads(replReq, raft.GzipCompression, 1024); err != nil || replReq.Compression != uint32(raft.NoCompression) {
+		t.Errorf("Expected payload below the threshold to be left as is. Compression: %d, Error: %v", replReq.Compression, err)
+	}
+}
+
+func TestWaitForLeader(t *testing.T) {
+	repl := newTestReplicator(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*leaderPollInterval)
+	defer cancel()
+	if err := repl.WaitForLeader(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected error: %v without a leader, Actual: %v", context.DeadlineExceeded, err)
+	}
+	close(repl.node.stopc)
+	if err := repl.WaitForLeader(context.Background()); err != raft.ErrNoLeader {
+		t.Errorf("Expected error: %v once stopped, Actual: %v", raft.ErrNoLeader, err)
+	}
+}
+
+func TestMembershipChange(t *testing.T) {
+	prev := raftpb.ConfState{Nodes: []uint64{1, 2}, Learners: []uint64{3}}
+	cases := []struct {
+		next   raftpb.ConfState
+		nodeID uint64
+		change string
+	}{
+		{raftpb.ConfState{Nodes: []uint64{1, 2, 4}, Learners: []uint64{3}}, 4, addVoterChange},
+		{raftpb.ConfState{Nodes: []uint64{1, 2}, Learners: []uint64{3, 4}}, 4, addLearnerChange},
+		{raftpb.ConfState{Nodes: []uint64{1, 2, 3}}, 3, promoteChange},
+		{raftpb.ConfState{Nodes: []uint64{1}, Learners: []uint64{3}}, 2, removeChange},
+		{raftpb.ConfState{Nodes: []uint64{1, 2}}, 3, removeChange},
+		{prev, 2, ""},
+	}
+	for _, c := range cases {
+		if change := membershipChange(prev, c.next, c.nodeID); change != c.change {
+			t.Errorf("Expected change: %q for Node %d, got: %q", c.change, c.nodeID, change)
+		}
+	}
+}
+
 func testListMembers(t *testing.T) {
 	members := strings.Split(clusterUrl, ",")
 	clus.assertMembers(t, members)
 	clus.assertRaftMembers(t)
+	checkQuorumConnectivity(t)
+	checkReplicationFactor(t)
+}
+
+func checkReplicationFactor(t *testing.T) {
+	for _, peer := range clus.peers {
+		if voters, quorum := peer.repl.ReplicationFactor(); voters != clusterSize || quorum != clusterSize/2+1 {
+			t.Errorf("Replication factor mismatch on node %d. Voters: %d, Quorum: %d", peer.id, voters, quorum)
+		}
+	}
+}
+
+func checkWaitForLeader(t *testing.T) {
+	for _, peer := range clus.peers {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := peer.repl.WaitForLeader(ctx)
+		cancel()
+		if err != nil {
+			t.Errorf("Expected peer %d to know of the leader, Error: %v", peer.id, err)
+		}
+	}
+}
+
+func checkProposalCounts(t *testing.T) {
+	for _, peer := range clus.peers {
+		status := peer.repl.Status()
+		if status.ProposalsCommitted < 3 || status.ProposalsMade != status.ProposalsCommitted+status.ProposalsFailed {
+			t.Errorf("Unexpected proposal counts on node %d. Made: %d, Committed: %d, Failed: %d",
+				peer.id, status.ProposalsMade, status.ProposalsCommitted, status.ProposalsFailed)
+		}
+	}
+}
+
+func checkCommits(t *testing.T) {
+	peer := clus.peers[0]
+	applied := peer.repl.AppliedIndex()
+	commits, next, err := peer.repl.Commits(1, int(applied))
+	var compacted *raft.CompactedError
+	if errors.As(err, &compacted) {
+		commits, next, err = peer.repl.Commits(compacted.FirstIndex, int(applied))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) == 0 || next < applied+1 {
+		t.Errorf("Expected commits up to applied index: %d, Actual: %d commits up to: %d", applied, len(commits), next-1)
+	}
+	if _, _, err := peer.repl.Commits(0, 1); !errors.Is(err, raft.ErrCompacted) {
+		t.Errorf("Expected error: %v on reading compacted entries, Actual: %v", raft.ErrCompacted, err)
+	}
+}
+
+func checkSnapshot(t *testing.T) {
+	peer := clus.peers[0]
+	index, err := peer.repl.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied := peer.repl.AppliedIndex(); index < applied {
+		t.Errorf("Expected snapshot index: %d to be at least the applied index: %d", index, applied)
+	}
+	if again, err := peer.repl.Snapshot(context.Background()); err != nil || again < index {
+		t.Errorf("Expected snapshot at index: %d or later, Actual: %d, Error: %v", index, again, err)
+	}
+}
+
+func checkQuorumConnectivity(t *testing.T) {
+	for _, peer := range clus.peers {
+		healthy, reachable, err := peer.repl.CheckQuorumConnectivity()
+		if leader, _ := peer.repl.ListMembers(); leader != peer.id {
+			if !errors.Is(err, raft.ErrNotLeader) {
+				t.Errorf("Expected error: %v on follower %d, Actual: %v", raft.ErrNotLeader, peer.id, err)
+			}
+			// removals must not bypass the check on followers
+			ctx := raft.WithDryRun(context.Background())
+			if err := peer.repl.RemoveMember(ctx, strings.Split(clusterUrl, ",")[0]); !errors.Is(err, raft.ErrNotLeader) {
+				t.Errorf("Expected error: %v on removing via follower %d, Actual: %v", raft.ErrNotLeader, peer.id, err)
+			}
+		} else if err != nil || !healthy || len(reachable) != clusterSize {
+			t.Errorf("Expected all voters to be reachable from leader. Healthy: %t, Reachable: %v, Error: %v", healthy, reachable, err)
+		}
+	}
 }
 
 func testSaveLoadLargeData(t *testing.T) {
@@ -97,6 +1727,10 @@ func testSaveLoadData(t *testing.T) {
 
 	//assertions
 	clus.assertDB(t, reqs...)
+	checkWaitForLeader(t)
+	checkProposalCounts(t)
+	checkCommits(t)
+	checkSnapshot(t)
 
 	// Loading
 	for _, req := range reqs {
@@ -191,8 +1825,8 @@ func testForNewNexusNodeJoinLeaveCluster(t *testing.T) {
 		// assert membership across all nodes
 		peer4.assertMembers(t, peer4.getLeaderUrl(), members)
 
-		// remove this peer
-		if err := peer1.repl.RemoveMember(context.Background(), peer4Url); err != nil {
+		// remove this peer via the leader, which checks for a quorum
+		if err := clus.leader(t).repl.RemoveMember(context.Background(), peer4Url); err != nil {
 			t.Fatal(err)
 		}
 		sleep(3)
@@ -203,6 +1837,275 @@ func testForNewNexusNodeJoinLeaveCluster(t *testing.T) {
 	}
 }
 
+func testJoinFromSnapshot(t *testing.T) {
+	leader := clus.leader(t)
+	reqs := []*kvReq{{"snap_join_key_1", "snap_join_val_1"}, {"snap_join_key_2", "snap_join_val_2"}}
+	leader.save(t, reqs...)
+	index, err := leader.repl.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// copy the snapshot over as an operator would, since the
+	// leader may purge it from its snap dir meanwhile
+	snapFile := copySnapshotFile(t, leader.repl.node.snapdir, index)
+	defer os.Remove(snapFile)
+	opts, err := raft.NewOptions(
+		raft.NodeUrl(peer6Url),
+		raft.LogDir(logDir),
+		raft.SnapDir(snapDir),
+		raft.ClusterUrl(clusterUrl),
+		raft.ReplicationTimeout(replTimeout),
+		raft.LeaseBasedReads(false),
+		raft.JoinFromSnapshot(snapFile),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db6 := newInMemKVStore()
+	repl6 := NewReplicator(db6, opts)
+	peer6 := &peer{repl6.node.id, db6, repl6}
+	peer6.start()
+	defer peer6.stop()
+	sleep(1)
+
+	// the data must already be there before the peer is even a member
+	peer6.assertDB(t, reqs...)
+
+	if err := leader.repl.AddMember(context.Background(), peer6Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	members := append(strings.Split(clusterUrl, ","), peer6Url)
+	clus.assertMembers(t, members)
+
+	// entries after the snapshot must still be shipped to the peer
+	req := &kvReq{"snap_join_key_3", "snap_join_val_3"}
+	leader.save(t, req)
+	sleep(1)
+	peer6.assertDB(t, append(reqs, req)...)
+
+	if err := leader.repl.RemoveMember(context.Background(), peer6Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	clus.assertMembers(t, members[0:len(members)-1])
+}
+
+// copySnapshotFile copies the snapshot file at the given index from
+// the given snap dir to a temp file, returning its path.
+func copySnapshotFile(t *testing.T, dir string, index uint64) string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix := fmt.Sprintf("-%016x.snap", index)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), suffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp, err := ioutil.TempFile("", "nexus_join_*.snap")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tmp.Close()
+		if _, err := tmp.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		return tmp.Name()
+	}
+	t.Fatalf("No snapshot at index: %d in %s", index, dir)
+	return ""
+}
+
+func testReplaceMember(t *testing.T) {
+	oldPeer, err := newJoiningPeer(peer7Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPeer.start()
+	defer oldPeer.stop()
+	leader := clus.leader(t)
+	if err := leader.repl.AddMember(context.Background(), peer7Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+
+	// the replacement has an explicit ID, given along with its URL
+	newPeer, err := newJoiningPeer(peer8Url, raft.NodeId(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPeer.start()
+	defer newPeer.stop()
+	newUrl := "8=" + peer8Url
+	if err := leader.repl.ReplaceMember(context.Background(), leader.id, newUrl); err == nil {
+		t.Errorf("Expected the leader to refuse replacing itself")
+	}
+	for _, peer := range clus.peers {
+		if peer.id == leader.id {
+			continue
+		}
+		if err := peer.repl.ReplaceMember(context.Background(), oldPeer.id, newUrl); !errors.Is(err, raft.ErrNotLeader) {
+			t.Errorf("Expected error: %v on follower %x, Actual: %v", raft.ErrNotLeader, peer.id, err)
+		}
+	}
+	if _, nodes := leader.repl.ListMembers(); len(nodes) != clusterSize+1 {
+		t.Fatalf("Expected no change to the members on refusing to replace, Actual: %v", nodes)
+	}
+
+	if err := leader.repl.ReplaceMember(context.Background(), oldPeer.id, newUrl); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	members := append(strings.Split(clusterUrl, ","), peer8Url)
+	clus.assertMembers(t, members)
+	if _, nodes := leader.repl.ListMembers(); nodes[8] == nil || nodes[8].IsLearner {
+		t.Errorf("Expected node at %s to be a voter with ID: 8, Actual members: %v", peer8Url, nodes)
+	}
+	if _, present := leader.repl.node.node.Status().Progress[oldPeer.id]; present {
+		t.Errorf("Expected node %x to be removed from the progress tracked by the leader", oldPeer.id)
+	}
+
+	// entries are replicated to the new voter
+	req := &kvReq{"replaced_key", "replaced_val"}
+	leader.save(t, req)
+	sleep(1)
+	newPeer.assertDB(t, req)
+
+	if err := leader.repl.RemoveMember(context.Background(), newUrl); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	clus.assertMembers(t, members[0:len(members)-1])
+}
+
+func testAdvertiseServiceAddr(t *testing.T) {
+	svcAddr := "127.0.0.1:9829"
+	newPeer, err := newJoiningPeer(peer9Url, raft.ServiceAddr(svcAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPeer.start()
+	defer newPeer.stop()
+	leader := clus.leader(t)
+	if err := leader.repl.AddMember(context.Background(), peer9Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	for _, peer := range append(clus.peers, newPeer) {
+		if _, nodes := peer.repl.ListMembers(); nodes[newPeer.id] == nil || nodes[newPeer.id].ServiceAddr != svcAddr {
+			t.Errorf("Expected node %x to know the service address: %s of node %x, Actual members: %v", peer.id, svcAddr, newPeer.id, nodes)
+		}
+	}
+
+	if err := leader.repl.RemoveMember(context.Background(), peer9Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	if addr := leader.repl.node.serviceAddr(newPeer.id); addr != "" {
+		t.Errorf("Expected the service address of a removed node to be forgotten, Actual: %s", addr)
+	}
+}
+
+func testDryRunMembership(t *testing.T) {
+	// stands in for a new node, which only needs to be reachable
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	newUrl := "http://" + ln.Addr().String()
+	members := strings.Split(clusterUrl, ",")
+	leader := clus.leader(t)
+	commit := leader.repl.node.node.Status().Commit
+
+	ctx := raft.WithDryRun(context.Background())
+	if err := leader.repl.AddMember(ctx, newUrl); err != nil {
+		t.Errorf("Expected dry run of adding %s to succeed, Actual: %v", newUrl, err)
+	}
+	if err := leader.repl.AddMember(ctx, members[1]); err == nil {
+		t.Errorf("Expected dry run of adding existing member %s to fail", members[1])
+	}
+	if err := leader.repl.RemoveMember(ctx, members[2]); err != nil {
+		t.Errorf("Expected dry run of removing %s to succeed, Actual: %v", members[2], err)
+	}
+	if err := leader.repl.RemoveMember(ctx, newUrl); !errors.Is(err, raft.ErrUnknownMember) {
+		t.Errorf("Expected error: %v, Actual: %v", raft.ErrUnknownMember, err)
+	}
+
+	// a dry run fails if the real addition would have to wait
+	var held []string
+	for !leader.repl.memberAdds.full() {
+		slotUrl := fmt.Sprintf("http://127.0.0.1:%d", 9400+len(held))
+		if err := leader.repl.memberAdds.acquire(context.Background(), slotUrl); err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, slotUrl)
+	}
+	if err := leader.repl.AddMember(ctx, newUrl); err == nil {
+		t.Error("Expected dry run of adding a member to fail while other additions are in progress")
+	}
+	for _, slotUrl := range held {
+		leader.repl.memberAdds.release(slotUrl)
+	}
+
+	sleep(1)
+	if actual := leader.repl.node.node.Status().Commit; actual != commit {
+		t.Errorf("Expected dry runs not to propose anything. Commit index was: %d, Actual: %d", commit, actual)
+	}
+	clus.assertMembers(t, members)
+}
+
+func testPromoteAndTransferLeadership(t *testing.T) {
+	peer5, err := newJoiningPeer(peer5Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer5.start()
+	defer peer5.stop()
+	sleep(3)
+
+	leader := clus.leader(t)
+	if err := leader.repl.AddLearner(context.Background(), peer5Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	if err := leader.repl.TransferLeadership(context.Background(), peer5.id); !errors.Is(err, raft.ErrUnknownMember) {
+		t.Errorf("Expected error: %v for transferring to a learner, Actual: %v", raft.ErrUnknownMember, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := leader.repl.PromoteLearner(ctx, peer5.id); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	if _, members := leader.repl.ListMembers(); members[peer5.id] == nil || members[peer5.id].IsLearner {
+		t.Fatalf("Expected node %x to be promoted to a voter, Actual: %v", peer5.id, members[peer5.id])
+	}
+	if err := leader.repl.TransferLeadership(ctx, peer5.id); err != nil {
+		t.Fatal(err)
+	}
+	if lead := leader.repl.node.getLeaderId(); lead != peer5.id {
+		t.Errorf("Expected leader: %x, Actual: %x", peer5.id, lead)
+	}
+
+	// hand the leadership back before removing the promoted member
+	if err := peer5.repl.TransferLeadership(ctx, leader.id); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.repl.RemoveMember(context.Background(), peer5Url); err != nil {
+		t.Fatal(err)
+	}
+	sleep(3)
+	clus.assertMembers(t, strings.Split(clusterUrl, ","))
+}
+
 func testForNodeRestart(t *testing.T) {
 	peer2 := clus.peers[1]
 	reqs := []*kvReq{&kvReq{"hello", "world"}, &kvReq{"foo", "bar"}}
@@ -276,6 +2179,17 @@ func (this *cluster) stop() {
 	}
 }
 
+func (this *cluster) leader(t *testing.T) *peer {
+	lead := this.peers[0].repl.node.getLeaderId()
+	for _, peer := range this.peers {
+		if peer.id == lead {
+			return peer
+		}
+	}
+	t.Fatalf("Leader %x is not among the peers", lead)
+	return nil
+}
+
 func (this *cluster) assertDB(t *testing.T, reqs ...*kvReq) {
 	for _, peer := range this.peers {
 		peer.assertDB(t, reqs...)
@@ -338,6 +2252,32 @@ func (peer *peer) assertMembers(t *testing.T, leader string, members []string) {
 	}
 }
 
+// newTestReplicator returns a replicator of node 1 with the given
+// options, or the default ones if nil, for testing its methods without
+// starting RAFT. Tests set up any other fields they need on it.
+func newTestReplicator(t *testing.T, opts raft.Options) *replicator {
+	if opts == nil {
+		var err error
+		if opts, err = raft.NewOptions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &replicator{
+		logger:            raft.StdLogger{},
+		node:              &raftNode{id: 1, logger: raft.StdLogger{}, stopc: make(chan struct{})},
+		opts:              opts,
+		statsCli:          stats.NewNoOpClient(),
+		store:             newInMemKVStore(),
+		waiter:            newTimedWait(),
+		applyWait:         wait.NewTimeList(),
+		idGen:             idutil.NewGenerator(1, time.Now()),
+		peerInactiveSince: make(map[uint64]time.Time),
+		offlinePeers:      make(map[uint64]bool),
+		memberWatchers:    make(map[chan raft.MemberEvent]struct{}),
+		appliedKeys:       newAppliedKeys(),
+	}
+}
+
 type peer struct {
 	id   uint64
 	db   *inMemKVStore
@@ -371,15 +2311,15 @@ func newPeer(id int) (*peer, error) {
 	return newPeerWithDB(id, memKVStore)
 }
 
-func newJoiningPeer(peerAddr string) (*peer, error) {
-	opts, err := raft.NewOptions(
+func newJoiningPeer(peerAddr string, extraOpts ...raft.Option) (*peer, error) {
+	opts, err := raft.NewOptions(append([]raft.Option{
 		raft.NodeUrl(peerAddr),
 		raft.LogDir(logDir),
 		raft.SnapDir(snapDir),
 		raft.ClusterUrl(clusterUrl),
 		raft.ReplicationTimeout(replTimeout),
 		raft.LeaseBasedReads(false),
-	)
+	}, extraOpts...)...)
 	if err != nil {
 		return nil, err
 	} else {
@@ -391,7 +2331,7 @@ func newJoiningPeer(peerAddr string) (*peer, error) {
 
 func (this *peer) getLeaderUrl() string {
 	lid := this.repl.node.getLeaderId()
-	return this.repl.node.rpeers[lid]
+	return this.repl.node.peerUrl(lid)
 }
 
 func (this *peer) start() {
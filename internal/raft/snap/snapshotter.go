@@ -9,6 +9,7 @@ import (
 	"github.com/coreos/etcd/pkg/pbutil"
 	"github.com/coreos/etcd/raft"
 	"github.com/coreos/etcd/raft/raftpb"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
 	"io"
 	"log"
 	"os"
@@ -28,13 +29,57 @@ var (
 	ErrInvalidSnapshot = errors.New("snap: invalid snapshot")
 )
 
+// archiveQueueSize bounds the number of snapshots pending to be copied
+// onto the backend, beyond which the newer ones are skipped.
+const archiveQueueSize = 4
+
 type Snapshotter struct {
-	dir string
+	dir      string
+	dbDir    string
+	backend  pkg_raft.SnapshotStore
+	retain   uint
+	archiveC chan raftpb.Snapshot
+	donec    chan struct{}
 }
 
 func New(dir string) *Snapshotter {
+	return NewWithDBDir(dir, dir)
+}
+
+// NewWithDBDir creates a Snapshotter that loads DB snapshots
+// from a dir different from the one holding RAFT snapshots.
+func NewWithDBDir(dir, dbDir string) *Snapshotter {
 	return &Snapshotter{
-		dir: dir,
+		dir:   dir,
+		dbDir: dbDir,
+	}
+}
+
+// WithBackend makes this Snapshotter copy every snapshot it saves onto
+// the given backend, retaining up to the given number of the latest
+// ones there (0 retains all of them). Snapshots are still saved on the
+// local disk first, from where they are shipped to the other nodes, and
+// are copied onto the backend in the background. Close stops copying.
+func (s *Snapshotter) WithBackend(backend pkg_raft.SnapshotStore, retain uint) *Snapshotter {
+	s.backend, s.retain = backend, retain
+	s.archiveC, s.donec = make(chan raftpb.Snapshot, archiveQueueSize), make(chan struct{})
+	go s.runArchiver()
+	return s
+}
+
+// Close waits for the snapshots pending to be copied onto the backend,
+// if any. No snapshots must be saved after closing.
+func (s *Snapshotter) Close() {
+	if s.archiveC != nil {
+		close(s.archiveC)
+		<-s.donec
+	}
+}
+
+func (s *Snapshotter) runArchiver() {
+	defer close(s.donec)
+	for snapshot := range s.archiveC {
+		s.archive(&snapshot)
 	}
 }
 
@@ -42,7 +87,71 @@ func (s *Snapshotter) SaveSnapshot(snapshot raftpb.Snapshot, stream io.Reader) e
 	if raft.IsEmptySnap(snapshot) {
 		return nil
 	}
-	return s.saveSnapshot(&snapshot, stream)
+	if err := s.saveSnapshot(&snapshot, stream); err != nil {
+		return err
+	}
+	if s.backend != nil {
+		select {
+		case s.archiveC <- snapshot:
+		default:
+			log.Printf("WARNING - skipped copying snapshot at index %d onto the backend, as %d are pending", snapshot.Metadata.Index, archiveQueueSize)
+		}
+	}
+	return nil
+}
+
+// archive copies the given snapshot, already saved on the local disk,
+// onto the backend and purges the older ones there beyond the retention.
+// Failures are only logged, since the snapshot is safe on the local disk.
+func (s *Snapshotter) archive(snapshot *raftpb.Snapshot) {
+	snapFile := s.snapFileName(snapshot)
+	f, err := os.Open(snapFile)
+	if err != nil {
+		log.Printf("ERROR - cannot read snapshot file %v for the backend: %v", snapFile, err)
+		return
+	}
+	defer f.Close()
+	if err = s.backend.Put(snapshot.Metadata.Index, f); err != nil {
+		log.Printf("ERROR - failed to store snapshot at index %d onto the backend: %v", snapshot.Metadata.Index, err)
+		return
+	}
+	indexes, err := s.backend.List()
+	if err != nil {
+		log.Printf("ERROR - failed to list snapshots on the backend: %v", err)
+		return
+	}
+	for s.retain > 0 && uint(len(indexes)) > s.retain {
+		if err = s.backend.Delete(indexes[0]); err != nil {
+			log.Printf("ERROR - failed to delete snapshot at index %d from the backend: %v", indexes[0], err)
+			return
+		}
+		indexes = indexes[1:]
+	}
+}
+
+// LoadBackendSnapshot returns the latest readable snapshot on the
+// backend, along with the DB snapshot following it, or ErrNoSnapshot
+// if there is none.
+func (s *Snapshotter) LoadBackendSnapshot() (*raftpb.Snapshot, io.ReadCloser, error) {
+	if s.backend == nil {
+		return nil, nil, ErrNoSnapshot
+	}
+	indexes, err := s.backend.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(indexes) - 1; i >= 0; i-- {
+		name := fmt.Sprintf("backend snapshot at index %d", indexes[i])
+		data, err := s.backend.Get(indexes[i])
+		if err != nil {
+			log.Printf("ERROR - cannot read %s: %v", name, err)
+			continue
+		}
+		if snap, data, err := decodeSnap(name, data); err == nil {
+			return snap, data, nil
+		}
+	}
+	return nil, nil, ErrNoSnapshot
 }
 
 func (s *Snapshotter) saveSnapshot(snapshot *raftpb.Snapshot, stream io.Reader) error {
@@ -95,6 +204,26 @@ func (s *Snapshotter) writeSnap(snapFile string, snapshot *raftpb.Snapshot, data
 	return err
 }
 
+// SaveDBSnapshot writes the given DB snapshot into the DB snapshot
+// dir, in the same layout as the ones received from the leader.
+func (s *Snapshotter) SaveDBSnapshot(index uint64, data io.Reader) error {
+	fpath := filepath.Join(s.dbDir, fmt.Sprintf("%016x.snap%s", index, snapDBSuffix))
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, data); err == nil {
+		err = fileutil.Fsync(f)
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(fpath)
+	}
+	return err
+}
+
 func (s *Snapshotter) LoadSnapshot() (*raftpb.Snapshot, io.ReadCloser, error) {
 	names, err := s.snapNames()
 	if err != nil {
@@ -118,14 +247,14 @@ func (s *Snapshotter) LoadSnapshot() (*raftpb.Snapshot, io.ReadCloser, error) {
 }
 
 func (s *Snapshotter) LoadDBSnapshot() (io.ReadCloser, error) {
-	names, err := s.snapNames()
+	names, err := s.snapNamesIn(s.dbDir)
 	if err != nil {
 		return nil, err
 	}
 	var	data io.ReadCloser
 	for _, name := range names {
 		if strings.HasSuffix(name, snapDBSuffix) {
-			fpath := filepath.Join(s.dir, name)
+			fpath := filepath.Join(s.dbDir, name)
 			if data, err = readSnapDB(fpath); err == nil {
 				break
 			}
@@ -156,6 +285,12 @@ func loadSnap(dir, name string) (snap *raftpb.Snapshot, data io.ReadCloser, err
 	return
 }
 
+// ReadSnapshotFile reads the RAFT snapshot at the given path, along
+// with the DB snapshot stored following it.
+func ReadSnapshotFile(path string) (*raftpb.Snapshot, io.ReadCloser, error) {
+	return readSnap(path)
+}
+
 func readSnapDB(snapName string) (io.ReadCloser, error) {
 	snapFile, err := os.Open(snapName)
 	if err != nil {
@@ -172,24 +307,33 @@ func readSnap(snapName string) (*raftpb.Snapshot, io.ReadCloser, error) {
 		log.Printf("ERROR - cannot read file %v: %v", snapName, err)
 		return nil, nil, err
 	}
+	return decodeSnap(snapName, snapFile)
+}
 
+// decodeSnap reads the RAFT snapshot at the start of the given data,
+// returning the data positioned at the DB snapshot following it. The
+// data is closed if it cannot be decoded.
+func decodeSnap(snapName string, snapFile io.ReadCloser) (*raftpb.Snapshot, io.ReadCloser, error) {
 	snapLenBts := make([]byte, 4)
-	numRead, err := snapFile.Read(snapLenBts)
+	numRead, err := io.ReadFull(snapFile, snapLenBts)
 	if numRead != len(snapLenBts) || err != nil {
 		log.Printf("ERROR - unable to read file %v: %v", snapName, err)
+		snapFile.Close()
 		return nil, nil, ErrEmptySnapshot
 	}
 
 	snapLen := binary.LittleEndian.Uint32(snapLenBts)
 	snapBts := make([]byte, snapLen)
-	numRead, err = snapFile.Read(snapBts)
-	if err != nil {
+	numRead, err = io.ReadFull(snapFile, snapBts)
+	if err != nil && err != io.ErrUnexpectedEOF {
 		log.Printf("ERROR - unable to read snapshot data from file %v: %v", snapName, err)
+		snapFile.Close()
 		return nil, nil, err
 	}
 	if numRead != len(snapBts) {
 		log.Printf("ERROR - unable to read snapshot data fully from file %v. Expected snapshot length: %d, actual: %d",
 			snapName, snapLen, numRead)
+		snapFile.Close()
 		return nil, nil, ErrInvalidSnapshot
 	}
 
@@ -201,7 +345,11 @@ func readSnap(snapName string) (*raftpb.Snapshot, io.ReadCloser, error) {
 // snapNames returns the filename of the snapshots in logical time order (from newest to oldest).
 // If there is no available snapshots, an ErrNoSnapshot will be returned.
 func (s *Snapshotter) snapNames() ([]string, error) {
-	dir, err := os.Open(s.dir)
+	return s.snapNamesIn(s.dir)
+}
+
+func (s *Snapshotter) snapNamesIn(dirPath string) ([]string, error) {
+	dir, err := os.Open(dirPath)
 	if err != nil {
 		return nil, err
 	}
@@ -210,7 +358,7 @@ func (s *Snapshotter) snapNames() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err = s.cleanupSnapdir(names); err != nil {
+	if err = cleanupSnapdir(dirPath, names); err != nil {
 		return nil, err
 	}
 	snaps := checkSuffix(names)
@@ -242,11 +390,11 @@ func renameBroken(path string) {
 
 // cleanupSnapdir removes any files that should not be in the snapshot directory:
 // - db.tmp prefixed files that can be orphaned by defragmentation
-func (s *Snapshotter) cleanupSnapdir(filenames []string) error {
+func cleanupSnapdir(dir string, filenames []string) error {
 	for _, filename := range filenames {
 		if strings.HasPrefix(filename, "db.tmp") {
 			log.Printf("INFO - found orphaned defragmentation file; deleting: %s", filename)
-			if rmErr := os.Remove(filepath.Join(s.dir, filename)); rmErr != nil && !os.IsNotExist(rmErr) {
+			if rmErr := os.Remove(filepath.Join(dir, filename)); rmErr != nil && !os.IsNotExist(rmErr) {
 				return fmt.Errorf("failed to remove orphaned defragmentation file %s: %v", filename, rmErr)
 			}
 		}
@@ -21,6 +21,7 @@ import (
 	pioutil "github.com/coreos/etcd/pkg/ioutil"
 	"github.com/coreos/etcd/pkg/pbutil"
 	internal_snap "github.com/coreos/etcd/snap"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
 	"io"
 	"io/ioutil"
 	"os"
@@ -227,6 +228,94 @@ func TestAllSnapshotBroken(t *testing.T) {
 	}
 }
 
+func TestLoadDBSnapshotFromDBDir(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "snapshot")
+	dbDir := filepath.Join(os.TempDir(), "snapshot_db")
+	for _, d := range []string{dir, dbDir} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(d)
+	}
+	err := ioutil.WriteFile(filepath.Join(dbDir, fmt.Sprintf("%016x.snap.db", 1)), testSnap.Data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(dir).LoadDBSnapshot(); err != ErrNoSnapshot {
+		t.Errorf("err = %v, want %v", err, ErrNoSnapshot)
+	}
+	data, err := NewWithDBDir(dir, dbDir).LoadDBSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	if bts, _ := ioutil.ReadAll(data); !bytes.Equal(bts, testSnap.Data) {
+		t.Errorf("data = %s, want %s", bts, testSnap.Data)
+	}
+}
+
+func TestSaveDBSnapshot(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "snapshot")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ss := New(dir)
+	if err := ss.SaveDBSnapshot(testSnap.Metadata.Index, bytes.NewReader(testSnap.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%016x.snap.db", testSnap.Metadata.Index))); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ss.LoadDBSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	if bts, _ := ioutil.ReadAll(data); !bytes.Equal(bts, testSnap.Data) {
+		t.Errorf("data = %s, want %s", bts, testSnap.Data)
+	}
+}
+
+func TestSnapshotBackend(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "snapshot")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend, err := pkg_raft.NewFileSnapshotStore(filepath.Join(dir, "backend"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := New(dir).WithBackend(backend, 2)
+	if _, _, err := ss.LoadBackendSnapshot(); err != ErrNoSnapshot {
+		t.Errorf("err = %v, want %v", err, ErrNoSnapshot)
+	}
+	for index := uint64(1); index <= 3; index++ {
+		snapshot := *testSnap
+		snapshot.Metadata.Index = index
+		if err := ss.SaveSnapshot(snapshot, bytes.NewReader(testSnap.Data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ss.Close()
+	if indexes, err := backend.List(); err != nil || !reflect.DeepEqual(indexes, []uint64{2, 3}) {
+		t.Errorf("indexes = %v, err = %v, want [2 3]", indexes, err)
+	}
+	g, data, err := New(filepath.Join(dir, "lost")).WithBackend(backend, 2).LoadBackendSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	if g.Metadata.Index != 3 {
+		t.Errorf("index = %d, want 3", g.Metadata.Index)
+	}
+	if bts, _ := ioutil.ReadAll(data); !bytes.Equal(bts, testSnap.Data) {
+		t.Errorf("data = %s, want %s", bts, testSnap.Data)
+	}
+}
+
 func createSnapBody(t *testing.T, merged *internal_snap.Message) io.ReadCloser {
 	buf := new(bytes.Buffer)
 	if err := binary.Write(buf, binary.BigEndian, uint64(merged.Message.Size())); err != nil {
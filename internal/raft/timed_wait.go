@@ -0,0 +1,114 @@
+package raft
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/pkg/wait"
+	pkg_raft "github.com/flipkart-incubator/nexus/pkg/raft"
+)
+
+// timedWait is a wait.Wait that also tracks since when each of the
+// registered IDs has been waiting, in order to detect stuck requests.
+type timedWait struct {
+	wait.Wait
+	mu  sync.Mutex
+	ops map[uint64]timedOp
+}
+
+type timedOp struct {
+	opType   pkg_raft.OpType
+	since    time.Time
+	deadline time.Time
+}
+
+func newTimedWait() *timedWait {
+	return &timedWait{Wait: wait.New(), ops: make(map[uint64]timedOp)}
+}
+
+func (this *timedWait) Register(id uint64) <-chan interface{} {
+	this.track(id, "", nil)
+	return this.Wait.Register(id)
+}
+
+// registerOp is similar to Register except that it also records the
+// type of the operation and the deadline of the given context.
+func (this *timedWait) registerOp(id uint64, opType pkg_raft.OpType, ctx context.Context) <-chan interface{} {
+	this.track(id, opType, ctx)
+	return this.Wait.Register(id)
+}
+
+func (this *timedWait) Trigger(id uint64, x interface{}) {
+	this.untrack(id)
+	this.Wait.Trigger(id, x)
+}
+
+// track records the given operation as in flight, without registering
+// it for being triggered, until untrack is invoked with its ID.
+func (this *timedWait) track(id uint64, opType pkg_raft.OpType, ctx context.Context) {
+	op := timedOp{opType: opType, since: time.Now()}
+	if ctx != nil {
+		op.deadline, _ = ctx.Deadline()
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.ops[id] = op
+}
+
+func (this *timedWait) untrack(id uint64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	delete(this.ops, id)
+}
+
+// triggerAll triggers every operation waiting currently with x.
+func (this *timedWait) triggerAll(x interface{}) {
+	this.mu.Lock()
+	ids := make([]uint64, 0, len(this.ops))
+	for id := range this.ops {
+		ids = append(ids, id)
+	}
+	this.mu.Unlock()
+	for _, id := range ids {
+		this.Trigger(id, x)
+	}
+}
+
+// inflight returns the operations waiting currently, oldest first.
+func (this *timedWait) inflight() []pkg_raft.InflightOp {
+	this.mu.Lock()
+	ops := make([]pkg_raft.InflightOp, 0, len(this.ops))
+	for id, op := range this.ops {
+		ops = append(ops, pkg_raft.InflightOp{Id: id, Type: op.opType, Age: time.Since(op.since), Deadline: op.deadline})
+	}
+	this.mu.Unlock()
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Age > ops[j].Age })
+	return ops
+}
+
+// pending returns the number of operations waiting currently.
+func (this *timedWait) pending() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.ops)
+}
+
+// oldestAge returns for how long the longest waiting ID has been
+// waiting, or 0 if none are waiting.
+func (this *timedWait) oldestAge() time.Duration {
+	if ops := this.inflight(); len(ops) > 0 {
+		return ops[0].Age
+	}
+	return 0
+}
+
+// registerOp registers the given operation on the given wait, along
+// with its type and deadline if the wait tracks them.
+func registerOp(w wait.Wait, id uint64, opType pkg_raft.OpType, ctx context.Context) <-chan interface{} {
+	if tw, ok := w.(*timedWait); ok {
+		return tw.registerOp(id, opType, ctx)
+	}
+	return w.Register(id)
+}
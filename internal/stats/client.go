@@ -18,6 +18,7 @@ func NewTag(key, val string) Tag {
 type Client interface {
 	io.Closer
 	Incr(string, int64)
+	IncrWithTags(string, int64, ...Tag)
 	Gauge(string, int64)
 	GaugeDelta(string, int64)
 	Timing(string, time.Time)
@@ -25,11 +26,12 @@ type Client interface {
 
 type noopClient struct{}
 
-func (*noopClient) Incr(_ string, _ int64)       {}
-func (*noopClient) Gauge(_ string, _ int64)      {}
-func (*noopClient) GaugeDelta(_ string, _ int64) {}
-func (*noopClient) Timing(_ string, _ time.Time) {}
-func (*noopClient) Close() error                 { return nil }
+func (*noopClient) Incr(_ string, _ int64)                   {}
+func (*noopClient) IncrWithTags(_ string, _ int64, _ ...Tag) {}
+func (*noopClient) Gauge(_ string, _ int64)                  {}
+func (*noopClient) GaugeDelta(_ string, _ int64)             {}
+func (*noopClient) Timing(_ string, _ time.Time)             {}
+func (*noopClient) Close() error                             { return nil }
 
 func NewNoOpClient() *noopClient {
 	return &noopClient{}
@@ -57,6 +59,14 @@ func (sdc *statsDClient) Incr(name string, value int64) {
 	sdc.cli.Incr(name, value)
 }
 
+func (sdc *statsDClient) IncrWithTags(name string, value int64, tags ...Tag) {
+	statsTags := make([]statsd.Tag, len(tags))
+	for i, tag := range tags {
+		statsTags[i] = statsd.StringTag(tag.key, tag.val)
+	}
+	sdc.cli.Incr(name, value, statsTags...)
+}
+
 func (sdc *statsDClient) Gauge(name string, value int64) {
 	sdc.cli.Gauge(name, value)
 }
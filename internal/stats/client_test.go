@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -61,6 +63,61 @@ func TestStatsDClient(t *testing.T) {
 	logOutput(t, s)
 }
 
+func TestPrometheusClient(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	statsCli, err := NewPrometheusClient(reg, NewTag("nexusNode", "node1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statsCli.Incr("sample.counter", 5)
+	statsCli.IncrWithTags("sample.counter", 1, NewTag("type", "add"))
+	statsCli.Gauge("sample.gauge", 42)
+	statsCli.GaugeDelta("sample.gauge", -2)
+	timing(statsCli)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["nexusNode"] != "node1" {
+				t.Errorf("Expected default tag on metric: %s, Actual labels: %v", family.GetName(), labels)
+			}
+			key := family.GetName() + "/" + labels["name"] + "/" + labels["tags"]
+			switch {
+			case metric.Counter != nil:
+				values[key] = metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				values[key] = metric.Gauge.GetValue()
+			case metric.Histogram != nil:
+				values[key] = float64(metric.Histogram.GetSampleCount())
+			}
+		}
+	}
+	expected := map[string]float64{
+		"nexus_events_total/sample.counter/":         5,
+		"nexus_events_total/sample.counter/type=add": 1,
+		"nexus_gauge/sample.gauge/":                  40,
+		"nexus_timing_milliseconds/sample.timing/":   1,
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected value of %s: %v, Actual: %v", key, value, values[key])
+		}
+	}
+
+	statsCli.Close()
+	if _, err := NewPrometheusClient(reg); err != nil {
+		t.Errorf("Expected metrics to be registered again after closing, got: %v", err)
+	}
+}
+
 func timing(statsCli Client) {
 	defer statsCli.Timing("sample.timing", time.Now())
 	<-time.After(10 * time.Millisecond)
@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the Prometheus metrics into which all the metrics are rolled
+// up, with the original metric names, such as "save.latency.ms", as the
+// value of the "name" label. This keeps dashboards portable across
+// StatsD and Prometheus.
+const (
+	promCounterName = "nexus_events_total"
+	promGaugeName   = "nexus_gauge"
+	promTimingName  = "nexus_timing_milliseconds"
+)
+
+type prometheusClient struct {
+	reg      prometheus.Registerer
+	counters *prometheus.CounterVec
+	gauges   *prometheus.GaugeVec
+	timings  *prometheus.HistogramVec
+}
+
+// NewPrometheusClient returns a Client that maps Incr onto counters,
+// Gauge onto gauges and Timing onto histograms, all of which are
+// registered with the given registerer. The default tags are set as
+// constant labels on all the metrics. Tags passed to IncrWithTags are
+// set as the "tags" label, formatted as comma separated key=value pairs.
+func NewPrometheusClient(reg prometheus.Registerer, defTags ...Tag) (*prometheusClient, error) {
+	if reg == nil {
+		return nil, errors.New("prometheus registerer must not be nil")
+	}
+	constLabels := make(prometheus.Labels, len(defTags))
+	for _, defTag := range defTags {
+		constLabels[defTag.key] = defTag.val
+	}
+	pc := &prometheusClient{
+		reg: reg,
+		counters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        promCounterName,
+			Help:        "Number of occurrences of Nexus events, by name",
+			ConstLabels: constLabels,
+		}, []string{"name", "tags"}),
+		gauges: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        promGaugeName,
+			Help:        "Current values of Nexus gauges, by name",
+			ConstLabels: constLabels,
+		}, []string{"name"}),
+		timings: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        promTimingName,
+			Help:        "Durations of Nexus operations in milliseconds, by name",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.5, 2, 16),
+		}, []string{"name"}),
+	}
+	for _, collector := range pc.collectors() {
+		if err := reg.Register(collector); err != nil {
+			pc.Close()
+			return nil, err
+		}
+	}
+	return pc, nil
+}
+
+func (pc *prometheusClient) collectors() []prometheus.Collector {
+	return []prometheus.Collector{pc.counters, pc.gauges, pc.timings}
+}
+
+func (pc *prometheusClient) Incr(name string, value int64) {
+	pc.counters.WithLabelValues(name, "").Add(float64(value))
+}
+
+func (pc *prometheusClient) IncrWithTags(name string, value int64, tags ...Tag) {
+	pairs := make([]string, len(tags))
+	for i, tag := range tags {
+		pairs[i] = tag.key + "=" + tag.val
+	}
+	sort.Strings(pairs)
+	pc.counters.WithLabelValues(name, strings.Join(pairs, ",")).Add(float64(value))
+}
+
+func (pc *prometheusClient) Gauge(name string, value int64) {
+	pc.gauges.WithLabelValues(name).Set(float64(value))
+}
+
+func (pc *prometheusClient) GaugeDelta(name string, value int64) {
+	pc.gauges.WithLabelValues(name).Add(float64(value))
+}
+
+func (pc *prometheusClient) Timing(name string, startTime time.Time) {
+	pc.timings.WithLabelValues(name).Observe(float64(time.Since(startTime)) / float64(time.Millisecond))
+}
+
+// Close unregisters all the metrics, so that a replicator can be started
+// again with the same registerer.
+func (pc *prometheusClient) Close() error {
+	for _, collector := range pc.collectors() {
+		pc.reg.Unregister(collector)
+	}
+	return nil
+}
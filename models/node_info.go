@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ActiveSinceTime returns the time since which the transport to this
+// node has been active, or the zero time if it is currently inactive.
+func (x *NodeInfo) ActiveSinceTime() time.Time {
+	if x.GetActiveSince() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, x.GetActiveSince()*int64(time.Millisecond))
+}
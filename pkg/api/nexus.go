@@ -8,6 +8,7 @@ import (
 	"github.com/flipkart-incubator/nexus/pkg/db"
 	"github.com/flipkart-incubator/nexus/pkg/raft"
 	"github.com/golang/protobuf/proto"
+	"time"
 )
 
 
@@ -15,11 +16,36 @@ type RaftReplicator interface {
 	Start()
 	Id() uint64
 	Save(context.Context, []byte) ([]byte, error)
+	SaveBatch(context.Context, [][]byte) ([][]byte, error)
 	Load(context.Context, []byte) ([]byte, error)
+	LoadStream(context.Context, []byte, int, func([]byte) error) error
 	AddMember(context.Context, string) error
+	AddLearner(context.Context, string) error
+	AddShadow(context.Context, string) error
+	PromoteLearner(context.Context, uint64) error
 	RemoveMember(context.Context, string) error
+	ReplaceMember(context.Context, uint64, string) error
+	TransferLeadership(context.Context, uint64) error
 	ListMembers() (uint64, map[uint64]*models.NodeInfo)
-	Stop()
+	ConfChangeCount() uint64
+	ResetConfChangeCount() uint64
+	Status() raft.Status
+	ReplicationFactor() (int, int)
+	SetLogLevel(raft.LogLevel) raft.LogLevel
+	CompactLog(uint64) error
+	Snapshot(context.Context) (uint64, error)
+	AppliedIndex() uint64
+	Health() raft.Health
+	CheckQuorumConnectivity() (bool, []uint64, error)
+	Freshness(context.Context) (raft.Freshness, error)
+	WaitForLeader(context.Context) error
+	ExportConfig() ([]byte, error)
+	PendingMemberAdds() map[string]raft.MemberAddState
+	InflightOps() []raft.InflightOp
+	Commits(uint64, int) ([]raft.Commit, uint64, error)
+	WatchMembers(context.Context) (<-chan raft.MemberEvent, error)
+	Stop() error
+	StopWithTimeout(time.Duration) error
 }
 
 func NewRaftReplicator(store db.Store, opts ...raft.Option) (RaftReplicator, error) {
@@ -21,10 +21,24 @@ const _ = grpc.SupportPackageIsVersion7
 type NexusClient interface {
 	Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
 	Save(ctx context.Context, in *SaveRequest, opts ...grpc.CallOption) (*SaveResponse, error)
+	SaveStream(ctx context.Context, opts ...grpc.CallOption) (Nexus_SaveStreamClient, error)
 	Load(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (*LoadResponse, error)
+	LoadStream(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (Nexus_LoadStreamClient, error)
 	AddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*Status, error)
+	PromoteNode(ctx context.Context, in *PromoteNodeRequest, opts ...grpc.CallOption) (*Status, error)
 	RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*Status, error)
+	ReplaceNode(ctx context.Context, in *ReplaceNodeRequest, opts ...grpc.CallOption) (*Status, error)
+	TransferLeadership(ctx context.Context, in *TransferLeadershipRequest, opts ...grpc.CallOption) (*Status, error)
 	ListNodes(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	WatchTopology(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Nexus_WatchTopologyClient, error)
+	CompactLog(ctx context.Context, in *CompactLogRequest, opts ...grpc.CallOption) (*Status, error)
+	Snapshot(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SnapshotResponse, error)
+	HasApplied(ctx context.Context, in *HasAppliedRequest, opts ...grpc.CallOption) (*HasAppliedResponse, error)
+	Freshness(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*FreshnessResponse, error)
+	Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*Status, error)
+	ListInflightOps(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*InflightOpsResponse, error)
+	ClusterStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error)
+	WatchCommits(ctx context.Context, in *WatchCommitsRequest, opts ...grpc.CallOption) (Nexus_WatchCommitsClient, error)
 }
 
 type nexusClient struct {
@@ -53,6 +67,40 @@ func (c *nexusClient) Save(ctx context.Context, in *SaveRequest, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *nexusClient) SaveStream(ctx context.Context, opts ...grpc.CallOption) (Nexus_SaveStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Nexus_ServiceDesc.Streams[0], "/nexus.api.Nexus/SaveStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nexusSaveStreamClient{stream}
+	return x, nil
+}
+
+type Nexus_SaveStreamClient interface {
+	Send(*SaveRequest) error
+	CloseAndRecv() (*SaveResponse, error)
+	grpc.ClientStream
+}
+
+type nexusSaveStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *nexusSaveStreamClient) Send(m *SaveRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *nexusSaveStreamClient) CloseAndRecv() (*SaveResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(SaveResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *nexusClient) Load(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (*LoadResponse, error) {
 	out := new(LoadResponse)
 	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/Load", in, out, opts...)
@@ -62,6 +110,38 @@ func (c *nexusClient) Load(ctx context.Context, in *LoadRequest, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *nexusClient) LoadStream(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (Nexus_LoadStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Nexus_ServiceDesc.Streams[1], "/nexus.api.Nexus/LoadStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nexusLoadStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Nexus_LoadStreamClient interface {
+	Recv() (*LoadResponse, error)
+	grpc.ClientStream
+}
+
+type nexusLoadStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *nexusLoadStreamClient) Recv() (*LoadResponse, error) {
+	m := new(LoadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *nexusClient) AddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*Status, error) {
 	out := new(Status)
 	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/AddNode", in, out, opts...)
@@ -71,6 +151,15 @@ func (c *nexusClient) AddNode(ctx context.Context, in *AddNodeRequest, opts ...g
 	return out, nil
 }
 
+func (c *nexusClient) PromoteNode(ctx context.Context, in *PromoteNodeRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/PromoteNode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *nexusClient) RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*Status, error) {
 	out := new(Status)
 	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/RemoveNode", in, out, opts...)
@@ -80,6 +169,24 @@ func (c *nexusClient) RemoveNode(ctx context.Context, in *RemoveNodeRequest, opt
 	return out, nil
 }
 
+func (c *nexusClient) ReplaceNode(ctx context.Context, in *ReplaceNodeRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/ReplaceNode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) TransferLeadership(ctx context.Context, in *TransferLeadershipRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/TransferLeadership", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *nexusClient) ListNodes(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListNodesResponse, error) {
 	out := new(ListNodesResponse)
 	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/ListNodes", in, out, opts...)
@@ -89,16 +196,157 @@ func (c *nexusClient) ListNodes(ctx context.Context, in *emptypb.Empty, opts ...
 	return out, nil
 }
 
+func (c *nexusClient) WatchTopology(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Nexus_WatchTopologyClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Nexus_ServiceDesc.Streams[2], "/nexus.api.Nexus/WatchTopology", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nexusWatchTopologyClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Nexus_WatchTopologyClient interface {
+	Recv() (*ListNodesResponse, error)
+	grpc.ClientStream
+}
+
+type nexusWatchTopologyClient struct {
+	grpc.ClientStream
+}
+
+func (x *nexusWatchTopologyClient) Recv() (*ListNodesResponse, error) {
+	m := new(ListNodesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *nexusClient) CompactLog(ctx context.Context, in *CompactLogRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/CompactLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) Snapshot(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SnapshotResponse, error) {
+	out := new(SnapshotResponse)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/Snapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) HasApplied(ctx context.Context, in *HasAppliedRequest, opts ...grpc.CallOption) (*HasAppliedResponse, error) {
+	out := new(HasAppliedResponse)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/HasApplied", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) Freshness(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*FreshnessResponse, error) {
+	out := new(FreshnessResponse)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/Freshness", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/Drain", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) ListInflightOps(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*InflightOpsResponse, error) {
+	out := new(InflightOpsResponse)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/ListInflightOps", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) ClusterStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error) {
+	out := new(ClusterStatusResponse)
+	err := c.cc.Invoke(ctx, "/nexus.api.Nexus/ClusterStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusClient) WatchCommits(ctx context.Context, in *WatchCommitsRequest, opts ...grpc.CallOption) (Nexus_WatchCommitsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Nexus_ServiceDesc.Streams[3], "/nexus.api.Nexus/WatchCommits", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nexusWatchCommitsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Nexus_WatchCommitsClient interface {
+	Recv() (*WatchCommitsResponse, error)
+	grpc.ClientStream
+}
+
+type nexusWatchCommitsClient struct {
+	grpc.ClientStream
+}
+
+func (x *nexusWatchCommitsClient) Recv() (*WatchCommitsResponse, error) {
+	m := new(WatchCommitsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // NexusServer is the server API for Nexus service.
 // All implementations should embed UnimplementedNexusServer
 // for forward compatibility
 type NexusServer interface {
 	Check(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
 	Save(context.Context, *SaveRequest) (*SaveResponse, error)
+	SaveStream(Nexus_SaveStreamServer) error
 	Load(context.Context, *LoadRequest) (*LoadResponse, error)
+	LoadStream(*LoadRequest, Nexus_LoadStreamServer) error
 	AddNode(context.Context, *AddNodeRequest) (*Status, error)
+	PromoteNode(context.Context, *PromoteNodeRequest) (*Status, error)
 	RemoveNode(context.Context, *RemoveNodeRequest) (*Status, error)
+	ReplaceNode(context.Context, *ReplaceNodeRequest) (*Status, error)
+	TransferLeadership(context.Context, *TransferLeadershipRequest) (*Status, error)
 	ListNodes(context.Context, *emptypb.Empty) (*ListNodesResponse, error)
+	WatchTopology(*emptypb.Empty, Nexus_WatchTopologyServer) error
+	CompactLog(context.Context, *CompactLogRequest) (*Status, error)
+	Snapshot(context.Context, *emptypb.Empty) (*SnapshotResponse, error)
+	HasApplied(context.Context, *HasAppliedRequest) (*HasAppliedResponse, error)
+	Freshness(context.Context, *emptypb.Empty) (*FreshnessResponse, error)
+	Drain(context.Context, *DrainRequest) (*Status, error)
+	ListInflightOps(context.Context, *emptypb.Empty) (*InflightOpsResponse, error)
+	ClusterStatus(context.Context, *emptypb.Empty) (*ClusterStatusResponse, error)
+	WatchCommits(*WatchCommitsRequest, Nexus_WatchCommitsServer) error
 }
 
 // UnimplementedNexusServer should be embedded to have forward compatible implementations.
@@ -111,18 +359,60 @@ func (UnimplementedNexusServer) Check(context.Context, *HealthCheckRequest) (*He
 func (UnimplementedNexusServer) Save(context.Context, *SaveRequest) (*SaveResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Save not implemented")
 }
+func (UnimplementedNexusServer) SaveStream(Nexus_SaveStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SaveStream not implemented")
+}
 func (UnimplementedNexusServer) Load(context.Context, *LoadRequest) (*LoadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Load not implemented")
 }
+func (UnimplementedNexusServer) LoadStream(*LoadRequest, Nexus_LoadStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method LoadStream not implemented")
+}
 func (UnimplementedNexusServer) AddNode(context.Context, *AddNodeRequest) (*Status, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AddNode not implemented")
 }
+func (UnimplementedNexusServer) PromoteNode(context.Context, *PromoteNodeRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromoteNode not implemented")
+}
 func (UnimplementedNexusServer) RemoveNode(context.Context, *RemoveNodeRequest) (*Status, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveNode not implemented")
 }
+func (UnimplementedNexusServer) ReplaceNode(context.Context, *ReplaceNodeRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplaceNode not implemented")
+}
+func (UnimplementedNexusServer) TransferLeadership(context.Context, *TransferLeadershipRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferLeadership not implemented")
+}
 func (UnimplementedNexusServer) ListNodes(context.Context, *emptypb.Empty) (*ListNodesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
 }
+func (UnimplementedNexusServer) WatchTopology(*emptypb.Empty, Nexus_WatchTopologyServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTopology not implemented")
+}
+func (UnimplementedNexusServer) CompactLog(context.Context, *CompactLogRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompactLog not implemented")
+}
+func (UnimplementedNexusServer) Snapshot(context.Context, *emptypb.Empty) (*SnapshotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Snapshot not implemented")
+}
+func (UnimplementedNexusServer) HasApplied(context.Context, *HasAppliedRequest) (*HasAppliedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HasApplied not implemented")
+}
+func (UnimplementedNexusServer) Freshness(context.Context, *emptypb.Empty) (*FreshnessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Freshness not implemented")
+}
+func (UnimplementedNexusServer) Drain(context.Context, *DrainRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Drain not implemented")
+}
+func (UnimplementedNexusServer) ListInflightOps(context.Context, *emptypb.Empty) (*InflightOpsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListInflightOps not implemented")
+}
+func (UnimplementedNexusServer) ClusterStatus(context.Context, *emptypb.Empty) (*ClusterStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClusterStatus not implemented")
+}
+func (UnimplementedNexusServer) WatchCommits(*WatchCommitsRequest, Nexus_WatchCommitsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchCommits not implemented")
+}
 
 // UnsafeNexusServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to NexusServer will
@@ -171,6 +461,32 @@ func _Nexus_Save_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Nexus_SaveStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(NexusServer).SaveStream(&nexusSaveStreamServer{stream})
+}
+
+type Nexus_SaveStreamServer interface {
+	SendAndClose(*SaveResponse) error
+	Recv() (*SaveRequest, error)
+	grpc.ServerStream
+}
+
+type nexusSaveStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *nexusSaveStreamServer) SendAndClose(m *SaveResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *nexusSaveStreamServer) Recv() (*SaveRequest, error) {
+	m := new(SaveRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _Nexus_Load_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(LoadRequest)
 	if err := dec(in); err != nil {
@@ -189,6 +505,27 @@ func _Nexus_Load_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Nexus_LoadStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LoadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NexusServer).LoadStream(m, &nexusLoadStreamServer{stream})
+}
+
+type Nexus_LoadStreamServer interface {
+	Send(*LoadResponse) error
+	grpc.ServerStream
+}
+
+type nexusLoadStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *nexusLoadStreamServer) Send(m *LoadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Nexus_AddNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(AddNodeRequest)
 	if err := dec(in); err != nil {
@@ -207,6 +544,24 @@ func _Nexus_AddNode_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Nexus_PromoteNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).PromoteNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/PromoteNode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).PromoteNode(ctx, req.(*PromoteNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Nexus_RemoveNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(RemoveNodeRequest)
 	if err := dec(in); err != nil {
@@ -225,6 +580,42 @@ func _Nexus_RemoveNode_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Nexus_ReplaceNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplaceNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).ReplaceNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/ReplaceNode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).ReplaceNode(ctx, req.(*ReplaceNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_TransferLeadership_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferLeadershipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).TransferLeadership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/TransferLeadership",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).TransferLeadership(ctx, req.(*TransferLeadershipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Nexus_ListNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -243,6 +634,174 @@ func _Nexus_ListNodes_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Nexus_WatchTopology_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NexusServer).WatchTopology(m, &nexusWatchTopologyServer{stream})
+}
+
+type Nexus_WatchTopologyServer interface {
+	Send(*ListNodesResponse) error
+	grpc.ServerStream
+}
+
+type nexusWatchTopologyServer struct {
+	grpc.ServerStream
+}
+
+func (x *nexusWatchTopologyServer) Send(m *ListNodesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Nexus_CompactLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompactLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).CompactLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/CompactLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).CompactLog(ctx, req.(*CompactLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_Snapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).Snapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/Snapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).Snapshot(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_HasApplied_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HasAppliedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).HasApplied(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/HasApplied",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).HasApplied(ctx, req.(*HasAppliedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_Freshness_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).Freshness(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/Freshness",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).Freshness(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_Drain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).Drain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/Drain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).Drain(ctx, req.(*DrainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_ListInflightOps_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).ListInflightOps(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/ListInflightOps",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).ListInflightOps(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_ClusterStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusServer).ClusterStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nexus.api.Nexus/ClusterStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusServer).ClusterStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nexus_WatchCommits_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchCommitsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NexusServer).WatchCommits(m, &nexusWatchCommitsServer{stream})
+}
+
+type Nexus_WatchCommitsServer interface {
+	Send(*WatchCommitsResponse) error
+	grpc.ServerStream
+}
+
+type nexusWatchCommitsServer struct {
+	grpc.ServerStream
+}
+
+func (x *nexusWatchCommitsServer) Send(m *WatchCommitsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Nexus_ServiceDesc is the grpc.ServiceDesc for Nexus service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -266,15 +825,76 @@ var Nexus_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "AddNode",
 			Handler:    _Nexus_AddNode_Handler,
 		},
+		{
+			MethodName: "PromoteNode",
+			Handler:    _Nexus_PromoteNode_Handler,
+		},
 		{
 			MethodName: "RemoveNode",
 			Handler:    _Nexus_RemoveNode_Handler,
 		},
+		{
+			MethodName: "ReplaceNode",
+			Handler:    _Nexus_ReplaceNode_Handler,
+		},
+		{
+			MethodName: "TransferLeadership",
+			Handler:    _Nexus_TransferLeadership_Handler,
+		},
 		{
 			MethodName: "ListNodes",
 			Handler:    _Nexus_ListNodes_Handler,
 		},
+		{
+			MethodName: "CompactLog",
+			Handler:    _Nexus_CompactLog_Handler,
+		},
+		{
+			MethodName: "Snapshot",
+			Handler:    _Nexus_Snapshot_Handler,
+		},
+		{
+			MethodName: "HasApplied",
+			Handler:    _Nexus_HasApplied_Handler,
+		},
+		{
+			MethodName: "Freshness",
+			Handler:    _Nexus_Freshness_Handler,
+		},
+		{
+			MethodName: "Drain",
+			Handler:    _Nexus_Drain_Handler,
+		},
+		{
+			MethodName: "ListInflightOps",
+			Handler:    _Nexus_ListInflightOps_Handler,
+		},
+		{
+			MethodName: "ClusterStatus",
+			Handler:    _Nexus_ClusterStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SaveStream",
+			Handler:       _Nexus_SaveStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "LoadStream",
+			Handler:       _Nexus_LoadStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchTopology",
+			Handler:       _Nexus_WatchTopology_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchCommits",
+			Handler:       _Nexus_WatchCommits_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/api/nexus.proto",
 }
@@ -19,5 +19,9 @@ type Store interface {
 	Load([]byte) ([]byte, error)
 
 	Backup(SnapshotState) (io.ReadCloser, error)
+	// Restore replaces the entire contents of the store with those of
+	// the given snapshot. It must be atomic: on failure, the store must
+	// either be left as it was or be safe to Restore again from scratch,
+	// since Nexus retries failed restores with the same snapshot.
 	Restore(io.ReadCloser) error
 }
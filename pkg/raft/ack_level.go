@@ -0,0 +1,75 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AckLevel controls the point at which a Save is acknowledged to the
+// caller, trading off its latency against the guarantees it offers.
+type AckLevel int
+
+const (
+	// AckAppliedLocal acknowledges a Save once the entry is committed
+	// and applied onto the store of the node it was made on. Reads on
+	// this node observe the write as soon as the Save returns, and any
+	// error raised by the store is returned to the caller. This is the
+	// default level.
+	AckAppliedLocal AckLevel = iota
+	// AckCommitted acknowledges a Save as soon as the entry is known to
+	// be committed, without waiting for it to be applied. This has the
+	// lowest latency and the entry is durable on a majority of the
+	// nodes, but reads even on this node may not observe the write yet.
+	// Errors raised by the store while applying are not returned and
+	// neither is the response of the store.
+	AckCommitted
+	// AckQuorumConfirmed acknowledges a Save once the entry is applied
+	// locally and a subsequent read index, that is a round of heartbeats
+	// from the leader, is acknowledged by a majority, confirming that
+	// the leader is still in charge and the commit is known to a quorum.
+	// This costs an extra round trip over AckAppliedLocal. It does not
+	// guarantee that a quorum has applied the entry, since followers do
+	// not report back the entries they applied.
+	AckQuorumConfirmed
+)
+
+var ackLevelNames = map[AckLevel]string{
+	AckAppliedLocal:    "applied-local",
+	AckCommitted:       "committed",
+	AckQuorumConfirmed: "quorum-confirmed",
+}
+
+func (al AckLevel) String() string {
+	if name, present := ackLevelNames[al]; present {
+		return name
+	}
+	return fmt.Sprintf("AckLevel(%d)", int(al))
+}
+
+func ParseAckLevel(name string) (AckLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for al, alName := range ackLevelNames {
+		if alName == name {
+			return al, nil
+		}
+	}
+	return AckAppliedLocal, fmt.Errorf("unknown ack level: '%s'", name)
+}
+
+type ackLevelKey struct{}
+
+// WithAckLevel returns a child context carrying the given ack level,
+// which the replicator honours before acknowledging a Save.
+func WithAckLevel(ctx context.Context, al AckLevel) context.Context {
+	return context.WithValue(ctx, ackLevelKey{}, al)
+}
+
+// AckLevelFrom returns the ack level carried by the given context,
+// defaulting to AckAppliedLocal when none is present.
+func AckLevelFrom(ctx context.Context) AckLevel {
+	if al, ok := ctx.Value(ackLevelKey{}).(AckLevel); ok {
+		return al
+	}
+	return AckAppliedLocal
+}
@@ -0,0 +1,20 @@
+package raft
+
+import "time"
+
+// AuditRecord describes a single write applied onto the store.
+type AuditRecord struct {
+	RequestId     uint64
+	CorrelationId string
+	Size          int
+	Index         uint64
+	Term          uint64
+	AppliedAt     time.Time
+}
+
+// AuditFunc is invoked with the record of every write applied onto the
+// store, in the order in which they are applied. With ParallelApply,
+// that need not be the order of commit, which is given by the Index of
+// the records. It is called from a dedicated goroutine and not from the
+// apply loop.
+type AuditFunc func(record AuditRecord)
@@ -0,0 +1,81 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// ClusterConfig captures the membership topology of a cluster, as
+// opposed to its data. It can be exported from a running cluster and
+// later used for bootstrapping a new cluster with the same members.
+type ClusterConfig struct {
+	ClusterId uint64          `json:"clusterId"`
+	Members   []ClusterMember `json:"members"`
+}
+
+// ClusterMember describes a single member of the cluster.
+type ClusterMember struct {
+	Id      uint64 `json:"id"`
+	Url     string `json:"url"`
+	Learner bool   `json:"learner,omitempty"`
+}
+
+// Marshal encodes this config into the format understood by
+// ParseClusterConfig.
+func (this *ClusterConfig) Marshal() ([]byte, error) {
+	return json.MarshalIndent(this, "", "  ")
+}
+
+// ParseClusterConfig decodes the config exported from a cluster.
+func ParseClusterConfig(data []byte) (*ClusterConfig, error) {
+	config := new(ClusterConfig)
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if len(config.Members) == 0 {
+		return nil, errors.New("cluster config must have at least one member")
+	}
+	return config, nil
+}
+
+// BootstrapFromConfig reconstructs the peers of a new cluster from the
+// given config, in place of ClusterUrl. Since RAFT can only be started
+// with voters, learners of the original cluster are bootstrapped as
+// voters as well. Member IDs are derived from their URLs as usual and
+// hence match the ones in the config.
+func BootstrapFromConfig(config *ClusterConfig) Option {
+	return func(opts *options) error {
+		if config == nil || len(config.Members) == 0 {
+			return errors.New("cluster config must have at least one member")
+		}
+		urls := make([]string, len(config.Members))
+		for i, member := range config.Members {
+			urls[i] = member.Url
+		}
+		opts.clusterUrls = nil
+		if err := ClusterUrl(strings.Join(urls, ","))(opts); err != nil {
+			return err
+		}
+		clusterUrls := opts.ClusterUrls()
+		for _, member := range config.Members {
+			if _, present := clusterUrls[member.Id]; member.Id != 0 && !present {
+				return errors.New("ID of cluster member does not match its URL: " + member.Url)
+			}
+		}
+		return nil
+	}
+}
+
+func clusterConfigFromFile(path string) Option {
+	return func(opts *options) error {
+		if data, err := ioutil.ReadFile(path); err != nil {
+			return err
+		} else if config, err := ParseClusterConfig(data); err != nil {
+			return err
+		} else {
+			return BootstrapFromConfig(config)(opts)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package raft
+
+// Commit is an entry committed via RAFT and applied onto the store,
+// as streamed to consumers of the committed log. Data has the payloads
+// given to Save in order, more than one for Saves made via SaveBatch.
+type Commit struct {
+	Index uint64
+	Term  uint64
+	Data  [][]byte
+}
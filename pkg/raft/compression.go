@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compression is the codec using which payloads of Saves are compressed
+// before being appended to the RAFT log, and decompressed before being
+// applied onto the store.
+type Compression int
+
+const (
+	// NoCompression appends payloads to the RAFT log as is.
+	NoCompression Compression = iota
+	// GzipCompression compresses payloads using gzip.
+	GzipCompression
+)
+
+var compressionNames = map[Compression]string{
+	NoCompression:   "none",
+	GzipCompression: "gzip",
+}
+
+func (c Compression) String() string {
+	if name, present := compressionNames[c]; present {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+func ParseCompression(name string) (Compression, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for c, cName := range compressionNames {
+		if cName == name {
+			return c, nil
+		}
+	}
+	return NoCompression, fmt.Errorf("unknown compression: '%s'", name)
+}
@@ -0,0 +1,81 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ReadConsistency controls how a Load is served by the replicator.
+type ReadConsistency int
+
+const (
+	// Linearizable reads go through the RAFT ReadIndex protocol and
+	// wait for the local store to catch up before being served.
+	Linearizable ReadConsistency = iota
+	// Stale reads are served directly from the local store of
+	// whichever node receives them.
+	Stale
+	// LeaderOnly reads are served from the local store of the current
+	// leader without a ReadIndex round trip and fail on other nodes.
+	LeaderOnly
+)
+
+var readConsistencyNames = map[ReadConsistency]string{
+	Linearizable: "linearizable",
+	Stale:        "stale",
+	LeaderOnly:   "leader-only",
+}
+
+func (rc ReadConsistency) String() string {
+	if name, present := readConsistencyNames[rc]; present {
+		return name
+	}
+	return fmt.Sprintf("ReadConsistency(%d)", int(rc))
+}
+
+func ParseReadConsistency(name string) (ReadConsistency, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for rc, rcName := range readConsistencyNames {
+		if rcName == name {
+			return rc, nil
+		}
+	}
+	return Linearizable, fmt.Errorf("unknown read consistency: '%s'", name)
+}
+
+type readConsistencyKey struct{}
+
+// WithReadConsistency returns a child context carrying the given read
+// consistency, which the replicator honours while serving a Load.
+func WithReadConsistency(ctx context.Context, rc ReadConsistency) context.Context {
+	return context.WithValue(ctx, readConsistencyKey{}, rc)
+}
+
+// ReadConsistencyFrom returns the read consistency carried by the given
+// context, defaulting to Linearizable when none is present.
+func ReadConsistencyFrom(ctx context.Context) ReadConsistency {
+	if rc, ok := ctx.Value(readConsistencyKey{}).(ReadConsistency); ok {
+		return rc
+	}
+	return Linearizable
+}
+
+type minIndexKey struct{}
+
+// WithMinIndex returns a child context requiring the Load to observe
+// all the entries up to the given RAFT index, irrespective of its read
+// consistency. This gives read-your-writes even for stale reads, when
+// given the index of a prior Save.
+func WithMinIndex(ctx context.Context, index uint64) context.Context {
+	return context.WithValue(ctx, minIndexKey{}, index)
+}
+
+// MinIndexFrom returns the minimum RAFT index carried by the given
+// context, or 0 if none is present.
+func MinIndexFrom(ctx context.Context) uint64 {
+	if index, ok := ctx.Value(minIndexKey{}).(uint64); ok {
+		return index
+	}
+	return 0
+}
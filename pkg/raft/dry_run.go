@@ -0,0 +1,18 @@
+package raft
+
+import "context"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a child context marking the membership change made
+// with it as a dry run. The replicator then validates the change and
+// checks that the node is reachable, without proposing the change.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether the given context marks a dry run.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
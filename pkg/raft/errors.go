@@ -0,0 +1,122 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotLeader        = errors.New("this node is not the current leader")
+	ErrProposalTooLarge = errors.New("proposal exceeds the maximum allowed size")
+	// ErrNoLeader is returned when the cluster has no leader at the
+	// moment, such as before the first election. It is safe to retry.
+	ErrNoLeader = errors.New("no leader in the cluster currently")
+	// ErrApplyLagging is returned when a linearizable read times out
+	// waiting for the store to apply the entries preceding it.
+	ErrApplyLagging = errors.New("store is lagging behind in applying committed entries")
+	// ErrProposalDropped is returned when too many bytes are pending
+	// to be committed and applied. It is safe to retry after a while.
+	ErrProposalDropped = errors.New("too many uncommitted proposals, proposal dropped")
+	// ErrConfChangeInProgress is returned for Saves made during a
+	// membership change, if configured to reject them.
+	ErrConfChangeInProgress = errors.New("membership change in progress")
+	// ErrNoQuorum is returned when a majority of the voters are not
+	// reachable from the leader, in which case membership changes
+	// are refused as they cannot be committed.
+	ErrNoQuorum = errors.New("quorum of voters is not reachable")
+	// ErrUnknownMember is returned when a membership change refers
+	// to a node that is not a member of the cluster.
+	ErrUnknownMember = errors.New("node is not a member of the cluster")
+	// ErrRestoreFailed is returned for Loads made while the store is
+	// being restored again after failing to restore from a snapshot.
+	ErrRestoreFailed = errors.New("store failed to restore from snapshot")
+	// ErrRecovering is returned for Loads made while the store is
+	// being restored from a snapshot, if configured to reject them.
+	ErrRecovering = errors.New("store is being restored from a snapshot")
+	// ErrLeaderChanged is returned for linearizable Loads during which
+	// the leader or its term changed, if configured to verify them.
+	ErrLeaderChanged = errors.New("leadership changed while serving the read")
+	// ErrNodeRemoved is returned for Saves and Loads made on a node
+	// after it has been removed from the cluster.
+	ErrNodeRemoved = errors.New("node has been removed from the cluster")
+	// ErrStopTimeout is returned when the replicator could not be
+	// stopped cleanly within the configured stop timeout.
+	ErrStopTimeout = errors.New("timed out stopping the replicator")
+	// ErrCommitClosed is reported when the RAFT commit channel gets
+	// closed without the replicator being stopped or an error cause.
+	ErrCommitClosed = errors.New("commit channel closed unexpectedly")
+	// ErrShadowMember is returned for Saves and Loads made on a shadow
+	// member, which only replicates and never serves clients.
+	ErrShadowMember = errors.New("shadow member does not serve client requests")
+	// ErrOverloaded is matched by the OverloadedError returned for
+	// Saves rejected while shedding load.
+	ErrOverloaded = errors.New("node is overloaded, saves are being shed")
+	// ErrCompacted is matched by the CompactedError returned when the
+	// committed entries requested are no longer in the RAFT log.
+	ErrCompacted = errors.New("requested entries have been compacted")
+	// ErrShuttingDown is returned for Saves made on a replicator being
+	// stopped, and for requests pending when it stops.
+	ErrShuttingDown = errors.New("replicator is shutting down")
+	// ErrTooManyRequests is returned for requests rejected as too many
+	// of them are in flight, such as Saves beyond the limit set via
+	// WithMaxInflightProposals.
+	ErrTooManyRequests = errors.New("too many requests in flight, retry later")
+	// ErrTimeout is matched by the errors returned by clients for
+	// requests that did not complete within their deadline.
+	ErrTimeout = errors.New("request timed out")
+)
+
+// BatchError is returned by SaveBatch when some of the payloads in
+// the batch fail to be saved. Errs has the error of each payload in
+// the order of the batch, which is nil for the ones saved.
+type BatchError struct {
+	Errs []error
+}
+
+func (this *BatchError) Error() string {
+	failed, first := 0, -1
+	for i, err := range this.Errs {
+		if err != nil {
+			if first < 0 {
+				first = i
+			}
+			failed++
+		}
+	}
+	if first < 0 {
+		return "batch saved without errors"
+	}
+	return fmt.Sprintf("%d of %d batch entries failed, first at %d: %v", failed, len(this.Errs), first, this.Errs[first])
+}
+
+// OverloadedError is returned for Saves rejected as too many Saves are
+// timing out. Clients should retry only after RetryAfter.
+type OverloadedError struct {
+	RetryAfter time.Duration
+}
+
+func (this *OverloadedError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrOverloaded, this.RetryAfter)
+}
+
+func (this *OverloadedError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// CompactedError is returned when the committed entries requested start
+// before FirstIndex, the oldest entry still retained in the RAFT log.
+// Consumers must then re-bootstrap from a snapshot of the store taken at
+// or after SnapshotIndex, and resume from the entry following it.
+type CompactedError struct {
+	FirstIndex    uint64
+	SnapshotIndex uint64
+}
+
+func (this *CompactedError) Error() string {
+	return fmt.Sprintf("%v, entries are retained from index %d, re-bootstrap from a snapshot at index %d or later", ErrCompacted, this.FirstIndex, this.SnapshotIndex)
+}
+
+func (this *CompactedError) Unwrap() error {
+	return ErrCompacted
+}
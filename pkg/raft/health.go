@@ -0,0 +1,22 @@
+package raft
+
+// Health describes the state of a node, using which its liveness and
+// readiness to serve requests can be determined.
+type Health struct {
+	// Alive is set as long as the RAFT event loop of the node is
+	// running, irrespective of whether the cluster has a leader.
+	Alive bool
+	// Leader is the ID of the current leader, or 0 if there is none.
+	Leader uint64
+	// CommitIndex is the commit index known to the node.
+	CommitIndex uint64
+	// AppliedIndex is the index up to which the node has applied
+	// the committed entries onto its store.
+	AppliedIndex uint64
+	// Shadow is set if the node is a shadow member, which never
+	// serves client requests and hence is never ready.
+	Shadow bool
+	// Connected is set if the node is connected over the transport to
+	// the leader, or to a quorum of the voters if it is the leader.
+	Connected bool
+}
@@ -0,0 +1,29 @@
+package raft
+
+import "time"
+
+// OpType identifies the kind of an operation in flight.
+type OpType string
+
+const (
+	// OpSave is a Save waiting on its entry to be committed or applied.
+	OpSave OpType = "save"
+	// OpLoad is a linearizable Load waiting on its read index.
+	OpLoad OpType = "load"
+	// OpApplyWait is a Load waiting on the store to apply the entries
+	// preceding it.
+	OpApplyWait OpType = "apply_wait"
+	// OpConfChange is a membership change waiting to be applied.
+	OpConfChange OpType = "confchange"
+)
+
+// InflightOp describes an operation that is waiting to be served,
+// meant for finding out what is stuck while debugging.
+type InflightOp struct {
+	Id   uint64
+	Type OpType
+	Age  time.Duration
+	// Deadline is the deadline of the context of the operation,
+	// or the zero time if it has none.
+	Deadline time.Time
+}
@@ -0,0 +1,21 @@
+package raft
+
+import "context"
+
+type leaderRequiredKey struct{}
+
+// WithLeaderRequired returns a child context requiring the Save made
+// with it to be proposed by the leader itself. Elsewhere, the Save then
+// fails fast with ErrNotLeader, or ErrNoLeader if no leader is known,
+// instead of being forwarded to the leader by RAFT, so that the caller
+// may retry it on the leader.
+func WithLeaderRequired(ctx context.Context) context.Context {
+	return context.WithValue(ctx, leaderRequiredKey{}, true)
+}
+
+// IsLeaderRequired reports whether the given context requires the
+// Save made with it to be proposed by the leader.
+func IsLeaderRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(leaderRequiredKey{}).(bool)
+	return required
+}
@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel is the minimum severity of the messages that are logged.
+type LogLevel int32
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var logLevelNames = map[LogLevel]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (ll LogLevel) String() string {
+	if name, present := logLevelNames[ll]; present {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(ll))
+}
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for ll, llName := range logLevelNames {
+		if llName == name {
+			return ll, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level: '%s'", name)
+}
@@ -0,0 +1,39 @@
+package raft
+
+import "log"
+
+// Logger receives the logs of the replicator, so that they can be
+// integrated with the logging pipeline of the embedding application.
+// Its methods match those of zap.SugaredLogger. Fatalf must not return.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+	Fatalf(format string, v ...interface{})
+}
+
+// StdLogger is the Logger used by default, which writes to the
+// standard library logger with the level as a prefix, except for
+// informational logs.
+type StdLogger struct{}
+
+func (StdLogger) Debugf(format string, v ...interface{}) {
+	log.Printf("[DEBUG] "+format, v...)
+}
+
+func (StdLogger) Infof(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (StdLogger) Warnf(format string, v ...interface{}) {
+	log.Printf("[WARN] "+format, v...)
+}
+
+func (StdLogger) Errorf(format string, v ...interface{}) {
+	log.Printf("[ERROR] "+format, v...)
+}
+
+func (StdLogger) Fatalf(format string, v ...interface{}) {
+	log.Fatalf(format, v...)
+}
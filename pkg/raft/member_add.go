@@ -0,0 +1,30 @@
+package raft
+
+// MemberAddState is the state of a member addition that is yet to
+// complete. Additions are throttled so that new members catch up with
+// the leader a few at a time.
+type MemberAddState int
+
+const (
+	// MemberAddQueued implies the addition is waiting for the
+	// ones in progress to complete.
+	MemberAddQueued MemberAddState = iota
+	// MemberAddInProgress implies the member has been added or is
+	// being added, and is catching up with the leader.
+	MemberAddInProgress
+)
+
+func (this MemberAddState) String() string {
+	switch this {
+	case MemberAddQueued:
+		return "queued"
+	case MemberAddInProgress:
+		return "in-progress"
+	default:
+		return "unknown"
+	}
+}
+
+func (this MemberAddState) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
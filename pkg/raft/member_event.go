@@ -0,0 +1,29 @@
+package raft
+
+type MemberEventType int
+
+const (
+	MemberOffline MemberEventType = iota
+	MemberOnline
+)
+
+func (this MemberEventType) String() string {
+	switch this {
+	case MemberOffline:
+		return "MemberOffline"
+	case MemberOnline:
+		return "MemberOnline"
+	default:
+		return "Unknown"
+	}
+}
+
+// MemberEvent is a change in the connectivity of a node to one of its
+// peers. MemberOffline is sent once the peer has been unreachable for
+// longer than the offline grace period, and MemberOnline once it is
+// reachable again.
+type MemberEvent struct {
+	Type    MemberEventType
+	NodeId  uint64
+	NodeUrl string
+}
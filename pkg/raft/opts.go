@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/coreos/etcd/raft"
+	"github.com/flipkart-incubator/nexus/pkg/db"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -26,55 +29,186 @@ const (
 	defaultRaftReplTimeout = 5
 	defaultMaxWAL          = 5
 	defaultMaxSNAP         = 5
+
+	defaultCompressionThreshold = 1024
+
+	defaultHeartbeatTick = 1
+	defaultElectionTick  = 10
+	defaultTickInterval  = 100 * time.Millisecond
+
+	// defaultConfChangeTimeout is the minimum time membership changes
+	// are given by default, as they take longer than Saves.
+	defaultConfChangeTimeout = 30 * time.Second
 )
 
 type Option func(*options) error
 
+// ApplyFunc is invoked with the RAFT entry and the data of each
+// request committed by the cluster, in the order of commit. It is
+// called from the apply loop and hence must return quickly.
+type ApplyFunc func(entry db.RaftEntry, data []byte)
+
+// PartitionFunc maps the data of a request to the partition of the
+// store it belongs to. Requests of different partitions must be
+// independent of each other, as they may get applied concurrently.
+type PartitionFunc func(data []byte) uint64
+
+// CommitClosedFunc is invoked with the cause of the RAFT commit channel
+// getting closed while the replicator has not been stopped, after which
+// no more requests get applied on this node.
+type CommitClosedFunc func(err error)
+
 type Options interface {
 	NodeId() uint64
 	NodeUrl() *url.URL
 	Join() bool
 	LogDir() string
 	SnapDir() string
+	DBSnapDir() string
+	JoinSnapshot() string
+	SnapshotStore() SnapshotStore
 	ClusterUrls() map[uint64]string
 	ClusterId() uint64
+	GroupId() uint64
 	ReplTimeout() time.Duration
 	ReadOption() raft.ReadOnlyOption
 	StatsDAddr() string
+	PrometheusRegisterer() prometheus.Registerer
 	MaxSnapFiles() uint
 	MaxWALFiles() uint
 	SnapshotCount() uint64
 	SnapshotCatchUpEntries() uint64
+	MinSnapshotInterval() time.Duration
+	OfflineGracePeriod() time.Duration
+	DebugServerAddr() string
+	ExpvarNamespace() string
+	ServiceAddr() string
+	MaxProposalSize() int
+	DisableElection() bool
+	PreVote() bool
+	HeartbeatTick() int
+	ElectionTick() int
+	TickInterval() time.Duration
+	TermMismatchPolicy() TermMismatchPolicy
+	LogOnly() bool
+	PanicOnRestoreFailure() bool
+	RejectLoadsWhileRestoring() bool
+	VerifyLeaderOnRead() bool
+	DeterminismCheckInterval() uint64
+	PayloadCompression() (Compression, int)
+	OnApply() ApplyFunc
+	OnCommitClosed() CommitClosedFunc
+	ApplyWorkers() int
+	PartitionFunc() PartitionFunc
+	ApplyWaitTimeout() time.Duration
+	ReachabilityTimeout() time.Duration
+	MaxInMemLogEntries() uint64
+	StopTimeout() time.Duration
+	ConfChangeTimeout() time.Duration
+	MaxUncommittedSize() int64
+	RejectSavesDuringConfChange() bool
+	MaxConcurrentMemberAdds() int
+	ShadowMembers() bool
+	MaxInflightProposals() int
+	RejectOverInflightLimit() bool
+	LoadShedding() (int, time.Duration)
+	Auditor() (AuditFunc, int)
+	Logger() Logger
 }
 
 type options struct {
 	nodeUrl                *url.URL
 	nodeUrlStr             string
+	nodeId                 uint64
+	nodeIds                map[string]uint64
 	logDir                 string
 	snapDir                string
+	dbSnapDir              string
+	joinSnapshot           string
+	snapshotStore          SnapshotStore
 	clusterUrl             string
 	clusterName            string
+	groupId                uint64
 	clusterUrls            []*url.URL
 	replTimeout            time.Duration
 	leaseBasedReads        bool
 	statsdAddr             string
+	promRegisterer         prometheus.Registerer
 	maxSnapFiles           int
 	maxWALFiles            int
 	snapshotCount          int64
 	snapshotCatchUpEntries int64
+	minSnapInterval        time.Duration
+	offlineGracePeriod     time.Duration
+	debugServerAddr        string
+	expvarNamespace        string
+	serviceAddr            string
+	maxProposalSize        int
+	disableElection        bool
+	noPreVote              bool
+	heartbeatTick          int
+	electionTick           int
+	tickInterval           time.Duration
+	termMismatchPolicy     TermMismatchPolicy
+	logOnly                bool
+	panicOnRestoreFailure  bool
+	rejectRestoringLoads   bool
+	verifyLeaderOnRead     bool
+	determinismInterval    uint64
+	compression            Compression
+	compressionThreshold   int
+	onApply                ApplyFunc
+	onCommitClosed         CommitClosedFunc
+	applyWorkers           int
+	partitionFunc          PartitionFunc
+	applyWaitTimeout       time.Duration
+	reachabilityTimeout    time.Duration
+	maxInMemLogEntries     int64
+	stopTimeout            time.Duration
+	confChangeTimeout      time.Duration
+	maxUncommittedSize     int64
+	rejectConfChangeSaves  bool
+	maxMemberAdds          int
+	shadowMembers          bool
+	maxInflightProposals   int
+	rejectOverInflight     bool
+	shedLoadTimeouts       int
+	shedLoadWindow         time.Duration
+	auditFunc              AuditFunc
+	auditQueueSize         int
+	logger                 Logger
 }
 
 var (
-	opts              options
-	replTimeoutInSecs int64
+	opts                     options
+	replTimeoutInSecs        int64
+	offlineGracePeriodInSecs int64
+	termMismatchPolicyName   string
+	compressionName          string
+	applyWaitTimeoutInMillis int64
+	reachabilityTimeoutInMs  int64
+	stopTimeoutInSecs        int64
+	confChangeTimeoutInSecs  int64
+	minSnapIntervalInSecs    int64
+	shedLoadWindowInMillis   int64
+	clusterConfigFile        string
+	snapshotStoreDir         string
+	preVote                  bool
+	tickIntervalInMillis     int64
 )
 
 func init() {
 	flag.StringVar(&opts.nodeUrlStr, "nexus-node-url", "", "Url for the Nexus service to be started on this node (format: http://<local_node>:<port_num>)")
 	flag.StringVar(&opts.logDir, "nexus-log-dir", "/tmp/logs", "Dir for storing RAFT logs")
 	flag.StringVar(&opts.snapDir, "nexus-snap-dir", "/tmp/snap", "Dir for storing RAFT snapshots")
-	flag.StringVar(&opts.clusterUrl, "nexus-cluster-url", "", "Comma separated list of Nexus URLs of other nodes in the cluster")
+	flag.StringVar(&opts.dbSnapDir, "nexus-db-snap-dir", "", "Dir for storing DB snapshots received from the leader (defaults to nexus-snap-dir)")
+	flag.StringVar(&opts.joinSnapshot, "nexus-join-snapshot", "", "Snapshot file copied from an existing member, to seed this node from when it joins the cluster")
+	flag.StringVar(&snapshotStoreDir, "nexus-snapshot-store-dir", "", "Dir, such as on a network mounted volume, to also keep the RAFT snapshots in for seeding this node when it joins afresh (disabled if empty)")
+	flag.Uint64Var(&opts.nodeId, "nexus-node-id", 0, "Explicit ID of this node, in place of the one derived from nexus-node-url (0 derives it from the URL)")
+	flag.StringVar(&opts.clusterUrl, "nexus-cluster-url", "", "Comma separated list of Nexus URLs of other nodes in the cluster, each optionally prefixed with its explicit ID (format: <id>=http://<node>:<port_num>)")
+	flag.StringVar(&clusterConfigFile, "nexus-cluster-config-file", "", "File containing the cluster config exported from another cluster, to bootstrap the peers from (overrides nexus-cluster-url)")
 	flag.StringVar(&opts.clusterName, "nexus-cluster-name", "", "Unique name of this Nexus cluster")
+	flag.Uint64Var(&opts.groupId, "nexus-group-id", 0, "ID of the RAFT group served by this replicator, sharing nexus-node-url with the other groups of this process (0 serves a single group)")
 	flag.Int64Var(&replTimeoutInSecs, "nexus-repl-timeout", defaultRaftReplTimeout, "Replication timeout in seconds")
 	flag.BoolVar(&opts.leaseBasedReads, "nexus-lease-based-reads", true, "Perform reads using RAFT leader leases")
 	flag.StringVar(&opts.statsdAddr, "nexus-statsd-addr", "", "StatsD server address (host:port) for relaying various metrics")
@@ -82,23 +216,93 @@ func init() {
 	flag.IntVar(&opts.maxSnapFiles, "nexus-max-snapshots", defaultMaxSNAP, "Maximum number of snapshot files to retain (0 is unlimited)")
 	flag.IntVar(&opts.maxWALFiles, "nexus-max-wals", defaultMaxWAL, "Maximum number of wal files to retain (0 is unlimited)")
 	flag.Int64Var(&opts.snapshotCount, "nexus-snapshot-count", defaultSnapshotCount, "Number of committed transactions to trigger a snapshot to disk. (default 10K)")
+	flag.Int64Var(&minSnapIntervalInSecs, "nexus-min-snapshot-interval", 0, "Minimum duration in seconds between snapshots, even if nexus-snapshot-count is reached (0 disables)")
 	flag.Int64Var(&opts.snapshotCatchUpEntries, "nexus-snapshot-catchup-entries", defaultSnapshotCatchUpEntries, "Number of entries for a slow follower to catch-up after compacting the raft storage entries (Default 5K)")
+	flag.Int64Var(&opts.maxInMemLogEntries, "nexus-max-inmem-log-entries", 0, "Maximum number of RAFT log entries to retain in memory before forcing a snapshot (0 is unlimited)")
+	flag.StringVar(&termMismatchPolicyName, "nexus-term-mismatch-policy", HaltOnMismatch.String(), "Action when the store and RAFT log disagree on the last applied entry during startup (halt|trust-raft)")
+	flag.Int64Var(&confChangeTimeoutInSecs, "nexus-conf-change-timeout", 0, "Timeout in seconds for membership changes (0 uses the larger of 30 seconds and the replication timeout)")
+	flag.Int64Var(&stopTimeoutInSecs, "nexus-stop-timeout", 0, "Timeout in seconds for the store to close during shutdown (0 waits indefinitely)")
+	flag.Int64Var(&applyWaitTimeoutInMillis, "nexus-apply-wait-timeout-ms", 0, "Timeout in milliseconds for linearizable reads to wait on the store to catch up (0 uses the replication timeout)")
+	flag.Int64Var(&reachabilityTimeoutInMs, "nexus-reachability-timeout-ms", 0, "Timeout in milliseconds for checking that a node being added is reachable (0 uses the deadline of the membership change)")
+	flag.BoolVar(&opts.logOnly, "nexus-log-only", false, "Replicate requests via RAFT without applying them onto the store")
+	flag.BoolVar(&opts.panicOnRestoreFailure, "nexus-panic-on-restore-failure", false, "Crash instead of retrying when the store fails to restore from a snapshot")
+	flag.BoolVar(&opts.rejectRestoringLoads, "nexus-reject-loads-while-restoring", false, "Reject loads made on this node while its store is being restored from a snapshot")
+	flag.BoolVar(&opts.verifyLeaderOnRead, "nexus-verify-leader-on-read", false, "Reject linearizable loads if the RAFT leader or term changed while serving them")
+	flag.StringVar(&compressionName, "nexus-compression", NoCompression.String(), "Codec for compressing Save payloads in the RAFT log (none|gzip)")
+	flag.IntVar(&opts.compressionThreshold, "nexus-compression-threshold", defaultCompressionThreshold, "Minimum size in bytes of Save payloads to be compressed")
+	flag.Uint64Var(&opts.determinismInterval, "nexus-determinism-check-interval", 0, "Number of entries after which replicas compare digests of the results of applying them onto the store (0 disables)")
+	flag.BoolVar(&opts.rejectConfChangeSaves, "nexus-reject-saves-during-conf-change", false, "Reject saves made on this node while a membership change proposed from it is in progress")
+	flag.IntVar(&opts.maxMemberAdds, "nexus-max-concurrent-member-adds", 1, "Maximum number of members that can be added and catching up with the leader at once")
+	flag.BoolVar(&opts.shadowMembers, "nexus-enable-shadow-members", false, "Allow adding shadow members via this node, once every member of the cluster supports them")
+	flag.BoolVar(&opts.disableElection, "nexus-disable-election", false, "Prevent this node from ever campaigning for RAFT leadership (useful while draining a node)")
+	flag.BoolVar(&preVote, "nexus-pre-vote", true, "Run a pre-vote before campaigning, so that a node rejoining after a partition does not disrupt the leader")
+	flag.IntVar(&opts.heartbeatTick, "nexus-heartbeat-tick", defaultHeartbeatTick, "Number of ticks between heartbeats sent by the RAFT leader")
+	flag.IntVar(&opts.electionTick, "nexus-election-tick", defaultElectionTick, "Number of ticks without hearing from the RAFT leader after which a follower campaigns (must exceed nexus-heartbeat-tick)")
+	flag.Int64Var(&tickIntervalInMillis, "nexus-tick-interval-ms", int64(defaultTickInterval/time.Millisecond), "Duration in milliseconds of a single RAFT tick")
+	flag.Int64Var(&opts.maxUncommittedSize, "nexus-max-uncommitted-size", 0, "Maximum size in bytes of proposals pending to be applied, beyond which new proposals are rejected (0 is unlimited)")
+	flag.IntVar(&opts.shedLoadTimeouts, "nexus-shed-load-timeouts", 0, "Number of Saves timing out within nexus-shed-load-window-ms, beyond which Saves are rejected for that window (0 disables load shedding)")
+	flag.Int64Var(&shedLoadWindowInMillis, "nexus-shed-load-window-ms", 1000, "Window in milliseconds for counting Save timeouts, which is also the duration for which Saves are rejected")
+	flag.IntVar(&opts.maxInflightProposals, "nexus-max-inflight-proposals", 0, "Maximum number of Saves proposed from this node and yet to be applied, beyond which Saves wait and get admitted by priority (0 is unlimited)")
+	flag.BoolVar(&opts.rejectOverInflight, "nexus-reject-over-inflight-limit", false, "Reject Saves beyond nexus-max-inflight-proposals with ErrTooManyRequests instead of making them wait")
+	flag.IntVar(&opts.maxProposalSize, "nexus-max-proposal-size", 0, "Maximum size in bytes of a single proposal to RAFT (0 is unlimited)")
+	flag.StringVar(&opts.debugServerAddr, "nexus-debug-addr", "", "Address (host:port) for serving pprof and RAFT debug endpoints (disabled if empty)")
+	flag.StringVar(&opts.expvarNamespace, "nexus-expvar-namespace", "", "Key under which the RAFT metrics are published via expvar (disabled if empty)")
+	flag.StringVar(&opts.serviceAddr, "nexus-service-addr", "", "Address (host:port) of the gRPC service of this node, advertised to the other members for clients to connect to (not advertised if empty)")
+	flag.Int64Var(&offlineGracePeriodInSecs, "nexus-offline-grace-period", 0, "Duration in seconds for which an unreachable peer is reported as SUSPECT before being marked OFFLINE (0 disables)")
 }
 
 func OptionsFromFlags() []Option {
+	clusterOpt := ClusterUrl(opts.clusterUrl)
+	if clusterConfigFile != "" {
+		clusterOpt = clusterConfigFromFile(clusterConfigFile)
+	}
 	return []Option{
 		LogDir(opts.logDir),
 		SnapDir(opts.snapDir),
-		ClusterUrl(opts.clusterUrl),
+		DBSnapDir(opts.dbSnapDir),
+		JoinFromSnapshot(opts.joinSnapshot),
+		snapshotStoreFromDir(snapshotStoreDir),
+		clusterOpt,
 		NodeUrl(opts.nodeUrlStr),
+		nodeIdFromFlag(opts.nodeId),
 		ReplicationTimeout(time.Duration(replTimeoutInSecs) * time.Second),
 		LeaseBasedReads(opts.leaseBasedReads),
 		StatsDAddr(opts.statsdAddr),
 		MaxSnapFiles(opts.maxSnapFiles),
 		MaxWALFiles(opts.maxWALFiles),
 		SnapshotCount(opts.snapshotCount),
+		MinSnapshotInterval(time.Duration(minSnapIntervalInSecs) * time.Second),
 		SnapshotCatchUpEntries(opts.snapshotCatchUpEntries),
+		MaxInMemLogEntries(opts.maxInMemLogEntries),
 		ClusterName(opts.clusterName),
+		GroupId(opts.groupId),
+		OfflineGracePeriod(time.Duration(offlineGracePeriodInSecs) * time.Second),
+		EnableDebugServer(opts.debugServerAddr),
+		PublishExpvar(opts.expvarNamespace),
+		ServiceAddr(opts.serviceAddr),
+		MaxProposalSize(opts.maxProposalSize),
+		inflightLimitFromFlags(opts.maxInflightProposals, opts.rejectOverInflight),
+		MaxUncommittedSize(opts.maxUncommittedSize),
+		ShedLoadOnTimeouts(opts.shedLoadTimeouts, time.Duration(shedLoadWindowInMillis)*time.Millisecond),
+		DisableElection(opts.disableElection),
+		WithPreVote(preVote),
+		WithHeartbeatTick(opts.heartbeatTick),
+		WithElectionTick(opts.electionTick),
+		WithTickInterval(time.Duration(tickIntervalInMillis) * time.Millisecond),
+		RejectSavesDuringConfChange(opts.rejectConfChangeSaves),
+		MaxConcurrentMemberAdds(opts.maxMemberAdds),
+		EnableShadowMembers(opts.shadowMembers),
+		termMismatchPolicyFromName(termMismatchPolicyName),
+		LogOnly(opts.logOnly),
+		PanicOnRestoreFailure(opts.panicOnRestoreFailure),
+		RejectLoadsWhileRestoring(opts.rejectRestoringLoads),
+		VerifyLeaderOnRead(opts.verifyLeaderOnRead),
+		VerifyDeterminism(opts.determinismInterval),
+		compressionFromName(compressionName, opts.compressionThreshold),
+		ApplyWaitTimeout(time.Duration(applyWaitTimeoutInMillis) * time.Millisecond),
+		ReachabilityTimeout(time.Duration(reachabilityTimeoutInMs) * time.Millisecond),
+		StopTimeout(time.Duration(stopTimeoutInSecs) * time.Second),
+		ConfChangeTimeout(time.Duration(confChangeTimeoutInSecs) * time.Second),
 	}
 }
 
@@ -109,11 +313,59 @@ func NewOptions(opts ...Option) (Options, error) {
 			return nil, err
 		}
 	}
+	if err := options.validateNodeIds(); err != nil {
+		return nil, err
+	}
+	if options.ElectionTick() <= options.HeartbeatTick() {
+		return nil, fmt.Errorf("election tick %d must be greater than heartbeat tick %d", options.ElectionTick(), options.HeartbeatTick())
+	}
 	return options, nil
 }
 
 func (this *options) NodeId() uint64 {
-	return this.hash(this.nodeUrl.Host)
+	if this.nodeId != 0 {
+		return this.nodeId
+	}
+	return this.idOf(this.nodeUrl.Host)
+}
+
+// idOf returns the ID of the node listening at the given host, which is
+// the one given explicitly along with its URL, if any, or else the one
+// derived from the host itself.
+func (this *options) idOf(host string) uint64 {
+	if id, present := this.nodeIds[host]; present {
+		return id
+	}
+	return this.hash(host)
+}
+
+// validateNodeIds ensures that no two nodes of the cluster end up with
+// the same ID, and that the explicit ID of this node, if any, agrees
+// with the one it is listed with in the cluster URLs.
+func (this *options) validateNodeIds() error {
+	hosts := make(map[uint64]string, len(this.clusterUrls))
+	for _, nodeUrl := range this.clusterUrls {
+		id := this.idOf(nodeUrl.Host)
+		if host, present := hosts[id]; present && host != nodeUrl.Host {
+			return fmt.Errorf("nodes at %s and %s have the same ID: %d", host, nodeUrl.Host, id)
+		}
+		hosts[id] = nodeUrl.Host
+	}
+	if this.nodeId == 0 || this.nodeUrl == nil {
+		return nil
+	}
+	host := this.nodeUrl.Host
+	if id, present := this.nodeIds[host]; present {
+		if id != this.nodeId {
+			return fmt.Errorf("node ID %d does not match the ID %d given with its URL", this.nodeId, id)
+		}
+	} else if hosts[this.hash(host)] == host {
+		return fmt.Errorf("node ID %d must also be given with the URL of this node in the cluster URLs", this.nodeId)
+	}
+	if other, present := hosts[this.nodeId]; present && other != host {
+		return fmt.Errorf("node ID %d is already used by the node at %s", this.nodeId, other)
+	}
+	return nil
 }
 
 func (this *options) hash(url string) uint64 {
@@ -130,18 +382,38 @@ func (this *options) Join() bool {
 	return !present
 }
 
+// nodeDir returns the dir of this node under the given one, which is
+// further scoped by the RAFT group, if any.
+func (this *options) nodeDir(dir string) string {
+	if this.groupId != 0 {
+		return fmt.Sprintf("%s/node_%d/group_%d", dir, this.NodeId(), this.groupId)
+	}
+	return fmt.Sprintf("%s/node_%d", dir, this.NodeId())
+}
+
 func (this *options) LogDir() string {
-	return fmt.Sprintf("%s/node_%d", this.logDir, this.NodeId())
+	return this.nodeDir(this.logDir)
 }
 
 func (this *options) SnapDir() string {
-	return fmt.Sprintf("%s/node_%d", this.snapDir, this.NodeId())
+	return this.nodeDir(this.snapDir)
+}
+
+func (this *options) DBSnapDir() string {
+	if this.dbSnapDir == "" {
+		return this.SnapDir()
+	}
+	return this.nodeDir(this.dbSnapDir)
+}
+
+func (this *options) JoinSnapshot() string {
+	return this.joinSnapshot
 }
 
 func (this *options) ClusterUrls() map[uint64]string {
 	res := make(map[uint64]string, len(this.clusterUrls))
 	for _, nodeUrl := range this.clusterUrls {
-		id := this.hash(nodeUrl.Host)
+		id := this.idOf(nodeUrl.Host)
 		res[id] = nodeUrl.String()
 	}
 	return res
@@ -199,6 +471,41 @@ func validateAndParseAddress(addr string) (*url.URL, error) {
 	}
 }
 
+// parseNodeAddr parses the given node address, which is its URL
+// optionally prefixed with an explicit ID of the node, as in
+// 1=http://host:port. The returned ID is 0 if none is given.
+func parseNodeAddr(addr string) (uint64, *url.URL, error) {
+	var id uint64
+	if i := strings.IndexRune(addr, '='); i >= 0 && !strings.Contains(addr[:i], "://") {
+		var err error
+		if id, err = strconv.ParseUint(strings.TrimSpace(addr[:i]), 10, 64); err != nil {
+			return 0, nil, fmt.Errorf("given node ID, %s is not a valid number", addr[:i])
+		}
+		if id == 0 {
+			return 0, nil, errors.New("Node ID must be non-zero")
+		}
+		addr = strings.TrimSpace(addr[i+1:])
+	}
+	nodeUrl, err := validateAndParseAddress(addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, nodeUrl, nil
+}
+
+// setNodeId records the explicit ID given for the node at the given URL.
+func (this *options) setNodeId(nodeUrl *url.URL, id uint64) {
+	if id == 0 {
+		return
+	}
+	if this.nodeIds == nil {
+		this.nodeIds = make(map[string]uint64)
+	}
+	this.nodeIds[nodeUrl.Host] = id
+}
+
+// NodeUrl sets the URL of this node, optionally prefixed with an
+// explicit ID of the node as in 1=http://host:port.
 func NodeUrl(addr string) Option {
 	return func(opts *options) error {
 		addr = strings.TrimSpace(addr)
@@ -217,15 +524,41 @@ func NodeUrl(addr string) Option {
 			}
 			return errors.New("nexus listen address not provided & auto detection failed")
 		}
-		if nodeUrl, err := validateAndParseAddress(addr); err != nil {
+		if id, nodeUrl, err := parseNodeAddr(addr); err != nil {
 			return err
 		} else {
 			opts.nodeUrl = nodeUrl
+			opts.setNodeId(nodeUrl, id)
+		}
+		return nil
+	}
+}
+
+// NodeId sets an explicit ID for this node, in place of the one derived
+// from its URL. Since every node must know the IDs of its peers, the
+// same ID must also be given along with the URL of this node in the
+// cluster URLs, as in 1=http://host:port, and with the URL passed for
+// adding this node to an existing cluster. The ID must be non-zero and
+// unique within the cluster.
+func NodeId(id uint64) Option {
+	return func(opts *options) error {
+		if id == 0 {
+			return errors.New("Node ID must be non-zero")
 		}
+		opts.nodeId = id
 		return nil
 	}
 }
 
+func nodeIdFromFlag(id uint64) Option {
+	return func(opts *options) error {
+		if id == 0 {
+			return nil
+		}
+		return NodeId(id)(opts)
+	}
+}
+
 func LogDir(dir string) Option {
 	return func(opts *options) error {
 		dir = strings.TrimSpace(dir)
@@ -248,6 +581,61 @@ func SnapDir(dir string) Option {
 	}
 }
 
+// DBSnapDir sets the dir for storing the DB snapshots received from the
+// leader, such as for co-locating them with the data of the store. By
+// default, they are stored along with the RAFT snapshots in SnapDir.
+func DBSnapDir(dir string) Option {
+	return func(opts *options) error {
+		opts.dbSnapDir = strings.TrimSpace(dir)
+		return nil
+	}
+}
+
+// JoinFromSnapshot seeds a joining node from the given snapshot file,
+// typically copied over from the snap dir of an existing member. The
+// node then starts from the index of this snapshot, so that the leader
+// only ships the entries after it instead of its entire state. It is
+// ignored if the node is not joining or already has a WAL.
+func JoinFromSnapshot(path string) Option {
+	return func(opts *options) error {
+		opts.joinSnapshot = strings.TrimSpace(path)
+		return nil
+	}
+}
+
+func (this *options) SnapshotStore() SnapshotStore {
+	return this.snapshotStore
+}
+
+// WithSnapshotStore makes this node copy every RAFT snapshot it takes
+// or receives onto the given backend, retaining as many of them there
+// as MaxSnapFiles. A node joining the cluster without a WAL, such as
+// one added back after losing its disk, is seeded from the latest
+// snapshot on the backend, unless given a snapshot to join from. Nodes
+// not joining are never seeded, since that would lose their RAFT hard
+// state. Snapshots are still kept on the local disk, from where they
+// are shipped to the other nodes, and copied onto the backend in the
+// background.
+func WithSnapshotStore(store SnapshotStore) Option {
+	return func(opts *options) error {
+		opts.snapshotStore = store
+		return nil
+	}
+}
+
+func snapshotStoreFromDir(dir string) Option {
+	return func(opts *options) error {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			return nil
+		}
+		store, err := NewFileSnapshotStore(dir)
+		if err != nil {
+			return err
+		}
+		return WithSnapshotStore(store)(opts)
+	}
+}
+
 func ClusterUrl(url string) Option {
 	return func(opts *options) error {
 		url = strings.TrimSpace(url)
@@ -257,10 +645,11 @@ func ClusterUrl(url string) Option {
 		opts.clusterUrl = url
 		nodes := strings.Split(opts.clusterUrl, ",")
 		for _, node := range nodes {
-			if nodeUrl, err := validateAndParseAddress(node); err != nil {
+			if id, nodeUrl, err := parseNodeAddr(strings.TrimSpace(node)); err != nil {
 				return err
 			} else {
 				opts.clusterUrls = append(opts.clusterUrls, nodeUrl)
+				opts.setNodeId(nodeUrl, id)
 			}
 		}
 		return nil
@@ -293,6 +682,24 @@ func StatsDAddr(statsdAddr string) Option {
 	}
 }
 
+func (this *options) PrometheusRegisterer() prometheus.Registerer {
+	return this.promRegisterer
+}
+
+// PrometheusMetrics publishes the metrics of the replicator to Prometheus
+// via the given registerer, instead of to StatsD. The metric names, such
+// as "save.latency.ms", are kept as label values so that dashboards can
+// be ported across both.
+func PrometheusMetrics(reg prometheus.Registerer) Option {
+	return func(opts *options) error {
+		if reg == nil {
+			return errors.New("prometheus registerer must not be nil")
+		}
+		opts.promRegisterer = reg
+		return nil
+	}
+}
+
 func (this *options) MaxSnapFiles() uint {
 	return uint(this.maxSnapFiles)
 }
@@ -309,6 +716,13 @@ func (this *options) SnapshotCatchUpEntries() uint64 {
 	return uint64(this.snapshotCatchUpEntries)
 }
 
+// MaxSnapFiles sets the number of the latest snapshots retained on
+// disk, beyond which older ones are purged periodically. This applies
+// to both the RAFT snapshots and the DB snapshots alongside them. Zero
+// retains all of them. Lagging followers are always sent the latest
+// snapshot, and entries preceding it are retained only up to
+// SnapshotCatchUpEntries, hence older snapshots only help in manually
+// recovering a node to an earlier state.
 func MaxSnapFiles(count int) Option {
 	return func(opts *options) error {
 		if count < 0 {
@@ -319,6 +733,11 @@ func MaxSnapFiles(count int) Option {
 	}
 }
 
+// MaxWALFiles sets the number of the latest WAL files retained on disk,
+// beyond which older ones are purged periodically. Zero retains all of
+// them. A WAL file is purged only once it is no longer needed for
+// replaying the entries after the latest snapshot, hence retaining
+// fewer snapshots and snapshotting more often frees up more disk.
 func MaxWALFiles(count int) Option {
 	return func(opts *options) error {
 		if count < 0 {
@@ -350,15 +769,737 @@ func SnapshotCatchUpEntries(count int64) Option {
 }
 
 func (this *options) ClusterId() uint64 {
+	if this.groupId != 0 {
+		// distinct for every group, so that the groups sharing
+		// a listener can tell apart the messages of each other
+		return this.hash(fmt.Sprintf("%s/group_%d", this.clusterName, this.groupId))
+	}
 	if this.clusterName == "" {
 		return 0
 	}
 	return this.hash(this.clusterName)
 }
 
+func (this *options) GroupId() uint64 {
+	return this.groupId
+}
+
+// GroupId sets the ID of the RAFT group served by the replicator, for
+// hosting several independent groups in the same process. Replicators
+// of different groups can use the same NodeUrl, in which case they share
+// its listener, and keep their logs and snapshots in the same dirs, in
+// which case they get a sub dir per group. All the members of a group
+// must use the same ID, and each group must be given its own
+// SnapshotStore, if any. Metrics are tagged with the group ID, so the
+// groups can share a Prometheus registerer. A value of 0 implies a
+// single group, which does not share its listener.
+func GroupId(id uint64) Option {
+	return func(opts *options) error {
+		opts.groupId = id
+		return nil
+	}
+}
+
 func ClusterName(name string) Option {
 	return func(opts *options) error {
 		opts.clusterName = name
 		return nil
 	}
 }
+
+func (this *options) OfflineGracePeriod() time.Duration {
+	return this.offlineGracePeriod
+}
+
+func OfflineGracePeriod(period time.Duration) Option {
+	return func(opts *options) error {
+		if period < 0 {
+			return errors.New("offlineGracePeriod cannot be negative")
+		}
+		opts.offlineGracePeriod = period
+		return nil
+	}
+}
+
+func (this *options) DebugServerAddr() string {
+	return this.debugServerAddr
+}
+
+// EnableDebugServer serves the pprof handlers along with the RAFT status
+// and membership endpoints over HTTP at the given address. An empty
+// address disables the debug server.
+func EnableDebugServer(addr string) Option {
+	return func(opts *options) error {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			opts.debugServerAddr = ""
+			return nil
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("given debug server address, %s is invalid, error: %v", addr, err)
+		}
+		opts.debugServerAddr = addr
+		return nil
+	}
+}
+
+func (this *options) ExpvarNamespace() string {
+	return this.expvarNamespace
+}
+
+// PublishExpvar publishes the key RAFT metrics of this node, such as
+// its term, commit and applied indexes, via expvar under the given key.
+// As expvar keys are global to the process, the key must be unique
+// among the replicators running in it. Once a replicator is stopped,
+// its key reads as null and may be reused by another replicator. An
+// empty key disables this.
+func PublishExpvar(namespace string) Option {
+	return func(opts *options) error {
+		opts.expvarNamespace = strings.TrimSpace(namespace)
+		return nil
+	}
+}
+
+func (this *options) ServiceAddr() string {
+	return this.serviceAddr
+}
+
+// ServiceAddr sets the address of the gRPC service of this node, which
+// it advertises to the other members. Members only know each other by
+// their RAFT URLs otherwise, and clients need this address to connect
+// to members other than the ones they were given. An empty address is
+// not advertised.
+func ServiceAddr(addr string) Option {
+	return func(opts *options) error {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			opts.serviceAddr = ""
+			return nil
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("given service address, %s is invalid, error: %v", addr, err)
+		}
+		opts.serviceAddr = addr
+		return nil
+	}
+}
+
+func (this *options) MaxProposalSize() int {
+	return this.maxProposalSize
+}
+
+// MaxProposalSize limits the size in bytes of any single request
+// proposed to RAFT. A value of 0 implies no limit.
+func MaxProposalSize(size int) Option {
+	return func(opts *options) error {
+		if size < 0 {
+			return errors.New("maxProposalSize cannot be negative")
+		}
+		opts.maxProposalSize = size
+		return nil
+	}
+}
+
+func (this *options) DisableElection() bool {
+	return this.disableElection
+}
+
+// DisableElection turns this node into a non-campaigning voter. It keeps
+// replicating entries and voting for other candidates but never starts an
+// election itself, not even when asked to take over leadership. This is
+// meant for nodes that are about to be removed from the cluster.
+//
+// Note that such a node still counts towards the quorum size. Hence with
+// N nodes of which D have elections disabled, the cluster can elect a new
+// leader only if a majority is reachable and at least one of the reachable
+// nodes has elections enabled. Never disable elections on a majority.
+func DisableElection(disableElection bool) Option {
+	return func(opts *options) error {
+		opts.disableElection = disableElection
+		return nil
+	}
+}
+
+func (this *options) PreVote() bool {
+	return !this.noPreVote
+}
+
+// WithPreVote makes this node run a pre-vote before campaigning, which
+// is enabled by default. A node then bumps its term and starts an
+// election only if a majority would vote for it, so that a node that
+// was partitioned away does not disrupt a stable leader on rejoining.
+// Nodes with elections disabled always run a pre-vote.
+func WithPreVote(preVote bool) Option {
+	return func(opts *options) error {
+		opts.noPreVote = !preVote
+		return nil
+	}
+}
+
+func (this *options) HeartbeatTick() int {
+	if this.heartbeatTick == 0 {
+		return defaultHeartbeatTick
+	}
+	return this.heartbeatTick
+}
+
+// WithHeartbeatTick sets the number of ticks between the heartbeats
+// sent by the leader to its followers. Defaults to 1.
+func WithHeartbeatTick(ticks int) Option {
+	return func(opts *options) error {
+		if ticks <= 0 {
+			return errors.New("Heartbeat tick must strictly be greater than 0")
+		}
+		opts.heartbeatTick = ticks
+		return nil
+	}
+}
+
+func (this *options) ElectionTick() int {
+	if this.electionTick == 0 {
+		return defaultElectionTick
+	}
+	return this.electionTick
+}
+
+// WithElectionTick sets the number of ticks for which a follower waits
+// to hear from the leader before campaigning to be the leader, which
+// must be greater than the heartbeat tick. Defaults to 10. It is to be
+// raised for clusters whose members are far apart, such as across data
+// centers, to avoid spurious elections.
+func WithElectionTick(ticks int) Option {
+	return func(opts *options) error {
+		if ticks <= 0 {
+			return errors.New("Election tick must strictly be greater than 0")
+		}
+		opts.electionTick = ticks
+		return nil
+	}
+}
+
+func (this *options) TickInterval() time.Duration {
+	if this.tickInterval == 0 {
+		return defaultTickInterval
+	}
+	return this.tickInterval
+}
+
+// WithTickInterval sets the duration of a single RAFT tick, which along
+// with the heartbeat and election ticks determines the heartbeat interval
+// and the election timeout. Defaults to 100ms.
+func WithTickInterval(interval time.Duration) Option {
+	return func(opts *options) error {
+		if interval <= 0 {
+			return errors.New("Tick interval must strictly be greater than 0")
+		}
+		opts.tickInterval = interval
+		return nil
+	}
+}
+
+func (this *options) TermMismatchPolicy() TermMismatchPolicy {
+	return this.termMismatchPolicy
+}
+
+// OnTermMismatch sets the policy for resolving a divergence between the
+// last RAFT entry applied by the store and the RAFT log, such as the store
+// having applied an entry that was later overwritten by a new leader.
+// Defaults to HaltOnMismatch.
+func OnTermMismatch(policy TermMismatchPolicy) Option {
+	return func(opts *options) error {
+		if _, present := termMismatchPolicyNames[policy]; !present {
+			return fmt.Errorf("invalid term mismatch policy: %d", int(policy))
+		}
+		opts.termMismatchPolicy = policy
+		return nil
+	}
+}
+
+func termMismatchPolicyFromName(name string) Option {
+	return func(opts *options) error {
+		if policy, err := ParseTermMismatchPolicy(name); err != nil {
+			return err
+		} else {
+			opts.termMismatchPolicy = policy
+			return nil
+		}
+	}
+}
+
+func (this *options) LogOnly() bool {
+	return this.logOnly
+}
+
+// LogOnly turns Nexus into a plain replicated log. Committed requests
+// are no longer saved onto the store but only delivered to the ApplyFunc
+// registered via OnApply, if any. Save calls still wait for their
+// request to be committed, but receive no response data.
+func LogOnly(logOnly bool) Option {
+	return func(opts *options) error {
+		opts.logOnly = logOnly
+		return nil
+	}
+}
+
+func (this *options) PanicOnRestoreFailure() bool {
+	return this.panicOnRestoreFailure
+}
+
+// PanicOnRestoreFailure crashes the process when the store fails to
+// restore from a snapshot, as was the case earlier. By default, the
+// restore is instead retried with backoff, during which this node is
+// reported as not alive and refuses Loads.
+func PanicOnRestoreFailure(panicOnFailure bool) Option {
+	return func(opts *options) error {
+		opts.panicOnRestoreFailure = panicOnFailure
+		return nil
+	}
+}
+
+func (this *options) RejectLoadsWhileRestoring() bool {
+	return this.rejectRestoringLoads
+}
+
+// RejectLoadsWhileRestoring fails Loads with ErrRecovering while the
+// store is being restored from a snapshot, such as when a lagging
+// follower catches up, instead of serving them from a partially
+// restored store. This applies to stale reads as well.
+func RejectLoadsWhileRestoring(reject bool) Option {
+	return func(opts *options) error {
+		opts.rejectRestoringLoads = reject
+		return nil
+	}
+}
+
+func (this *options) VerifyLeaderOnRead() bool {
+	return this.verifyLeaderOnRead
+}
+
+// VerifyLeaderOnRead makes linearizable Loads confirm, just before
+// reading the store, that the leader and its term are the same as when
+// the read began. Otherwise the Load fails with ErrLeaderChanged. This
+// only detects a change of leader or term seen by this node by then,
+// it does not guard against one right after the check, nor against a
+// change this node is yet to learn of.
+func VerifyLeaderOnRead(verify bool) Option {
+	return func(opts *options) error {
+		opts.verifyLeaderOnRead = verify
+		return nil
+	}
+}
+
+func (this *options) PayloadCompression() (Compression, int) {
+	return this.compression, this.compressionThreshold
+}
+
+// CompressPayloads compresses the payloads of Saves of at least the
+// given size in bytes using the given codec, before proposing them to
+// RAFT. Payloads are decompressed before being applied onto the store,
+// hence stores are unaffected. Payloads that do not shrink on being
+// compressed are proposed as is. All the nodes must be running a
+// version that supports the codec.
+func CompressPayloads(compression Compression, threshold int) Option {
+	return func(opts *options) error {
+		if _, present := compressionNames[compression]; !present {
+			return fmt.Errorf("invalid compression: %d", int(compression))
+		}
+		if threshold < 0 {
+			return errors.New("compression threshold cannot be negative")
+		}
+		opts.compression = compression
+		opts.compressionThreshold = threshold
+		return nil
+	}
+}
+
+func compressionFromName(name string, threshold int) Option {
+	return func(opts *options) error {
+		if compression, err := ParseCompression(name); err != nil {
+			return err
+		} else {
+			return CompressPayloads(compression, threshold)(opts)
+		}
+	}
+}
+
+func (this *options) DeterminismCheckInterval() uint64 {
+	return this.determinismInterval
+}
+
+// VerifyDeterminism makes every node compute a digest of the results of
+// applying each window of the given number of entries onto the store,
+// and report it via RAFT. The leader compares the reported digests with
+// its own, and logs an error on a mismatch, which indicates a store
+// whose Save is not deterministic across replicas. Zero disables this.
+// Nodes of earlier versions apply the reported digests onto the store
+// as ordinary Saves, so it must only be enabled once all the nodes are
+// upgraded to a version supporting it.
+func VerifyDeterminism(interval uint64) Option {
+	return func(opts *options) error {
+		opts.determinismInterval = interval
+		return nil
+	}
+}
+
+func (this *options) OnApply() ApplyFunc {
+	return this.onApply
+}
+
+// OnApply registers a function to be invoked with every request
+// committed via RAFT, once it has been successfully applied onto the
+// store (or immediately on commit in LogOnly mode).
+func OnApply(fn ApplyFunc) Option {
+	return func(opts *options) error {
+		opts.onApply = fn
+		return nil
+	}
+}
+
+func (this *options) OnCommitClosed() CommitClosedFunc {
+	return this.onCommitClosed
+}
+
+// OnCommitClosed registers a function to be invoked when the RAFT
+// commit channel closes unexpectedly, such as on a transport failure.
+// By default, the process exits in such a case.
+func OnCommitClosed(fn CommitClosedFunc) Option {
+	return func(opts *options) error {
+		opts.onCommitClosed = fn
+		return nil
+	}
+}
+
+func (this *options) ApplyWorkers() int {
+	return this.applyWorkers
+}
+
+func (this *options) PartitionFunc() PartitionFunc {
+	return this.partitionFunc
+}
+
+// ParallelApply applies committed requests onto the store using the
+// given number of workers, with the partition of every request decided
+// by the given function. Requests within a partition are applied in the
+// order of commit, while requests across partitions are applied in
+// parallel. Hence the store must support concurrent saves. Linearizable
+// reads still observe all the requests committed before them.
+func ParallelApply(numWorkers int, partitionFn PartitionFunc) Option {
+	return func(opts *options) error {
+		if numWorkers < 1 {
+			return errors.New("number of apply workers must be at least 1")
+		}
+		if numWorkers > 1 && partitionFn == nil {
+			return errors.New("partition function must be given for applying in parallel")
+		}
+		opts.applyWorkers = numWorkers
+		opts.partitionFunc = partitionFn
+		return nil
+	}
+}
+
+func (this *options) ApplyWaitTimeout() time.Duration {
+	return this.applyWaitTimeout
+}
+
+// ApplyWaitTimeout bounds the time for which a linearizable read waits
+// on the store to apply all the entries preceding it, after its read
+// index is confirmed. It must be lower than the replication timeout to
+// be of any use. A value of 0 implies waiting until the replication
+// timeout.
+func ApplyWaitTimeout(timeout time.Duration) Option {
+	return func(opts *options) error {
+		if timeout < 0 {
+			return errors.New("applyWaitTimeout cannot be negative")
+		}
+		opts.applyWaitTimeout = timeout
+		return nil
+	}
+}
+
+func (this *options) ReachabilityTimeout() time.Duration {
+	return this.reachabilityTimeout
+}
+
+// ReachabilityTimeout bounds the time for which adding a member waits on
+// connecting to the RAFT service of the node, independent of the deadline
+// of the membership change as a whole, which also covers its commit. A
+// value of 0 implies waiting until the deadline of the membership change.
+func ReachabilityTimeout(timeout time.Duration) Option {
+	return func(opts *options) error {
+		if timeout < 0 {
+			return errors.New("reachabilityTimeout cannot be negative")
+		}
+		opts.reachabilityTimeout = timeout
+		return nil
+	}
+}
+
+func (this *options) MinSnapshotInterval() time.Duration {
+	return this.minSnapInterval
+}
+
+// MinSnapshotInterval sets the minimum duration between snapshots, so
+// that a low SnapshotCount under high write rates does not make the
+// node snapshot constantly. Snapshots forced by MaxInMemLogEntries are
+// not held back, as that cap guards the memory usage. A value of 0
+// implies no minimum.
+func MinSnapshotInterval(interval time.Duration) Option {
+	return func(opts *options) error {
+		if interval < 0 {
+			return errors.New("minSnapshotInterval cannot be negative")
+		}
+		opts.minSnapInterval = interval
+		return nil
+	}
+}
+
+func (this *options) MaxInMemLogEntries() uint64 {
+	return uint64(this.maxInMemLogEntries)
+}
+
+// MaxInMemLogEntries caps the number of RAFT log entries held in memory.
+// Entries are retained in memory until the next snapshot, which is taken
+// once SnapshotCount entries are applied. Under high write rates with
+// large entries, this cap forces an earlier snapshot so that memory usage
+// stays predictable. Only the entries already applied count towards the
+// cap, as the ones yet to be applied cannot be released by a snapshot.
+// Since SnapshotCatchUpEntries entries are retained after every snapshot
+// for slow followers to catch up, this cap must be well above it, else
+// snapshots get taken far too often. A value of 0 implies no cap.
+func MaxInMemLogEntries(count int64) Option {
+	return func(opts *options) error {
+		if count < 0 {
+			return errors.New("maxInMemLogEntries cannot be negative")
+		}
+		opts.maxInMemLogEntries = count
+		return nil
+	}
+}
+
+func (this *options) StopTimeout() time.Duration {
+	return this.stopTimeout
+}
+
+// StopTimeout bounds the time for which stopping the replicator waits
+// on the store to close. A value of 0 implies waiting indefinitely.
+func StopTimeout(timeout time.Duration) Option {
+	return func(opts *options) error {
+		if timeout < 0 {
+			return errors.New("stopTimeout cannot be negative")
+		}
+		opts.stopTimeout = timeout
+		return nil
+	}
+}
+
+func (this *options) ConfChangeTimeout() time.Duration {
+	if this.confChangeTimeout > 0 {
+		return this.confChangeTimeout
+	}
+	if this.replTimeout > defaultConfChangeTimeout {
+		return this.replTimeout
+	}
+	return defaultConfChangeTimeout
+}
+
+// ConfChangeTimeout bounds the time taken by membership changes, which
+// includes checking that new members are reachable and waiting on the
+// additions of other members, separately from the replication timeout
+// of Saves. A value of 0 implies the larger of 30 seconds and the
+// replication timeout.
+func ConfChangeTimeout(timeout time.Duration) Option {
+	return func(opts *options) error {
+		if timeout < 0 {
+			return errors.New("confChangeTimeout cannot be negative")
+		}
+		opts.confChangeTimeout = timeout
+		return nil
+	}
+}
+
+func (this *options) MaxUncommittedSize() int64 {
+	return this.maxUncommittedSize
+}
+
+// MaxUncommittedSize limits the total size in bytes of the proposals
+// made from this node that are yet to be applied. Beyond this limit,
+// new proposals are rejected with ErrProposalDropped instead of being
+// buffered, such as on a leader that cannot reach a quorum. A single
+// proposal is always admitted when none are pending. A value of 0
+// implies no limit.
+func MaxUncommittedSize(size int64) Option {
+	return func(opts *options) error {
+		if size < 0 {
+			return errors.New("maxUncommittedSize cannot be negative")
+		}
+		opts.maxUncommittedSize = size
+		return nil
+	}
+}
+
+func (this *options) RejectSavesDuringConfChange() bool {
+	return this.rejectConfChangeSaves
+}
+
+// RejectSavesDuringConfChange makes Saves fail with ErrConfChangeInProgress
+// while a membership change proposed from this node is yet to be applied,
+// for callers preferring to not write at all during such transitions.
+// Saves are otherwise safe during membership changes, since RAFT applies
+// one change at a time and commits every entry with a majority of the
+// configuration in effect.
+func RejectSavesDuringConfChange(reject bool) Option {
+	return func(opts *options) error {
+		opts.rejectConfChangeSaves = reject
+		return nil
+	}
+}
+
+func (this *options) MaxConcurrentMemberAdds() int {
+	if this.maxMemberAdds == 0 {
+		return 1
+	}
+	return this.maxMemberAdds
+}
+
+// MaxConcurrentMemberAdds limits the number of members that can be
+// added at once via this node. Additions beyond this limit are queued
+// until the members added earlier catch up with the leader, so that
+// the leader is not saturated sending snapshots to all of them at
+// once. Defaults to 1. Only the leader tracks how far the new members
+// have caught up, hence additions made via followers are forwarded to
+// the leader without being throttled. Operators relying on this limit
+// must add members via the leader.
+func MaxConcurrentMemberAdds(count int) Option {
+	return func(opts *options) error {
+		if count < 1 {
+			return errors.New("maxConcurrentMemberAdds must be positive")
+		}
+		opts.maxMemberAdds = count
+		return nil
+	}
+}
+
+func (this *options) ShadowMembers() bool {
+	return this.shadowMembers
+}
+
+// EnableShadowMembers allows adding shadow members via this node. The
+// conf change adding a shadow member marks it as such in its context,
+// which nodes predating shadow members take for the URL of the member
+// and fail on. Hence this must be enabled only once every member of the
+// cluster has been upgraded.
+func EnableShadowMembers(enable bool) Option {
+	return func(opts *options) error {
+		opts.shadowMembers = enable
+		return nil
+	}
+}
+
+func (this *options) MaxInflightProposals() int {
+	return this.maxInflightProposals
+}
+
+// MaxInflightProposals limits the number of Saves proposed from this
+// node and yet to be applied. Saves beyond this limit wait to be
+// admitted in the order of their Priority. A value of 0 implies no
+// limit, in which case priorities have no effect.
+func MaxInflightProposals(count int) Option {
+	return func(opts *options) error {
+		if count < 0 {
+			return errors.New("maxInflightProposals cannot be negative")
+		}
+		opts.maxInflightProposals = count
+		return nil
+	}
+}
+
+// inflightLimitFromFlags returns the option limiting the proposals in
+// flight, which rejects Saves beyond the limit if so flagged.
+func inflightLimitFromFlags(count int, reject bool) Option {
+	if reject {
+		return WithMaxInflightProposals(count)
+	}
+	return MaxInflightProposals(count)
+}
+
+func (this *options) RejectOverInflightLimit() bool {
+	return this.rejectOverInflight
+}
+
+// WithMaxInflightProposals is similar to MaxInflightProposals, except
+// that Saves beyond the limit fail right away with ErrTooManyRequests
+// instead of waiting to be admitted, so that clients can back off or
+// retry on another node. Priorities have no effect in this case.
+func WithMaxInflightProposals(count int) Option {
+	return func(opts *options) error {
+		if err := MaxInflightProposals(count)(opts); err != nil {
+			return err
+		}
+		opts.rejectOverInflight = true
+		return nil
+	}
+}
+
+func (this *options) LoadShedding() (int, time.Duration) {
+	return this.shedLoadTimeouts, this.shedLoadWindow
+}
+
+// ShedLoadOnTimeouts rejects Saves with ErrOverloaded for the given
+// window, once the given number of Saves time out within a window. The
+// rejections carry the time after which clients may retry. A value of 0
+// for maxTimeouts disables load shedding.
+func ShedLoadOnTimeouts(maxTimeouts int, window time.Duration) Option {
+	return func(opts *options) error {
+		if maxTimeouts < 0 {
+			return errors.New("maxTimeouts cannot be negative")
+		}
+		if maxTimeouts > 0 && window <= 0 {
+			return errors.New("window must be positive for shedding load")
+		}
+		opts.shedLoadTimeouts, opts.shedLoadWindow = maxTimeouts, window
+		return nil
+	}
+}
+
+func (this *options) Auditor() (AuditFunc, int) {
+	return this.auditFunc, this.auditQueueSize
+}
+
+// Auditor registers a function to be invoked with the audit record of
+// every write successfully applied onto the store, such as for shipping
+// them to an external audit log. Records are handed over via a queue of
+// the given size, which when full holds up applying further entries
+// rather than dropping records. Unlike OnApply, the function is not
+// invoked from the apply loop and may take longer to return.
+func Auditor(fn AuditFunc, queueSize int) Option {
+	return func(opts *options) error {
+		if fn == nil {
+			return errors.New("audit function must be given")
+		}
+		if queueSize <= 0 {
+			return errors.New("audit queue size must be positive")
+		}
+		opts.auditFunc, opts.auditQueueSize = fn, queueSize
+		return nil
+	}
+}
+
+func (this *options) Logger() Logger {
+	if this.logger == nil {
+		return StdLogger{}
+	}
+	return this.logger
+}
+
+// WithLogger sends the logs of the replicator to the given Logger,
+// instead of the standard library logger. Logs of the underlying etcd
+// RAFT library are not affected, since it only supports a global logger.
+func WithLogger(logger Logger) Option {
+	return func(opts *options) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		opts.logger = logger
+		return nil
+	}
+}
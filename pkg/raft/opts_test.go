@@ -1,6 +1,13 @@
 package raft
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flipkart-incubator/nexus/pkg/db"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 func TestListenAddr(t *testing.T) {
 	withoutError(t, NodeUrl("http://web.site:9090"))
@@ -22,6 +29,19 @@ func TestSnapDir(t *testing.T) {
 	withError(t, SnapDir("  "))
 }
 
+func TestDBSnapDir(t *testing.T) {
+	if opts, err := NewOptions(NodeUrl("http://site1:9090"), SnapDir("/folder/snap"), DBSnapDir(" ")); err != nil {
+		t.Fatal(err)
+	} else if opts.DBSnapDir() != opts.SnapDir() {
+		t.Errorf("Expected DB snapshot dir to default to %s, got: %s", opts.SnapDir(), opts.DBSnapDir())
+	}
+	if opts, err := NewOptions(NodeUrl("http://site1:9090"), DBSnapDir("/folder/db")); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(opts.DBSnapDir(), "/folder/db/") {
+		t.Errorf("Expected DB snapshot dir under /folder/db, got: %s", opts.DBSnapDir())
+	}
+}
+
 func TestClusterUrl(t *testing.T) {
 	withoutError(t, ClusterUrl("http://site1:9090,http://site2:9090,http://site3:9090"))
 	withError(t, ClusterUrl("http://site1:9090,site2:9090,http://site3:9090"))
@@ -52,6 +72,38 @@ func TestJoin(t *testing.T) {
 	}
 }
 
+func TestNodeId(t *testing.T) {
+	clusUrl := "1=http://site1:9090,2=http://site2:9090,http://site3:9090"
+	if opts, err := NewOptions(NodeUrl("http://site2:9090"), NodeId(2), ClusterUrl(clusUrl)); err != nil {
+		t.Errorf("Expected no error but got: %v", err)
+	} else {
+		if opts.NodeId() != 2 || opts.Join() {
+			t.Errorf("Expected node 2 to be a member, got ID: %d", opts.NodeId())
+		}
+		if peers := opts.ClusterUrls(); peers[1] != "http://site1:9090" || peers[2] != "http://site2:9090" || len(peers) != 3 {
+			t.Errorf("Expected explicit IDs of peers, got: %v", peers)
+		}
+	}
+	if opts, err := NewOptions(NodeUrl("4=http://site4:9090"), ClusterUrl(clusUrl)); err != nil {
+		t.Errorf("Expected no error but got: %v", err)
+	} else if opts.NodeId() != 4 || !opts.Join() {
+		t.Errorf("Expected node 4 to be joining, got ID: %d", opts.NodeId())
+	}
+	withError(t, NodeId(0))
+	withError(t, ClusterUrl("0=http://site1:9090"))
+	withError(t, ClusterUrl("x=http://site1:9090"))
+	for _, opts := range [][]Option{
+		{ClusterUrl("1=http://site1:9090,1=http://site2:9090")},
+		{NodeUrl("http://site2:9090"), NodeId(1), ClusterUrl(clusUrl)},
+		{NodeUrl("http://site2:9090"), NodeId(3), ClusterUrl(clusUrl)},
+		{NodeUrl("http://site3:9090"), NodeId(3), ClusterUrl(clusUrl)},
+	} {
+		if _, err := NewOptions(opts...); err == nil {
+			t.Errorf("Expected error for conflicting node IDs")
+		}
+	}
+}
+
 func TestDiscoverAddr(t *testing.T) {
 	if opts, err := NewOptions(ClusterUrl("http://127.0.0.1:9090,http://site2:9090,http://site3:9090"), NodeUrl("")); err != nil {
 		t.Errorf("Expected no error but got: %v", err)
@@ -81,6 +133,251 @@ func TestClusterId(t *testing.T){
 	}
 }
 
+func TestGroupId(t *testing.T) {
+	one, err := NewOptions(ClusterName("some-name"), GroupId(1), NodeUrl("http://127.0.0.1:9090"), LogDir("/tmp/logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := NewOptions(ClusterName("some-name"), GroupId(2), NodeUrl("http://127.0.0.1:9090"), LogDir("/tmp/logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.ClusterId() == two.ClusterId() {
+		t.Errorf("Expected distinct cluster IDs for distinct groups, got %d", one.ClusterId())
+	}
+	if one.LogDir() == two.LogDir() || !strings.HasSuffix(one.LogDir(), "/group_1") {
+		t.Errorf("Expected a log dir per group, got %s and %s", one.LogDir(), two.LogDir())
+	}
+}
+
+func TestOfflineGracePeriod(t *testing.T) {
+	withoutError(t, OfflineGracePeriod(0))
+	withoutError(t, OfflineGracePeriod(5*time.Second))
+	withError(t, OfflineGracePeriod(-time.Second))
+}
+
+func TestEnableDebugServer(t *testing.T) {
+	withoutError(t, EnableDebugServer(""))
+	withoutError(t, EnableDebugServer("127.0.0.1:6060"))
+	withoutError(t, EnableDebugServer(":6060"))
+	withError(t, EnableDebugServer("localhost"))
+}
+
+func TestServiceAddr(t *testing.T) {
+	withoutError(t, ServiceAddr(""))
+	withoutError(t, ServiceAddr("node1:9121"))
+	withError(t, ServiceAddr("node1"))
+}
+
+func TestMaxProposalSize(t *testing.T) {
+	withoutError(t, MaxProposalSize(0))
+	withoutError(t, MaxProposalSize(4<<20))
+	withError(t, MaxProposalSize(-1))
+}
+
+func TestDisableElection(t *testing.T) {
+	if opts, err := NewOptions(DisableElection(true)); err != nil {
+		t.Fatal(err)
+	} else if !opts.DisableElection() {
+		t.Error("Expected elections to be disabled")
+	}
+}
+
+func TestWithPreVote(t *testing.T) {
+	if opts, err := NewOptions(); err != nil {
+		t.Fatal(err)
+	} else if !opts.PreVote() {
+		t.Error("Expected pre-vote to be enabled by default")
+	}
+	if opts, err := NewOptions(WithPreVote(false)); err != nil {
+		t.Fatal(err)
+	} else if opts.PreVote() {
+		t.Error("Expected pre-vote to be disabled")
+	}
+}
+
+func TestTicks(t *testing.T) {
+	if opts, err := NewOptions(); err != nil {
+		t.Fatal(err)
+	} else if opts.HeartbeatTick() != 1 || opts.ElectionTick() != 10 || opts.TickInterval() != 100*time.Millisecond {
+		t.Errorf("Expected default ticks, got: %d, %d, %v", opts.HeartbeatTick(), opts.ElectionTick(), opts.TickInterval())
+	}
+	if opts, err := NewOptions(WithHeartbeatTick(3), WithElectionTick(30), WithTickInterval(time.Second)); err != nil {
+		t.Fatal(err)
+	} else if opts.HeartbeatTick() != 3 || opts.ElectionTick() != 30 || opts.TickInterval() != time.Second {
+		t.Errorf("Expected configured ticks, got: %d, %d, %v", opts.HeartbeatTick(), opts.ElectionTick(), opts.TickInterval())
+	}
+	withError(t, WithHeartbeatTick(0))
+	withError(t, WithElectionTick(1))
+	withError(t, WithTickInterval(-time.Second))
+	if _, err := NewOptions(WithHeartbeatTick(5), WithElectionTick(5)); err == nil {
+		t.Error("Expected error for election tick not greater than heartbeat tick")
+	}
+}
+
+func TestOnTermMismatch(t *testing.T) {
+	withoutError(t, OnTermMismatch(HaltOnMismatch))
+	withoutError(t, OnTermMismatch(TrustRaft))
+	withError(t, OnTermMismatch(TermMismatchPolicy(10)))
+	withoutError(t, termMismatchPolicyFromName("trust-raft"))
+	withError(t, termMismatchPolicyFromName("ignore"))
+}
+
+func TestLogOnly(t *testing.T) {
+	var applied []db.RaftEntry
+	onApply := func(entry db.RaftEntry, _ []byte) { applied = append(applied, entry) }
+	if opts, err := NewOptions(LogOnly(true), OnApply(onApply)); err != nil {
+		t.Fatal(err)
+	} else {
+		if !opts.LogOnly() {
+			t.Error("Expected log only mode to be enabled")
+		}
+		opts.OnApply()(db.RaftEntry{Term: 1, Index: 1}, nil)
+		if len(applied) != 1 {
+			t.Errorf("Expected apply function to be registered")
+		}
+	}
+}
+
+func TestParallelApply(t *testing.T) {
+	partitionFn := func(data []byte) uint64 { return uint64(len(data)) }
+	withoutError(t, ParallelApply(1, nil))
+	withoutError(t, ParallelApply(4, partitionFn))
+	withError(t, ParallelApply(0, partitionFn))
+	withError(t, ParallelApply(4, nil))
+}
+
+func TestApplyWaitTimeout(t *testing.T) {
+	withoutError(t, ApplyWaitTimeout(0))
+	withoutError(t, ApplyWaitTimeout(100*time.Millisecond))
+	withError(t, ApplyWaitTimeout(-time.Millisecond))
+}
+
+func TestMaxInMemLogEntries(t *testing.T) {
+	withoutError(t, MaxInMemLogEntries(0))
+	withoutError(t, MaxInMemLogEntries(50000))
+	withError(t, MaxInMemLogEntries(-1))
+}
+
+func TestReachabilityTimeout(t *testing.T) {
+	withoutError(t, ReachabilityTimeout(0))
+	withoutError(t, ReachabilityTimeout(2*time.Second))
+	withError(t, ReachabilityTimeout(-time.Second))
+}
+
+func TestMinSnapshotInterval(t *testing.T) {
+	withoutError(t, MinSnapshotInterval(0))
+	withoutError(t, MinSnapshotInterval(time.Minute))
+	withError(t, MinSnapshotInterval(-time.Second))
+}
+
+func TestStopTimeout(t *testing.T) {
+	withoutError(t, StopTimeout(0))
+	withoutError(t, StopTimeout(5*time.Second))
+	withError(t, StopTimeout(-time.Second))
+}
+
+func TestConfChangeTimeout(t *testing.T) {
+	withoutError(t, ConfChangeTimeout(0))
+	withoutError(t, ConfChangeTimeout(time.Minute))
+	withError(t, ConfChangeTimeout(-time.Second))
+
+	opts, _ := NewOptions(ReplicationTimeout(5 * time.Second))
+	if timeout := opts.ConfChangeTimeout(); timeout != defaultConfChangeTimeout {
+		t.Errorf("Expected default timeout: %s, Actual: %s", defaultConfChangeTimeout, timeout)
+	}
+	opts, _ = NewOptions(ReplicationTimeout(time.Minute))
+	if timeout := opts.ConfChangeTimeout(); timeout != time.Minute {
+		t.Errorf("Expected replication timeout: %s, Actual: %s", time.Minute, timeout)
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	withoutError(t, PrometheusMetrics(prometheus.NewRegistry()))
+	withError(t, PrometheusMetrics(nil))
+}
+
+func TestWithLogger(t *testing.T) {
+	withoutError(t, WithLogger(StdLogger{}))
+	withError(t, WithLogger(nil))
+
+	opts, _ := NewOptions()
+	if _, ok := opts.Logger().(StdLogger); !ok {
+		t.Errorf("Expected default logger: StdLogger, Actual: %T", opts.Logger())
+	}
+}
+
+func TestMaxUncommittedSize(t *testing.T) {
+	withoutError(t, MaxUncommittedSize(0))
+	withoutError(t, MaxUncommittedSize(64<<20))
+	withError(t, MaxUncommittedSize(-1))
+}
+
+func TestMaxConcurrentMemberAdds(t *testing.T) {
+	withoutError(t, MaxConcurrentMemberAdds(2))
+	withError(t, MaxConcurrentMemberAdds(0))
+	if opts, err := NewOptions(); err != nil {
+		t.Fatal(err)
+	} else if opts.MaxConcurrentMemberAdds() != 1 {
+		t.Errorf("Expected 1 concurrent member add by default, got: %d", opts.MaxConcurrentMemberAdds())
+	}
+}
+
+func TestMaxInflightProposals(t *testing.T) {
+	withoutError(t, MaxInflightProposals(0))
+	withoutError(t, MaxInflightProposals(64))
+	withError(t, MaxInflightProposals(-1))
+	withError(t, WithMaxInflightProposals(-1))
+	if opts, err := NewOptions(WithMaxInflightProposals(64)); err != nil || !opts.RejectOverInflightLimit() || opts.MaxInflightProposals() != 64 {
+		t.Errorf("Expected Saves beyond 64 proposals in flight to be rejected")
+	}
+}
+
+func TestShedLoadOnTimeouts(t *testing.T) {
+	withoutError(t, ShedLoadOnTimeouts(0, 0))
+	withoutError(t, ShedLoadOnTimeouts(10, time.Second))
+	withError(t, ShedLoadOnTimeouts(-1, time.Second))
+	withError(t, ShedLoadOnTimeouts(10, 0))
+}
+
+func TestCompressPayloads(t *testing.T) {
+	withoutError(t, CompressPayloads(NoCompression, 0))
+	withoutError(t, CompressPayloads(GzipCompression, 1024))
+	withError(t, CompressPayloads(Compression(42), 1024))
+	withError(t, CompressPayloads(GzipCompression, -1))
+}
+
+func TestAuditor(t *testing.T) {
+	auditFn := func(AuditRecord) {}
+	withoutError(t, Auditor(auditFn, 1024))
+	withError(t, Auditor(auditFn, 0))
+	withError(t, Auditor(nil, 1024))
+}
+
+func TestBootstrapFromConfig(t *testing.T) {
+	data := []byte(`{"clusterId": 1, "members": [{"url": "http://site1:9090"}, {"url": "http://site2:9090", "learner": true}]}`)
+	config, err := ParseClusterConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := NewOptions(ClusterUrl("http://site3:9090"), BootstrapFromConfig(config), NodeUrl("http://site1:9090"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusterUrls := opts.ClusterUrls(); len(clusterUrls) != 2 {
+		t.Errorf("Expected 2 peers from the config, got: %v", clusterUrls)
+	}
+	if opts.Join() {
+		t.Error("Expected join flag to be false")
+	}
+	config.Members[0].Id = 42
+	withError(t, BootstrapFromConfig(config))
+	withError(t, BootstrapFromConfig(&ClusterConfig{}))
+	if _, err := ParseClusterConfig([]byte(`{"members": []}`)); err == nil {
+		t.Error("Expected error for config without members")
+	}
+}
+
 func withError(t *testing.T, opt Option) {
 	if _, err := NewOptions(opt); err != nil {
 		t.Logf("As expected, received error: %v", err)
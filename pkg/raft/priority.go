@@ -0,0 +1,64 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Priority controls the order in which Saves waiting to be proposed
+// are admitted, when the number of proposals in flight is limited via
+// MaxInflightProposals. It only affects the local scheduling of Saves
+// before they are proposed. Once proposed, all the entries are ordered
+// by RAFT irrespective of their priority.
+type Priority int
+
+const (
+	// NormalPriority is the default priority of Saves.
+	NormalPriority Priority = iota
+	// HighPriority Saves are admitted before all the others waiting,
+	// suitable for latency critical writes.
+	HighPriority
+	// BulkPriority Saves are admitted only when no others are waiting.
+	BulkPriority
+)
+
+var priorityNames = map[Priority]string{
+	NormalPriority: "normal",
+	HighPriority:   "high",
+	BulkPriority:   "bulk",
+}
+
+func (p Priority) String() string {
+	if name, present := priorityNames[p]; present {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+func ParsePriority(name string) (Priority, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for p, pName := range priorityNames {
+		if pName == name {
+			return p, nil
+		}
+	}
+	return NormalPriority, fmt.Errorf("unknown priority: '%s'", name)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a child context carrying the given priority,
+// which the replicator honours while admitting a Save.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority carried by the given context,
+// defaulting to NormalPriority when none is present.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return NormalPriority
+}
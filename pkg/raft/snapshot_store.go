@@ -0,0 +1,101 @@
+package raft
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SnapshotStore is a backend holding copies of the RAFT snapshots of a
+// node, keyed by their RAFT index, such as for recovering the node when
+// its local disk is lost. Each snapshot is stored as a single blob, in
+// the same format as the snapshot files on the local disk, hence can be
+// kept in an object store like S3 or GCS under a key derived from the
+// index. Implementations must be safe for concurrent use.
+type SnapshotStore interface {
+	// Put stores the snapshot at the given index, replacing any
+	// existing one. The snapshot must be visible to Get only once
+	// it is stored entirely.
+	Put(index uint64, data io.Reader) error
+	// Get returns the snapshot at the given index, which is to be
+	// closed by the caller.
+	Get(index uint64) (io.ReadCloser, error)
+	// List returns the indexes of all the snapshots, in ascending order.
+	List() ([]uint64, error)
+	// Delete removes the snapshot at the given index, if present.
+	Delete(index uint64) error
+}
+
+const fileSnapshotSuffix = ".snap"
+
+type fileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore returns a SnapshotStore keeping the snapshots as
+// files in the given dir, such as one on a network mounted volume.
+func NewFileSnapshotStore(dir string) (SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &fileSnapshotStore{dir: dir}, nil
+}
+
+func (this *fileSnapshotStore) path(index uint64) string {
+	return filepath.Join(this.dir, fmt.Sprintf("%016x%s", index, fileSnapshotSuffix))
+}
+
+func (this *fileSnapshotStore) Put(index uint64, data io.Reader) error {
+	f, err := ioutil.TempFile(this.dir, "put-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, data); err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), this.path(index))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (this *fileSnapshotStore) Get(index uint64) (io.ReadCloser, error) {
+	return os.Open(this.path(index))
+}
+
+func (this *fileSnapshotStore) List() ([]uint64, error) {
+	names, err := ioutil.ReadDir(this.dir)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []uint64
+	for _, file := range names {
+		name := file.Name()
+		if !strings.HasSuffix(name, fileSnapshotSuffix) {
+			continue
+		}
+		if index, err := strconv.ParseUint(strings.TrimSuffix(name, fileSnapshotSuffix), 16, 64); err == nil {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes, nil
+}
+
+func (this *fileSnapshotStore) Delete(index uint64) error {
+	if err := os.Remove(this.path(index)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
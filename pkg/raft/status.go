@@ -0,0 +1,51 @@
+package raft
+
+// Status captures the state of the local replicator that is of
+// interest to operators, over and above the RAFT membership.
+type Status struct {
+	// Term is the current RAFT term as known to this node.
+	Term uint64
+	// CommitIndex is the RAFT index up to which entries are known
+	// to this node as committed.
+	CommitIndex uint64
+	// AppliedIndex is the RAFT index up to which committed entries
+	// have been applied onto the store of this node.
+	AppliedIndex uint64
+	// Leader is the ID of the RAFT leader as known to this node, or
+	// 0 if there is no leader currently.
+	Leader uint64
+	// LastSnapshotIndex is the RAFT index of the snapshot last
+	// loaded into the store, or 0 if none has been loaded.
+	LastSnapshotIndex uint64
+	// LastSnapshotTerm is the RAFT term of the snapshot last
+	// loaded into the store, or 0 if none has been loaded.
+	LastSnapshotTerm uint64
+	// Voters is the number of voting members of the cluster, as per
+	// the membership last applied on this node.
+	Voters int
+	// Quorum is the number of voters that must acknowledge an entry
+	// for it to be committed, i.e. Voters/2 + 1. The cluster tolerates
+	// the failure of Voters - Quorum voters.
+	Quorum int
+	// ProposalsMade is the number of Saves proposed from this node
+	// since it started. It only ever increases.
+	ProposalsMade uint64
+	// ProposalsCommitted is the number of Saves proposed from this
+	// node that got committed. It only ever increases.
+	ProposalsCommitted uint64
+	// ProposalsFailed is the number of Saves proposed from this node
+	// that failed to get committed in time, or to be proposed at all.
+	// It only ever increases. Proposals neither committed nor failed
+	// are in flight.
+	ProposalsFailed uint64
+	// Writable reports whether Saves can currently be committed, i.e.
+	// there is a leader that can reach a quorum of voters. Only the
+	// leader tracks the reachability of every voter, so followers
+	// report this as per their own connectivity to the leader.
+	Writable bool
+	// Readable reports whether at least one replica, as known to this
+	// node, has caught up with the commit index closely enough to serve
+	// Loads. Only the leader tracks the progress of every member, so
+	// followers only account for themselves.
+	Readable bool
+}
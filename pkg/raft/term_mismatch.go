@@ -0,0 +1,44 @@
+package raft
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TermMismatchPolicy decides how a node resolves a divergence between
+// the last RAFT entry applied by the store and the RAFT log, detected
+// while starting up.
+type TermMismatchPolicy int
+
+const (
+	// HaltOnMismatch stops the node from starting, leaving it to the
+	// operator to repair the store.
+	HaltOnMismatch TermMismatchPolicy = iota
+	// TrustRaft treats the RAFT log as the source of truth, restoring the
+	// store from the latest RAFT snapshot and re-applying all the entries
+	// following it. The node still halts if there is no snapshot to
+	// restore from, as the entries applied by the store cannot be undone.
+	TrustRaft
+)
+
+var termMismatchPolicyNames = map[TermMismatchPolicy]string{
+	HaltOnMismatch: "halt",
+	TrustRaft:      "trust-raft",
+}
+
+func (tmp TermMismatchPolicy) String() string {
+	if name, present := termMismatchPolicyNames[tmp]; present {
+		return name
+	}
+	return fmt.Sprintf("TermMismatchPolicy(%d)", int(tmp))
+}
+
+func ParseTermMismatchPolicy(name string) (TermMismatchPolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for tmp, tmpName := range termMismatchPolicyNames {
+		if tmpName == name {
+			return tmp, nil
+		}
+	}
+	return HaltOnMismatch, fmt.Errorf("unknown term mismatch policy: '%s'", name)
+}
@@ -0,0 +1,67 @@
+package raft
+
+import "context"
+
+// RequestTrace correlates a single Save across the logs of all the
+// nodes, right from its proposal till it gets applied.
+type RequestTrace struct {
+	// CorrelationId is supplied by the client and is included in
+	// all the log lines related to the request.
+	CorrelationId string
+	// IdempotencyKey is supplied by the client to identify retries of
+	// the same request, which are then applied only once.
+	IdempotencyKey string
+	// RequestId is the internal ID assigned to the request by the
+	// replicator, populated once the request is proposed.
+	RequestId uint64
+	// AppliedIndex is the RAFT index at which the request got applied,
+	// populated once the request is applied on this node.
+	AppliedIndex uint64
+}
+
+type requestTraceKey struct{}
+
+// WithRequestTrace returns a child context carrying the given trace,
+// which the replicator populates while serving a Save.
+func WithRequestTrace(ctx context.Context, trace *RequestTrace) context.Context {
+	return context.WithValue(ctx, requestTraceKey{}, trace)
+}
+
+// RequestTraceFrom returns the trace carried by the given context,
+// or nil if none is present.
+func RequestTraceFrom(ctx context.Context) *RequestTrace {
+	if trace, ok := ctx.Value(requestTraceKey{}).(*RequestTrace); ok {
+		return trace
+	}
+	return nil
+}
+
+// Freshness describes how up to date the data served by a Load is.
+// The difference between the indexes bounds the number of committed
+// entries not yet reflected in the data.
+type Freshness struct {
+	// CommittedIndex is the commit index of the leader. For
+	// linearizable reads, it is obtained from the leader itself, while
+	// for the others it is as last learnt from the leader's heartbeats.
+	CommittedIndex uint64
+	// AppliedIndex is the index up to which the node serving the
+	// Load had applied the entries onto its store.
+	AppliedIndex uint64
+}
+
+type freshnessKey struct{}
+
+// WithFreshness returns a child context carrying the given freshness,
+// which the replicator populates while serving a Load.
+func WithFreshness(ctx context.Context, freshness *Freshness) context.Context {
+	return context.WithValue(ctx, freshnessKey{}, freshness)
+}
+
+// FreshnessFrom returns the freshness carried by the given context,
+// or nil if none is present.
+func FreshnessFrom(ctx context.Context) *Freshness {
+	if freshness, ok := ctx.Value(freshnessKey{}).(*Freshness); ok {
+		return freshness
+	}
+	return nil
+}